@@ -0,0 +1,168 @@
+// Package model has the request and response models of the books api, the
+// rest server writes them and the client reads them
+package model
+
+// BookList response model, Next is the cursor for the following page
+type BookList struct {
+	Items []BookModel `json:"items"`
+	Next  string      `json:"next,omitempty"`
+}
+
+// BookModel is a response model for a book
+type BookModel struct {
+	ID        string `json:"id" openapi:"readOnly"`
+	ISBN      string `json:"isbn,omitempty"`
+	Title     string `json:"title"`
+	Author    string `json:"author"`
+	Publisher string `json:"publisher"`
+	PubDate   string `json:"pubdate" openapi:"format=date"`
+	Rating    int    `json:"rating" openapi:"enum=1|2|3"`
+	Status    string `json:"status" openapi:"enum=CheckedIn|CheckedOut|OnHold"`
+
+	// Copies is only part of responses, it is ignored when sent
+	Copies *AvailabilityModel `json:"copies,omitempty"`
+}
+
+// TrashList response model, most recently removed first
+type TrashList struct {
+	Items []TrashedBookModel `json:"items"`
+}
+
+// TrashedBookModel is a book in the trash and when it will be purged
+type TrashedBookModel struct {
+	BookModel
+	DeletedAt string `json:"deleted_at" openapi:"format=date-time"`
+	PurgeAt   string `json:"purge_at" openapi:"format=date-time"`
+}
+
+// ImportReport response model, the outcome of every row of an import
+type ImportReport struct {
+	DryRun     bool             `json:"dry_run"`
+	Created    int              `json:"created"`
+	Duplicates int              `json:"duplicates"`
+	Failed     int              `json:"failed"`
+	Rows       []ImportRowModel `json:"rows"`
+}
+
+// ImportRowModel is the outcome of importing a row, book_id is the id of the
+// created book and error is why the row was not created
+type ImportRowModel struct {
+	Row    int    `json:"row"`
+	Status string `json:"status" openapi:"enum=created|valid|duplicate|failed"`
+	BookID string `json:"book_id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// AvailabilityModel counts the copies of a book
+type AvailabilityModel struct {
+	Total     int    `json:"total"`
+	Available int    `json:"available"`
+	Summary   string `json:"summary"`
+}
+
+// SearchResults response model, items are ordered by relevance
+type SearchResults struct {
+	Items []SearchResultModel `json:"items"`
+}
+
+// SearchResultModel is a book along with its search relevance
+// highlights map field names to snippets with matches wrapped in <b></b>
+type SearchResultModel struct {
+	BookModel
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+// History response model, the timeline of a book oldest first
+type History struct {
+	Items []ChangeModel `json:"items"`
+}
+
+// ChangeModel is a response model for a single history entry
+type ChangeModel struct {
+	Field     string `json:"field"`
+	OldValue  string `json:"old_value"`
+	NewValue  string `json:"new_value"`
+	Actor     string `json:"actor"`
+	ChangedAt string `json:"changed_at" openapi:"format=date-time"`
+}
+
+// PatronModel is a request and response model for a patron
+type PatronModel struct {
+	ID    string `json:"id" openapi:"readOnly"`
+	Name  string `json:"name"`
+	Email string `json:"email" openapi:"format=email"`
+}
+
+// CheckOutRequest is the request model to check out a book
+type CheckOutRequest struct {
+	PatronID string `json:"patron_id"`
+	DueDate  string `json:"due_date" openapi:"format=date,optional"`
+}
+
+// LoanModel is a response model for a loan
+type LoanModel struct {
+	ID           string `json:"id"`
+	BookID       string `json:"book_id"`
+	CopyID       string `json:"copy_id,omitempty"`
+	PatronID     string `json:"patron_id"`
+	CheckedOutAt string `json:"checked_out_at" openapi:"format=date-time"`
+	DueDate      string `json:"due_date" openapi:"format=date"`
+	ReturnedAt   string `json:"returned_at,omitempty" openapi:"format=date-time"`
+	OverdueAt    string `json:"overdue_at,omitempty" openapi:"format=date-time"`
+}
+
+// OverdueLoanList response model, most late first
+type OverdueLoanList struct {
+	Items []OverdueLoanModel `json:"items"`
+}
+
+// OverdueLoanModel is a loan past its due date and who has the book
+type OverdueLoanModel struct {
+	LoanModel
+	Patron   PatronModel `json:"patron"`
+	DaysLate int         `json:"days_late"`
+}
+
+// PlaceHoldRequest is the request body used to put a patron in a hold queue
+type PlaceHoldRequest struct {
+	PatronID string `json:"patron_id"`
+}
+
+// HoldList response model, in queue order
+type HoldList struct {
+	Items []HoldModel `json:"items"`
+}
+
+// HoldModel response model
+type HoldModel struct {
+	ID        string `json:"id"`
+	BookID    string `json:"book_id"`
+	CopyID    string `json:"copy_id,omitempty"`
+	PatronID  string `json:"patron_id"`
+	Status    string `json:"status" openapi:"enum=Waiting|Ready|Fulfilled|Cancelled|Expired"`
+	PlacedAt  string `json:"placed_at" openapi:"format=date-time"`
+	ReadyAt   string `json:"ready_at,omitempty" openapi:"format=date-time"`
+	ExpiresAt string `json:"expires_at,omitempty" openapi:"format=date-time"`
+	ClosedAt  string `json:"closed_at,omitempty" openapi:"format=date-time"`
+}
+
+// CopyList response model, ordered by barcode
+type CopyList struct {
+	Items []CopyModel `json:"items"`
+}
+
+// CopyModel is the request and response model of a copy of a book
+type CopyModel struct {
+	ID        string `json:"id" openapi:"readOnly"`
+	BookID    string `json:"book_id" openapi:"readOnly"`
+	Barcode   string `json:"barcode"`
+	Status    string `json:"status" openapi:"readOnly"`
+	Condition string `json:"condition" openapi:"enum=New|Good|Fair|Poor|Damaged,optional"`
+}
+
+// CheckInRequest is the optional request body of a check in, the barcode
+// is only required when more than one copy of the book is checked out
+type CheckInRequest struct {
+	Barcode string `json:"barcode" openapi:"optional"`
+}
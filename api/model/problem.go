@@ -0,0 +1,57 @@
+package model
+
+// Problem codes, they identify a problem and will not change
+const (
+	CodeInvalidFields        = "invalid_fields"
+	CodeInvalidBody          = "invalid_body"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeNotAcceptable        = "not_acceptable"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeVersionConflict      = "version_conflict"
+	CodeIfMatchRequired      = "if_match_required"
+	CodeNotUnique            = "not_unique"
+	CodeISBNExists           = "isbn_exists"
+	CodeBarcodeExists        = "barcode_exists"
+	CodeCopyInUse            = "copy_in_use"
+	CodeLastCopy             = "last_copy"
+	CodeBookCheckedOut       = "book_checked_out"
+	CodeBookNotCheckedOut    = "book_not_checked_out"
+	CodeBookAvailable        = "book_available"
+	CodeBookOnHold           = "book_on_hold"
+	CodeHoldExists           = "hold_exists"
+	CodeHoldClosed           = "hold_closed"
+	CodeInternal             = "internal_error"
+)
+
+// FieldError codes
+const (
+	FieldRequired    = "required"
+	FieldInvalid     = "invalid"
+	FieldNotFound    = "not_found"
+	FieldNotEditable = "not_editable"
+)
+
+// Problem response model, the RFC 7807 problem details of an error
+// Code identifies the problem as Type does, Errors has a FieldError for each
+// field of the request which is invalid
+type Problem struct {
+	Type   string       `json:"type"`
+	Title  string       `json:"title"`
+	Status int          `json:"status"`
+	Detail string       `json:"detail,omitempty"`
+	Code   string       `json:"code"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError response model, why a field of the request is invalid
+type FieldError struct {
+	Field  string `json:"field"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// Error makes a FieldError an error handlers can return like any other
+func (e FieldError) Error() string {
+	return e.Detail
+}
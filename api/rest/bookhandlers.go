@@ -1,143 +1,506 @@
 package rest
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/tempcke/books/api/model"
 	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/entity/validation"
 	"github.com/tempcke/books/internal"
+	"github.com/tempcke/books/repository/repoerr"
 	"github.com/tempcke/books/usecase"
 )
 
 var dateFormat = "2006-01-02"
 
+var errPubDateFormat = model.FieldError{Field: "pubdate", Code: model.FieldInvalid, Detail: "pubdate must be in yyyy-mm-dd format"}
+
+// list page sizes
+const (
+	defaultListLimit   = 100
+	defaultSearchLimit = 20
+	maxListLimit       = 1000
+)
+
+var errLimitRange = model.FieldError{
+	Field:  "limit",
+	Code:   model.FieldInvalid,
+	Detail: "limit must be between 1 and " + strconv.Itoa(maxListLimit),
+}
+
 func addBook(bookRepo usecase.BookReaderWriter, log *internal.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		data := BookModel{}
+		data := model.BookModel{}
 		if err := decodeRequestData(w, r.Body, &data); err != nil {
 			log.Error(err)
 			return
 		}
 
-		pDate, err := time.Parse(dateFormat, data.PubDate)
+		b, err := newBook(data)
 		if err != nil {
-			errorResponse(w, http.StatusBadRequest, "pubdate must be in yyyy-mm-dd format")
-			log.Error(err)
+			errorResponse(w, err)
+			log.Debug(err)
 			return
 		}
 
-		b := book.NewBook(
-			data.Title,
-			data.Author,
-			pDate,
-			book.Rating(data.Rating),
-			book.Status(data.Status),
-		)
-
-		if err := usecase.AddBook(bookRepo, b); err != nil {
+		b, err = usecase.AddBook(r.Context(), bookRepo, b)
+		if err != nil {
 			log.Debug(err)
-			errorResponse(w, http.StatusBadRequest, "Missing or invalid fields")
+			errorResponse(w, err)
 			return
 		}
 
 		w.WriteHeader(http.StatusCreated)
-		jsonResponse(w, NewBookModel(b))
+		response(w, NewBookModel(b))
+	}
+}
+
+// newBook constructs a new book from the data sent to add it
+func newBook(data model.BookModel) (book.Book, error) {
+	pDate, err := time.Parse(dateFormat, data.PubDate)
+
+	b := book.NewBook(
+		data.Title,
+		data.Author,
+		data.Publisher,
+		pDate,
+		book.Rating(data.Rating),
+		book.Status(data.Status),
+	)
+	b.ISBN = data.ISBN
+	if err != nil {
+		return b, pubDateInvalid(b)
+	}
+	return b, nil
+}
+
+// pubDateInvalid is the error of a book sent with a pubdate which could not
+// be parsed, it has every other rule the book fails too
+func pubDateInvalid(b book.Book) error {
+	errs := validation.Errors{{Field: "PubDate", Rule: errPubDateFormat}}
+	var invalid validation.Errors
+	if errors.As(b.Validate(), &invalid) {
+		for _, e := range invalid {
+			if e.Rule != book.ErrPubDateIsRequired {
+				errs = append(errs, e)
+			}
+		}
 	}
+	return errs
 }
 
-func getBook(bookRepo usecase.BookReader, log *internal.Logger) http.HandlerFunc {
+func getBook(repo usecase.LibraryRepo, log *internal.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		bookID := chi.URLParam(r, "bookID")
-		b, err := usecase.GetBook(bookRepo, bookID)
+		b, err := usecase.GetBook(r.Context(), repo, bookID)
 		if err != nil {
-			errorResponse(w, http.StatusNotFound, "bookId not found")
+			problemResponse(w, problemNotFound, "bookId not found")
 			log.Debug("getBook handler, id not found: " + bookID)
 			return
 		}
-		jsonResponse(w, NewBookModel(b))
+		w.Header().Set("ETag", etag(b))
+		if notModified(w, r, b) {
+			return
+		}
+		m := NewBookModel(b)
+		addAvailability(r.Context(), repo, log, &m)
+		response(w, m)
+	}
+}
+
+func getBookByISBN(repo usecase.LibraryRepo, log *internal.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		isbn := chi.URLParam(r, "isbn")
+		b, err := usecase.GetBookByISBN(r.Context(), repo, isbn)
+		if err == book.ErrISBNInvalid {
+			errorResponse(w, err)
+			return
+		}
+		if err != nil {
+			problemResponse(w, problemNotFound, "isbn not found")
+			log.Debug("getBookByISBN handler, isbn not found: " + isbn)
+			return
+		}
+		w.Header().Set("ETag", etag(b))
+		if notModified(w, r, b) {
+			return
+		}
+		m := NewBookModel(b)
+		addAvailability(r.Context(), repo, log, &m)
+		response(w, m)
+	}
+}
+
+func listBooks(repo usecase.LibraryRepo, log *internal.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := bookQueryFromRequest(r)
+		if err == nil {
+			err = q.Validate()
+		}
+		if err != nil {
+			log.Debug(err)
+			errorResponse(w, err)
+			return
+		}
+
+		page, err := usecase.ListBooks(r.Context(), repo, q)
+		if err != nil {
+			log.Error(err)
+			problemResponse(w, problemInternal, "Error fetching list")
+			return
+		}
+
+		list := NewBookListModel(page.Books...)
+		list.Next = page.Next
+		models := make([]*model.BookModel, len(list.Items))
+		for i := range list.Items {
+			models[i] = &list.Items[i]
+		}
+		addAvailability(r.Context(), repo, log, models...)
+		response(w, list)
+	}
+}
+
+// addAvailability adds the copy counts to the book models, when they can not
+// be counted the books are still worth returning so the error is only logged
+func addAvailability(ctx context.Context, repo usecase.CopyReader, log *internal.Logger, models ...*model.BookModel) {
+	ids := make([]string, len(models))
+	for i, m := range models {
+		ids[i] = m.ID
+	}
+
+	counts, err := usecase.BookAvailability(ctx, repo, ids...)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, m := range models {
+		m.Copies = NewAvailabilityModel(counts[m.ID])
 	}
 }
 
-func listBooks(bookRepo usecase.BookReader, log *internal.Logger) http.HandlerFunc {
+// bookQueryFromRequest reads the filter, sort and pagination params
+// sort is a comma separated list of fields, prefix a field with - to reverse
+// eg: ?author=Martin%20Fowler&sort=-pubdate,title&limit=20
+func bookQueryFromRequest(r *http.Request) (usecase.BookQuery, error) {
+	params := r.URL.Query()
+	q := usecase.BookQuery{
+		Filter: usecase.BookFilter{
+			Author:        params.Get("author"),
+			Status:        book.Status(params.Get("status")),
+			TitleContains: params.Get("title"),
+		},
+		Limit: defaultListLimit,
+		After: params.Get("cursor"),
+	}
+
+	if v := params.Get("rating"); v != "" {
+		rating, err := strconv.Atoi(v)
+		if err != nil {
+			return q, model.FieldError{Field: "rating", Code: model.FieldInvalid, Detail: "rating must be an int"}
+		}
+		q.Filter.Rating = book.Rating(rating)
+	}
+
+	for param, date := range map[string]*time.Time{
+		"pubdate_from": &q.Filter.PubDateFrom,
+		"pubdate_to":   &q.Filter.PubDateTo,
+	} {
+		if v := params.Get(param); v != "" {
+			t, err := time.Parse(dateFormat, v)
+			if err != nil {
+				return q, model.FieldError{Field: param, Code: model.FieldInvalid, Detail: param + " must be in yyyy-mm-dd format"}
+			}
+			*date = t
+		}
+	}
+
+	if v := params.Get("sort"); v != "" {
+		for _, field := range strings.Split(v, ",") {
+			s := usecase.Sort{Field: usecase.SortField(field)}
+			if strings.HasPrefix(field, "-") {
+				s = usecase.Sort{Field: usecase.SortField(field[1:]), Desc: true}
+			}
+			q.Sort = append(q.Sort, s)
+		}
+	}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			return q, errLimitRange
+		}
+		q.Limit = limit
+	}
+
+	return q, nil
+}
+
+func searchBooks(repo usecase.LibraryRepo, log *internal.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		books, err := usecase.ListBooks(bookRepo)
+		query := r.URL.Query().Get("q")
+		if query == "" {
+			errorResponse(w, usecase.ErrSearchQueryRequired)
+			return
+		}
+
+		limit := defaultSearchLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxListLimit {
+				errorResponse(w, errLimitRange)
+				return
+			}
+			limit = n
+		}
+
+		results, err := usecase.SearchBooks(r.Context(), repo, query, limit)
 		if err != nil {
 			log.Error(err)
-			errorResponse(w, http.StatusInternalServerError, "Error fetching list")
+			problemResponse(w, problemInternal, "Error searching books")
 			return
 		}
-		jsonResponse(w, NewBookListModel(books...))
+		sr := NewSearchResultsModel(results...)
+		models := make([]*model.BookModel, len(sr.Items))
+		for i := range sr.Items {
+			models[i] = &sr.Items[i].BookModel
+		}
+		addAvailability(r.Context(), repo, log, models...)
+		response(w, sr)
 	}
 }
 
-func deleteBook(bookRepo usecase.BookReaderWriter, log *internal.Logger) http.HandlerFunc {
+func deleteBook(bookRepo usecase.LibraryRepo, log *internal.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		bookID := chi.URLParam(r, "bookID")
-		err := usecase.RemoveBook(bookRepo, bookID)
+		b, err := usecase.GetBook(r.Context(), bookRepo, bookID)
+		if err == repoerr.ErrRecordNotFound {
+			bookGone(w, r)
+			return
+		}
 		if err != nil {
-			// what should a RESTful DELETE endpoint do
-			// when the resource does not exist?
-			// for now I vote nothing, the client wants it gone
-			// and it isn't there ... so client should be happy
+			log.Error(err)
+			errorResponse(w, err)
+			return
+		}
+		version, err := ifMatch(r, b)
+		if err != nil {
+			errorResponse(w, err)
+			return
+		}
 
-			w.WriteHeader(http.StatusNoContent)
+		err = usecase.RemoveBook(r.Context(), bookRepo, bookID, version)
+		if err == repoerr.ErrRecordNotFound {
+			// removed since it was read
+			bookGone(w, r)
+			return
+		}
+		if err != nil {
+			log.Error(err)
+			errorResponse(w, err)
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
-func putBookStatus(bookRepo usecase.BookReaderWriter, log *internal.Logger) http.HandlerFunc {
+// bookGone answers the delete of a book which does not exist
+func bookGone(w http.ResponseWriter, r *http.Request) {
+	// what should a RESTful DELETE endpoint do
+	// when the resource does not exist?
+	// for now I vote nothing, the client wants it gone
+	// and it isn't there ... so client should be happy
+	// unless it only wanted a version of it gone (RFC 7232)
+	if r.Header.Get("If-Match") != "" {
+		errorResponse(w, usecase.ErrVersionConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listTrash(repo usecase.LibraryRepo, log *internal.Logger, retention time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		books, err := usecase.TrashedBooks(r.Context(), repo)
+		if err != nil {
+			log.Error(err)
+			problemResponse(w, problemInternal, "Error fetching the trash")
+			return
+		}
+		response(w, NewTrashListModel(retention, books...))
+	}
+}
+
+func restoreBook(repo usecase.LibraryRepo, log *internal.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		bookID := chi.URLParam(r, "bookID")
-		b, err := usecase.GetBook(bookRepo, bookID)
+		b, err := usecase.RestoreBook(r.Context(), repo, bookID)
 		if err != nil {
-			errorResponse(w, http.StatusNotFound, "bookId not found")
-			log.Debug("putBookStatus handler, id not found: " + bookID)
+			log.Debug(err)
+			errorResponse(w, err)
 			return
 		}
+		w.Header().Set("ETag", etag(b))
+		response(w, NewBookModel(b))
+	}
+}
 
-		status := chi.URLParam(r, "status")
+func putBook(bookRepo usecase.LibraryRepo, log *internal.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bookID := chi.URLParam(r, "bookID")
+		b, err := usecase.GetBook(r.Context(), bookRepo, bookID)
+		if err != nil {
+			problemResponse(w, problemNotFound, "bookId not found")
+			log.Debug("putBook handler, id not found: " + bookID)
+			return
+		}
+		version, err := ifMatch(r, b)
+		if err != nil {
+			errorResponse(w, err)
+			return
+		}
+
+		data := model.BookModel{}
+		if err := decodeRequestData(w, r.Body, &data); err != nil {
+			log.Error(err)
+			return
+		}
+
+		replaceBook(r.Context(), w, bookRepo, log, bookID, version, data, actor(r))
+	}
+}
 
-		b, err = usecase.ChangeBookStatus(bookRepo, bookID, book.Status(status))
+func patchBook(bookRepo usecase.LibraryRepo, log *internal.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bookID := chi.URLParam(r, "bookID")
+		b, err := usecase.GetBook(r.Context(), bookRepo, bookID)
+		if err != nil {
+			problemResponse(w, problemNotFound, "bookId not found")
+			log.Debug("patchBook handler, id not found: " + bookID)
+			return
+		}
+		version, err := ifMatch(r, b)
+		if err != nil {
+			errorResponse(w, err)
+			return
+		}
+
+		var patch interface{}
+		if err := decodeRequestData(w, r.Body, &patch); err != nil {
+			log.Error(err)
+			return
+		}
+
+		data, err := applyMergePatch(NewBookModel(b), patch)
 		if err != nil {
 			log.Debug(err)
-			errorResponse(w, http.StatusBadRequest, "Failed to update book, are you passing a valid status?")
+			problemResponse(w, problemInvalidBody, "Patch could not be applied to book")
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		jsonResponse(w, NewBookModel(b))
+		replaceBook(r.Context(), w, bookRepo, log, bookID, version, data, actor(r))
+	}
+}
+
+// replaceBook stores data as the new state of the book and writes the response
+// the book is only replaced while it is at version
+func replaceBook(
+	ctx context.Context,
+	w http.ResponseWriter,
+	bookRepo usecase.LibraryRepo,
+	log *internal.Logger,
+	bookID string,
+	version int,
+	data model.BookModel,
+	actor string,
+) {
+	pDate, pDateErr := time.Parse(dateFormat, data.PubDate)
+
+	b := book.Book{
+		ID:        bookID,
+		Version:   version,
+		ISBN:      data.ISBN,
+		Title:     data.Title,
+		Author:    data.Author,
+		Publisher: data.Publisher,
+		PubDate:   pDate,
+		Rating:    book.Rating(data.Rating),
+		Status:    book.Status(data.Status),
+	}
+	if pDateErr != nil {
+		log.Debug(pDateErr)
+		errorResponse(w, pubDateInvalid(b))
+		return
 	}
+
+	b, err := usecase.UpdateBook(ctx, bookRepo, b, actor)
+	if err != nil {
+		log.Debug(err)
+		errorResponse(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(b))
+	w.WriteHeader(http.StatusOK)
+	response(w, NewBookModel(b))
 }
 
-func putBookRating(bookRepo usecase.BookReaderWriter, log *internal.Logger) http.HandlerFunc {
+func putBookRating(bookRepo usecase.LibraryRepo, log *internal.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		bookID := chi.URLParam(r, "bookID")
-		b, err := usecase.GetBook(bookRepo, bookID)
+		b, err := usecase.GetBook(r.Context(), bookRepo, bookID)
+		if err != nil {
+			problemResponse(w, problemNotFound, "bookId not found")
+			log.Debug("putBookRating handler, id not found: " + bookID)
+			return
+		}
+		version, err := ifMatch(r, b)
 		if err != nil {
-			errorResponse(w, http.StatusNotFound, "bookId not found")
-			log.Debug("putBookStatus handler, id not found: " + bookID)
+			errorResponse(w, err)
 			return
 		}
 
 		rating := chi.URLParam(r, "rating")
 		value, err := strconv.Atoi(rating)
 		if err != nil {
-			log.Debug("putBookStatus handler, could not convert rating to int: " + rating)
-			errorResponse(w, http.StatusBadRequest, "Invalid rating, could not convert to int")
+			log.Debug("putBookRating handler, could not convert rating to int: " + rating)
+			fieldResponse(w, "rating", model.FieldInvalid, "rating must be an int")
+			return
 		}
 
-		b, err = usecase.ChangeBookRating(bookRepo, bookID, book.Rating(value))
+		b, err = usecase.ChangeBookRating(r.Context(), bookRepo, bookID, version, book.Rating(value), actor(r))
 		if err != nil {
 			log.Debug(err)
-			errorResponse(w, http.StatusBadRequest, "Failed to update book, are you passing a valid rating?")
+			errorResponse(w, err)
 			return
 		}
 
+		w.Header().Set("ETag", etag(b))
 		w.WriteHeader(http.StatusOK)
-		jsonResponse(w, NewBookModel(b))
+		response(w, NewBookModel(b))
+	}
+}
+
+func getBookHistory(bookRepo usecase.BookReader, log *internal.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bookID := chi.URLParam(r, "bookID")
+		if _, err := usecase.GetBook(r.Context(), bookRepo, bookID); err != nil {
+			problemResponse(w, problemNotFound, "bookId not found")
+			log.Debug("getBookHistory handler, id not found: " + bookID)
+			return
+		}
+
+		history, err := usecase.BookHistory(r.Context(), bookRepo, bookID)
+		if err != nil {
+			log.Error(err)
+			problemResponse(w, problemInternal, "Error fetching history")
+			return
+		}
+		response(w, NewHistoryModel(history...))
 	}
 }
@@ -0,0 +1,74 @@
+package rest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/tempcke/books/api/model"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/internal"
+	"github.com/tempcke/books/usecase"
+)
+
+func addCopy(repo usecase.LibraryRepo, log *internal.Logger, pickupWindow time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bookID := chi.URLParam(r, "bookID")
+		if _, err := usecase.GetBook(r.Context(), repo, bookID); err != nil {
+			problemResponse(w, problemNotFound, "bookId not found")
+			log.Debug("addCopy handler, id not found: " + bookID)
+			return
+		}
+
+		data := model.CopyModel{}
+		if err := decodeRequestData(w, r.Body, &data); err != nil {
+			log.Error(err)
+			return
+		}
+
+		condition := book.Condition(data.Condition)
+		if condition == "" {
+			condition = book.ConditionGood
+		}
+
+		c, err := usecase.AddCopy(r.Context(), repo, book.NewCopy(bookID, data.Barcode, condition), pickupWindow, actor(r))
+		if err != nil {
+			log.Debug(err)
+			errorResponse(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		response(w, NewCopyModel(c))
+	}
+}
+
+func listCopies(repo usecase.LibraryRepo, log *internal.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bookID := chi.URLParam(r, "bookID")
+		copies, err := usecase.BookCopies(r.Context(), repo, bookID)
+		if err != nil {
+			problemResponse(w, problemNotFound, "bookId not found")
+			log.Debug("listCopies handler, id not found: " + bookID)
+			return
+		}
+		response(w, NewCopyListModel(copies...))
+	}
+}
+
+func removeCopy(repo usecase.LibraryRepo, log *internal.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bookID := chi.URLParam(r, "bookID")
+		copyID := chi.URLParam(r, "copyID")
+
+		err := usecase.RemoveCopy(r.Context(), repo, bookID, copyID, actor(r))
+		if err != nil && err != usecase.ErrCopyNotFound {
+			log.Debug(err)
+			errorResponse(w, err)
+			return
+		}
+
+		// like deleting a book, a copy which does not exist is already gone
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,168 @@
+package rest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tempcke/books/api/model"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/internal"
+	"github.com/tempcke/books/usecase"
+)
+
+// bookEncoder writes the books of an export, Close ends the export
+type bookEncoder interface {
+	Encode(m model.BookModel) error
+	Close() error
+}
+
+// exportFormat is how an export is written
+type exportFormat struct {
+	contentType string
+	newEncoder  func(w io.Writer) bookEncoder
+}
+
+// exportFormats by the value of the format param
+var exportFormats = map[string]exportFormat{
+	"csv":    {"text/csv; charset=utf-8", newCSVEncoder},
+	"ndjson": {mediaTypeNDJSON, newNDJSONEncoder},
+	"json":   {"application/json", newJSONEncoder},
+}
+
+// exportBooks streams every book matching the filters of the list endpoint,
+// a failure part way through aborts the response so the client can tell the
+// export is incomplete
+func exportBooks(repo usecase.LibraryRepo, log *internal.Logger, clock func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("format")
+		if name == "" {
+			name = "json"
+		}
+		format, ok := exportFormats[name]
+		if !ok {
+			fieldResponse(w, "format", model.FieldInvalid, "format must be csv, ndjson or json")
+			return
+		}
+		if _, ok := preferred(r, format.contentType); !ok {
+			notAcceptable(w, format.contentType)
+			return
+		}
+
+		q, err := bookQueryFromRequest(r)
+		if err != nil {
+			errorResponse(w, err)
+			return
+		}
+
+		var enc bookEncoder
+		start := func() {
+			filename := "books-" + clock().Format(dateFormat) + "." + name
+			w.Header().Set("Content-Type", format.contentType)
+			w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+			enc = format.newEncoder(w)
+		}
+
+		err = usecase.ExportBooks(r.Context(), repo, q, func(b book.Book) error {
+			if enc == nil {
+				start()
+			}
+			return enc.Encode(NewBookModel(b))
+		})
+		if err != nil && enc == nil {
+			switch err {
+			case usecase.ErrSortFieldInvalid:
+				errorResponse(w, err)
+			default:
+				log.Error(err)
+				problemResponse(w, problemInternal, "Error exporting books")
+			}
+			return
+		}
+		if err != nil {
+			// the status was sent, ending the response as usual would pass
+			// the books written so far off as the whole export
+			log.Error("export cut short: " + err.Error())
+			panic(http.ErrAbortHandler)
+		}
+
+		if enc == nil {
+			start()
+		}
+		if err := enc.Close(); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// csvEncoder writes the columns of a csv import, and the book id first
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func newCSVEncoder(w io.Writer) bookEncoder {
+	enc := csvEncoder{csv.NewWriter(w)}
+	enc.w.Write(append([]string{"id"}, csvColumns...))
+	return enc
+}
+
+func (enc csvEncoder) Encode(m model.BookModel) error {
+	return enc.w.Write([]string{
+		m.ID, m.ISBN, m.Title, m.Author, m.Publisher, m.PubDate,
+		strconv.Itoa(m.Rating), m.Status,
+	})
+}
+
+func (enc csvEncoder) Close() error {
+	enc.w.Flush()
+	return enc.w.Error()
+}
+
+// ndjsonEncoder writes a book per line
+type ndjsonEncoder struct {
+	e *json.Encoder
+}
+
+func newNDJSONEncoder(w io.Writer) bookEncoder {
+	return ndjsonEncoder{json.NewEncoder(w)}
+}
+
+func (enc ndjsonEncoder) Encode(m model.BookModel) error {
+	return enc.e.Encode(m)
+}
+
+func (enc ndjsonEncoder) Close() error {
+	return nil
+}
+
+// jsonEncoder writes a BookList without a next cursor
+type jsonEncoder struct {
+	w     io.Writer
+	count *int
+}
+
+func newJSONEncoder(w io.Writer) bookEncoder {
+	io.WriteString(w, `{"items":[`)
+	return jsonEncoder{w, new(int)}
+}
+
+func (enc jsonEncoder) Encode(m model.BookModel) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if *enc.count > 0 {
+		data = append([]byte(","), data...)
+	}
+	*enc.count++
+	_, err = enc.w.Write(data)
+	return err
+}
+
+func (enc jsonEncoder) Close() error {
+	_, err := io.WriteString(enc.w, "]}\n")
+	return err
+}
@@ -1,31 +1,149 @@
 package rest
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tempcke/books/api/model"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/usecase"
 )
 
+// actorHeader names who is making a change, recorded in the book history
+const actorHeader = "X-Actor"
+
+func actor(r *http.Request) string {
+	if a := r.Header.Get(actorHeader); a != "" {
+		return a
+	}
+	return "anonymous"
+}
+
+// etag is the entity tag of a book, it changes with every version of the book
+func etag(b book.Book) string {
+	return `"` + strconv.Itoa(b.Version) + `"`
+}
+
+// etagMatch tells if a list of entity tags from an If-Match or If-None-Match
+// header has tag in it, weak tags are compared as strong ones
+func etagMatch(header, tag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// errIfMatchRequired is reported when a request changing a book has no
+// If-Match header
+var errIfMatchRequired = errors.New("If-Match header is required")
+
+// ifMatch checks the If-Match header of a request changing a book and returns
+// the version the change is conditional on.  The header is required so a
+// client can not overwrite a change it has not seen, * is version 0 which the
+// usecases take as any version, even one written after b was read.
+// It fails with errIfMatchRequired without the header and with
+// usecase.ErrVersionConflict when the header names another version
+func ifMatch(r *http.Request, b book.Book) (int, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, errIfMatchRequired
+	}
+	if header == "*" {
+		return 0, nil
+	}
+	if !etagMatch(header, etag(b)) {
+		return 0, usecase.ErrVersionConflict
+	}
+	return b.Version, nil
+}
+
+// notModified writes a 304 response when the If-None-Match header of the
+// request names the current version of the book, which the client already has
+func notModified(w http.ResponseWriter, r *http.Request, b book.Book) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !etagMatch(header, etag(b)) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
 func decodeRequestData(w http.ResponseWriter, body io.Reader, data interface{}) error {
 	err := json.NewDecoder(body).Decode(&data)
 	if err != nil {
-		errorResponse(w, http.StatusBadRequest, "Request body was not valid json")
+		problemResponse(w, problemInvalidBody, "Request body was not valid json")
 		return err
 	}
 	return nil
 }
 
-func jsonResponse(w http.ResponseWriter, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	err := json.NewEncoder(w).Encode(data)
+// applyMergePatch applies a JSON Merge Patch (RFC 7396) to a BookModel
+func applyMergePatch(data model.BookModel, patch interface{}) (model.BookModel, error) {
+	var target interface{}
+	raw, err := json.Marshal(data)
 	if err != nil {
-		log.Println("json.Encode response failed: " + err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		return data, err
+	}
+	if err := json.Unmarshal(raw, &target); err != nil {
+		return data, err
+	}
+
+	raw, err = json.Marshal(mergePatch(target, patch))
+	if err != nil {
+		return data, err
+	}
+
+	patched := model.BookModel{}
+	err = json.Unmarshal(raw, &patched)
+	return patched, err
+}
+
+// mergePatch merges patch into target following the RFC 7396 algorithm
+// null values remove a member, objects are merged and anything else replaces
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
 	}
+
+	return t
 }
 
-func errorResponse(w http.ResponseWriter, code int, msg string) {
-	w.WriteHeader(code)
-	jsonResponse(w, ErrorResponse{Error: msg})
+// response writes data in the media type negotiated for the request
+func response(w http.ResponseWriter, data interface{}) {
+	enc := encoderFor(w)
+	var buf bytes.Buffer
+	if err := enc.encode(&buf, data); err != nil {
+		log.Println("encoding the response failed: " + err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	mediaType := enc.mediaType
+	if _, ok := data.(model.Problem); ok {
+		mediaType = enc.problemMediaType
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Write(buf.Bytes())
 }
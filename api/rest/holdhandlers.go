@@ -0,0 +1,82 @@
+package rest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/tempcke/books/api/model"
+	"github.com/tempcke/books/internal"
+	"github.com/tempcke/books/usecase"
+)
+
+func placeHold(repo usecase.LibraryRepo, log *internal.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bookID := chi.URLParam(r, "bookID")
+		if _, err := usecase.GetBook(r.Context(), repo, bookID); err != nil {
+			problemResponse(w, problemNotFound, "bookId not found")
+			log.Debug("placeHold handler, id not found: " + bookID)
+			return
+		}
+
+		data := model.PlaceHoldRequest{}
+		if err := decodeRequestData(w, r.Body, &data); err != nil {
+			log.Error(err)
+			return
+		}
+
+		if _, err := usecase.GetPatron(r.Context(), repo, data.PatronID); err != nil {
+			fieldResponse(w, "patron_id", model.FieldNotFound, "patron_id not found")
+			log.Debug("placeHold handler, patron not found: " + data.PatronID)
+			return
+		}
+
+		h, err := usecase.PlaceHold(r.Context(), repo, bookID, data.PatronID)
+		if err != nil {
+			log.Debug(err)
+			errorResponse(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		response(w, NewHoldModel(h))
+	}
+}
+
+func listBookHolds(repo usecase.LibraryRepo, log *internal.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bookID := chi.URLParam(r, "bookID")
+		if _, err := usecase.GetBook(r.Context(), repo, bookID); err != nil {
+			problemResponse(w, problemNotFound, "bookId not found")
+			log.Debug("listBookHolds handler, id not found: " + bookID)
+			return
+		}
+
+		holds, err := usecase.BookHolds(r.Context(), repo, bookID)
+		if err != nil {
+			log.Error(err)
+			problemResponse(w, problemInternal, "Error fetching holds")
+			return
+		}
+		response(w, NewHoldListModel(holds...))
+	}
+}
+
+func cancelHold(repo usecase.LibraryRepo, log *internal.Logger, pickupWindow time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		holdID := chi.URLParam(r, "holdID")
+		if _, err := usecase.GetHold(r.Context(), repo, holdID); err != nil {
+			// like deleting a book, a hold which does not exist is already gone
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		_, err := usecase.CancelHold(r.Context(), repo, holdID, pickupWindow, actor(r))
+		if err != nil && err != usecase.ErrHoldIsClosed {
+			log.Error(err)
+			problemResponse(w, problemInternal, "Failed to cancel hold")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,165 @@
+package rest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tempcke/books/api/model"
+	"github.com/tempcke/books/internal"
+	"github.com/tempcke/books/usecase"
+)
+
+// maxImportSize is the largest import body accepted, in bytes
+const maxImportSize = 10 << 20
+
+// import media types
+const (
+	mediaTypeCSV    = "text/csv"
+	mediaTypeNDJSON = "application/x-ndjson"
+)
+
+// csvColumns are the columns of a csv import, only isbn is optional
+var csvColumns = []string{"isbn", "title", "author", "publisher", "pubdate", "rating", "status"}
+
+func importBooks(repo usecase.LibraryRepo, log *internal.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var opts usecase.ImportOptions
+		for param, flag := range map[string]*bool{
+			"dry_run":     &opts.DryRun,
+			"best_effort": &opts.BestEffort,
+		} {
+			if v := r.URL.Query().Get(param); v != "" {
+				b, err := strconv.ParseBool(v)
+				if err != nil {
+					fieldResponse(w, param, model.FieldInvalid, param+" must be true or false")
+					return
+				}
+				*flag = b
+			}
+		}
+
+		var readRows func(io.Reader) ([]usecase.ImportRow, error)
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case mediaTypeCSV:
+			readRows = csvImportRows
+		case mediaTypeNDJSON:
+			readRows = ndjsonImportRows
+		default:
+			problemResponse(w, problemUnsupportedMediaType,
+				"Content-Type must be "+mediaTypeCSV+" or "+mediaTypeNDJSON)
+			return
+		}
+
+		rows, err := readRows(http.MaxBytesReader(w, r.Body, maxImportSize))
+		if err != nil {
+			log.Debug(err)
+			problemResponse(w, problemInvalidBody, err.Error())
+			return
+		}
+
+		report, err := usecase.ImportBooks(r.Context(), repo, rows, opts)
+		if err != nil {
+			log.Error(err)
+			problemResponse(w, problemInternal, "Error importing books")
+			return
+		}
+		response(w, NewImportReportModel(opts.DryRun, report))
+	}
+}
+
+// csvImportRows reads a csv with a header row naming the columns, rows are
+// numbered as in a spreadsheet so the first row after the header is row 2
+func csvImportRows(body io.Reader) ([]usecase.ImportRow, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("csv header row is required")
+	}
+	if err != nil {
+		return nil, errors.New("csv is not valid: " + err.Error())
+	}
+	index := make(map[string]int)
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, col := range csvColumns[1:] {
+		if _, ok := index[col]; !ok {
+			return nil, errors.New("csv header is missing the " + col + " column")
+		}
+	}
+
+	var rows []usecase.ImportRow
+	for n := 2; ; n++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		row := usecase.ImportRow{Row: n}
+		if perr, ok := err.(*csv.ParseError); ok && perr.Err == csv.ErrFieldCount {
+			row.Err = errors.New("row does not have a value for every column")
+			rows = append(rows, row)
+			continue
+		}
+		if err != nil {
+			return nil, errors.New("csv is not valid: " + err.Error())
+		}
+
+		field := func(col string) string {
+			if i, ok := index[col]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		data := model.BookModel{
+			ISBN:      field("isbn"),
+			Title:     field("title"),
+			Author:    field("author"),
+			Publisher: field("publisher"),
+			PubDate:   field("pubdate"),
+			Status:    field("status"),
+		}
+		if data.Rating, err = strconv.Atoi(field("rating")); err != nil {
+			row.Err = errors.New("rating must be an int")
+		} else {
+			row.Book, row.Err = newBook(data)
+		}
+		rows = append(rows, row)
+	}
+}
+
+// ndjsonImportRows reads a book from every line, blank lines are skipped
+func ndjsonImportRows(body io.Reader) ([]usecase.ImportRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(nil, maxImportSize)
+
+	var rows []usecase.ImportRow
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		row := usecase.ImportRow{Row: n}
+		data := model.BookModel{}
+		if err := json.Unmarshal([]byte(line), &data); err != nil {
+			row.Err = errors.New("row is not a valid json book")
+		} else {
+			row.Book, row.Err = newBook(data)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New("ndjson is not valid: " + err.Error())
+	}
+	return rows, nil
+}
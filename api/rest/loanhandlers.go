@@ -0,0 +1,122 @@
+package rest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/tempcke/books/api/model"
+	"github.com/tempcke/books/internal"
+	"github.com/tempcke/books/usecase"
+)
+
+func checkOutBook(
+	repo usecase.LibraryRepo,
+	log *internal.Logger,
+	clock func() time.Time,
+	loanPeriod time.Duration,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bookID := chi.URLParam(r, "bookID")
+		if _, err := usecase.GetBook(r.Context(), repo, bookID); err != nil {
+			problemResponse(w, problemNotFound, "bookId not found")
+			log.Debug("checkOutBook handler, id not found: " + bookID)
+			return
+		}
+
+		data := model.CheckOutRequest{}
+		if err := decodeRequestData(w, r.Body, &data); err != nil {
+			log.Error(err)
+			return
+		}
+
+		if _, err := usecase.GetPatron(r.Context(), repo, data.PatronID); err != nil {
+			fieldResponse(w, "patron_id", model.FieldNotFound, "patron_id not found")
+			log.Debug("checkOutBook handler, patron not found: " + data.PatronID)
+			return
+		}
+
+		// the due date is optional, defaulting to the loan period from today
+		now := clock()
+		dueDate := now.Add(loanPeriod)
+		if data.DueDate != "" {
+			var err error
+			dueDate, err = time.Parse(dateFormat, data.DueDate)
+			if err != nil {
+				fieldResponse(w, "due_date", model.FieldInvalid, "due_date must be in yyyy-mm-dd format")
+				log.Debug(err)
+				return
+			}
+		}
+
+		l, err := usecase.CheckOut(r.Context(), repo, bookID, data.PatronID, now, dueDate, actor(r))
+		if err != nil {
+			log.Debug(err)
+			errorResponse(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		response(w, NewLoanModel(l))
+	}
+}
+
+func checkInBook(repo usecase.LibraryRepo, log *internal.Logger, clock func() time.Time, pickupWindow time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bookID := chi.URLParam(r, "bookID")
+		if _, err := usecase.GetBook(r.Context(), repo, bookID); err != nil {
+			problemResponse(w, problemNotFound, "bookId not found")
+			log.Debug("checkInBook handler, id not found: " + bookID)
+			return
+		}
+
+		// the body is optional, it is only needed to say which copy is returned
+		data := model.CheckInRequest{}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			log.Error(err)
+			problemResponse(w, problemInvalidBody, "Failed to read request body")
+			return
+		}
+		if len(bytes.TrimSpace(body)) > 0 {
+			if err := decodeRequestData(w, bytes.NewReader(body), &data); err != nil {
+				log.Debug(err)
+				return
+			}
+		}
+
+		var copyID string
+		if data.Barcode != "" {
+			c, err := repo.GetCopyByBarcode(r.Context(), data.Barcode)
+			if err != nil || c.BookID != bookID {
+				fieldResponse(w, "barcode", model.FieldNotFound, "barcode is not a copy of this book")
+				return
+			}
+			copyID = c.ID
+		}
+
+		l, err := usecase.CheckIn(r.Context(), repo, bookID, copyID, clock(), pickupWindow, actor(r))
+		if err != nil {
+			log.Debug(err)
+			errorResponse(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		response(w, NewLoanModel(l))
+	}
+}
+
+func listOverdueLoans(repo usecase.LibraryRepo, log *internal.Logger, clock func() time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		overdue, err := usecase.OverdueLoans(r.Context(), repo, clock())
+		if err != nil {
+			log.Error(err)
+			problemResponse(w, problemInternal, "Error fetching overdue loans")
+			return
+		}
+		response(w, NewOverdueLoanListModel(overdue...))
+	}
+}
@@ -1,23 +1,20 @@
 package rest
 
 import (
+	"time"
+
+	"github.com/tempcke/books/api/model"
 	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/entity/hold"
+	"github.com/tempcke/books/entity/loan"
+	"github.com/tempcke/books/entity/patron"
+	"github.com/tempcke/books/usecase"
 )
 
-// ErrorResponse response model
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
-
-// BookList response model
-type BookList struct {
-	Items []BookModel `json:"items"`
-}
-
 // NewBookListModel constructs a BookList model from a set of books
-func NewBookListModel(bookList ...book.Book) BookList {
-	pl := BookList{
-		Items: make([]BookModel, len(bookList)),
+func NewBookListModel(bookList ...book.Book) model.BookList {
+	pl := model.BookList{
+		Items: make([]model.BookModel, len(bookList)),
 	}
 	for i, p := range bookList {
 		pl.Items[i] = NewBookModel(p)
@@ -25,24 +22,193 @@ func NewBookListModel(bookList ...book.Book) BookList {
 	return pl
 }
 
-// BookModel is a response model for a book
-type BookModel struct {
-	ID      string `json:"id"`
-	Title   string `json:"title"`
-	Author  string `json:"author"`
-	PubDate string `json:"pubdate"`
-	Rating  int    `json:"rating"`
-	Status  string `json:"status"`
+// NewBookModel is the BookModel constructor
+func NewBookModel(book book.Book) model.BookModel {
+	return model.BookModel{
+		ID:        book.ID,
+		ISBN:      book.ISBN,
+		Title:     book.Title,
+		Author:    book.Author,
+		Publisher: book.Publisher,
+		PubDate:   book.PubDate.Format(dateFormat),
+		Rating:    int(book.Rating),
+		Status:    string(book.Status),
+	}
 }
 
-// NewBookModel is the BookModel constructor
-func NewBookModel(book book.Book) BookModel {
-	return BookModel{
-		ID:      book.ID,
-		Title:   book.Title,
-		Author:  book.Author,
-		PubDate: book.PubDate.Format(dateFormat),
-		Rating:  int(book.Rating),
-		Status:  string(book.Status),
+// NewTrashListModel constructs a TrashList model, books are purged once they
+// were in the trash for the retention period
+func NewTrashListModel(retention time.Duration, books ...book.Book) model.TrashList {
+	tl := model.TrashList{
+		Items: make([]model.TrashedBookModel, len(books)),
+	}
+	for i, b := range books {
+		tl.Items[i] = model.TrashedBookModel{
+			BookModel: NewBookModel(b),
+			DeletedAt: b.DeletedAt.Format(time.RFC3339),
+			PurgeAt:   b.DeletedAt.Add(retention).Format(time.RFC3339),
+		}
+	}
+	return tl
+}
+
+// NewImportReportModel constructs an ImportReport model
+func NewImportReportModel(dryRun bool, report usecase.ImportReport) model.ImportReport {
+	m := model.ImportReport{
+		DryRun:     dryRun,
+		Created:    report.Count(usecase.ImportCreated),
+		Duplicates: report.Count(usecase.ImportDuplicate),
+		Failed:     report.Count(usecase.ImportFailed),
+		Rows:       make([]model.ImportRowModel, len(report.Results)),
+	}
+	for i, res := range report.Results {
+		m.Rows[i] = model.ImportRowModel{
+			Row:    res.Row,
+			Status: res.Status.String(),
+		}
+		if res.Status == usecase.ImportCreated {
+			m.Rows[i].BookID = res.BookID
+		}
+		if res.Err != nil {
+			m.Rows[i].Error = res.Err.Error()
+		}
+	}
+	return m
+}
+
+// NewAvailabilityModel is the AvailabilityModel constructor
+func NewAvailabilityModel(a book.Availability) *model.AvailabilityModel {
+	return &model.AvailabilityModel{
+		Total:     a.Total,
+		Available: a.Available,
+		Summary:   a.String(),
+	}
+}
+
+// NewSearchResultsModel constructs a SearchResults model
+func NewSearchResultsModel(results ...usecase.SearchResult) model.SearchResults {
+	sr := model.SearchResults{
+		Items: make([]model.SearchResultModel, len(results)),
+	}
+	for i, res := range results {
+		sr.Items[i] = model.SearchResultModel{
+			BookModel:  NewBookModel(res.Book),
+			Score:      res.Score,
+			Highlights: res.Highlights,
+		}
+	}
+	return sr
+}
+
+// NewHistoryModel constructs a History model from a set of changes
+func NewHistoryModel(changes ...book.Change) model.History {
+	h := model.History{
+		Items: make([]model.ChangeModel, len(changes)),
+	}
+	for i, c := range changes {
+		h.Items[i] = model.ChangeModel{
+			Field:     c.Field.String(),
+			OldValue:  c.OldValue,
+			NewValue:  c.NewValue,
+			Actor:     c.Actor,
+			ChangedAt: c.ChangedAt.Format(time.RFC3339),
+		}
+	}
+	return h
+}
+
+// NewPatronModel is the PatronModel constructor
+func NewPatronModel(p patron.Patron) model.PatronModel {
+	return model.PatronModel{
+		ID:    p.ID,
+		Name:  p.Name,
+		Email: p.Email,
+	}
+}
+
+// NewLoanModel is the LoanModel constructor
+func NewLoanModel(l loan.Loan) model.LoanModel {
+	m := model.LoanModel{
+		ID:           l.ID,
+		BookID:       l.BookID,
+		CopyID:       l.CopyID,
+		PatronID:     l.PatronID,
+		CheckedOutAt: l.CheckedOutAt.Format(time.RFC3339),
+		DueDate:      l.DueDate.Format(dateFormat),
+	}
+	if l.IsReturned() {
+		m.ReturnedAt = l.ReturnedAt.Format(time.RFC3339)
+	}
+	if !l.OverdueAt.IsZero() {
+		m.OverdueAt = l.OverdueAt.Format(time.RFC3339)
+	}
+	return m
+}
+
+// NewOverdueLoanListModel constructs an OverdueLoanList model
+func NewOverdueLoanListModel(overdue ...usecase.OverdueLoan) model.OverdueLoanList {
+	ol := model.OverdueLoanList{
+		Items: make([]model.OverdueLoanModel, len(overdue)),
+	}
+	for i, o := range overdue {
+		ol.Items[i] = model.OverdueLoanModel{
+			LoanModel: NewLoanModel(o.Loan),
+			Patron:    NewPatronModel(o.Patron),
+			DaysLate:  o.DaysLate,
+		}
+	}
+	return ol
+}
+
+// NewHoldListModel constructs a HoldList model
+func NewHoldListModel(holds ...hold.Hold) model.HoldList {
+	hl := model.HoldList{
+		Items: make([]model.HoldModel, len(holds)),
+	}
+	for i, h := range holds {
+		hl.Items[i] = NewHoldModel(h)
+	}
+	return hl
+}
+
+// NewHoldModel is the HoldModel constructor
+func NewHoldModel(h hold.Hold) model.HoldModel {
+	m := model.HoldModel{
+		ID:       h.ID,
+		BookID:   h.BookID,
+		CopyID:   h.CopyID,
+		PatronID: h.PatronID,
+		Status:   h.Status.String(),
+		PlacedAt: h.PlacedAt.Format(time.RFC3339),
+	}
+	if !h.ReadyAt.IsZero() {
+		m.ReadyAt = h.ReadyAt.Format(time.RFC3339)
+		m.ExpiresAt = h.ExpiresAt.Format(time.RFC3339)
+	}
+	if !h.ClosedAt.IsZero() {
+		m.ClosedAt = h.ClosedAt.Format(time.RFC3339)
+	}
+	return m
+}
+
+// NewCopyListModel constructs a CopyList model
+func NewCopyListModel(copies ...book.Copy) model.CopyList {
+	cl := model.CopyList{
+		Items: make([]model.CopyModel, len(copies)),
+	}
+	for i, c := range copies {
+		cl.Items[i] = NewCopyModel(c)
+	}
+	return cl
+}
+
+// NewCopyModel is the CopyModel constructor
+func NewCopyModel(c book.Copy) model.CopyModel {
+	return model.CopyModel{
+		ID:        c.ID,
+		BookID:    c.BookID,
+		Barcode:   c.Barcode,
+		Status:    c.Status.String(),
+		Condition: c.Condition.String(),
 	}
 }
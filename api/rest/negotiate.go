@@ -0,0 +1,408 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/tempcke/books/api/model"
+)
+
+// encoder writes a response model in a media type, a Problem is written as
+// problemMediaType
+type encoder struct {
+	mediaType        string
+	problemMediaType string
+	encode           func(w io.Writer, v interface{}) error
+}
+
+// encoders is the registry of response media types, the first one is used
+// when the client accepts any type
+var encoders = []encoder{
+	{"application/json", "application/problem+json", encodeJSON},
+	{"application/xml", "application/problem+xml", encodeXML},
+	{"text/csv", "text/csv", encodeCSV},
+}
+
+// problemNamespace is the xml namespace of RFC 7807 problem details
+const problemNamespace = "urn:ietf:rfc:7807"
+
+// negotiate picks the encoder of every response by the Accept header of the
+// request, a request which accepts none of them gets 406 Not Acceptable
+func negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc, ok := acceptable(r.Header.Get("Accept"))
+		nw := &negotiatedWriter{ResponseWriter: w, enc: enc}
+		defer nw.writeHeader()
+
+		if !ok {
+			types := make([]string, len(encoders))
+			for i, e := range encoders {
+				types[i] = e.mediaType
+			}
+			notAcceptable(nw, types...)
+			return
+		}
+		next.ServeHTTP(nw, r)
+	})
+}
+
+// fixedMediaType is negotiate for the routes with a fixed media type, they
+// check the Accept header themselves, see preferred, and problems are json
+func fixedMediaType(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nw := &negotiatedWriter{ResponseWriter: w, enc: encoders[0]}
+		defer nw.writeHeader()
+		next.ServeHTTP(nw, r)
+	})
+}
+
+// notAcceptable answers a request which accepts none of the media types
+func notAcceptable(w http.ResponseWriter, types ...string) {
+	problemResponse(w, problemNotAcceptable, "Accept must allow one of "+strings.Join(types, ", "))
+}
+
+// acceptable finds the encoder of the media type the client prefers, the
+// default encoder when the header is empty
+func acceptable(header string) (encoder, bool) {
+	if strings.TrimSpace(header) == "" {
+		return encoders[0], true
+	}
+	for _, a := range acceptedRanges(header) {
+		for _, e := range encoders {
+			if mediaTypeMatch(a.mediaType, e.mediaType) || a.mediaType == e.problemMediaType {
+				return e, true
+			}
+		}
+	}
+	return encoders[0], false
+}
+
+// preferred picks the media type the client prefers out of the fixed media
+// types of a route which is not negotiated, such as an export in the format
+// it asked for, the first one when the header is empty
+func preferred(r *http.Request, types ...string) (string, bool) {
+	header := r.Header.Get("Accept")
+	if strings.TrimSpace(header) == "" {
+		return types[0], true
+	}
+	for _, a := range acceptedRanges(header) {
+		for _, t := range types {
+			mediaType, _, _ := mime.ParseMediaType(t)
+			if mediaTypeMatch(a.mediaType, mediaType) {
+				return t, true
+			}
+		}
+	}
+	return "", false
+}
+
+// accepted is a media range of an Accept header
+type accepted struct {
+	mediaType string
+	q         float64
+}
+
+// acceptedRanges lists the media ranges of an Accept header which the client
+// accepts, the ones it prefers first
+func acceptedRanges(header string) []accepted {
+	var list []accepted
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			list = append(list, accepted{mediaType, q})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].q > list[j].q
+	})
+	return list
+}
+
+// mediaTypeMatch tells if a media type, which may be a range such as text/*,
+// includes the media type of an encoder
+func mediaTypeMatch(accepted, mediaType string) bool {
+	if accepted == "*/*" || accepted == mediaType {
+		return true
+	}
+	if strings.HasSuffix(accepted, "/*") {
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(accepted, "*"))
+	}
+	return false
+}
+
+// negotiatedWriter holds on to the status of a response until the response
+// is written, so response can still set the Content-Type after a handler has
+// called WriteHeader
+type negotiatedWriter struct {
+	http.ResponseWriter
+	enc         encoder
+	status      int
+	wroteHeader bool
+}
+
+// WriteHeader keeps the status until the header is written
+func (w *negotiatedWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+	}
+}
+
+// Write writes the header first
+func (w *negotiatedWriter) Write(data []byte) (int, error) {
+	w.writeHeader()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *negotiatedWriter) writeHeader() {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// encoderFor returns the encoder negotiated for a response
+func encoderFor(w http.ResponseWriter) encoder {
+	if nw, ok := w.(*negotiatedWriter); ok {
+		return nw.enc
+	}
+	return encoders[0]
+}
+
+func encodeJSON(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// encodeXML writes a model as xml with the element names of its json keys,
+// the root element is named after the model, eg: book_list for a BookList
+func encodeXML(w io.Writer, v interface{}) error {
+	name := modelName(reflect.TypeOf(v))
+	var attrs []xml.Attr
+	if _, ok := v.(model.Problem); ok {
+		attrs = append(attrs, xml.Attr{Name: xml.Name{Local: "xmlns"}, Value: problemNamespace})
+	}
+	enc := xml.NewEncoder(w)
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	if err := xmlElement(enc, name, reflect.ValueOf(v), attrs...); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+func xmlElement(enc *xml.Encoder, name string, v reflect.Value, attrs ...xml.Attr) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}, Attr: attrs}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		for _, f := range modelFields(v.Type()) {
+			fv := v.FieldByIndex(f.index)
+			if f.omitEmpty && fv.IsZero() {
+				continue
+			}
+			if err := xmlElement(enc, f.name, fv); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := xmlElement(enc, "item", v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+		for _, k := range keys {
+			entry := xml.StartElement{
+				Name: xml.Name{Local: "entry"},
+				Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: fmt.Sprint(k)}},
+			}
+			if err := enc.EncodeElement(fmt.Sprint(v.MapIndex(k)), entry); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(v))); err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// encodeCSV writes the items of a list model, or any other model, as rows
+// with a column for each json key.  Nested models are flattened into columns
+// such as copies.total and a list or map within a row is a json cell
+func encodeCSV(w io.Writer, v interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("can not encode %T as csv", v)
+	}
+	rows := []reflect.Value{rv}
+	if items := rv.FieldByName("Items"); items.IsValid() && items.Kind() == reflect.Slice {
+		rows = make([]reflect.Value, items.Len())
+		for i := range rows {
+			rows[i] = items.Index(i)
+		}
+		rv = reflect.New(items.Type().Elem()).Elem()
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader(rv.Type(), "")); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := cw.Write(csvRecord(row.Type(), row)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvHeader(t reflect.Type, prefix string) []string {
+	var header []string
+	for _, f := range modelFields(t) {
+		if ft := indirectType(f.typ); ft.Kind() == reflect.Struct {
+			header = append(header, csvHeader(ft, prefix+f.name+".")...)
+			continue
+		}
+		header = append(header, prefix+f.name)
+	}
+	return header
+}
+
+// csvRecord has a cell for every column of csvHeader(t), a nil v is empty
+func csvRecord(t reflect.Type, v reflect.Value) []string {
+	var record []string
+	for _, f := range modelFields(t) {
+		var fv reflect.Value
+		if v.IsValid() {
+			fv = v.FieldByIndex(f.index)
+			if fv.Kind() == reflect.Ptr && fv.IsNil() {
+				fv = reflect.Value{}
+			}
+		}
+		if ft := indirectType(f.typ); ft.Kind() == reflect.Struct {
+			record = append(record, csvRecord(ft, reflect.Indirect(fv))...)
+			continue
+		}
+		record = append(record, csvCell(fv))
+	}
+	return record
+}
+
+func csvCell(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		data, _ := json.Marshal(v.Interface())
+		return string(data)
+	}
+	return fmt.Sprint(reflect.Indirect(v))
+}
+
+// modelField is a field of a response model by its json key
+type modelField struct {
+	name      string
+	index     []int
+	typ       reflect.Type
+	tag       reflect.StructTag
+	omitEmpty bool
+}
+
+// modelFields lists the fields of a model as encoding/json sees them,
+// the fields of embedded models are inlined
+func modelFields(t reflect.Type) []modelField {
+	var fields []modelField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if sf.PkgPath != "" || tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		if sf.Anonymous && parts[0] == "" && sf.Type.Kind() == reflect.Struct {
+			for _, f := range modelFields(sf.Type) {
+				f.index = append([]int{i}, f.index...)
+				fields = append(fields, f)
+			}
+			continue
+		}
+
+		f := modelField{name: parts[0], index: []int{i}, typ: sf.Type, tag: sf.Tag}
+		if f.name == "" {
+			f.name = sf.Name
+		}
+		for _, opt := range parts[1:] {
+			f.omitEmpty = f.omitEmpty || opt == "omitempty"
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// modelName is the snake case name of a model type without the Model suffix
+func modelName(t reflect.Type) string {
+	name := strings.TrimSuffix(indirectType(t).Name(), "Model")
+	var b bytes.Buffer
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return "response"
+	}
+	return b.String()
+}
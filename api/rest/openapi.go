@@ -0,0 +1,480 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tempcke/books/api/model"
+)
+
+// openAPIVersion is the version of the api which the document describes
+const openAPIVersion = "1.0.0"
+
+// mediaTypeOpenAPI is the media type of an OpenAPI document in json
+const mediaTypeOpenAPI = "application/vnd.oai.openapi+json"
+
+// operation describes a route of the api for the OpenAPI document
+type operation struct {
+	method  string
+	path    string
+	id      string
+	summary string
+	params  []parameter
+
+	// body is the model sent to the route, nil when it takes no body
+	// bodyTypes are the media types of a body which is not json
+	body      interface{}
+	bodyTypes []string
+
+	// status is the status of success, result the model it responds with
+	// which is nil when it responds without a body.  resultTypes are the
+	// media types of a result which may be more than json
+	status      int
+	result      interface{}
+	resultTypes []string
+	etag        bool
+
+	// also are other statuses without a body, problems are the statuses of
+	// the problems the route reports
+	also     map[int]string
+	problems []int
+}
+
+// parameter of an operation
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *schema `json:"schema"`
+}
+
+func pathParam(name, description string) parameter {
+	return parameter{Name: name, In: "path", Description: description, Required: true, Schema: &schema{Type: "string"}}
+}
+
+func queryParam(name, typ, description string) parameter {
+	return parameter{Name: name, In: "query", Description: description, Schema: &schema{Type: typ}}
+}
+
+func headerParam(name, description string) parameter {
+	return parameter{Name: name, In: "header", Description: description, Schema: &schema{Type: "string"}}
+}
+
+// params shared by routes
+var (
+	bookIDParam      = pathParam("bookID", "id of the book")
+	actorParam       = headerParam(actorHeader, "who is making the change, recorded in the book history")
+	ifMatchParam     = parameter{Name: "If-Match", In: "header", Description: "ETag of the version of the book the change is for or * for any version, 412 when the book has changed since and 428 without it", Required: true, Schema: &schema{Type: "string"}}
+	ifNoneMatchParam = headerParam("If-None-Match", "ETag of the version of the book the client has, 304 when it is current")
+	bookQueryParams  = []parameter{
+		queryParam("author", "string", "books by this author"),
+		queryParam("title", "string", "books with this in the title"),
+		queryParam("status", "string", "books with this status"),
+		queryParam("rating", "integer", "books with this rating"),
+		{Name: "pubdate_from", In: "query", Description: "books published on or after", Schema: &schema{Type: "string", Format: "date"}},
+		{Name: "pubdate_to", In: "query", Description: "books published on or before", Schema: &schema{Type: "string", Format: "date"}},
+		queryParam("sort", "string", "comma separated fields to sort by, a field prefixed with - is reversed, eg: -pubdate,title"),
+	}
+)
+
+// operations of every route of the api
+var operations = []operation{
+	{
+		method: http.MethodPost, path: "/book", id: "addBook", summary: "Add a book",
+		body: model.BookModel{}, status: http.StatusCreated, result: model.BookModel{},
+		problems: []int{http.StatusBadRequest, http.StatusConflict},
+	},
+	{
+		method: http.MethodGet, path: "/book", id: "listBooks", summary: "List books a page at a time",
+		params: append(append([]parameter{}, bookQueryParams...),
+			queryParam("limit", "integer", "books per page, up to "+strconv.Itoa(maxListLimit)),
+			queryParam("cursor", "string", "next from the previous page"),
+		),
+		status: http.StatusOK, result: model.BookList{},
+		problems: []int{http.StatusBadRequest},
+	},
+	{
+		method: http.MethodGet, path: "/book/search", id: "searchBooks", summary: "Ranked full text search of books",
+		params: []parameter{
+			{Name: "q", In: "query", Description: "web search syntax", Required: true, Schema: &schema{Type: "string"}},
+			queryParam("limit", "integer", "most results to return, up to "+strconv.Itoa(maxListLimit)),
+		},
+		status: http.StatusOK, result: model.SearchResults{},
+		problems: []int{http.StatusBadRequest},
+	},
+	{
+		method: http.MethodPost, path: "/book/import", id: "importBooks", summary: "Import books from csv or ndjson",
+		params: []parameter{
+			queryParam("dry_run", "boolean", "check every row and write nothing"),
+			queryParam("best_effort", "boolean", "write the valid rows even when others fail"),
+		},
+		bodyTypes: []string{mediaTypeCSV, mediaTypeNDJSON},
+		status:    http.StatusOK, result: model.ImportReport{},
+		problems: []int{http.StatusBadRequest, http.StatusUnsupportedMediaType},
+	},
+	{
+		method: http.MethodGet, path: "/book/export", id: "exportBooks", summary: "Download every book matching the filters",
+		params: append([]parameter{{
+			Name: "format", In: "query", Description: "json when not given",
+			Schema: &schema{Type: "string", Enum: []interface{}{"csv", "ndjson", "json"}},
+		}}, bookQueryParams...),
+		status: http.StatusOK, result: model.BookList{}, resultTypes: []string{"application/json", "text/csv", mediaTypeNDJSON},
+		problems: []int{http.StatusBadRequest},
+	},
+	{
+		method: http.MethodGet, path: "/book/isbn/{isbn}", id: "getBookByISBN", summary: "Get a book by its ISBN",
+		params: []parameter{pathParam("isbn", "ISBN-10 or ISBN-13, with or without hyphens"), ifNoneMatchParam},
+		status: http.StatusOK, result: model.BookModel{}, etag: true,
+		also:     map[int]string{http.StatusNotModified: "The client has the current version"},
+		problems: []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	{
+		method: http.MethodGet, path: "/book/{bookID}", id: "getBook", summary: "Get a book",
+		params: []parameter{bookIDParam, ifNoneMatchParam},
+		status: http.StatusOK, result: model.BookModel{}, etag: true,
+		also:     map[int]string{http.StatusNotModified: "The client has the current version"},
+		problems: []int{http.StatusNotFound},
+	},
+	{
+		method: http.MethodPut, path: "/book/{bookID}", id: "replaceBook", summary: "Replace a book",
+		params: []parameter{bookIDParam, ifMatchParam, actorParam},
+		body:   model.BookModel{}, status: http.StatusOK, result: model.BookModel{}, etag: true,
+		problems: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed, http.StatusPreconditionRequired},
+	},
+	{
+		method: http.MethodPatch, path: "/book/{bookID}", id: "updateBook", summary: "Update fields of a book with a JSON merge patch",
+		params: []parameter{bookIDParam, ifMatchParam, actorParam},
+		body:   model.BookModel{}, bodyTypes: []string{"application/merge-patch+json", "application/json"},
+		status: http.StatusOK, result: model.BookModel{}, etag: true,
+		problems: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed, http.StatusPreconditionRequired},
+	},
+	{
+		method: http.MethodDelete, path: "/book/{bookID}", id: "deleteBook", summary: "Move a book to the trash",
+		params:   []parameter{bookIDParam, ifMatchParam},
+		status:   http.StatusNoContent,
+		problems: []int{http.StatusConflict, http.StatusPreconditionFailed, http.StatusPreconditionRequired},
+	},
+	{
+		method: http.MethodPut, path: "/book/{bookID}/rating/{rating}", id: "changeBookRating", summary: "Change the rating of a book",
+		params: []parameter{bookIDParam, pathParam("rating", "1, 2 or 3"), ifMatchParam, actorParam},
+		status: http.StatusOK, result: model.BookModel{}, etag: true,
+		problems: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusPreconditionFailed, http.StatusPreconditionRequired},
+	},
+	{
+		method: http.MethodGet, path: "/book/{bookID}/history", id: "getBookHistory", summary: "Changes made to a book",
+		params: []parameter{bookIDParam},
+		status: http.StatusOK, result: model.History{},
+		problems: []int{http.StatusNotFound},
+	},
+	{
+		method: http.MethodPost, path: "/book/{bookID}/checkout", id: "checkOutBook", summary: "Lend a copy of a book to a patron",
+		params: []parameter{bookIDParam, actorParam},
+		body:   model.CheckOutRequest{}, status: http.StatusCreated, result: model.LoanModel{},
+		problems: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		method: http.MethodPost, path: "/book/{bookID}/checkin", id: "checkInBook", summary: "Return a copy of a book",
+		params: []parameter{bookIDParam, actorParam},
+		body:   model.CheckInRequest{}, status: http.StatusOK, result: model.LoanModel{},
+		problems: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		method: http.MethodPost, path: "/book/{bookID}/copies", id: "addCopy", summary: "Add a copy of a book",
+		params: []parameter{bookIDParam, actorParam},
+		body:   model.CopyModel{}, status: http.StatusCreated, result: model.CopyModel{},
+		problems: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		method: http.MethodGet, path: "/book/{bookID}/copies", id: "listCopies", summary: "List the copies of a book",
+		params: []parameter{bookIDParam},
+		status: http.StatusOK, result: model.CopyList{},
+		problems: []int{http.StatusNotFound},
+	},
+	{
+		method: http.MethodDelete, path: "/book/{bookID}/copies/{copyID}", id: "removeCopy", summary: "Remove a copy of a book",
+		params:   []parameter{bookIDParam, pathParam("copyID", "id of the copy"), actorParam},
+		status:   http.StatusNoContent,
+		problems: []int{http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		method: http.MethodPost, path: "/book/{bookID}/holds", id: "placeHold", summary: "Place a hold on a book for a patron",
+		params: []parameter{bookIDParam},
+		body:   model.PlaceHoldRequest{}, status: http.StatusCreated, result: model.HoldModel{},
+		problems: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		method: http.MethodGet, path: "/book/{bookID}/holds", id: "listBookHolds", summary: "List the open holds on a book",
+		params: []parameter{bookIDParam},
+		status: http.StatusOK, result: model.HoldList{},
+		problems: []int{http.StatusNotFound},
+	},
+	{
+		method: http.MethodGet, path: "/trash", id: "listTrash", summary: "List the books in the trash",
+		status: http.StatusOK, result: model.TrashList{},
+	},
+	{
+		method: http.MethodPost, path: "/trash/{bookID}/restore", id: "restoreBook", summary: "Restore a book from the trash",
+		params: []parameter{bookIDParam},
+		status: http.StatusOK, result: model.BookModel{}, etag: true,
+		problems: []int{http.StatusNotFound, http.StatusConflict},
+	},
+	{
+		method: http.MethodPost, path: "/patron", id: "addPatron", summary: "Add a patron",
+		body: model.PatronModel{}, status: http.StatusCreated, result: model.PatronModel{},
+		problems: []int{http.StatusBadRequest},
+	},
+	{
+		method: http.MethodGet, path: "/patron/{patronID}", id: "getPatron", summary: "Get a patron",
+		params: []parameter{pathParam("patronID", "id of the patron")},
+		status: http.StatusOK, result: model.PatronModel{},
+		problems: []int{http.StatusNotFound},
+	},
+	{
+		method: http.MethodDelete, path: "/holds/{holdID}", id: "cancelHold", summary: "Cancel a hold",
+		params: []parameter{pathParam("holdID", "id of the hold"), actorParam},
+		status: http.StatusNoContent,
+	},
+	{
+		method: http.MethodGet, path: "/loans/overdue", id: "listOverdueLoans", summary: "List the loans which are overdue",
+		status: http.StatusOK, result: model.OverdueLoanList{},
+	},
+	{
+		method: http.MethodGet, path: "/openapi.json", id: "getOpenAPI", summary: "This OpenAPI document",
+		status: http.StatusOK, result: map[string]interface{}{}, resultTypes: []string{"application/json", mediaTypeOpenAPI},
+	},
+}
+
+// schema is an OpenAPI schema object
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	ReadOnly             bool               `json:"readOnly,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIHeader struct {
+	Description string  `json:"description"`
+	Schema      *schema `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Headers     map[string]openAPIHeader    `json:"headers,omitempty"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Parameters  []parameter                `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIDocument struct {
+	OpenAPI string `json:"openapi"`
+	Info    struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Version     string `json:"version"`
+	} `json:"info"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// newOpenAPIDocument describes the operations and the models they send and
+// respond with, the schemas of the models follow their json encoding
+func newOpenAPIDocument(ops []operation) openAPIDocument {
+	var doc openAPIDocument
+	doc.OpenAPI = "3.0.3"
+	doc.Info.Title = "Books"
+	doc.Info.Description = "A library of books, their copies, loans and holds.  " +
+		"Responses are also encoded as application/xml or text/csv by the Accept header, " +
+		"errors are RFC 7807 problem details"
+	doc.Info.Version = openAPIVersion
+	doc.Paths = make(map[string]map[string]openAPIOperation)
+	schemas := make(schemaSet)
+
+	for _, op := range ops {
+		o := openAPIOperation{
+			OperationID: op.id,
+			Summary:     op.summary,
+			Parameters:  op.params,
+			Responses:   make(map[string]openAPIResponse),
+		}
+
+		if op.body != nil || len(op.bodyTypes) > 0 {
+			o.RequestBody = &openAPIRequestBody{Required: true, Content: make(map[string]openAPIMediaType)}
+			types := op.bodyTypes
+			if len(types) == 0 {
+				types = []string{"application/json"}
+			}
+			for _, t := range types {
+				s := &schema{Type: "string"}
+				if op.body != nil {
+					s = schemas.of(reflect.TypeOf(op.body))
+				}
+				o.RequestBody.Content[t] = openAPIMediaType{Schema: s}
+			}
+		}
+
+		success := openAPIResponse{Description: http.StatusText(op.status)}
+		if op.result != nil {
+			types := op.resultTypes
+			if len(types) == 0 {
+				types = []string{"application/json"}
+			}
+			success.Content = make(map[string]openAPIMediaType)
+			for _, t := range types {
+				s := &schema{Type: "string"}
+				if strings.HasSuffix(t, "json") {
+					s = schemas.of(reflect.TypeOf(op.result))
+				}
+				success.Content[t] = openAPIMediaType{Schema: s}
+			}
+		}
+		if op.etag {
+			success.Headers = map[string]openAPIHeader{
+				"ETag": {Description: "version of the book, for If-Match and If-None-Match", Schema: &schema{Type: "string"}},
+			}
+		}
+		o.Responses[strconv.Itoa(op.status)] = success
+
+		for status, description := range op.also {
+			o.Responses[strconv.Itoa(status)] = openAPIResponse{Description: description}
+		}
+
+		problem := schemas.of(reflect.TypeOf(model.Problem{}))
+		for _, status := range append(op.problems, http.StatusNotAcceptable, http.StatusInternalServerError) {
+			o.Responses[strconv.Itoa(status)] = openAPIResponse{
+				Description: http.StatusText(status),
+				Content:     map[string]openAPIMediaType{"application/problem+json": {Schema: problem}},
+			}
+		}
+
+		if doc.Paths[op.path] == nil {
+			doc.Paths[op.path] = make(map[string]openAPIOperation)
+		}
+		doc.Paths[op.path][strings.ToLower(op.method)] = o
+	}
+
+	doc.Components.Schemas = schemas
+	return doc
+}
+
+// schemaSet are the schemas of models by name
+type schemaSet map[string]*schema
+
+// of is the schema of a type, a model is a reference to its schema in s
+func (s schemaSet) of(t reflect.Type) *schema {
+	t = indirectType(t)
+	switch t.Kind() {
+	case reflect.Struct:
+		name := strings.TrimSuffix(t.Name(), "Model")
+		if _, ok := s[name]; !ok {
+			s[name] = nil // a model which refers to itself is not generated twice
+			s[name] = s.object(t)
+		}
+		return &schema{Ref: "#/components/schemas/" + name}
+	case reflect.Slice, reflect.Array:
+		return &schema{Type: "array", Items: s.of(t.Elem())}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: s.of(t.Elem())}
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	}
+	return &schema{}
+}
+
+// object is the schema of a model, a field is required unless it is omitted
+// when empty.  The openapi tag of a field adds to its schema, eg:
+// `openapi:"format=date,optional"`, enum values are separated by |
+func (s schemaSet) object(t reflect.Type) *schema {
+	obj := &schema{
+		Type:                 "object",
+		Properties:           make(map[string]*schema),
+		AdditionalProperties: false,
+	}
+	for _, f := range modelFields(t) {
+		prop := s.of(f.typ)
+		required := !f.omitEmpty
+		for _, opt := range strings.Split(f.tag.Get("openapi"), ",") {
+			switch name, value := splitOption(opt); name {
+			case "readOnly":
+				prop.ReadOnly = true
+			case "optional":
+				required = false
+			case "format":
+				prop.Format = value
+			case "enum":
+				for _, v := range strings.Split(value, "|") {
+					if prop.Type == "integer" {
+						n, _ := strconv.Atoi(v)
+						prop.Enum = append(prop.Enum, n)
+						continue
+					}
+					prop.Enum = append(prop.Enum, v)
+				}
+			}
+		}
+		obj.Properties[f.name] = prop
+		if required {
+			obj.Required = append(obj.Required, f.name)
+		}
+	}
+	sort.Strings(obj.Required)
+	return obj
+}
+
+func splitOption(opt string) (name, value string) {
+	if i := strings.Index(opt, "="); i >= 0 {
+		return opt[:i], opt[i+1:]
+	}
+	return opt, ""
+}
+
+// openAPI serves the OpenAPI document of the api, it is always json
+func openAPI(doc openAPIDocument) http.HandlerFunc {
+	data, err := json.Marshal(doc)
+	return func(w http.ResponseWriter, r *http.Request) {
+		mediaType, ok := preferred(r, "application/json", mediaTypeOpenAPI)
+		if !ok {
+			notAcceptable(w, "application/json", mediaTypeOpenAPI)
+			return
+		}
+		if err != nil {
+			problemResponse(w, problemInternal, "Error encoding the OpenAPI document")
+			return
+		}
+		w.Header().Set("Content-Type", mediaType)
+		w.Write(data)
+	}
+}
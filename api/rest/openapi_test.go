@@ -0,0 +1,335 @@
+package rest_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/api/rest"
+	"github.com/tempcke/books/repository/memory"
+)
+
+// GET /openapi.json
+func TestOpenAPIDescribesEveryRoute(t *testing.T) {
+	spec := getOpenAPISpec(t, server)
+
+	var documented []string
+	for path, ops := range spec.paths() {
+		for method := range ops.(map[string]interface{}) {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	var routed []string
+	err := chi.Walk(server.Handler.(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routed = append(routed, method+" "+strings.TrimSuffix(route, "/"))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	sort.Strings(documented)
+	sort.Strings(routed)
+	assert.Equal(t, routed, documented)
+}
+
+// TestOpenAPIResponses exercises every operation of the api and checks the
+// responses are described by the OpenAPI document
+func TestOpenAPIResponses(t *testing.T) {
+	var later time.Duration
+	server := rest.NewServer(memory.NewRepo(), logger, rest.WithClock(func() time.Time { return time.Now().Add(later) }))
+	spec := getOpenAPISpec(t, server)
+	covered := make(map[string]bool)
+
+	send := func(method, uri, body string, headers ...string) jsonMap {
+		t.Helper()
+		req := httptest.NewRequest(method, uri, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		op := spec.check(t, req, rr)
+		covered[op] = true
+		data := jsonMap{}
+		if strings.Contains(rr.Header().Get("Content-Type"), "json") && !strings.Contains(rr.Header().Get("Content-Type"), "ndjson") {
+			json.Unmarshal(rr.Body.Bytes(), &data)
+		}
+		return data
+	}
+	missing := "/book/" + makeBook("missing").ID
+
+	send(http.MethodGet, "/openapi.json", "")
+
+	b := send(http.MethodPost, "/book", `{"isbn":"0-201-48567-2","title":"Refactoring","author":"Martin Fowler","publisher":"Addison-Wesley","pubdate":"1999-06-28","rating":3,"status":"CheckedIn"}`)
+	bookURI := fmt.Sprintf("/book/%v", b["id"])
+	send(http.MethodPost, "/book", `{"title":"","author":"a","publisher":"p","pubdate":"1999","rating":7,"status":"CheckedIn"}`)
+	send(http.MethodPost, "/book", `{"isbn":"9780201485677","title":"t","author":"a","publisher":"p","pubdate":"1999-06-28","rating":1,"status":"CheckedIn"}`)
+
+	send(http.MethodGet, "/book?sort=-pubdate,title&limit=10", "")
+	send(http.MethodGet, "/book?limit=0", "")
+	send(http.MethodGet, "/book/search?q=refactoring", "")
+	send(http.MethodGet, "/book/search", "")
+
+	send(http.MethodPost, "/book/import?dry_run=true", "isbn,title,author,publisher,pubdate,rating,status\n,Dry,a,p,2020-01-01,1,CheckedIn\n", "Content-Type", "text/csv")
+	send(http.MethodPost, "/book/import", "{}", "Content-Type", "application/json")
+	for _, format := range []string{"json", "csv", "ndjson"} {
+		send(http.MethodGet, "/book/export?format="+format, "")
+	}
+
+	send(http.MethodGet, "/book/isbn/9780201485677", "")
+	send(http.MethodGet, "/book/isbn/9780201485677", "", "If-None-Match", `"1"`)
+	send(http.MethodGet, "/book/isbn/0201485673", "")
+	send(http.MethodGet, "/book/isbn/9780306406157", "")
+
+	send(http.MethodGet, bookURI, "")
+	send(http.MethodGet, missing, "")
+	send(http.MethodPut, bookURI, `{"isbn":"9780201485677","title":"Refactoring 2","author":"Martin Fowler","publisher":"Addison-Wesley","pubdate":"1999-06-28","rating":3,"status":"CheckedIn"}`, "X-Actor", "editor", "If-Match", `"1"`)
+	send(http.MethodPut, bookURI, `{"title":"Refactoring 3"}`)
+	send(http.MethodPatch, bookURI, `{"title":"Refactoring"}`, "Content-Type", "application/merge-patch+json", "If-Match", "*")
+	send(http.MethodPatch, bookURI, `{"title":"stale"}`, "If-Match", `"1"`)
+	send(http.MethodPut, bookURI+"/rating/2", "", "If-Match", "*")
+	send(http.MethodPut, bookURI+"/rating/9", "", "If-Match", "*")
+	send(http.MethodPut, bookURI+"/rating/3", "")
+	send(http.MethodPut, bookURI+"/rating/3", "", "If-Match", `"1"`)
+	send(http.MethodGet, bookURI+"/history", "")
+
+	reader := send(http.MethodPost, "/patron", `{"name":"Jane Doe","email":"jane@example.com"}`)
+	waiting := send(http.MethodPost, "/patron", `{"name":"John Doe","email":"john@example.com"}`)
+	send(http.MethodPost, "/patron", `{"name":"","email":"nobody"}`)
+	send(http.MethodGet, fmt.Sprintf("/patron/%v", reader["id"]), "")
+	send(http.MethodGet, "/patron/"+makeBook("missing").ID, "")
+
+	send(http.MethodPost, bookURI+"/checkout", fmt.Sprintf(`{"patron_id":"%v","due_date":"%v"}`, reader["id"], time.Now().AddDate(0, 0, 1).Format("2006-01-02")))
+	send(http.MethodPost, bookURI+"/checkout", fmt.Sprintf(`{"patron_id":"%v"}`, waiting["id"]))
+	h := send(http.MethodPost, bookURI+"/holds", fmt.Sprintf(`{"patron_id":"%v"}`, waiting["id"]))
+	send(http.MethodGet, bookURI+"/holds", "")
+	later = 72 * time.Hour
+	send(http.MethodGet, "/loans/overdue", "")
+	send(http.MethodPost, bookURI+"/checkin", "")
+	send(http.MethodPost, bookURI+"/checkin", "")
+
+	c := send(http.MethodPost, bookURI+"/copies", `{"barcode":"B-2","condition":"New"}`)
+	send(http.MethodPost, bookURI+"/copies", `{"barcode":"B-2"}`)
+	send(http.MethodGet, bookURI+"/copies", "")
+	send(http.MethodDelete, fmt.Sprintf("%v/copies/%v", bookURI, c["id"]), "")
+	send(http.MethodDelete, fmt.Sprintf("/holds/%v", h["id"]), "")
+
+	send(http.MethodDelete, bookURI, "", "If-Match", `"1"`)
+	send(http.MethodDelete, bookURI, "")
+	send(http.MethodDelete, bookURI, "", "If-Match", "*")
+	send(http.MethodGet, "/trash", "")
+	send(http.MethodPost, fmt.Sprintf("/trash/%v/restore", b["id"]), "")
+	send(http.MethodPost, "/trash"+strings.TrimPrefix(missing, "/book")+"/restore", "")
+
+	for _, op := range spec.operations() {
+		assert.True(t, covered[op], "operation not exercised: "+op)
+	}
+}
+
+// openAPISpec is a decoded OpenAPI document
+type openAPISpec jsonMap
+
+func getOpenAPISpec(t *testing.T, server http.Handler) openAPISpec {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	spec := openAPISpec{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &spec))
+	assert.Equal(t, "3.0.3", spec["openapi"])
+	return spec
+}
+
+func (s openAPISpec) paths() map[string]interface{} {
+	paths, _ := s["paths"].(map[string]interface{})
+	return paths
+}
+
+// operations are every method and path of the document, eg: GET /book
+func (s openAPISpec) operations() []string {
+	var ops []string
+	for path, methods := range s.paths() {
+		for method := range methods.(map[string]interface{}) {
+			ops = append(ops, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(ops)
+	return ops
+}
+
+// route finds the path of the document a request is for, a path without
+// params is preferred so /book/search is not taken for /book/{bookID}
+func (s openAPISpec) route(urlPath string) string {
+	segments := strings.Split(strings.TrimSuffix(urlPath, "/"), "/")
+	best, bestParams := "", -1
+	for path := range s.paths() {
+		parts := strings.Split(path, "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		params := 0
+		for i, p := range parts {
+			if strings.HasPrefix(p, "{") {
+				params++
+			} else if p != segments[i] {
+				params = -1
+				break
+			}
+		}
+		if params >= 0 && (bestParams < 0 || params < bestParams) {
+			best, bestParams = path, params
+		}
+	}
+	return best
+}
+
+// check asserts a response is one the document describes for the request and
+// returns the operation, eg: GET /book/{bookID}
+func (s openAPISpec) check(t *testing.T, req *http.Request, rr *httptest.ResponseRecorder) string {
+	t.Helper()
+	path := s.route(req.URL.Path)
+	op := req.Method + " " + path
+	methods, _ := s.paths()[path].(map[string]interface{})
+	operation, ok := methods[strings.ToLower(req.Method)].(map[string]interface{})
+	if !assert.True(t, ok, "no operation for %v %v", req.Method, req.URL) {
+		return op
+	}
+
+	responses, _ := operation["responses"].(map[string]interface{})
+	res, ok := responses[strconv.Itoa(rr.Code)].(map[string]interface{})
+	if !assert.True(t, ok, "%v does not respond %v: %v", op, rr.Code, rr.Body.String()) {
+		return op
+	}
+
+	if headers, ok := res["headers"].(map[string]interface{}); ok {
+		for name := range headers {
+			assert.NotEmpty(t, rr.Header().Get(name), "%v %v header", op, name)
+		}
+	}
+
+	content, _ := res["content"].(map[string]interface{})
+	if len(content) == 0 {
+		assert.Empty(t, rr.Body.String(), "%v %v has no content", op, rr.Code)
+		return op
+	}
+	mediaType, _, _ := mime.ParseMediaType(rr.Header().Get("Content-Type"))
+	media, ok := content[mediaType].(map[string]interface{})
+	if !assert.True(t, ok, "%v %v is not %v", op, rr.Code, mediaType) {
+		return op
+	}
+	if !strings.HasSuffix(mediaType, "json") || strings.HasSuffix(mediaType, "ndjson") {
+		return op
+	}
+
+	var body interface{}
+	if assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body), op) {
+		schema, _ := media["schema"].(map[string]interface{})
+		for _, err := range s.validate(schema, body, "body") {
+			t.Errorf("%v %v: %v", op, rr.Code, err)
+		}
+	}
+	return op
+}
+
+// validate checks a decoded json value against the parts of a schema the
+// document uses: $ref, type, properties, required, additionalProperties,
+// items, format and enum
+func (s openAPISpec) validate(schema map[string]interface{}, v interface{}, at string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		components, _ := s["components"].(map[string]interface{})
+		schemas, _ := components["schemas"].(map[string]interface{})
+		named, ok := schemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]interface{})
+		if !ok {
+			return []string{at + ": unknown schema " + ref}
+		}
+		return s.validate(named, v, at)
+	}
+
+	var errs []string
+	fail := func(format string, args ...interface{}) []string {
+		return append(errs, at+": "+fmt.Sprintf(format, args...))
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fail("%v is not an object", v)
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := obj[name.(string)]; !ok {
+				errs = fail("%v is required", name)
+			}
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		for name, value := range obj {
+			if prop, ok := props[name].(map[string]interface{}); ok {
+				errs = append(errs, s.validate(prop, value, at+"."+name)...)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					errs = fail("%v is not in the schema", name)
+				}
+			case map[string]interface{}:
+				errs = append(errs, s.validate(additional, value, at+"."+name)...)
+			}
+		}
+	case "array":
+		list, ok := v.([]interface{})
+		if !ok {
+			return fail("%v is not an array", v)
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range list {
+			errs = append(errs, s.validate(items, item, at+"["+strconv.Itoa(i)+"]")...)
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fail("%v is not a string", v)
+		}
+		layout := map[interface{}]string{"date": "2006-01-02", "date-time": time.RFC3339}[schema["format"]]
+		if _, err := time.Parse(layout, str); layout != "" && err != nil {
+			errs = fail("%q is not a %v", str, schema["format"])
+		}
+		if schema["format"] == "email" && !strings.Contains(str, "@") {
+			errs = fail("%q is not an email", str)
+		}
+	case "integer", "number":
+		n, ok := v.(float64)
+		if !ok || (schema["type"] == "integer" && n != math.Trunc(n)) {
+			return fail("%v is not an %v", v, schema["type"])
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fail("%v is not a boolean", v)
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		for _, e := range enum {
+			if e == v {
+				return errs
+			}
+		}
+		errs = fail("%v is not one of %v", v, enum)
+	}
+	return errs
+}
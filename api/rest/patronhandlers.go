@@ -0,0 +1,44 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/tempcke/books/api/model"
+	"github.com/tempcke/books/entity/patron"
+	"github.com/tempcke/books/internal"
+	"github.com/tempcke/books/usecase"
+)
+
+func addPatron(patronRepo usecase.PatronReaderWriter, log *internal.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := model.PatronModel{}
+		if err := decodeRequestData(w, r.Body, &data); err != nil {
+			log.Error(err)
+			return
+		}
+
+		p := patron.NewPatron(data.Name, data.Email)
+		if err := usecase.AddPatron(r.Context(), patronRepo, p); err != nil {
+			log.Debug(err)
+			errorResponse(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		response(w, NewPatronModel(p))
+	}
+}
+
+func getPatron(patronRepo usecase.PatronReader, log *internal.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		patronID := chi.URLParam(r, "patronID")
+		p, err := usecase.GetPatron(r.Context(), patronRepo, patronID)
+		if err != nil {
+			problemResponse(w, problemNotFound, "patronId not found")
+			log.Debug("getPatron handler, id not found: " + patronID)
+			return
+		}
+		response(w, NewPatronModel(p))
+	}
+}
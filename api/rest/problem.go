@@ -0,0 +1,158 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/tempcke/books/api/model"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/entity/hold"
+	"github.com/tempcke/books/entity/loan"
+	"github.com/tempcke/books/entity/patron"
+	"github.com/tempcke/books/entity/validation"
+	"github.com/tempcke/books/repository/repoerr"
+	"github.com/tempcke/books/usecase"
+)
+
+// problemTypeBase prefixed to the code of a problem is its type URI
+const problemTypeBase = "urn:books:problem:"
+
+// problemType is what every occurrence of a problem has in common
+type problemType struct {
+	status int
+	code   string
+	title  string
+}
+
+// problem types which handlers report without an error to map
+var (
+	problemInvalidFields        = problemType{http.StatusBadRequest, model.CodeInvalidFields, "Request has invalid fields"}
+	problemInvalidBody          = problemType{http.StatusBadRequest, model.CodeInvalidBody, "Request body could not be read"}
+	problemNotFound             = problemType{http.StatusNotFound, model.CodeNotFound, "Resource not found"}
+	problemMethodNotAllowed     = problemType{http.StatusMethodNotAllowed, model.CodeMethodNotAllowed, "Method is not allowed"}
+	problemNotAcceptable        = problemType{http.StatusNotAcceptable, model.CodeNotAcceptable, "No acceptable media type"}
+	problemUnsupportedMediaType = problemType{http.StatusUnsupportedMediaType, model.CodeUnsupportedMediaType, "Content-Type is not supported"}
+	problemVersionConflict      = problemType{http.StatusPreconditionFailed, model.CodeVersionConflict, "Book was changed since it was read"}
+	problemInternal             = problemType{http.StatusInternalServerError, model.CodeInternal, "Internal server error"}
+)
+
+// errorProblems maps the sentinel errors of the usecases and repositories to
+// the problem they are reported as
+var errorProblems = map[error]problemType{
+	repoerr.ErrRecordNotFound:      problemNotFound,
+	repoerr.ErrRecordNotUnique:     {http.StatusConflict, model.CodeNotUnique, "Record is not unique"},
+	usecase.ErrVersionConflict:     problemVersionConflict,
+	errIfMatchRequired:             {http.StatusPreconditionRequired, model.CodeIfMatchRequired, "If-Match header is required"},
+	usecase.ErrISBNExists:          {http.StatusConflict, model.CodeISBNExists, "ISBN belongs to another book"},
+	usecase.ErrBarcodeExists:       {http.StatusConflict, model.CodeBarcodeExists, "Barcode is already in use"},
+	usecase.ErrCopyNotFound:        problemNotFound,
+	usecase.ErrCopyIsInUse:         {http.StatusConflict, model.CodeCopyInUse, "Copy is checked out or on hold"},
+	usecase.ErrLastCopy:            {http.StatusConflict, model.CodeLastCopy, "The last copy of a book can not be removed"},
+	usecase.ErrBookIsCheckedOut:    {http.StatusConflict, model.CodeBookCheckedOut, "Every copy of the book is checked out"},
+	usecase.ErrBookIsNotCheckedOut: {http.StatusConflict, model.CodeBookNotCheckedOut, "Book is not checked out"},
+	usecase.ErrBookIsAvailable:     {http.StatusConflict, model.CodeBookAvailable, "Book is checked in"},
+	usecase.ErrBookIsOnHold:        {http.StatusConflict, model.CodeBookOnHold, "Book is on hold for another patron"},
+	usecase.ErrHoldExists:          {http.StatusConflict, model.CodeHoldExists, "Patron already has a hold on this book"},
+	usecase.ErrHoldIsClosed:        {http.StatusConflict, model.CodeHoldClosed, "Hold is no longer open"},
+}
+
+// errorFields maps the validation errors of the entities and usecases to the
+// field of the request they are about
+var errorFields = map[error]model.FieldError{
+	book.ErrTitleIsRequired:        {Field: "title", Code: model.FieldRequired},
+	book.ErrAuthorIsRequired:       {Field: "author", Code: model.FieldRequired},
+	book.ErrPublisherIsRequired:    {Field: "publisher", Code: model.FieldRequired},
+	book.ErrPubDateIsRequired:      {Field: "pubdate", Code: model.FieldRequired},
+	book.ErrRatingInvalid:          {Field: "rating", Code: model.FieldInvalid},
+	book.ErrStatusInvalid:          {Field: "status", Code: model.FieldInvalid},
+	book.ErrISBNInvalid:            {Field: "isbn", Code: model.FieldInvalid},
+	book.ErrBookIDIsRequired:       {Field: "book_id", Code: model.FieldRequired},
+	book.ErrBarcodeIsRequired:      {Field: "barcode", Code: model.FieldRequired},
+	book.ErrConditionInvalid:       {Field: "condition", Code: model.FieldInvalid},
+	loan.ErrBookIDIsRequired:       {Field: "book_id", Code: model.FieldRequired},
+	loan.ErrPatronIDIsRequired:     {Field: "patron_id", Code: model.FieldRequired},
+	loan.ErrDueDateInvalid:         {Field: "due_date", Code: model.FieldInvalid},
+	hold.ErrBookIDIsRequired:       {Field: "book_id", Code: model.FieldRequired},
+	hold.ErrPatronIDIsRequired:     {Field: "patron_id", Code: model.FieldRequired},
+	patron.ErrNameIsRequired:       {Field: "name", Code: model.FieldRequired},
+	patron.ErrEmailInvalid:         {Field: "email", Code: model.FieldInvalid},
+	usecase.ErrStatusIsNotEditable: {Field: "status", Code: model.FieldNotEditable},
+	usecase.ErrCopyIsRequired:      {Field: "barcode", Code: model.FieldRequired},
+	usecase.ErrSearchQueryRequired: {Field: "q", Code: model.FieldRequired},
+	usecase.ErrSortFieldInvalid:    {Field: "sort", Code: model.FieldInvalid},
+	usecase.ErrCursorInvalid:       {Field: "cursor", Code: model.FieldInvalid},
+	usecase.ErrLimitInvalid:        {Field: "limit", Code: model.FieldInvalid},
+}
+
+func newProblem(pt problemType, detail string, fields ...model.FieldError) model.Problem {
+	return model.Problem{
+		Type:   problemTypeBase + pt.code,
+		Title:  pt.title,
+		Status: pt.status,
+		Detail: detail,
+		Code:   pt.code,
+		Errors: fields,
+	}
+}
+
+// problemFor is the problem an error is reported as, an error which is not
+// mapped is an internal error and what went wrong is not shown to clients
+func problemFor(err error) model.Problem {
+	var errs validation.Errors
+	if errors.As(err, &errs) {
+		fields := make([]model.FieldError, len(errs))
+		for i, e := range errs {
+			fe, ok := fieldFor(e)
+			if !ok {
+				fe = model.FieldError{Field: strings.ToLower(e.Field), Code: model.FieldInvalid, Detail: e.Error()}
+			}
+			fields[i] = fe
+		}
+		return newProblem(problemInvalidFields, errs.Error(), fields...)
+	}
+	if fe, ok := fieldFor(err); ok {
+		return newProblem(problemInvalidFields, fe.Detail, fe)
+	}
+	for sentinel, pt := range errorProblems {
+		if errors.Is(err, sentinel) {
+			return newProblem(pt, sentinel.Error())
+		}
+	}
+	return newProblem(problemInternal, "")
+}
+
+// fieldFor is the FieldError of an error about a single field of the request
+func fieldFor(err error) (model.FieldError, bool) {
+	var fe model.FieldError
+	if errors.As(err, &fe) {
+		return fe, true
+	}
+	for sentinel, fe := range errorFields {
+		if errors.Is(err, sentinel) {
+			fe.Detail = sentinel.Error()
+			return fe, true
+		}
+	}
+	return fe, false
+}
+
+// errorResponse writes the problem err is reported as
+func errorResponse(w http.ResponseWriter, err error) {
+	writeProblem(w, problemFor(err))
+}
+
+// problemResponse writes a problem of the given type
+func problemResponse(w http.ResponseWriter, pt problemType, detail string) {
+	writeProblem(w, newProblem(pt, detail))
+}
+
+// fieldResponse writes the problem of a single invalid field
+func fieldResponse(w http.ResponseWriter, field, code, detail string) {
+	errorResponse(w, model.FieldError{Field: field, Code: code, Detail: detail})
+}
+
+func writeProblem(w http.ResponseWriter, p model.Problem) {
+	w.WriteHeader(p.Status)
+	response(w, p)
+}
@@ -2,8 +2,11 @@ package rest
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/tempcke/books/entity/hold"
+	"github.com/tempcke/books/entity/loan"
 	"github.com/tempcke/books/internal"
 	"github.com/tempcke/books/usecase"
 )
@@ -11,30 +14,119 @@ import (
 // Server is used to expose appliaction over a RESTful API
 type Server struct {
 	http.Handler
-	bookRepo usecase.BookReaderWriter
-	log      *internal.Logger
+	repo         usecase.LibraryRepo
+	log          *internal.Logger
+	loanPeriod   time.Duration
+	pickupWindow time.Duration
+	retention    time.Duration
+	clock        func() time.Time
+}
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithLoanPeriod sets how long books are lent for when no due date is given
+func WithLoanPeriod(period time.Duration) Option {
+	return func(s *Server) {
+		s.loanPeriod = period
+	}
+}
+
+// WithPickupWindow sets how long a returned book is held for a patron
+func WithPickupWindow(window time.Duration) Option {
+	return func(s *Server) {
+		s.pickupWindow = window
+	}
+}
+
+// WithTrashRetention sets how long removed books are kept in the trash
+func WithTrashRetention(retention time.Duration) Option {
+	return func(s *Server) {
+		s.retention = retention
+	}
+}
+
+// WithClock replaces time.Now as the source of the current time
+func WithClock(clock func() time.Time) Option {
+	return func(s *Server) {
+		s.clock = clock
+	}
 }
 
 // NewServer constructs a Server
-func NewServer(bookRepo usecase.BookReaderWriter, logger *internal.Logger) *Server {
+func NewServer(repo usecase.LibraryRepo, logger *internal.Logger, options ...Option) *Server {
 	server := new(Server)
-	server.bookRepo = bookRepo
+	server.repo = repo
 	server.log = logger
+	server.loanPeriod = loan.DefaultPeriod
+	server.pickupWindow = hold.DefaultPickupWindow
+	server.retention = usecase.DefaultTrashRetention
+	server.clock = time.Now
+	for _, option := range options {
+		option(server)
+	}
 	server.initRouter()
 	return server
 }
 
 func (s *Server) initRouter() {
 	r := chi.NewRouter()
+	r.NotFound(negotiate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problemResponse(w, problemNotFound, r.URL.Path+" not found")
+	})).ServeHTTP)
+	r.MethodNotAllowed(negotiate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problemResponse(w, problemMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+	})).ServeHTTP)
+
+	r.Group(func(r chi.Router) {
+		r.Use(fixedMediaType)
+		r.Get("/book/export", exportBooks(s.repo, s.log, s.clock))
+		r.Get("/openapi.json", openAPI(newOpenAPIDocument(operations)))
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(negotiate)
+		s.negotiatedRoutes(r)
+	})
+	s.Handler = r
+}
+
+// negotiatedRoutes are the routes which respond in the media type the client
+// prefers, see negotiate
+func (s *Server) negotiatedRoutes(r chi.Router) {
 	r.Route("/book", func(r chi.Router) {
-		r.Post("/", addBook(s.bookRepo, s.log))
-		r.Get("/", listBooks(s.bookRepo, s.log))
+		r.Post("/", addBook(s.repo, s.log))
+		r.Get("/", listBooks(s.repo, s.log))
+		r.Get("/search", searchBooks(s.repo, s.log))
+		r.Post("/import", importBooks(s.repo, s.log))
+		r.Get("/isbn/{isbn}", getBookByISBN(s.repo, s.log))
 		r.Route("/{bookID}", func(r chi.Router) {
-			r.Get("/", getBook(s.bookRepo, s.log))
-			r.Delete("/", deleteBook(s.bookRepo, s.log))
-			r.Put("/status/{status}", putBookStatus(s.bookRepo, s.log))
-			r.Put("/rating/{rating}", putBookRating(s.bookRepo, s.log))
+			r.Get("/", getBook(s.repo, s.log))
+			r.Put("/", putBook(s.repo, s.log))
+			r.Patch("/", patchBook(s.repo, s.log))
+			r.Delete("/", deleteBook(s.repo, s.log))
+			r.Put("/rating/{rating}", putBookRating(s.repo, s.log))
+			r.Get("/history", getBookHistory(s.repo, s.log))
+			r.Post("/checkout", checkOutBook(s.repo, s.log, s.clock, s.loanPeriod))
+			r.Post("/checkin", checkInBook(s.repo, s.log, s.clock, s.pickupWindow))
+			r.Post("/copies", addCopy(s.repo, s.log, s.pickupWindow))
+			r.Get("/copies", listCopies(s.repo, s.log))
+			r.Delete("/copies/{copyID}", removeCopy(s.repo, s.log))
+			r.Post("/holds", placeHold(s.repo, s.log))
+			r.Get("/holds", listBookHolds(s.repo, s.log))
 		})
 	})
-	s.Handler = r
+	r.Route("/trash", func(r chi.Router) {
+		r.Get("/", listTrash(s.repo, s.log, s.retention))
+		r.Post("/{bookID}/restore", restoreBook(s.repo, s.log))
+	})
+	r.Route("/patron", func(r chi.Router) {
+		r.Post("/", addPatron(s.repo, s.log))
+		r.Get("/{patronID}", getPatron(s.repo, s.log))
+	})
+	r.Route("/holds", func(r chi.Router) {
+		r.Delete("/{holdID}", cancelHold(s.repo, s.log, s.pickupWindow))
+	})
+	r.Route("/loans", func(r chi.Router) {
+		r.Get("/overdue", listOverdueLoans(s.repo, s.log, s.clock))
+	})
 }
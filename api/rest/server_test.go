@@ -2,36 +2,46 @@ package rest_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/api/model"
 	"github.com/tempcke/books/api/rest"
 	"github.com/tempcke/books/entity/book"
-	"github.com/tempcke/books/fake"
+	"github.com/tempcke/books/entity/patron"
 	"github.com/tempcke/books/internal"
+	"github.com/tempcke/books/repository/memory"
+	"github.com/tempcke/books/usecase"
 )
 
 type jsonMap map[string]interface{}
 
 var (
+	ctx    = context.Background()
 	logger = internal.NewLogger()
-	repo   = fake.NewBookRepo()
+	repo   = memory.NewRepo()
 	server = rest.NewServer(repo, logger)
 )
 
 var (
-	author  = "john smith"
-	pubdate = "2020-01-01"
-	rating  = book.RateOne
-	status  = book.StatusCheckedIn
+	author    = "john smith"
+	publisher = "acme publishing"
+	pubdate   = "2020-01-01"
+	rating    = book.RateOne
+	status    = book.StatusCheckedIn
 )
 
-var bookJsonTemplate = `{"title":"%v","author":"%v","pubdate":"%v","rating":%v,"status":"%v"}`
+var bookJsonTemplate = `{"title":"%v","author":"%v","publisher":"%v","pubdate":"%v","rating":%v,"status":"%v"}`
 
 var dateFormat = "2006-01-02"
 
@@ -40,6 +50,7 @@ func makeBookJson(title string) string {
 		bookJsonTemplate,
 		title,
 		author,
+		publisher,
 		pubdate,
 		rating,
 		status,
@@ -61,10 +72,11 @@ func TestPostBook(t *testing.T) {
 		id := data["id"].(string)
 
 		// confirm record in repo
-		b, err := repo.GetBookByID(id)
+		b, err := repo.GetBookByID(ctx, id)
 		assert.NoError(t, err)
 		assert.Equal(t, title, b.Title)
 		assert.Equal(t, author, b.Author)
+		assert.Equal(t, publisher, b.Publisher)
 		assert.Equal(t, pubdate, b.PubDate.Format(dateFormat))
 		assert.Equal(t, rating, b.Rating)
 		assert.Equal(t, status, b.Status)
@@ -78,14 +90,30 @@ func TestPostBook(t *testing.T) {
 		rr := httptestPost("/book", json)
 		data := getJsonMapFromResponseBody(t, rr)
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
-		assert.NotEmpty(t, data["error"])
+		assertFieldError(t, data, "title", model.FieldRequired)
+	})
+
+	t.Run("post book with empty publisher, expect 400", func(t *testing.T) {
+		json := fmt.Sprintf(
+			bookJsonTemplate,
+			"no publisher",
+			author,
+			"",
+			pubdate,
+			rating,
+			status,
+		)
+		rr := httptestPost("/book", json)
+		data := getJsonMapFromResponseBody(t, rr)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assertFieldError(t, data, "publisher", model.FieldRequired)
 	})
 
 	t.Run("post with invalid json", func(t *testing.T) {
-		rr := httptestPost("/book", `{"title":"t","author":"a","pubdate":"2020-01-01","rating":1,"status":"CheckedIn",}`) // trailing comma is invalid
+		rr := httptestPost("/book", `{"title":"t","author":"a","publisher":"p","pubdate":"2020-01-01","rating":1,"status":"CheckedIn",}`) // trailing comma is invalid
 		data := getJsonMapFromResponseBody(t, rr)
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
-		assert.NotEmpty(t, data["error"])
+		assert.Equal(t, model.CodeInvalidBody, data["code"])
 	})
 
 	t.Run("post with invalid pubdate format", func(t *testing.T) {
@@ -93,6 +121,7 @@ func TestPostBook(t *testing.T) {
 			bookJsonTemplate,
 			"invalid pubdate",
 			author,
+			publisher,
 			"01/01/2020",
 			rating,
 			status,
@@ -100,18 +129,23 @@ func TestPostBook(t *testing.T) {
 		rr := httptestPost("/book", json)
 		data := getJsonMapFromResponseBody(t, rr)
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
-		assert.NotEmpty(t, data["error"])
+		assertFieldError(t, data, "pubdate", model.FieldInvalid)
 	})
 }
 
 func TestGetBook(t *testing.T) {
 	t.Run("sunny day", func(t *testing.T) {
 		b := makeBook("GET book")
-		repo.AddBook(b)
+		repo.AddBook(ctx, b)
 		rr := httptestGet("/book/" + b.ID)
 		data := getJsonMapFromResponseBody(t, rr)
 		assert.Equal(t, http.StatusOK, rr.Code)
 		assertDataMatchesBook(t, data, b)
+		assert.Equal(t, map[string]interface{}{
+			"total":     1.0,
+			"available": 1.0,
+			"summary":   "1 of 1 available",
+		}, data["copies"])
 	})
 
 	t.Run("book not found", func(t *testing.T) {
@@ -119,14 +153,247 @@ func TestGetBook(t *testing.T) {
 		rr := httptestGet("/book/" + b.ID)
 		data := getJsonMapFromResponseBody(t, rr)
 		assert.Equal(t, http.StatusNotFound, rr.Code)
-		assert.NotEmpty(t, data["error"])
+		assert.Equal(t, model.CodeNotFound, data["code"])
+	})
+}
+
+func TestContentNegotiation(t *testing.T) {
+	b := makeBook("negotiated book")
+	b.PubDate = time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	repo.AddBook(ctx, b)
+	get := func(uri, accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, uri, nil)
+		req.Header.Set("Accept", accept)
+		return execReq(req)
+	}
+
+	t.Run("json by default", func(t *testing.T) {
+		for _, accept := range []string{"", "*/*", "application/*", "application/json"} {
+			rr := get("/book/"+b.ID, accept)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"), accept)
+		}
+	})
+
+	t.Run("xml book", func(t *testing.T) {
+		rr := get("/book/"+b.ID, "application/xml")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/xml", rr.Header().Get("Content-Type"))
+		var m struct {
+			XMLName xml.Name `xml:"book"`
+			ID      string   `xml:"id"`
+			Title   string   `xml:"title"`
+			Rating  int      `xml:"rating"`
+			Copies  struct {
+				Total int `xml:"total"`
+			} `xml:"copies"`
+		}
+		assert.NoError(t, xml.Unmarshal(rr.Body.Bytes(), &m))
+		assert.Equal(t, b.ID, m.ID)
+		assert.Equal(t, b.Title, m.Title)
+		assert.Equal(t, 1, m.Rating)
+		assert.Equal(t, 1, m.Copies.Total)
+		assert.NotContains(t, rr.Body.String(), "<isbn>")
+	})
+
+	t.Run("csv book", func(t *testing.T) {
+		rr := get("/book/"+b.ID, "text/csv")
+		assert.Equal(t, "text/csv", rr.Header().Get("Content-Type"))
+		assert.Equal(t,
+			"id,isbn,title,author,publisher,pubdate,rating,status,copies.total,copies.available,copies.summary\n"+
+				b.ID+",,negotiated book,john smith,"+publisher+",2020-01-02,1,CheckedIn,1,1,1 of 1 available\n",
+			rr.Body.String())
+	})
+
+	t.Run("csv list has a row per item", func(t *testing.T) {
+		rr := get("/book?title=negotiated", "text/csv;q=0.9, application/xml;q=0.1")
+		assert.Equal(t, "text/csv", rr.Header().Get("Content-Type"))
+		lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+		if assert.Len(t, lines, 2) {
+			assert.True(t, strings.HasPrefix(lines[0], "id,isbn,title"))
+			assert.True(t, strings.HasPrefix(lines[1], b.ID+","))
+		}
+	})
+
+	t.Run("errors are negotiated too", func(t *testing.T) {
+		rr := get("/book/"+makeBook("not found").ID, "application/xml")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Equal(t, "application/problem+xml", rr.Header().Get("Content-Type"))
+		assert.Contains(t, rr.Body.String(), `<problem xmlns="urn:ietf:rfc:7807">`)
+		assert.Contains(t, rr.Body.String(), "<detail>bookId not found</detail>")
+	})
+
+	t.Run("unknown routes are negotiated too", func(t *testing.T) {
+		for _, uri := range []string{"/nowhere", "/book/" + b.ID + "/nowhere"} {
+			rr := get(uri, "application/xml")
+			assert.Equal(t, http.StatusNotFound, rr.Code, uri)
+			assert.Equal(t, "application/problem+xml", rr.Header().Get("Content-Type"), uri)
+		}
+	})
+
+	t.Run("routes with a fixed media type", func(t *testing.T) {
+		tt := []struct {
+			uri, accept, mediaType string
+		}{
+			{"/book/export?format=ndjson", "application/x-ndjson", "application/x-ndjson"},
+			{"/book/export?format=csv", "text/*, application/json;q=0.5", "text/csv; charset=utf-8"},
+			{"/book/export", "*/*", "application/json"},
+			{"/openapi.json", "application/vnd.oai.openapi+json", "application/vnd.oai.openapi+json"},
+			{"/openapi.json", "application/xml;q=0.5, application/json", "application/json"},
+		}
+		for _, tc := range tt {
+			rr := get(tc.uri, tc.accept)
+			assert.Equal(t, http.StatusOK, rr.Code, tc.uri)
+			assert.Equal(t, tc.mediaType, rr.Header().Get("Content-Type"), tc.uri)
+		}
+
+		for _, uri := range []string{"/book/export?format=json", "/book/export?format=ndjson", "/openapi.json"} {
+			rr := get(uri, "application/xml")
+			assert.Equal(t, http.StatusNotAcceptable, rr.Code, uri)
+			assert.Equal(t, model.CodeNotAcceptable, getJsonMapFromResponseBody(t, rr)["code"])
+		}
+	})
+
+	t.Run("unsupported type, expect 406", func(t *testing.T) {
+		rr := get("/book/"+b.ID, "image/png, application/json;q=0")
+		assert.Equal(t, http.StatusNotAcceptable, rr.Code)
+		assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+		assert.Equal(t, model.CodeNotAcceptable, getJsonMapFromResponseBody(t, rr)["code"])
+	})
+
+	t.Run("the status of created responses is kept", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/book", jsonReader(makeBookJson("negotiated created")))
+		req.Header.Set("Accept", "application/xml")
+		rr := execReq(req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, "application/xml", rr.Header().Get("Content-Type"))
+		assert.Contains(t, rr.Body.String(), "<title>negotiated created</title>")
+	})
+}
+
+func TestProblems(t *testing.T) {
+	b := makeBook("problem book")
+	repo.AddBook(ctx, b)
+
+	problem := func(rr *httptest.ResponseRecorder) jsonMap {
+		assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+		data := getJsonMapFromResponseBody(t, rr)
+		assert.Equal(t, float64(rr.Code), data["status"])
+		assert.Equal(t, "urn:books:problem:"+data["code"].(string), data["type"])
+		assert.NotEmpty(t, data["title"])
+		return data
+	}
+
+	t.Run("validation errors name the field", func(t *testing.T) {
+		rr := httptestPost("/book", fmt.Sprintf(bookJsonTemplate, "", author, publisher, pubdate, rating, status))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		data := problem(rr)
+		assertFieldError(t, data, "title", model.FieldRequired)
+		assert.Equal(t, book.ErrTitleIsRequired.Error(), data["detail"])
+
+		rr = httptestPost("/book", fmt.Sprintf(bookJsonTemplate, "bad rating", author, publisher, pubdate, 9, status))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assertFieldError(t, problem(rr), "rating", model.FieldInvalid)
+	})
+
+	t.Run("every invalid field is reported", func(t *testing.T) {
+		for uri, send := range map[string]func(string, string) *httptest.ResponseRecorder{
+			"/book":         httptestPost,
+			"/book/" + b.ID: httptestPut,
+		} {
+			rr := send(uri, `{"title":"","author":"a","publisher":"","pubdate":"01/02/2020","rating":9,"status":"CheckedIn"}`)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, uri)
+			data := problem(rr)
+			assert.Equal(t, model.CodeInvalidFields, data["code"], uri)
+
+			var fields []string
+			errs, _ := data["errors"].([]interface{})
+			for _, e := range errs {
+				fe, _ := e.(map[string]interface{})
+				fields = append(fields, fe["field"].(string)+" "+fe["code"].(string))
+			}
+			assert.Equal(t, []string{
+				"pubdate invalid", "title required", "publisher required", "rating invalid",
+			}, fields, uri)
+		}
+	})
+
+	t.Run("sentinel errors have their own code", func(t *testing.T) {
+		rr := httptestPut("/book/"+b.ID, `{"title":"problem book","author":"a","publisher":"p","pubdate":"2020-01-01","rating":1,"status":"CheckedOut"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assertFieldError(t, problem(rr), "status", model.FieldNotEditable)
+
+		req, _ := http.NewRequest(http.MethodDelete, "/book/"+b.ID, nil)
+		req.Header.Set("If-Match", `"999"`)
+		rr = execReq(req)
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+		assert.Equal(t, model.CodeVersionConflict, problem(rr)["code"])
+	})
+
+	t.Run("unknown routes and methods", func(t *testing.T) {
+		rr := httptestGet("/nowhere")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Equal(t, model.CodeNotFound, problem(rr)["code"])
+
+		rr = httptestPatch("/trash", `{}`)
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+		assert.Equal(t, model.CodeMethodNotAllowed, problem(rr)["code"])
+	})
+
+	t.Run("problem types are acceptable", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/book/"+makeBook("missing").ID, nil)
+		req.Header.Set("Accept", "application/problem+json")
+		rr := execReq(req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Equal(t, model.CodeNotFound, problem(rr)["code"])
+	})
+}
+
+func TestGetBookByISBN(t *testing.T) {
+	bookJson := strings.TrimSuffix(makeBookJson("ISBN book"), "}") + `,"isbn":"0-201-48567-2"}`
+
+	t.Run("isbn is stored as ISBN-13", func(t *testing.T) {
+		rr := httptestPost("/book", bookJson)
+		data := getJsonMapFromResponseBody(t, rr)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, "9780201485677", data["isbn"])
+	})
+
+	t.Run("isbn belongs to another book", func(t *testing.T) {
+		rr := httptestPost("/book", bookJson)
+		data := getJsonMapFromResponseBody(t, rr)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Equal(t, model.CodeISBNExists, data["code"])
+	})
+
+	t.Run("sunny day", func(t *testing.T) {
+		rr := httptestGet("/book/isbn/0-201-48567-2")
+		data := getJsonMapFromResponseBody(t, rr)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "ISBN book", data["title"])
+		assert.Equal(t, "9780201485677", data["isbn"])
+		assert.NotEmpty(t, data["copies"])
+	})
+
+	t.Run("invalid isbn", func(t *testing.T) {
+		rr := httptestGet("/book/isbn/0201485673")
+		data := getJsonMapFromResponseBody(t, rr)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assertFieldError(t, data, "isbn", model.FieldInvalid)
+	})
+
+	t.Run("isbn not found", func(t *testing.T) {
+		rr := httptestGet("/book/isbn/9780306406157")
+		data := getJsonMapFromResponseBody(t, rr)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Equal(t, model.CodeNotFound, data["code"])
 	})
 }
 
 func TestListBooks(t *testing.T) {
 	t.Run("expect empty set when no books exist", func(t *testing.T) {
 		// reset repo and server
-		repo = fake.NewBookRepo()
+		repo = memory.NewRepo()
 		server = rest.NewServer(repo, logger)
 
 		getResponse := httptestGet("/book")
@@ -144,8 +411,8 @@ func TestListBooks(t *testing.T) {
 		// create two books in repo
 		b1 := makeBook("list book 1")
 		b2 := makeBook("list book 2")
-		repo.AddBook(b1)
-		repo.AddBook(b2)
+		repo.AddBook(ctx, b1)
+		repo.AddBook(ctx, b2)
 
 		// list via API
 		getResponse := httptestGet("/book")
@@ -174,6 +441,138 @@ func TestListBooks(t *testing.T) {
 	})
 }
 
+func TestListBooksQuery(t *testing.T) {
+	// reset repo and server
+	repo = memory.NewRepo()
+	server = rest.NewServer(repo, logger)
+
+	a := book.NewBook("Alpha", "ann", publisher, time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), book.RateOne, book.StatusCheckedIn)
+	b := book.NewBook("Beta", "bob", publisher, time.Date(2002, 1, 1, 0, 0, 0, 0, time.UTC), book.RateTwo, book.StatusCheckedOut)
+	c := book.NewBook("Gamma", "ann", publisher, time.Date(2003, 1, 1, 0, 0, 0, 0, time.UTC), book.RateThree, book.StatusCheckedIn)
+	for _, bk := range []book.Book{a, b, c} {
+		repo.AddBook(ctx, bk)
+	}
+
+	type bookList struct {
+		Items []map[string]interface{} `json:"items"`
+		Next  string                   `json:"next"`
+	}
+	getList := func(t *testing.T, uri string) bookList {
+		t.Helper()
+		rr := httptestGet(uri)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var list bookList
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+		return list
+	}
+	titles := func(list bookList) []interface{} {
+		out := make([]interface{}, len(list.Items))
+		for i, item := range list.Items {
+			out[i] = item["title"]
+		}
+		return out
+	}
+
+	t.Run("filter by author and status", func(t *testing.T) {
+		list := getList(t, "/book?author=ann&status=CheckedIn")
+		assert.Equal(t, []interface{}{"Alpha", "Gamma"}, titles(list))
+	})
+
+	t.Run("filter by rating, title and pubdate", func(t *testing.T) {
+		list := getList(t, "/book?rating=2&title=et&pubdate_from=2002-01-01&pubdate_to=2002-12-31")
+		assert.Equal(t, []interface{}{"Beta"}, titles(list))
+	})
+
+	t.Run("sort descending", func(t *testing.T) {
+		list := getList(t, "/book?sort=-pubdate")
+		assert.Equal(t, []interface{}{"Gamma", "Beta", "Alpha"}, titles(list))
+	})
+
+	t.Run("paginate using next", func(t *testing.T) {
+		list := getList(t, "/book?sort=title&limit=2")
+		assert.Equal(t, []interface{}{"Alpha", "Beta"}, titles(list))
+		assert.NotEmpty(t, list.Next)
+
+		list = getList(t, "/book?sort=title&limit=2&cursor="+list.Next)
+		assert.Equal(t, []interface{}{"Gamma"}, titles(list))
+		assert.Empty(t, list.Next)
+	})
+
+	t.Run("invalid params, expect 400", func(t *testing.T) {
+		for _, query := range []string{
+			"rating=A",
+			"pubdate_from=01/01/2020",
+			"sort=color",
+			"limit=0",
+			"limit=100000",
+			"cursor=garbage",
+		} {
+			rr := httptestGet("/book?" + query)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+			data := getJsonMapFromResponseBody(t, rr)
+			assert.Equal(t, model.CodeInvalidFields, data["code"], query)
+		}
+	})
+}
+
+// GET /book/search?q={query}
+func TestSearchBooks(t *testing.T) {
+	a := book.NewBook("Refactoring", "Martin Fowler", "Addison-Wesley", time.Now(), rating, status)
+	b := book.NewBook("Domain Driven Design", "Eric Evans", "Addison-Wesley", time.Now(), rating, status)
+	repo.AddBook(ctx, a)
+	repo.AddBook(ctx, b)
+
+	type results struct {
+		Items []map[string]interface{} `json:"items"`
+	}
+
+	t.Run("missing query, expect 400", func(t *testing.T) {
+		rr := httptestGet("/book/search")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		data := getJsonMapFromResponseBody(t, rr)
+		assertFieldError(t, data, "q", model.FieldRequired)
+	})
+
+	t.Run("invalid limit, expect 400", func(t *testing.T) {
+		rr := httptestGet("/book/search?q=fowler&limit=none")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		rr := httptestGet("/book/search?q=zzyzx")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var res results
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+		assert.Len(t, res.Items, 0)
+	})
+
+	t.Run("match with score and highlights", func(t *testing.T) {
+		rr := httptestGet("/book/search?q=fowler")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var res results
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+		assert.Len(t, res.Items, 1)
+		assertDataMatchesBook(t, res.Items[0], a)
+		assert.Greater(t, res.Items[0]["score"], float64(0))
+		assert.Equal(t,
+			map[string]interface{}{"author": "Martin <b>Fowler</b>"},
+			res.Items[0]["highlights"],
+		)
+	})
+
+	t.Run("title matches rank first", func(t *testing.T) {
+		rr := httptestGet("/book/search?q=design")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var res results
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+		if assert.NotEmpty(t, res.Items) {
+			assert.Equal(t, b.ID, res.Items[0]["id"])
+		}
+	})
+}
+
 func TestDeleteBook(t *testing.T) {
 	b := makeBook("del book")
 
@@ -183,48 +582,392 @@ func TestDeleteBook(t *testing.T) {
 	// a lot of conflicting answers on this one, I'm going to chose no
 	// for now because I can't think of a reason why the client should care
 	t.Run("unknown book, expect 204", func(t *testing.T) {
-		rr := httptestDelete("/book/" + b.ID)
+		req, _ := http.NewRequest(http.MethodDelete, "/book/"+b.ID, nil)
+		rr := execReq(req)
 		assert.Equal(t, http.StatusNoContent, rr.Code)
 	})
 
+	// unless only a version of it was to be deleted
+	t.Run("unknown book with if-match, expect 412", func(t *testing.T) {
+		for _, tag := range []string{`"3"`, "*"} {
+			req, _ := http.NewRequest(http.MethodDelete, "/book/"+b.ID, nil)
+			req.Header.Set("If-Match", tag)
+			rr := execReq(req)
+			assert.Equal(t, http.StatusPreconditionFailed, rr.Code, tag)
+			assert.Equal(t, model.CodeVersionConflict, getJsonMapFromResponseBody(t, rr)["code"])
+		}
+	})
+
 	t.Run("delete existing book, expect 204", func(t *testing.T) {
-		repo.AddBook(b)
+		repo.AddBook(ctx, b)
 
 		rr := httptestDelete("/book/" + b.ID)
 		assert.Equal(t, http.StatusNoContent, rr.Code)
 
 		// record should not be retrievable by repo anymore
-		_, err := repo.GetBookByID(b.ID)
+		_, err := repo.GetBookByID(ctx, b.ID)
 		assert.Error(t, err)
 	})
+
+	t.Run("book with a copy checked out, expect 409", func(t *testing.T) {
+		b := makeBook("del checked out book")
+		repo.AddBook(ctx, b)
+		p := patron.NewPatron("Jane Doe", "jane@example.com")
+		repo.AddPatron(ctx, p)
+		rr := httptestPost("/book/"+b.ID+"/checkout", `{"patron_id":"`+p.ID+`"}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		rr = httptestDelete("/book/" + b.ID)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Equal(t, model.CodeCopyInUse, getJsonMapFromResponseBody(t, rr)["code"])
+		_, err := repo.GetBookByID(ctx, b.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("book which could not be read, expect 500", func(t *testing.T) {
+		server := rest.NewServer(brokenRepo{repo}, logger)
+		req, _ := http.NewRequest(http.MethodDelete, "/book/"+b.ID, nil)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
 }
 
-// PUT /book/{bookID}/status/{status}
-func TestPutStatus(t *testing.T) {
-	b := makeBook("put status book")
+// brokenRepo fails to read books, as a repo does when its db is down
+type brokenRepo struct {
+	usecase.LibraryRepo
+}
 
-	t.Run("update book that does not exist", func(t *testing.T) {
-		status := book.StatusCheckedOut
-		rr := httptestPut("/book/"+b.ID+"/status/"+status.String(), "")
+func (brokenRepo) GetBookByID(context.Context, string) (book.Book, error) {
+	return book.Book{}, errors.New("db is down")
+}
+
+// GET /trash and POST /trash/{bookID}/restore
+func TestTrash(t *testing.T) {
+	repo := memory.NewRepo()
+	server := rest.NewServer(repo, logger, rest.WithTrashRetention(48*time.Hour))
+	serve := func(method, uri string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, uri, nil)
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		return rr
+	}
+
+	b := makeBook("trash book")
+	repo.AddBook(ctx, b)
+
+	t.Run("restore a book which is not in the trash, expect 404", func(t *testing.T) {
+		rr := serve(http.MethodPost, "/trash/"+b.ID+"/restore")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("deleted book is listed in the trash", func(t *testing.T) {
+		rr := serve(http.MethodDelete, "/book/"+b.ID)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		rr = serve(http.MethodGet, "/book/"+b.ID)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		rr = serve(http.MethodGet, "/trash")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var list model.TrashList
+		json.NewDecoder(rr.Body).Decode(&list)
+		if assert.Len(t, list.Items, 1) {
+			item := list.Items[0]
+			assert.Equal(t, b.ID, item.ID)
+			assert.Equal(t, b.Title, item.Title)
+			deletedAt, err := time.Parse(time.RFC3339, item.DeletedAt)
+			assert.NoError(t, err)
+			purgeAt, err := time.Parse(time.RFC3339, item.PurgeAt)
+			assert.NoError(t, err)
+			assert.Equal(t, 48*time.Hour, purgeAt.Sub(deletedAt))
+		}
+	})
+
+	t.Run("restore a book, expect 200", func(t *testing.T) {
+		rr := serve(http.MethodPost, "/trash/"+b.ID+"/restore")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `"3"`, rr.Header().Get("ETag"))
+		assertDataMatchesBook(t, getJsonMapFromResponseBody(t, rr), b)
+
+		rr = serve(http.MethodGet, "/book/"+b.ID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = serve(http.MethodGet, "/trash")
+		assert.JSONEq(t, `{"items":[]}`, rr.Body.String())
+	})
+
+	t.Run("restore a book whose isbn was taken, expect 409", func(t *testing.T) {
+		a, other := makeBook("trash isbn book"), makeBook("other isbn book")
+		a.ISBN = "9780131103627"
+		repo.AddBook(ctx, a)
+		serve(http.MethodDelete, "/book/"+a.ID)
+		other.ISBN = a.ISBN
+		repo.AddBook(ctx, other)
+
+		rr := serve(http.MethodPost, "/trash/"+a.ID+"/restore")
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+}
+
+// POST /book/import
+func TestImportBooks(t *testing.T) {
+	repo := memory.NewRepo()
+	server := rest.NewServer(repo, logger)
+	importBooks := func(contentType, query, body string) (int, model.ImportReport) {
+		req, _ := http.NewRequest(http.MethodPost, "/book/import"+query, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		var report model.ImportReport
+		json.Unmarshal(rr.Body.Bytes(), &report)
+		return rr.Code, report
+	}
+
+	csvBody := "title,author,publisher,pubdate,rating,status,isbn\n" +
+		"Refactoring,Martin Fowler,Addison-Wesley,1999-07-08,3,CheckedIn,0-201-48567-2\n" +
+		"No Author,,acme publishing,2020-01-01,1,CheckedIn,\n" +
+		"Bad Rating,john smith,acme publishing,2020-01-01,three,CheckedIn,\n" +
+		"Refactoring Again,Martin Fowler,Addison-Wesley,2018-11-19,3,CheckedIn,9780201485677\n"
+
+	t.Run("unsupported content type, expect 415", func(t *testing.T) {
+		code, _ := importBooks("application/json", "", "[]")
+		assert.Equal(t, http.StatusUnsupportedMediaType, code)
+	})
+
+	t.Run("csv without the required columns, expect 400", func(t *testing.T) {
+		code, _ := importBooks("text/csv", "", "title,author\nRefactoring,Martin Fowler\n")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("csv dry run", func(t *testing.T) {
+		code, report := importBooks("text/csv", "?dry_run=true", csvBody)
+		assert.Equal(t, http.StatusOK, code)
+		assert.True(t, report.DryRun)
+		assert.Equal(t, 0, report.Created)
+		assert.Equal(t, 1, report.Duplicates)
+		assert.Equal(t, 2, report.Failed)
+		if assert.Len(t, report.Rows, 4) {
+			assert.Equal(t, 2, report.Rows[0].Row)
+			assert.Equal(t, "valid", report.Rows[0].Status)
+			assert.Equal(t, "failed", report.Rows[1].Status)
+			assert.Equal(t, book.ErrAuthorIsRequired.Error(), report.Rows[1].Error)
+			assert.Equal(t, "rating must be an int", report.Rows[2].Error)
+			assert.Equal(t, "duplicate", report.Rows[3].Status)
+		}
+	})
+
+	t.Run("csv all or nothing", func(t *testing.T) {
+		_, report := importBooks("text/csv", "", csvBody)
+		assert.Equal(t, 0, report.Created)
+		_, err := repo.GetBookByISBN(ctx, "9780201485677")
+		assert.Error(t, err)
+	})
+
+	t.Run("csv best effort", func(t *testing.T) {
+		code, report := importBooks("text/csv", "?best_effort=true", csvBody)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 1, report.Created)
+		if assert.Len(t, report.Rows, 4) {
+			assert.Equal(t, "created", report.Rows[0].Status)
+			b, err := repo.GetBookByISBN(ctx, "9780201485677")
+			assert.NoError(t, err)
+			assert.Equal(t, b.ID, report.Rows[0].BookID)
+		}
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		body := makeBookJson("ndjson book A") + "\n\n" +
+			"not json\n" +
+			`{"title":"ndjson book B","author":"john smith","publisher":"acme","pubdate":"2020-01-01","rating":2,"status":"CheckedIn","isbn":"0-201-48567-2"}` + "\n"
+		code, report := importBooks("application/x-ndjson", "?best_effort=1", body)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 1, report.Created)
+		assert.Equal(t, 1, report.Duplicates)
+		assert.Equal(t, 1, report.Failed)
+		if assert.Len(t, report.Rows, 3) {
+			assert.Equal(t, 1, report.Rows[0].Row)
+			assert.Equal(t, 3, report.Rows[1].Row)
+			assert.Equal(t, 4, report.Rows[2].Row)
+		}
+	})
+}
+
+// GET /book/export
+func TestExportBooks(t *testing.T) {
+	repo := memory.NewRepo()
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	server := rest.NewServer(repo, logger, rest.WithClock(func() time.Time { return now }))
+	export := func(query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, "/book/export"+query, nil)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		return rr
+	}
+
+	a, b, c := makeBook("export A"), makeBook("export B"), makeBook("export C")
+	a.ISBN = "9780201485677"
+	c.Author = "Jane Doe"
+	for _, x := range []book.Book{a, b, c} {
+		repo.AddBook(ctx, x)
+	}
+
+	t.Run("unknown format, expect 400", func(t *testing.T) {
+		rr := export("?format=xml")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("invalid sort, expect 400", func(t *testing.T) {
+		rr := export("?sort=color")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("json with the list filters", func(t *testing.T) {
+		rr := export("?author=john%20smith&sort=-title")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="books-2021-03-04.json"`, rr.Header().Get("Content-Disposition"))
+		var list model.BookList
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+		if assert.Len(t, list.Items, 2) {
+			assert.Equal(t, b.ID, list.Items[0].ID)
+			assert.Equal(t, a.ID, list.Items[1].ID)
+		}
+	})
+
+	t.Run("empty json", func(t *testing.T) {
+		rr := export("?author=nobody")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"items":[]}`, rr.Body.String())
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		rr := export("?format=ndjson")
+		assert.Equal(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+		lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+		if assert.Len(t, lines, 3) {
+			var m model.BookModel
+			assert.NoError(t, json.Unmarshal([]byte(lines[0]), &m))
+			assert.Equal(t, a.ID, m.ID)
+			assert.Equal(t, a.ISBN, m.ISBN)
+		}
+	})
+
+	t.Run("csv can be imported", func(t *testing.T) {
+		rr := export("?format=csv&author=jane%20doe")
+		assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="books-2021-03-04.csv"`, rr.Header().Get("Content-Disposition"))
+		assert.Equal(t,
+			"id,isbn,title,author,publisher,pubdate,rating,status\n"+
+				c.ID+",,export C,Jane Doe,"+publisher+","+c.PubDate.Format(dateFormat)+",1,CheckedIn\n",
+			rr.Body.String())
+
+		req, _ := http.NewRequest(http.MethodPost, "/book/import?dry_run=true", rr.Body)
+		req.Header.Set("Content-Type", "text/csv")
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		var report model.ImportReport
+		json.Unmarshal(rr.Body.Bytes(), &report)
+		if assert.Len(t, report.Rows, 1) {
+			assert.Equal(t, "valid", report.Rows[0].Status)
+		}
+	})
+
+	t.Run("failure part way through aborts the response", func(t *testing.T) {
+		server := rest.NewServer(cutShortRepo{repo, 2}, logger)
+		req, _ := http.NewRequest(http.MethodGet, "/book/export?format=ndjson", nil)
+		rr := httptest.NewRecorder()
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() { server.ServeHTTP(rr, req) })
+		assert.Len(t, strings.Split(strings.TrimSpace(rr.Body.String()), "\n"), 2)
+
+		ts := httptest.NewServer(server)
+		defer ts.Close()
+		res, err := http.Get(ts.URL + "/book/export")
+		if err == nil {
+			_, err = ioutil.ReadAll(res.Body)
+			res.Body.Close()
+		}
+		assert.Error(t, err)
+	})
+}
+
+// cutShortRepo fails an export after n books, as a repo does when its db
+// goes down part way through
+type cutShortRepo struct {
+	usecase.LibraryRepo
+	n int
+}
+
+func (r cutShortRepo) ExportBooks(ctx context.Context, q usecase.BookQuery, fn func(book.Book) error) error {
+	var count int
+	return r.LibraryRepo.ExportBooks(ctx, q, func(b book.Book) error {
+		if count == r.n {
+			return errors.New("db is down")
+		}
+		count++
+		return fn(b)
+	})
+}
+
+// PUT /book/{bookID}
+func TestPutBook(t *testing.T) {
+	b := makeBook("put book")
+
+	t.Run("replace book that does not exist", func(t *testing.T) {
+		rr := httptestPut("/book/"+b.ID, makeBookJson("put book"))
 		assert.Equal(t, http.StatusNotFound, rr.Code)
 	})
 
-	repo.AddBook(b)
+	repo.AddBook(ctx, b)
+
+	t.Run("replace with missing title should fail", func(t *testing.T) {
+		rr := httptestPut("/book/"+b.ID, makeBookJson(""))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		b2, _ := repo.GetBookByID(ctx, b.ID)
+		assert.Equal(t, b.Title, b2.Title) // ensure it hasn't changed
+	})
+
+	t.Run("replace with invalid json should fail", func(t *testing.T) {
+		rr := httptestPut("/book/"+b.ID, `{"title":"t",}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
 
-	t.Run("update status with invalid value", func(t *testing.T) {
-		status := "not-a-valid-status"
-		rr := httptestPut("/book/"+b.ID+"/status/"+status, "")
+	t.Run("status can not be replaced", func(t *testing.T) {
+		json := fmt.Sprintf(
+			bookJsonTemplate,
+			b.Title,
+			b.Author,
+			b.Publisher,
+			b.PubDate.Format(dateFormat),
+			b.Rating,
+			book.StatusCheckedOut,
+		)
+		rr := httptestPut("/book/"+b.ID, json)
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
-		b2, _ := repo.GetBookByID(b.ID)
+		b2, _ := repo.GetBookByID(ctx, b.ID)
 		assert.Equal(t, b.Status, b2.Status) // ensure it hasn't changed
 	})
 
-	t.Run("change status", func(t *testing.T) {
-		status := book.StatusCheckedOut
-		rr := httptestPut("/book/"+b.ID+"/status/"+status.String(), "")
+	t.Run("replace book", func(t *testing.T) {
+		json := fmt.Sprintf(
+			bookJsonTemplate,
+			"put book fixed",
+			"jane doe",
+			"other publishing",
+			"2019-02-03",
+			book.RateThree,
+			book.StatusCheckedIn,
+		)
+		rr := httptestPut("/book/"+b.ID, json)
 		assert.Equal(t, http.StatusOK, rr.Code)
-		b2, _ := repo.GetBookByID(b.ID)
-		assert.Equal(t, status, b2.Status) // ensure is updated
+
+		b2, _ := repo.GetBookByID(ctx, b.ID)
+		assert.Equal(t, "put book fixed", b2.Title)
+		assert.Equal(t, "jane doe", b2.Author)
+		assert.Equal(t, "other publishing", b2.Publisher)
+		assert.Equal(t, "2019-02-03", b2.PubDate.Format(dateFormat))
+		assert.Equal(t, book.RateThree, b2.Rating)
+		assert.Equal(t, book.StatusCheckedIn, b2.Status)
 
 		// check response data structure
 		data := getJsonMapFromResponseBody(t, rr)
@@ -232,6 +975,576 @@ func TestPutStatus(t *testing.T) {
 	})
 }
 
+// PATCH /book/{bookID}
+func TestPatchBook(t *testing.T) {
+	b := makeBook("patch book")
+
+	t.Run("patch book that does not exist", func(t *testing.T) {
+		rr := httptestPatch("/book/"+b.ID, `{"title":"patched"}`)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	repo.AddBook(ctx, b)
+
+	t.Run("patch with invalid json should fail", func(t *testing.T) {
+		rr := httptestPatch("/book/"+b.ID, `{"title":"patched",}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("removing a required field should fail", func(t *testing.T) {
+		rr := httptestPatch("/book/"+b.ID, `{"author":null}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		b2, _ := repo.GetBookByID(ctx, b.ID)
+		assert.Equal(t, b.Author, b2.Author) // ensure it hasn't changed
+	})
+
+	t.Run("patch with invalid rating should fail", func(t *testing.T) {
+		rr := httptestPatch("/book/"+b.ID, `{"rating":42}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		b2, _ := repo.GetBookByID(ctx, b.ID)
+		assert.Equal(t, b.Rating, b2.Rating) // ensure it hasn't changed
+	})
+
+	t.Run("patch title only", func(t *testing.T) {
+		rr := httptestPatch("/book/"+b.ID, `{"title":"patch book fixed"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		b2, _ := repo.GetBookByID(ctx, b.ID)
+		assert.Equal(t, "patch book fixed", b2.Title)
+		assert.Equal(t, b.Author, b2.Author)
+		assert.Equal(t, b.Publisher, b2.Publisher)
+		assert.Equal(t, b.PubDate.Format(dateFormat), b2.PubDate.Format(dateFormat))
+		assert.Equal(t, b.Rating, b2.Rating)
+		assert.Equal(t, b.Status, b2.Status)
+
+		// check response data structure
+		data := getJsonMapFromResponseBody(t, rr)
+		assertDataMatchesBook(t, data, b2)
+	})
+
+	t.Run("id in patch is ignored", func(t *testing.T) {
+		rr := httptestPatch("/book/"+b.ID, `{"id":"some-other-id"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		data := getJsonMapFromResponseBody(t, rr)
+		assert.Equal(t, b.ID, data["id"])
+	})
+}
+
+// ETag, If-Match and If-None-Match on /book/{bookID}
+func TestConditionalRequests(t *testing.T) {
+	b := makeBook("conditional book")
+	repo.AddBook(ctx, b)
+	uri := "/book/" + b.ID
+
+	conditional := func(method, header, etag, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, uri, jsonReader(body))
+		req.Header.Set(header, etag)
+		return execReq(req)
+	}
+
+	rr := httptestGet(uri)
+	etag := rr.Header().Get("ETag")
+	assert.Equal(t, `"1"`, etag)
+
+	t.Run("if-none-match current etag is not modified", func(t *testing.T) {
+		rr := conditional(http.MethodGet, "If-None-Match", etag, "")
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+		assert.Equal(t, etag, rr.Header().Get("ETag"))
+		assert.Empty(t, rr.Body.String())
+	})
+
+	t.Run("if-none-match old etag gets the book", func(t *testing.T) {
+		rr := conditional(http.MethodGet, "If-None-Match", `"0"`, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assertDataMatchesBook(t, getJsonMapFromResponseBody(t, rr), b)
+	})
+
+	t.Run("patch with current etag", func(t *testing.T) {
+		rr := conditional(http.MethodPatch, "If-Match", etag, `{"title":"conditional book fixed"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotEqual(t, etag, rr.Header().Get("ETag"))
+		assert.Equal(t, rr.Header().Get("ETag"), httptestGet(uri).Header().Get("ETag"))
+	})
+
+	t.Run("put with old etag", func(t *testing.T) {
+		rr := conditional(http.MethodPut, "If-Match", etag, makeBookJson("lost update"))
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+		b2, _ := repo.GetBookByID(ctx, b.ID)
+		assert.Equal(t, "conditional book fixed", b2.Title)
+	})
+
+	t.Run("patch with old etag", func(t *testing.T) {
+		rr := conditional(http.MethodPatch, "If-Match", etag, `{"title":"lost update"}`)
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+	})
+
+	t.Run("delete with old etag", func(t *testing.T) {
+		rr := conditional(http.MethodDelete, "If-Match", etag, "")
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+		_, err := repo.GetBookByID(ctx, b.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("changes without if-match", func(t *testing.T) {
+		for _, method := range []string{http.MethodPut, http.MethodPatch, http.MethodDelete} {
+			req, _ := http.NewRequest(method, uri, jsonReader(`{"title":"lost update"}`))
+			rr := execReq(req)
+			assert.Equal(t, http.StatusPreconditionRequired, rr.Code, method)
+			assert.Equal(t, model.CodeIfMatchRequired, getJsonMapFromResponseBody(t, rr)["code"])
+		}
+		b2, err := repo.GetBookByID(ctx, b.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "conditional book fixed", b2.Title)
+	})
+
+	t.Run("delete with any etag", func(t *testing.T) {
+		rr := conditional(http.MethodDelete, "If-Match", "*", "")
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		_, err := repo.GetBookByID(ctx, b.ID)
+		assert.Error(t, err)
+	})
+
+	t.Run("any etag matches a book changed since it was read", func(t *testing.T) {
+		b := makeBook("raced book")
+		repo.AddBook(ctx, b)
+		server := rest.NewServer(racingRepo{repo}, logger)
+		serve := func(method, body string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(method, "/book/"+b.ID, jsonReader(body))
+			req.Header.Set("If-Match", "*")
+			rr := httptest.NewRecorder()
+			server.ServeHTTP(rr, req)
+			return rr
+		}
+
+		rr := serve(http.MethodPut, makeBookJson("raced book fixed"))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = serve(http.MethodDelete, "")
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		_, err := repo.GetBookByID(ctx, b.ID)
+		assert.Error(t, err)
+	})
+}
+
+// racingRepo changes a book each time it is read, as another client does
+// between a handler reading a book and changing it
+type racingRepo struct {
+	usecase.LibraryRepo
+}
+
+func (r racingRepo) GetBookByID(ctx context.Context, id string) (book.Book, error) {
+	b, err := r.LibraryRepo.GetBookByID(ctx, id)
+	if err != nil {
+		return b, err
+	}
+	return b, r.LibraryRepo.UpdateBook(ctx, b)
+}
+
+// POST /patron
+func TestPostPatron(t *testing.T) {
+	t.Run("expect 201 and patron stored in repo", func(t *testing.T) {
+		rr := httptestPost("/patron", `{"name":"Jane Doe","email":"jane@example.com"}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		data := getJsonMapFromResponseBody(t, rr)
+		assert.NotEmpty(t, data["id"])
+
+		p, err := repo.GetPatronByID(ctx, data["id"].(string))
+		assert.NoError(t, err)
+		assert.Equal(t, "Jane Doe", p.Name)
+		assert.Equal(t, "jane@example.com", p.Email)
+		assert.Equal(t, p.Name, data["name"])
+		assert.Equal(t, p.Email, data["email"])
+	})
+
+	t.Run("invalid email, expect 400", func(t *testing.T) {
+		rr := httptestPost("/patron", `{"name":"Jane Doe","email":"jane"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		data := getJsonMapFromResponseBody(t, rr)
+		assertFieldError(t, data, "email", model.FieldInvalid)
+	})
+
+	t.Run("invalid json, expect 400", func(t *testing.T) {
+		rr := httptestPost("/patron", `{"name":"Jane Doe",}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+// GET /patron/{patronID}
+func TestGetPatron(t *testing.T) {
+	p := patron.NewPatron("John Smith", "john@example.com")
+
+	t.Run("patron not found", func(t *testing.T) {
+		rr := httptestGet("/patron/" + p.ID)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("sunny day", func(t *testing.T) {
+		repo.AddPatron(ctx, p)
+		rr := httptestGet("/patron/" + p.ID)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		data := getJsonMapFromResponseBody(t, rr)
+		assert.Equal(t, p.ID, data["id"])
+		assert.Equal(t, p.Name, data["name"])
+		assert.Equal(t, p.Email, data["email"])
+	})
+}
+
+// POST /book/{bookID}/checkout and /book/{bookID}/checkin
+func TestCheckOutAndIn(t *testing.T) {
+	b := makeBook("checkout book")
+	p := patron.NewPatron("Jane Doe", "jane@example.com")
+	repo.AddPatron(ctx, p)
+	dueDate := time.Now().AddDate(0, 0, 14).Format(dateFormat)
+	checkOutJson := fmt.Sprintf(`{"patron_id":"%v","due_date":"%v"}`, p.ID, dueDate)
+
+	t.Run("check out book that does not exist", func(t *testing.T) {
+		rr := httptestPost("/book/"+b.ID+"/checkout", checkOutJson)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("check in book that does not exist", func(t *testing.T) {
+		rr := httptestPost("/book/"+b.ID+"/checkin", "")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	repo.AddBook(ctx, b)
+
+	t.Run("check in book that is not checked out", func(t *testing.T) {
+		rr := httptestPost("/book/"+b.ID+"/checkin", "")
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("check out to unknown patron", func(t *testing.T) {
+		unknown := patron.NewPatron("Nobody", "nobody@example.com")
+		rr := httptestPost("/book/"+b.ID+"/checkout",
+			fmt.Sprintf(`{"patron_id":"%v","due_date":"%v"}`, unknown.ID, dueDate))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("check out with invalid due date", func(t *testing.T) {
+		for _, due := range []string{"01/01/2020", "2001-01-01"} {
+			rr := httptestPost("/book/"+b.ID+"/checkout",
+				fmt.Sprintf(`{"patron_id":"%v","due_date":"%v"}`, p.ID, due))
+			assert.Equal(t, http.StatusBadRequest, rr.Code, due)
+		}
+		b2, _ := repo.GetBookByID(ctx, b.ID)
+		assert.Equal(t, book.StatusCheckedIn, b2.Status) // ensure it hasn't changed
+	})
+
+	t.Run("check out", func(t *testing.T) {
+		rr := httptestPost("/book/"+b.ID+"/checkout", checkOutJson)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		data := getJsonMapFromResponseBody(t, rr)
+		assert.NotEmpty(t, data["id"])
+		assert.Equal(t, b.ID, data["book_id"])
+		assert.Equal(t, p.ID, data["patron_id"])
+		assert.Equal(t, dueDate, data["due_date"])
+		assert.NotEmpty(t, data["checked_out_at"])
+		assert.Nil(t, data["returned_at"])
+
+		b2, _ := repo.GetBookByID(ctx, b.ID)
+		assert.Equal(t, book.StatusCheckedOut, b2.Status)
+	})
+
+	t.Run("check out a checked out book", func(t *testing.T) {
+		rr := httptestPost("/book/"+b.ID+"/checkout", checkOutJson)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("check in", func(t *testing.T) {
+		rr := httptestPost("/book/"+b.ID+"/checkin", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		data := getJsonMapFromResponseBody(t, rr)
+		assert.Equal(t, b.ID, data["book_id"])
+		assert.Equal(t, p.ID, data["patron_id"])
+		assert.NotEmpty(t, data["returned_at"])
+
+		b2, _ := repo.GetBookByID(ctx, b.ID)
+		assert.Equal(t, book.StatusCheckedIn, b2.Status)
+	})
+}
+
+// POST /book/{bookID}/copies, GET /book/{bookID}/copies, DELETE /book/{bookID}/copies/{copyID}
+func TestCopies(t *testing.T) {
+	b := makeBook("copies book")
+	jane := patron.NewPatron("Jane Doe", "jane@example.com")
+	john := patron.NewPatron("John Doe", "john@example.com")
+	repo.AddPatron(ctx, jane)
+	repo.AddPatron(ctx, john)
+	barcode := "31234000000010"
+	copyJson := fmt.Sprintf(`{"barcode":"%v","condition":"New"}`, barcode)
+	listCopies := func(t *testing.T) model.CopyList {
+		t.Helper()
+		rr := httptestGet("/book/" + b.ID + "/copies")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var list model.CopyList
+		json.NewDecoder(rr.Body).Decode(&list)
+		return list
+	}
+	copies := func(t *testing.T) jsonMap {
+		t.Helper()
+		rr := httptestGet("/book/" + b.ID)
+		return jsonMap(getJsonMapFromResponseBody(t, rr)["copies"].(map[string]interface{}))
+	}
+
+	t.Run("copies of book that does not exist", func(t *testing.T) {
+		rr := httptestPost("/book/"+b.ID+"/copies", copyJson)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		rr = httptestGet("/book/" + b.ID + "/copies")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	repo.AddBook(ctx, b)
+
+	t.Run("add copy with invalid fields", func(t *testing.T) {
+		for _, body := range []string{`{"condition":"New"}`, `{"barcode":"123","condition":"Shiny"}`} {
+			rr := httptestPost("/book/"+b.ID+"/copies", body)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+		}
+	})
+
+	var copyID string
+	t.Run("add copy", func(t *testing.T) {
+		rr := httptestPost("/book/"+b.ID+"/copies", copyJson)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		data := getJsonMapFromResponseBody(t, rr)
+		assert.NotEmpty(t, data["id"])
+		assert.Equal(t, b.ID, data["book_id"])
+		assert.Equal(t, barcode, data["barcode"])
+		assert.Equal(t, "CheckedIn", data["status"])
+		assert.Equal(t, "New", data["condition"])
+		copyID = data["id"].(string)
+
+		assert.Len(t, listCopies(t).Items, 2)
+		assert.Equal(t, "2 of 2 available", copies(t)["summary"])
+	})
+
+	t.Run("add copy with a barcode in use", func(t *testing.T) {
+		rr := httptestPost("/book/"+b.ID+"/copies", copyJson)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("check out each copy", func(t *testing.T) {
+		for _, p := range []patron.Patron{jane, john} {
+			rr := httptestPost("/book/"+b.ID+"/checkout", fmt.Sprintf(`{"patron_id":"%v"}`, p.ID))
+			assert.Equal(t, http.StatusCreated, rr.Code)
+			assert.NotEmpty(t, getJsonMapFromResponseBody(t, rr)["copy_id"])
+		}
+		assert.Equal(t, "0 of 2 available", copies(t)["summary"])
+	})
+
+	t.Run("remove copy that is checked out", func(t *testing.T) {
+		rr := httptestDelete("/book/" + b.ID + "/copies/" + copyID)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("check in needs a barcode when several copies are out", func(t *testing.T) {
+		rr := httptestPost("/book/"+b.ID+"/checkin", "")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = httptestPost("/book/"+b.ID+"/checkin", `{"barcode":"unknown"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("check in by barcode", func(t *testing.T) {
+		rr := httptestPost("/book/"+b.ID+"/checkin", fmt.Sprintf(`{"barcode":"%v"}`, barcode))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, copyID, getJsonMapFromResponseBody(t, rr)["copy_id"])
+		assert.Equal(t, "1 of 2 available", copies(t)["summary"])
+
+		rr = httptestPost("/book/"+b.ID+"/checkin", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("remove copy", func(t *testing.T) {
+		rr := httptestDelete("/book/" + b.ID + "/copies/" + copyID)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Len(t, listCopies(t).Items, 1)
+	})
+
+	t.Run("remove the last copy", func(t *testing.T) {
+		rr := httptestDelete("/book/" + b.ID + "/copies/" + b.ID)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+}
+
+// POST /book/{bookID}/holds, GET /book/{bookID}/holds, DELETE /holds/{holdID}
+func TestHolds(t *testing.T) {
+	b := makeBook("hold book")
+	jane := patron.NewPatron("Jane Doe", "jane@example.com")
+	john := patron.NewPatron("John Doe", "john@example.com")
+	mary := patron.NewPatron("Mary Roe", "mary@example.com")
+	repo.AddPatron(ctx, jane)
+	repo.AddPatron(ctx, john)
+	repo.AddPatron(ctx, mary)
+	holdJson := func(p patron.Patron) string {
+		return fmt.Sprintf(`{"patron_id":"%v"}`, p.ID)
+	}
+	listHolds := func(t *testing.T) model.HoldList {
+		t.Helper()
+		rr := httptestGet("/book/" + b.ID + "/holds")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var list model.HoldList
+		json.NewDecoder(rr.Body).Decode(&list)
+		return list
+	}
+
+	t.Run("hold book that does not exist", func(t *testing.T) {
+		rr := httptestPost("/book/"+b.ID+"/holds", holdJson(john))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		rr = httptestGet("/book/" + b.ID + "/holds")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	repo.AddBook(ctx, b)
+
+	t.Run("hold book that is checked in", func(t *testing.T) {
+		rr := httptestPost("/book/"+b.ID+"/holds", holdJson(john))
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	rr := httptestPost("/book/"+b.ID+"/checkout", holdJson(jane))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	t.Run("hold for unknown patron", func(t *testing.T) {
+		unknown := patron.NewPatron("Nobody", "nobody@example.com")
+		rr := httptestPost("/book/"+b.ID+"/holds", holdJson(unknown))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	var johnHoldID string
+	t.Run("place holds", func(t *testing.T) {
+		rr := httptestPost("/book/"+b.ID+"/holds", holdJson(john))
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		data := getJsonMapFromResponseBody(t, rr)
+		assert.NotEmpty(t, data["id"])
+		assert.Equal(t, b.ID, data["book_id"])
+		assert.Equal(t, john.ID, data["patron_id"])
+		assert.Equal(t, "Waiting", data["status"])
+		johnHoldID = data["id"].(string)
+
+		rr = httptestPost("/book/"+b.ID+"/holds", holdJson(mary))
+		assert.Equal(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("hold the same book twice", func(t *testing.T) {
+		rr := httptestPost("/book/"+b.ID+"/holds", holdJson(john))
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("list holds in queue order", func(t *testing.T) {
+		list := listHolds(t)
+		if assert.Len(t, list.Items, 2) {
+			assert.Equal(t, john.ID, list.Items[0].PatronID)
+			assert.Equal(t, mary.ID, list.Items[1].PatronID)
+		}
+	})
+
+	t.Run("check in holds the book for the first patron", func(t *testing.T) {
+		rr := httptestPost("/book/"+b.ID+"/checkin", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		b2, _ := repo.GetBookByID(ctx, b.ID)
+		assert.Equal(t, book.StatusOnHold, b2.Status)
+
+		list := listHolds(t)
+		if assert.Len(t, list.Items, 2) {
+			assert.Equal(t, "Ready", list.Items[0].Status)
+			assert.NotEmpty(t, list.Items[0].ExpiresAt)
+		}
+	})
+
+	t.Run("check out to a patron the book is not held for", func(t *testing.T) {
+		rr := httptestPost("/book/"+b.ID+"/checkout", holdJson(mary))
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("cancel hold passes the book on", func(t *testing.T) {
+		rr := httptestDelete("/holds/" + johnHoldID)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		list := listHolds(t)
+		if assert.Len(t, list.Items, 1) {
+			assert.Equal(t, mary.ID, list.Items[0].PatronID)
+			assert.Equal(t, "Ready", list.Items[0].Status)
+		}
+	})
+
+	t.Run("cancel hold that is already closed", func(t *testing.T) {
+		rr := httptestDelete("/holds/" + johnHoldID)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+	})
+
+	t.Run("check out to the patron the book is held for", func(t *testing.T) {
+		rr := httptestPost("/book/"+b.ID+"/checkout", holdJson(mary))
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Len(t, listHolds(t).Items, 0)
+	})
+}
+
+// GET /loans/overdue
+func TestListOverdueLoans(t *testing.T) {
+	repo := memory.NewRepo()
+	now := time.Now()
+	clock := now
+	server := rest.NewServer(repo, logger,
+		rest.WithLoanPeriod(7*24*time.Hour),
+		rest.WithClock(func() time.Time { return clock }))
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		return rr
+	}
+
+	b := makeBook("overdue book")
+	p := patron.NewPatron("Jane Doe", "jane@example.com")
+	repo.AddBook(ctx, b)
+	repo.AddPatron(ctx, p)
+
+	t.Run("check out without a due date uses the loan period", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/book/"+b.ID+"/checkout",
+			jsonReader(fmt.Sprintf(`{"patron_id":"%v"}`, p.ID)))
+		rr := serve(req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		data := getJsonMapFromResponseBody(t, rr)
+		assert.Equal(t, now.AddDate(0, 0, 7).Format(dateFormat), data["due_date"])
+		assert.Equal(t, now.Format(time.RFC3339), data["checked_out_at"])
+	})
+
+	t.Run("nothing overdue yet", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/loans/overdue", nil)
+		rr := serve(req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var list model.OverdueLoanList
+		json.NewDecoder(rr.Body).Decode(&list)
+		assert.Len(t, list.Items, 0)
+	})
+
+	clock = now.AddDate(0, 0, 10)
+
+	t.Run("overdue loan with patron and days late", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/loans/overdue", nil)
+		rr := serve(req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var list model.OverdueLoanList
+		json.NewDecoder(rr.Body).Decode(&list)
+		if assert.Len(t, list.Items, 1) {
+			item := list.Items[0]
+			assert.Equal(t, b.ID, item.BookID)
+			assert.Equal(t, p.ID, item.Patron.ID)
+			assert.Equal(t, p.Name, item.Patron.Name)
+			assert.Equal(t, 3, item.DaysLate)
+		}
+	})
+
+	t.Run("check in is returned at the time of the clock", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/book/"+b.ID+"/checkin", jsonReader(""))
+		rr := serve(req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		data := getJsonMapFromResponseBody(t, rr)
+		assert.Equal(t, clock.Format(time.RFC3339), data["returned_at"])
+	})
+}
+
 // PUT /book/{bookID}/rating/{rating}
 func TestPutRating(t *testing.T) {
 	b := makeBook("put rating book")
@@ -242,13 +1555,13 @@ func TestPutRating(t *testing.T) {
 		assert.Equal(t, http.StatusNotFound, rr.Code)
 	})
 
-	repo.AddBook(b)
+	repo.AddBook(ctx, b)
 
 	t.Run("update rating with string value should fail", func(t *testing.T) {
 		rating := "A"
 		rr := httptestPut("/book/"+b.ID+"/rating/"+rating, "")
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
-		b2, _ := repo.GetBookByID(b.ID)
+		b2, _ := repo.GetBookByID(ctx, b.ID)
 		assert.Equal(t, b.Status, b2.Status) // ensure it hasn't changed
 	})
 
@@ -256,7 +1569,7 @@ func TestPutRating(t *testing.T) {
 		rating := "42"
 		rr := httptestPut("/book/"+b.ID+"/rating/"+rating, "")
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
-		b2, _ := repo.GetBookByID(b.ID)
+		b2, _ := repo.GetBookByID(ctx, b.ID)
 		assert.Equal(t, b.Status, b2.Status) // ensure it hasn't changed
 	})
 
@@ -264,12 +1577,137 @@ func TestPutRating(t *testing.T) {
 		rating := book.RateTwo
 		rr := httptestPut("/book/"+b.ID+"/rating/"+rating.String(), "")
 		assert.Equal(t, http.StatusOK, rr.Code)
-		b2, _ := repo.GetBookByID(b.ID)
+		b2, _ := repo.GetBookByID(ctx, b.ID)
 		assert.Equal(t, rating, b2.Rating) // ensure is updated
 
 		// check response data structure
 		data := getJsonMapFromResponseBody(t, rr)
 		assertDataMatchesBook(t, data, b2)
+		assert.Equal(t, httptestGet("/book/"+b.ID).Header().Get("ETag"), rr.Header().Get("ETag"))
+	})
+
+	t.Run("change rating without if-match", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPut, "/book/"+b.ID+"/rating/"+book.RateThree.String(), nil)
+		rr := execReq(req)
+		assert.Equal(t, http.StatusPreconditionRequired, rr.Code)
+		assert.Equal(t, model.CodeIfMatchRequired, getJsonMapFromResponseBody(t, rr)["code"])
+		b2, _ := repo.GetBookByID(ctx, b.ID)
+		assert.Equal(t, book.RateTwo, b2.Rating)
+	})
+
+	t.Run("change rating with old etag", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPut, "/book/"+b.ID+"/rating/"+book.RateThree.String(), nil)
+		req.Header.Set("If-Match", `"1"`)
+		rr := execReq(req)
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+		assert.Equal(t, model.CodeVersionConflict, getJsonMapFromResponseBody(t, rr)["code"])
+		b2, _ := repo.GetBookByID(ctx, b.ID)
+		assert.Equal(t, book.RateTwo, b2.Rating)
+	})
+}
+
+// a book removed while a request is handled is reported as not found, as the
+// usecases find it missing after the handler found it
+func TestBookRemovedMidRequest(t *testing.T) {
+	repo := memory.NewRepo()
+	server := rest.NewServer(vanishingRepo{repo}, logger)
+	p := patron.NewPatron("Jane Doe", "jane@example.com")
+	repo.AddPatron(ctx, p)
+
+	tests := map[string]func(b book.Book, c book.Copy) (method, uri, body string){
+		"check in": func(b book.Book, c book.Copy) (string, string, string) {
+			return http.MethodPost, "/book/" + b.ID + "/checkin", ""
+		},
+		"place hold": func(b book.Book, c book.Copy) (string, string, string) {
+			return http.MethodPost, "/book/" + b.ID + "/holds", `{"patron_id":"` + p.ID + `"}`
+		},
+		"add copy": func(b book.Book, c book.Copy) (string, string, string) {
+			return http.MethodPost, "/book/" + b.ID + "/copies", `{"barcode":"` + b.ID + `-2"}`
+		},
+		"remove copy": func(b book.Book, c book.Copy) (string, string, string) {
+			// the handler does not read the book, it is already in the trash
+			repo.RemoveBook(ctx, b.ID)
+			return http.MethodDelete, "/book/" + b.ID + "/copies/" + c.ID, ""
+		},
+	}
+	for name, request := range tests {
+		t.Run(name, func(t *testing.T) {
+			b := makeBook(name)
+			repo.AddBook(ctx, b)
+			c := book.NewCopy(b.ID, b.ID+"-1", book.ConditionGood)
+			repo.AddCopy(ctx, c)
+
+			method, uri, body := request(b, c)
+			req, _ := http.NewRequest(method, uri, jsonReader(body))
+			rr := httptest.NewRecorder()
+			server.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusNotFound, rr.Code)
+			assert.Equal(t, model.CodeNotFound, getJsonMapFromResponseBody(t, rr)["code"])
+		})
+	}
+}
+
+// vanishingRepo moves a book to the trash once it is read, as another client
+// does between a handler finding a book and changing it
+type vanishingRepo struct {
+	usecase.LibraryRepo
+}
+
+func (r vanishingRepo) GetBookByID(ctx context.Context, id string) (book.Book, error) {
+	b, err := r.LibraryRepo.GetBookByID(ctx, id)
+	if err != nil {
+		return b, err
+	}
+	return b, r.LibraryRepo.RemoveBook(ctx, id)
+}
+
+// GET /book/{bookID}/history
+func TestGetBookHistory(t *testing.T) {
+	b := makeBook("history book")
+
+	t.Run("history of book that does not exist", func(t *testing.T) {
+		rr := httptestGet("/book/" + b.ID + "/history")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		data := getJsonMapFromResponseBody(t, rr)
+		assert.Equal(t, model.CodeNotFound, data["code"])
+	})
+
+	repo.AddBook(ctx, b)
+
+	t.Run("changes are listed with their actor", func(t *testing.T) {
+		p := patron.NewPatron("Jane Doe", "jane@example.com")
+		repo.AddPatron(ctx, p)
+		checkOutJson := fmt.Sprintf(
+			`{"patron_id":"%v","due_date":"%v"}`,
+			p.ID, time.Now().AddDate(0, 0, 14).Format(dateFormat),
+		)
+		req, _ := http.NewRequest(http.MethodPost, "/book/"+b.ID+"/checkout", jsonReader(checkOutJson))
+		req.Header.Set("X-Actor", "jane")
+		rr := execReq(req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		rr = httptestPut("/book/"+b.ID+"/rating/"+book.RateThree.String(), "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = httptestGet("/book/" + b.ID + "/history")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var history struct {
+			Items []map[string]interface{} `json:"items"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &history))
+		if assert.Len(t, history.Items, 4) {
+			status, rating := history.Items[2], history.Items[3]
+			assert.Equal(t, "status", status["field"])
+			assert.Equal(t, book.StatusCheckedIn.String(), status["old_value"])
+			assert.Equal(t, book.StatusCheckedOut.String(), status["new_value"])
+			assert.Equal(t, "jane", status["actor"])
+			assert.NotEmpty(t, status["changed_at"])
+
+			assert.Equal(t, "rating", rating["field"])
+			assert.Equal(t, book.RateThree.String(), rating["new_value"])
+			assert.Equal(t, "anonymous", rating["actor"])
+		}
 	})
 }
 
@@ -285,13 +1723,24 @@ func httptestGet(uri string) *httptest.ResponseRecorder {
 	return execReq(req)
 }
 
+// httptestDelete, httptestPut and httptestPatch change a book whatever its
+// version is, TestConditionalRequests covers If-Match
 func httptestDelete(uri string) *httptest.ResponseRecorder {
 	req, _ := http.NewRequest(http.MethodDelete, uri, nil)
+	req.Header.Set("If-Match", "*")
 	return execReq(req)
 }
 
 func httptestPut(uri, body string) *httptest.ResponseRecorder {
 	req, _ := http.NewRequest(http.MethodPut, uri, jsonReader(body))
+	req.Header.Set("If-Match", "*")
+	return execReq(req)
+}
+
+func httptestPatch(uri, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodPatch, uri, jsonReader(body))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", "*")
 	return execReq(req)
 }
 
@@ -314,8 +1763,21 @@ func getJsonMapFromResponseBody(t *testing.T, r *httptest.ResponseRecorder) json
 	return m
 }
 
+// assertFieldError asserts data is an invalid_fields problem about field
+func assertFieldError(t *testing.T, data jsonMap, field, code string) {
+	t.Helper()
+	assert.Equal(t, model.CodeInvalidFields, data["code"])
+	errs, _ := data["errors"].([]interface{})
+	if assert.Len(t, errs, 1) {
+		fe, _ := errs[0].(map[string]interface{})
+		assert.Equal(t, field, fe["field"])
+		assert.Equal(t, code, fe["code"])
+		assert.NotEmpty(t, fe["detail"])
+	}
+}
+
 func makeBook(title string) book.Book {
-	return book.NewBook(title, "john smith", time.Now(), book.RateOne, book.StatusCheckedIn)
+	return book.NewBook(title, "john smith", publisher, time.Now(), book.RateOne, book.StatusCheckedIn)
 }
 
 // custom assertions
@@ -324,6 +1786,7 @@ func assertDataMatchesBook(t *testing.T, data jsonMap, b book.Book) {
 	assert.Equal(t, b.ID, data["id"])
 	assert.Equal(t, b.Title, data["title"])
 	assert.Equal(t, b.Author, data["author"])
+	assert.Equal(t, b.Publisher, data["publisher"])
 	assert.Equal(t, b.PubDate.Format(dateFormat), data["pubdate"])
 	assert.Equal(t, float64(b.Rating), data["rating"])
 	assert.Equal(t, b.Status.String(), data["status"])
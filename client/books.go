@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tempcke/books/api/model"
+)
+
+var dateFormat = "2006-01-02"
+
+// AddBook adds a book to the library, the book is returned with its id
+func (c *Client) AddBook(ctx context.Context, b model.BookModel) (model.BookModel, error) {
+	var added model.BookModel
+	req, err := c.newRequest(ctx, http.MethodPost, "/book", b)
+	if err != nil {
+		return added, err
+	}
+	return added, c.do(req, &added)
+}
+
+// GetBook gets a book and how many of its copies are available
+func (c *Client) GetBook(ctx context.Context, bookID string) (model.BookModel, error) {
+	var b model.BookModel
+	req, err := c.newRequest(ctx, http.MethodGet, bookPath(bookID), nil)
+	if err != nil {
+		return b, err
+	}
+	return b, c.do(req, &b)
+}
+
+// DeleteBook moves a book to the trash whatever its version is, a book which
+// does not exist is ErrNotFound
+func (c *Client) DeleteBook(ctx context.Context, bookID string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, bookPath(bookID), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("If-Match", "*")
+
+	err = c.do(req, nil)
+	if errors.Is(err, ErrVersionConflict) {
+		// * has nothing to match when there is no book
+		if _, getErr := c.GetBook(ctx, bookID); errors.Is(getErr, ErrNotFound) {
+			return getErr
+		}
+	}
+	return err
+}
+
+// SetStatus changes the status of a book
+// the status of a book follows its copies, so the server only changes it by
+// checking a copy out or in, see CheckOut and CheckIn, and a status other than
+// the current one is an ErrInvalidFields error with a not_editable status field
+func (c *Client) SetStatus(ctx context.Context, bookID, status string) (model.BookModel, error) {
+	var b model.BookModel
+	req, err := c.newRequest(ctx, http.MethodPatch, bookPath(bookID), map[string]string{"status": status})
+	if err != nil {
+		return b, err
+	}
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", "*")
+	return b, c.do(req, &b)
+}
+
+// SetRating changes the rating of a book whatever its version is
+func (c *Client) SetRating(ctx context.Context, bookID string, rating int) (model.BookModel, error) {
+	var b model.BookModel
+	req, err := c.newRequest(ctx, http.MethodPut, bookPath(bookID)+"/rating/"+strconv.Itoa(rating), nil)
+	if err != nil {
+		return b, err
+	}
+	req.Header.Set("If-Match", "*")
+	return b, c.do(req, &b)
+}
+
+// Import media types
+const (
+	MediaTypeCSV    = "text/csv"
+	MediaTypeNDJSON = "application/x-ndjson"
+)
+
+// ImportOptions of ImportBooks
+// DryRun only validates the books, without BestEffort no book is added when
+// any row fails
+type ImportOptions struct {
+	DryRun     bool
+	BestEffort bool
+}
+
+// ImportBooks adds the books of a csv or ndjson file, mediaType tells which
+// the report has the outcome of every row
+func (c *Client) ImportBooks(ctx context.Context, r io.Reader, mediaType string, opts ImportOptions) (model.ImportReport, error) {
+	var report model.ImportReport
+	q := url.Values{}
+	q.Set("dry_run", strconv.FormatBool(opts.DryRun))
+	q.Set("best_effort", strconv.FormatBool(opts.BestEffort))
+	req, err := c.newRequest(ctx, http.MethodPost, "/book/import?"+q.Encode(), r)
+	if err != nil {
+		return report, err
+	}
+	req.Header.Set("Content-Type", mediaType)
+	return report, c.do(req, &report)
+}
+
+// ExportBooks streams the books which pass the filter as csv, ndjson or json
+// the caller closes the returned reader, PageSize of the filter is ignored
+func (c *Client) ExportBooks(ctx context.Context, format string, filter BookFilter) (io.ReadCloser, error) {
+	q := filter.query()
+	q.Del("limit")
+	q.Set("format", format)
+	req, err := c.newRequest(ctx, http.MethodGet, "/book/export?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	// the export has its own media type, problems are still json
+	req.Header.Set("Accept", "*/*")
+	res, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// MaxPageSize is the largest PageSize the server lists
+const MaxPageSize = 1000
+
+// BookFilter selects the books ListBooks iterates, the zero value is every book
+// Sort is a list of fields, prefix a field with - to reverse it
+// PageSize is how many books are fetched per request, 0 is the server default
+// and at most MaxPageSize
+type BookFilter struct {
+	Author        string
+	Status        string
+	Rating        int
+	PubDateFrom   time.Time
+	PubDateTo     time.Time
+	TitleContains string
+	Sort          []string
+	PageSize      int
+}
+
+// query is the filter as the query params of a list request
+func (f BookFilter) query() url.Values {
+	q := url.Values{}
+	for param, v := range map[string]string{
+		"author": f.Author,
+		"status": f.Status,
+		"title":  f.TitleContains,
+		"sort":   strings.Join(f.Sort, ","),
+	} {
+		if v != "" {
+			q.Set(param, v)
+		}
+	}
+	if f.Rating != 0 {
+		q.Set("rating", strconv.Itoa(f.Rating))
+	}
+	if !f.PubDateFrom.IsZero() {
+		q.Set("pubdate_from", f.PubDateFrom.Format(dateFormat))
+	}
+	if !f.PubDateTo.IsZero() {
+		q.Set("pubdate_to", f.PubDateTo.Format(dateFormat))
+	}
+	if f.PageSize != 0 {
+		q.Set("limit", strconv.Itoa(f.PageSize))
+	}
+	return q
+}
+
+// ListBooks iterates the books which pass the filter, pages are fetched as
+// the iteration needs them
+//
+//	books := c.ListBooks(ctx, client.BookFilter{Author: "Martin Fowler"})
+//	for books.Next() {
+//		fmt.Println(books.Book().Title)
+//	}
+//	err := books.Err()
+func (c *Client) ListBooks(ctx context.Context, filter BookFilter) *Books {
+	return &Books{c: c, ctx: ctx, query: filter.query()}
+}
+
+// Books is an iterator of the books of a list
+type Books struct {
+	c     *Client
+	ctx   context.Context
+	query url.Values
+	page  []model.BookModel
+	book  model.BookModel
+	next  string
+	last  bool
+	err   error
+}
+
+// Next moves to the next book, false when there are no more books or a page
+// could not be fetched, which Err tells
+func (it *Books) Next() bool {
+	for len(it.page) == 0 {
+		if it.last || it.err != nil {
+			return false
+		}
+		it.fetch()
+	}
+	it.book, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Book is the current book of the iteration
+func (it *Books) Book() model.BookModel {
+	return it.book
+}
+
+// Err is the error which ended the iteration, nil when every book was iterated
+func (it *Books) Err() error {
+	return it.err
+}
+
+// fetch gets the page after the current one
+func (it *Books) fetch() {
+	if it.next != "" {
+		it.query.Set("cursor", it.next)
+	}
+	req, err := it.c.newRequest(it.ctx, http.MethodGet, "/book?"+it.query.Encode(), nil)
+	if err != nil {
+		it.err = err
+		return
+	}
+
+	var list model.BookList
+	if it.err = it.c.do(req, &list); it.err != nil {
+		return
+	}
+	it.page, it.next, it.last = list.Items, list.Next, list.Next == ""
+}
+
+func bookPath(bookID string) string {
+	return "/book/" + url.PathEscape(bookID)
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/tempcke/books/api/model"
+)
+
+// Client of the book server REST api
+type Client struct {
+	baseURL string
+	http    *http.Client
+	actor   string
+	token   string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient replaces http.DefaultClient as the client requests are sent with
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithActor names who makes changes, they are recorded in the book history
+// under this name instead of anonymous
+func WithActor(actor string) Option {
+	return func(c *Client) {
+		c.actor = actor
+	}
+}
+
+// WithToken sends a bearer token with every request, for a server behind a
+// proxy which authenticates its clients
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// NewClient is the Client constructor, baseURL is where the server is
+// eg: http://localhost:8080
+func NewClient(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    http.DefaultClient,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// newRequest builds a request of the api, body is sent as json when not nil
+// or as is when it is an io.Reader, the caller then sets the Content-Type
+func (c *Client) newRequest(ctx context.Context, method, path string, body interface{}) (*http.Request, error) {
+	reader, isReader := body.(io.Reader)
+	if body != nil && !isReader {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil && !isReader {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.actor != "" {
+		req.Header.Set("X-Actor", c.actor)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// send sends a request, an error response is returned as an *Error
+// the caller closes the body of the response
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		defer res.Body.Close()
+		return nil, newError(res)
+	}
+	return res, nil
+}
+
+// do sends a request and decodes the json response into result, unless it is
+// nil
+func (c *Client) do(req *http.Request, result interface{}) error {
+	res, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if result == nil {
+		_, err = io.Copy(ioutil.Discard, res.Body)
+		return err
+	}
+	return json.NewDecoder(res.Body).Decode(result)
+}
+
+// newError reads the problem of an error response, a response which is not a
+// problem, such as one from a proxy, is an Error with only the status
+func newError(res *http.Response) *Error {
+	e := &Error{Problem: model.Problem{
+		Status: res.StatusCode,
+		Title:  http.StatusText(res.StatusCode),
+	}}
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "application/problem+json") {
+		return e
+	}
+
+	var p model.Problem
+	if err := json.NewDecoder(res.Body).Decode(&p); err == nil {
+		e.Problem = p
+	}
+	return e
+}
@@ -0,0 +1,311 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/api/model"
+	"github.com/tempcke/books/api/rest"
+	"github.com/tempcke/books/client"
+	"github.com/tempcke/books/internal"
+	"github.com/tempcke/books/repository/memory"
+)
+
+var ctx = context.Background()
+
+func newClient(t *testing.T, options ...client.Option) *client.Client {
+	c, _ := newClientAndURL(t, options...)
+	return c
+}
+
+// newClientAndURL is a client of a new server and where the server is, for
+// requests the client does not make
+func newClientAndURL(t *testing.T, options ...client.Option) (*client.Client, string) {
+	ts := httptest.NewServer(rest.NewServer(memory.NewRepo(), internal.NewLogger()))
+	t.Cleanup(ts.Close)
+	return client.NewClient(ts.URL, options...), ts.URL
+}
+
+func makeBook(title string) model.BookModel {
+	return model.BookModel{
+		Title:     title,
+		Author:    "john smith",
+		Publisher: "acme publishing",
+		PubDate:   "2020-01-01",
+		Rating:    1,
+		Status:    "CheckedIn",
+	}
+}
+
+func TestBook(t *testing.T) {
+	c := newClient(t, client.WithActor("librarian"))
+
+	t.Run("add and get", func(t *testing.T) {
+		b := makeBook("Refactoring")
+		b.ISBN = "0-201-48567-2"
+		added, err := c.AddBook(ctx, b)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, added.ID)
+		assert.Equal(t, "9780201485677", added.ISBN)
+
+		got, err := c.GetBook(ctx, added.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, added.Title, got.Title)
+		if assert.NotNil(t, got.Copies) {
+			assert.Equal(t, 1, got.Copies.Available)
+		}
+
+		_, err = c.AddBook(ctx, b)
+		assert.True(t, errors.Is(err, client.ErrISBNExists))
+	})
+
+	t.Run("every invalid field", func(t *testing.T) {
+		b := makeBook("")
+		b.Rating = 7
+		_, err := c.AddBook(ctx, b)
+		assert.True(t, errors.Is(err, client.ErrInvalidFields))
+
+		var e *client.Error
+		if assert.True(t, errors.As(err, &e)) {
+			assert.Equal(t, http.StatusBadRequest, e.Status)
+			title, ok := e.Field("title")
+			assert.True(t, ok)
+			assert.Equal(t, model.FieldRequired, title.Code)
+			rating, ok := e.Field("rating")
+			assert.True(t, ok)
+			assert.Equal(t, model.FieldInvalid, rating.Code)
+			_, ok = e.Field("author")
+			assert.False(t, ok)
+		}
+	})
+
+	t.Run("set rating", func(t *testing.T) {
+		b, _ := c.AddBook(ctx, makeBook("rated"))
+		rated, err := c.SetRating(ctx, b.ID, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, rated.Rating)
+
+		_, err = c.SetRating(ctx, b.ID, 9)
+		assert.True(t, errors.Is(err, client.ErrInvalidFields))
+	})
+
+	t.Run("set status", func(t *testing.T) {
+		b, _ := c.AddBook(ctx, makeBook("status"))
+		same, err := c.SetStatus(ctx, b.ID, "CheckedIn")
+		assert.NoError(t, err)
+		assert.Equal(t, "CheckedIn", same.Status)
+
+		_, err = c.SetStatus(ctx, b.ID, "CheckedOut")
+		var e *client.Error
+		if assert.True(t, errors.As(err, &e)) {
+			assert.True(t, errors.Is(err, client.ErrInvalidFields))
+			fe, _ := e.Field("status")
+			assert.Equal(t, model.FieldNotEditable, fe.Code)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		b, _ := c.AddBook(ctx, makeBook("deleted"))
+		assert.NoError(t, c.DeleteBook(ctx, b.ID))
+		err := c.DeleteBook(ctx, b.ID)
+		assert.True(t, errors.Is(err, client.ErrNotFound))
+
+		_, err = c.GetBook(ctx, b.ID)
+		assert.True(t, errors.Is(err, client.ErrNotFound))
+		_, err = c.SetRating(ctx, b.ID, 2)
+		assert.True(t, errors.Is(err, client.ErrNotFound))
+	})
+}
+
+func TestListBooks(t *testing.T) {
+	c := newClient(t)
+	for i := 1; i <= 5; i++ {
+		b := makeBook(fmt.Sprintf("list book %v", i))
+		if i == 3 {
+			b.Author = "jane doe"
+		}
+		_, err := c.AddBook(ctx, b)
+		assert.NoError(t, err)
+	}
+
+	t.Run("every page", func(t *testing.T) {
+		books := c.ListBooks(ctx, client.BookFilter{Sort: []string{"-title"}, PageSize: 2})
+		assert.Equal(t, []string{
+			"list book 5", "list book 4", "list book 3", "list book 2", "list book 1",
+		}, titlesOf(books))
+		assert.NoError(t, books.Err())
+	})
+
+	t.Run("filtered", func(t *testing.T) {
+		books := c.ListBooks(ctx, client.BookFilter{Author: "john smith", TitleContains: "book", Sort: []string{"title"}})
+		assert.Equal(t, []string{"list book 1", "list book 2", "list book 4", "list book 5"}, titlesOf(books))
+		assert.NoError(t, books.Err())
+	})
+
+	t.Run("no books", func(t *testing.T) {
+		books := c.ListBooks(ctx, client.BookFilter{Author: "nobody"})
+		assert.Empty(t, titlesOf(books))
+		assert.NoError(t, books.Err())
+	})
+
+	t.Run("invalid filter", func(t *testing.T) {
+		books := c.ListBooks(ctx, client.BookFilter{Sort: []string{"color"}})
+		assert.False(t, books.Next())
+		assert.True(t, errors.Is(books.Err(), client.ErrInvalidFields))
+	})
+}
+
+func TestImportExport(t *testing.T) {
+	c := newClient(t)
+	csv := "isbn,title,author,publisher,pubdate,rating,status\n" +
+		",Imported,john smith,acme,2020-01-01,2,CheckedIn\n" +
+		",,john smith,acme,2020-01-01,2,CheckedIn\n"
+
+	t.Run("dry run", func(t *testing.T) {
+		report, err := c.ImportBooks(ctx, strings.NewReader(csv), client.MediaTypeCSV, client.ImportOptions{DryRun: true})
+		assert.NoError(t, err)
+		assert.True(t, report.DryRun)
+		assert.Equal(t, 1, report.Failed)
+		assert.Empty(t, titlesOf(c.ListBooks(ctx, client.BookFilter{})))
+	})
+
+	t.Run("nothing added when a row fails", func(t *testing.T) {
+		report, err := c.ImportBooks(ctx, strings.NewReader(csv), client.MediaTypeCSV, client.ImportOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, report.Created)
+		assert.Equal(t, 1, report.Failed)
+	})
+
+	t.Run("best effort", func(t *testing.T) {
+		report, err := c.ImportBooks(ctx, strings.NewReader(csv), client.MediaTypeCSV, client.ImportOptions{BestEffort: true})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, report.Created)
+		if assert.Len(t, report.Rows, 2) {
+			assert.Equal(t, 3, report.Rows[1].Row)
+			assert.NotEmpty(t, report.Rows[1].Error)
+		}
+	})
+
+	t.Run("unsupported media type", func(t *testing.T) {
+		_, err := c.ImportBooks(ctx, strings.NewReader(csv), "text/plain", client.ImportOptions{})
+		assert.True(t, errors.Is(err, client.ErrUnsupportedMediaType))
+	})
+
+	t.Run("export", func(t *testing.T) {
+		export, err := c.ExportBooks(ctx, "ndjson", client.BookFilter{Author: "john smith", PageSize: 1})
+		if assert.NoError(t, err) {
+			defer export.Close()
+			raw, _ := ioutil.ReadAll(export)
+			assert.Equal(t, 1, strings.Count(string(raw), "\n"))
+			assert.Contains(t, string(raw), `"title":"Imported"`)
+		}
+
+		_, err = c.ExportBooks(ctx, "xml", client.BookFilter{})
+		assert.True(t, errors.Is(err, client.ErrInvalidFields))
+	})
+}
+
+func TestCheckOut(t *testing.T) {
+	c, url := newClientAndURL(t)
+	b, _ := c.AddBook(ctx, makeBook("checked out"))
+	res, err := http.Post(url+"/patron", "application/json", strings.NewReader(`{"name":"Jane Doe","email":"jane@example.com"}`))
+	assert.NoError(t, err)
+	var p model.PatronModel
+	json.NewDecoder(res.Body).Decode(&p)
+	res.Body.Close()
+
+	due := time.Now().AddDate(0, 0, 7)
+	l, err := c.CheckOut(ctx, b.ID, p.ID, due)
+	assert.NoError(t, err)
+	assert.Equal(t, p.ID, l.PatronID)
+	assert.Equal(t, due.Format("2006-01-02"), l.DueDate)
+
+	_, err = c.CheckOut(ctx, b.ID, p.ID, time.Time{})
+	assert.True(t, errors.Is(err, client.ErrBookCheckedOut))
+	checkedOut, _ := c.GetBook(ctx, b.ID)
+	assert.Equal(t, "CheckedOut", checkedOut.Status)
+
+	returned, err := c.CheckIn(ctx, b.ID, "")
+	assert.NoError(t, err)
+	assert.Equal(t, l.ID, returned.ID)
+	assert.NotEmpty(t, returned.ReturnedAt)
+	checkedIn, _ := c.GetBook(ctx, b.ID)
+	assert.Equal(t, "CheckedIn", checkedIn.Status)
+
+	_, err = c.CheckIn(ctx, b.ID, "")
+	assert.True(t, errors.Is(err, client.ErrBookNotCheckedOut))
+	_, err = c.CheckIn(ctx, b.ID, "no such barcode")
+	assert.True(t, errors.Is(err, client.ErrInvalidFields))
+}
+
+func TestError(t *testing.T) {
+	t.Run("response which is not a problem", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "upstream is down", http.StatusBadGateway)
+		}))
+		defer ts.Close()
+
+		_, err := client.NewClient(ts.URL).GetBook(ctx, "id")
+		var e *client.Error
+		if assert.True(t, errors.As(err, &e)) {
+			assert.Equal(t, http.StatusBadGateway, e.Status)
+			assert.Equal(t, "Bad Gateway", e.Error())
+			assert.Nil(t, errors.Unwrap(err))
+		}
+	})
+
+	t.Run("delete of a book which is still there", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/problem+json")
+			if r.Method == http.MethodDelete {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				w.Write([]byte(`{"status":412,"code":"version_conflict"}`))
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":"id"}`))
+		}))
+		defer ts.Close()
+
+		err := client.NewClient(ts.URL).DeleteBook(ctx, "id")
+		assert.True(t, errors.Is(err, client.ErrVersionConflict))
+	})
+
+	t.Run("request which could not be sent", func(t *testing.T) {
+		err := client.NewClient("http://127.0.0.1:0").DeleteBook(ctx, "id")
+		assert.Error(t, err)
+		var e *client.Error
+		assert.False(t, errors.As(err, &e))
+	})
+}
+
+func titlesOf(books *client.Books) []string {
+	var titles []string
+	for books.Next() {
+		titles = append(titles, books.Book().Title)
+	}
+	return titles
+}
+
+func TestOptions(t *testing.T) {
+	var header http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	c := client.NewClient(ts.URL+"/", client.WithActor("desk"), client.WithToken("secret"))
+	assert.NoError(t, c.DeleteBook(ctx, "id"))
+	assert.Equal(t, "desk", header.Get("X-Actor"))
+	assert.Equal(t, "Bearer secret", header.Get("Authorization"))
+}
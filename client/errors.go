@@ -0,0 +1,84 @@
+package client
+
+import (
+	"errors"
+
+	"github.com/tempcke/books/api/model"
+)
+
+// Errors the problems of the server are matched to by errors.Is
+var (
+	ErrInvalidFields        = errors.New("Request has invalid fields")
+	ErrInvalidBody          = errors.New("Request body could not be read")
+	ErrNotFound             = errors.New("Resource not found")
+	ErrMethodNotAllowed     = errors.New("Method is not allowed")
+	ErrNotAcceptable        = errors.New("No acceptable media type")
+	ErrUnsupportedMediaType = errors.New("Content-Type is not supported")
+	ErrVersionConflict      = errors.New("Book was changed since it was read")
+	ErrIfMatchRequired      = errors.New("If-Match header is required")
+	ErrNotUnique            = errors.New("Record is not unique")
+	ErrISBNExists           = errors.New("ISBN belongs to another book")
+	ErrBarcodeExists        = errors.New("Barcode is already in use")
+	ErrCopyInUse            = errors.New("Copy is checked out or on hold")
+	ErrLastCopy             = errors.New("The last copy of a book can not be removed")
+	ErrBookCheckedOut       = errors.New("Every copy of the book is checked out")
+	ErrBookNotCheckedOut    = errors.New("Book is not checked out")
+	ErrBookAvailable        = errors.New("Book is checked in")
+	ErrBookOnHold           = errors.New("Book is on hold for another patron")
+	ErrHoldExists           = errors.New("Patron already has a hold on this book")
+	ErrHoldClosed           = errors.New("Hold is no longer open")
+	ErrInternal             = errors.New("Internal server error")
+)
+
+// codeErrors maps the codes of the problems to their errors
+var codeErrors = map[string]error{
+	model.CodeInvalidFields:        ErrInvalidFields,
+	model.CodeInvalidBody:          ErrInvalidBody,
+	model.CodeNotFound:             ErrNotFound,
+	model.CodeMethodNotAllowed:     ErrMethodNotAllowed,
+	model.CodeNotAcceptable:        ErrNotAcceptable,
+	model.CodeUnsupportedMediaType: ErrUnsupportedMediaType,
+	model.CodeVersionConflict:      ErrVersionConflict,
+	model.CodeIfMatchRequired:      ErrIfMatchRequired,
+	model.CodeNotUnique:            ErrNotUnique,
+	model.CodeISBNExists:           ErrISBNExists,
+	model.CodeBarcodeExists:        ErrBarcodeExists,
+	model.CodeCopyInUse:            ErrCopyInUse,
+	model.CodeLastCopy:             ErrLastCopy,
+	model.CodeBookCheckedOut:       ErrBookCheckedOut,
+	model.CodeBookNotCheckedOut:    ErrBookNotCheckedOut,
+	model.CodeBookAvailable:        ErrBookAvailable,
+	model.CodeBookOnHold:           ErrBookOnHold,
+	model.CodeHoldExists:           ErrHoldExists,
+	model.CodeHoldClosed:           ErrHoldClosed,
+	model.CodeInternal:             ErrInternal,
+}
+
+// Error is a problem the server responded with, errors.Is matches it to the
+// error of its code such as ErrNotFound
+type Error struct {
+	model.Problem
+}
+
+func (e *Error) Error() string {
+	if e.Detail != "" {
+		return e.Detail
+	}
+	return e.Title
+}
+
+// Unwrap is the error of the problem code, nil for an unknown code
+func (e *Error) Unwrap() error {
+	return codeErrors[e.Code]
+}
+
+// Field is why a field of the request is invalid, ok is false when the
+// field is not one of the invalid fields
+func (e *Error) Field(name string) (fe model.FieldError, ok bool) {
+	for _, fe := range e.Errors {
+		if fe.Field == name {
+			return fe, true
+		}
+	}
+	return fe, false
+}
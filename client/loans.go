@@ -0,0 +1,36 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/tempcke/books/api/model"
+)
+
+// CheckOut lends a copy of a book to a patron until dueDate, a zero dueDate
+// is the loan period of the server from today
+func (c *Client) CheckOut(ctx context.Context, bookID, patronID string, dueDate time.Time) (model.LoanModel, error) {
+	var l model.LoanModel
+	data := model.CheckOutRequest{PatronID: patronID}
+	if !dueDate.IsZero() {
+		data.DueDate = dueDate.Format(dateFormat)
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, bookPath(bookID)+"/checkout", data)
+	if err != nil {
+		return l, err
+	}
+	return l, c.do(req, &l)
+}
+
+// CheckIn returns a checked out copy of a book, the status of a book follows
+// its copies so CheckOut and CheckIn are how it changes.  barcode says which
+// copy is returned, it can be empty while only one copy is checked out
+func (c *Client) CheckIn(ctx context.Context, bookID, barcode string) (model.LoanModel, error) {
+	var l model.LoanModel
+	req, err := c.newRequest(ctx, http.MethodPost, bookPath(bookID)+"/checkin", model.CheckInRequest{Barcode: barcode})
+	if err != nil {
+		return l, err
+	}
+	return l, c.do(req, &l)
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tempcke/books/api/model"
+	"github.com/tempcke/books/client"
+)
+
+var dateFormat = "2006-01-02"
+
+// env is what a command runs with
+type env struct {
+	client *client.Client
+	out    printer
+	stdout io.Writer
+	stderr io.Writer
+	usage  string
+}
+
+// command of bookctl, usage is its arguments after bookctl
+type command struct {
+	usage   string
+	summary string
+	run     func(ctx context.Context, e *env, args []string) error
+}
+
+var commands = map[string]command{
+	"add": {
+		"add --title T --author A --publisher P --pubdate yyyy-mm-dd [--isbn I] [--rating 1|2|3]",
+		"add a book",
+		addCmd,
+	},
+	"get": {"get BOOK_ID", "show a book and how many copies are available", getCmd},
+	"list": {
+		"list [--author A] [--status S] [--title T] [--rating R] [--sort -pubdate,title] [--limit N]",
+		"list the books which pass the filters",
+		listCmd,
+	},
+	"rm":       {"rm BOOK_ID...", "move books to the trash, reporting each one which could not be", rmCmd},
+	"checkout": {"checkout BOOK_ID --patron PATRON_ID [--due yyyy-mm-dd]", "lend a copy of a book to a patron", checkoutCmd},
+	"rate":     {"rate BOOK_ID 1|2|3", "change the rating of a book", rateCmd},
+	"import": {
+		"import [--dry-run] [--best-effort] FILE.csv|FILE.ndjson",
+		"add the books of a file, reporting every row",
+		importCmd,
+	},
+	"export": {
+		"export [--format csv|ndjson|json] [--file F] [list filters]",
+		"write the books which pass the filters, to stdout without --file",
+		exportCmd,
+	},
+}
+
+// usageError is a command used the wrong way
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+// flagError is a flag of a command which could not be parsed
+type flagError struct {
+	error
+}
+
+// flags is a flag set for the command
+func (e *env) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet("bookctl", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(e.stderr, "usage: bookctl "+e.usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the flags of a command and returns its other arguments, the
+// flags may come before, after or between them
+//
+//	checkout BOOK_ID --patron PATRON_ID
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var argv []string
+	for {
+		if err := fs.Parse(args); err == flag.ErrHelp {
+			return nil, err
+		} else if err != nil {
+			return nil, flagError{err}
+		}
+		if fs.NArg() == 0 {
+			return argv, nil
+		}
+		argv = append(argv, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// parseN is parse for a command with exactly n arguments
+func parseN(fs *flag.FlagSet, args []string, n int) ([]string, error) {
+	argv, err := parse(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(argv) != n {
+		return nil, usageError(fmt.Sprintf("expected %v arguments, got %v", n, len(argv)))
+	}
+	return argv, nil
+}
+
+// filterFlags adds the flags of the list filters, the filter is only set
+// once the flags are parsed
+func filterFlags(fs *flag.FlagSet) func() (client.BookFilter, error) {
+	var f client.BookFilter
+	var sort, from, to string
+	fs.StringVar(&f.Author, "author", "", "only books by this author")
+	fs.StringVar(&f.Status, "status", "", "only books with this status: CheckedIn, CheckedOut or OnHold")
+	fs.StringVar(&f.TitleContains, "title", "", "only books with this in their title")
+	fs.IntVar(&f.Rating, "rating", 0, "only books with this rating")
+	fs.StringVar(&from, "pubdate-from", "", "only books published on or after yyyy-mm-dd")
+	fs.StringVar(&to, "pubdate-to", "", "only books published on or before yyyy-mm-dd")
+	fs.StringVar(&sort, "sort", "", "comma separated fields to sort by, prefix a field with - to reverse it")
+	return func() (client.BookFilter, error) {
+		if sort != "" {
+			f.Sort = strings.Split(sort, ",")
+		}
+		for _, d := range []struct {
+			name  string
+			value string
+			date  *time.Time
+		}{
+			{"pubdate-from", from, &f.PubDateFrom},
+			{"pubdate-to", to, &f.PubDateTo},
+		} {
+			if d.value == "" {
+				continue
+			}
+			t, err := time.Parse(dateFormat, d.value)
+			if err != nil {
+				return f, usageError("--" + d.name + " must be in yyyy-mm-dd format")
+			}
+			*d.date = t
+		}
+		return f, nil
+	}
+}
+
+func addCmd(ctx context.Context, e *env, args []string) error {
+	fs := e.flags()
+	var b model.BookModel
+	fs.StringVar(&b.ISBN, "isbn", "", "ISBN-10 or ISBN-13, optional")
+	fs.StringVar(&b.Title, "title", "", "title of the book")
+	fs.StringVar(&b.Author, "author", "", "author of the book")
+	fs.StringVar(&b.Publisher, "publisher", "", "publisher of the book")
+	fs.StringVar(&b.PubDate, "pubdate", "", "date the book was published, yyyy-mm-dd")
+	fs.IntVar(&b.Rating, "rating", 1, "1, 2 or 3")
+	fs.StringVar(&b.Status, "status", "CheckedIn", "status of the new book")
+	if _, err := parseN(fs, args, 0); err != nil {
+		return err
+	}
+
+	added, err := e.client.AddBook(ctx, b)
+	if err != nil {
+		return err
+	}
+	return e.out.book(added)
+}
+
+func getCmd(ctx context.Context, e *env, args []string) error {
+	argv, err := parseN(e.flags(), args, 1)
+	if err != nil {
+		return err
+	}
+
+	b, err := e.client.GetBook(ctx, argv[0])
+	if err != nil {
+		return err
+	}
+	return e.out.book(b)
+}
+
+func listCmd(ctx context.Context, e *env, args []string) error {
+	fs := e.flags()
+	filter := filterFlags(fs)
+	limit := fs.Int("limit", 0, "list at most this many books, 0 is every book")
+	if _, err := parseN(fs, args, 0); err != nil {
+		return err
+	}
+
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+	if *limit > 0 && *limit <= client.MaxPageSize {
+		f.PageSize = *limit
+	}
+	var list []model.BookModel
+	books := e.client.ListBooks(ctx, f)
+	for (*limit == 0 || len(list) < *limit) && books.Next() {
+		list = append(list, books.Book())
+	}
+	if err := books.Err(); err != nil {
+		return err
+	}
+	return e.out.books(list)
+}
+
+func rmCmd(ctx context.Context, e *env, args []string) error {
+	ids, err := parse(e.flags(), args)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return usageError("expected a BOOK_ID")
+	}
+
+	// one book which can not be removed does not keep the others
+	failed := 0
+	for _, id := range ids {
+		if err := e.client.DeleteBook(ctx, id); err != nil {
+			printError(e.stderr, fmt.Errorf("%v: %w", id, err))
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v of %v books were not removed", failed, len(ids))
+	}
+	return nil
+}
+
+func checkoutCmd(ctx context.Context, e *env, args []string) error {
+	fs := e.flags()
+	patronID := fs.String("patron", "", "id of the patron borrowing the book")
+	due := fs.String("due", "", "due date, yyyy-mm-dd, defaults to the loan period of the server")
+	argv, err := parseN(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *patronID == "" {
+		return usageError("--patron is required")
+	}
+	var dueDate time.Time
+	if *due != "" {
+		if dueDate, err = time.Parse(dateFormat, *due); err != nil {
+			return usageError("--due must be in yyyy-mm-dd format")
+		}
+	}
+
+	l, err := e.client.CheckOut(ctx, argv[0], *patronID, dueDate)
+	if err != nil {
+		return err
+	}
+	return e.out.loan(l)
+}
+
+func rateCmd(ctx context.Context, e *env, args []string) error {
+	argv, err := parseN(e.flags(), args, 2)
+	if err != nil {
+		return err
+	}
+	rating, err := strconv.Atoi(argv[1])
+	if err != nil {
+		return usageError("rating must be 1, 2 or 3")
+	}
+
+	b, err := e.client.SetRating(ctx, argv[0], rating)
+	if err != nil {
+		return err
+	}
+	return e.out.book(b)
+}
+
+// importMediaTypes are the media types of the files which can be imported
+var importMediaTypes = map[string]string{
+	".csv":    client.MediaTypeCSV,
+	".ndjson": client.MediaTypeNDJSON,
+	".jsonl":  client.MediaTypeNDJSON,
+}
+
+// importCmd fails when a row of the file failed, even after the report of
+// every row was written, so scripts can tell
+func importCmd(ctx context.Context, e *env, args []string) error {
+	fs := e.flags()
+	var opts client.ImportOptions
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "only validate the books")
+	fs.BoolVar(&opts.BestEffort, "best-effort", false, "add the valid books even when a row fails")
+	argv, err := parseN(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	mediaType, ok := importMediaTypes[strings.ToLower(filepath.Ext(argv[0]))]
+	if !ok {
+		return usageError("the file must be .csv or .ndjson")
+	}
+
+	file, err := os.Open(argv[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	report, err := e.client.ImportBooks(ctx, file, mediaType, opts)
+	if err != nil {
+		return err
+	}
+	if err := e.out.importReport(report); err != nil {
+		return err
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%v of %v rows failed", report.Failed, len(report.Rows))
+	}
+	return nil
+}
+
+func exportCmd(ctx context.Context, e *env, args []string) error {
+	fs := e.flags()
+	filter := filterFlags(fs)
+	format := fs.String("format", "csv", "csv, ndjson or json")
+	path := fs.String("file", "", "file to write, it is replaced when it exists")
+	if _, err := parseN(fs, args, 0); err != nil {
+		return err
+	}
+
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+	export, err := e.client.ExportBooks(ctx, *format, f)
+	if err != nil {
+		return err
+	}
+	defer export.Close()
+
+	if *path == "" {
+		_, err = io.Copy(e.stdout, export)
+		return err
+	}
+	file, err := os.Create(*path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, export); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// printError writes why a command failed, a problem with invalid fields has
+// a line for each
+func printError(w io.Writer, err error) {
+	var e *client.Error
+	if errors.As(err, &e) && len(e.Errors) > 0 {
+		fmt.Fprintln(w, "bookctl: "+e.Title)
+		for _, fe := range e.Errors {
+			fmt.Fprintf(w, "  %v: %v\n", fe.Field, fe.Detail)
+		}
+		return
+	}
+	fmt.Fprintln(w, "bookctl: "+err.Error())
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// EnvConfig is the env var naming the config file, it replaces the default
+const EnvConfig = "BOOKCTL_CONFIG"
+
+const defaultURL = "http://localhost:8080"
+
+// output modes
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+)
+
+// Config of bookctl, read from a json file such as
+//
+//	{"url": "http://books.internal:8080", "actor": "front-desk", "token": "..."}
+//
+// Actor is the name changes are recorded under in the book history, Token is
+// sent as a bearer token for a server behind an authenticating proxy
+type Config struct {
+	URL    string `json:"url"`
+	Actor  string `json:"actor"`
+	Token  string `json:"token"`
+	Output string `json:"output"`
+}
+
+// defaultConfigPath is where the config file is when neither --config nor
+// BOOKCTL_CONFIG say, eg: ~/.config/bookctl/config.json
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "bookctl", "config.json")
+}
+
+// LoadConfig reads the config file at path, or the default one when path is
+// empty, settings the file does not have fall back to their defaults
+// only a missing default config file is not an error
+func LoadConfig(path string) (Config, error) {
+	conf := Config{URL: defaultURL, Output: OutputTable}
+	explicit := path != ""
+	if path == "" {
+		path = os.Getenv(EnvConfig)
+		explicit = path != ""
+	}
+	if path == "" {
+		path = defaultConfigPath()
+	}
+	if path == "" {
+		return conf, nil
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return conf, nil
+	}
+	if err != nil {
+		return conf, err
+	}
+	if err := json.Unmarshal(raw, &conf); err != nil {
+		return conf, fmt.Errorf("config %v: %v", path, err)
+	}
+	return conf, nil
+}
+
+// IsValid tells if the Config object is in a valid state
+func (c Config) IsValid() bool {
+	if c.URL == "" {
+		return false
+	}
+	return c.Output == OutputTable || c.Output == OutputJSON
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, json string) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(json), 0600))
+	return path
+}
+
+func TestConf(t *testing.T) {
+	tt := []struct {
+		conf  Config
+		valid bool
+	}{
+		{Config{}, false},
+		{Config{URL: defaultURL}, false},
+		{Config{URL: defaultURL, Output: "yaml"}, false},
+		{Config{Output: OutputTable}, false},
+		{Config{URL: defaultURL, Output: OutputTable}, true},
+		{Config{URL: defaultURL, Output: OutputJSON, Actor: "desk", Token: "t"}, true},
+	}
+	for i, tc := range tt {
+		t.Run(fmt.Sprintf("%v: %+v", i, tc.conf), func(t *testing.T) {
+			assert.Equal(t, tc.valid, tc.conf.IsValid())
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	defer os.Unsetenv(EnvConfig)
+	os.Unsetenv(EnvConfig)
+
+	t.Run("file", func(t *testing.T) {
+		path := writeConfig(t, `{"url":"http://books:8080","actor":"desk","token":"secret"}`)
+		conf, err := LoadConfig(path)
+		assert.NoError(t, err)
+		assert.Equal(t, Config{URL: "http://books:8080", Actor: "desk", Token: "secret", Output: OutputTable}, conf)
+	})
+
+	t.Run("file named by the env var", func(t *testing.T) {
+		os.Setenv(EnvConfig, writeConfig(t, `{"output":"json"}`))
+		defer os.Unsetenv(EnvConfig)
+		conf, err := LoadConfig("")
+		assert.NoError(t, err)
+		assert.Equal(t, Config{URL: defaultURL, Output: OutputJSON}, conf)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := LoadConfig(filepath.Join(t.TempDir(), "missing.json"))
+		assert.Error(t, err)
+
+		os.Setenv(EnvConfig, filepath.Join(t.TempDir(), "missing.json"))
+		defer os.Unsetenv(EnvConfig)
+		_, err = LoadConfig("")
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		_, err := LoadConfig(writeConfig(t, `url: http://books:8080`))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/tempcke/books/client"
+)
+
+// exit codes
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the bookctl command of args and returns the exit code
+//
+//	bookctl [--config F] [--server URL] [--output table|json] COMMAND ...
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("bookctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "", "config file, defaults to $"+EnvConfig+" or "+defaultConfigPath())
+	server := fs.String("server", "", "url of the bookserver, replaces the url of the config")
+	output := fs.String("output", "", "table or json, replaces the output of the config")
+	fs.Usage = func() { usage(stderr, fs) }
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	name := fs.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "bookctl: unknown command %q\n", name)
+		fs.Usage()
+		return exitUsage
+	}
+
+	conf, err := LoadConfig(*configPath)
+	if err != nil {
+		printError(stderr, err)
+		return exitError
+	}
+	if *server != "" {
+		conf.URL = *server
+	}
+	if *output != "" {
+		conf.Output = *output
+	}
+	if !conf.IsValid() {
+		// the config is not printed, it may have a token
+		fmt.Fprintln(stderr, "bookctl: invalid config, url is required and output must be table or json")
+		return exitError
+	}
+
+	e := &env{
+		client: client.NewClient(conf.URL, client.WithActor(conf.Actor), client.WithToken(conf.Token)),
+		out:    printer{stdout, conf.Output},
+		stdout: stdout,
+		stderr: stderr,
+		usage:  cmd.usage,
+	}
+	err = cmd.run(context.Background(), e, fs.Args()[1:])
+
+	var uerr usageError
+	var ferr flagError
+	switch {
+	case err == nil, err == flag.ErrHelp:
+		return exitOK
+	case errors.As(err, &uerr):
+		fmt.Fprintf(stderr, "bookctl %v: %v\nusage: bookctl %v\n", name, uerr, cmd.usage)
+		return exitUsage
+	case errors.As(err, &ferr):
+		// the flag set already wrote the error and the usage
+		return exitUsage
+	}
+	printError(stderr, err)
+	return exitError
+}
+
+func usage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintln(w, "usage: bookctl [flags] COMMAND [arguments]")
+	fmt.Fprintln(w, "\ncommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-9v %v\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(w, "\nflags:")
+	fs.PrintDefaults()
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/api/model"
+	"github.com/tempcke/books/api/rest"
+	"github.com/tempcke/books/internal"
+	"github.com/tempcke/books/repository/memory"
+)
+
+// newBookctl runs bookctl against a new server, the result is the exit code
+// and what was written to stdout and stderr
+func newBookctl(t *testing.T) (bookctl func(args ...string) (int, string, string), url string) {
+	ts := httptest.NewServer(rest.NewServer(memory.NewRepo(), internal.NewLogger()))
+	t.Cleanup(ts.Close)
+	config := writeConfig(t, `{"url":"`+ts.URL+`","actor":"desk"}`)
+
+	return func(args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := run(append([]string{"--config", config}, args...), &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}, ts.URL
+}
+
+var addArgs = []string{"add", "--title", "Refactoring", "--author", "Martin Fowler",
+	"--publisher", "Addison-Wesley", "--pubdate", "1999-06-28", "--rating", "3"}
+
+func TestBookctl(t *testing.T) {
+	bookctl, url := newBookctl(t)
+
+	code, out, _ := bookctl(append([]string{"--output", "json"}, addArgs...)...)
+	assert.Equal(t, exitOK, code)
+	var b model.BookModel
+	assert.NoError(t, json.Unmarshal([]byte(out), &b))
+	assert.NotEmpty(t, b.ID)
+
+	t.Run("get as a table", func(t *testing.T) {
+		code, out, _ := bookctl("get", b.ID)
+		assert.Equal(t, exitOK, code)
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		if assert.Len(t, lines, 2) {
+			assert.Contains(t, lines[0], "TITLE")
+			assert.Contains(t, lines[1], "Refactoring")
+			assert.Contains(t, lines[1], "1/1")
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		bookctl("add", "--title", "Other", "--author", "Jane Doe", "--publisher", "p", "--pubdate", "2020-01-01")
+		code, out, _ := bookctl("list", "--author", "Martin Fowler", "--status", "CheckedIn")
+		assert.Equal(t, exitOK, code)
+		assert.Contains(t, out, "Refactoring")
+		assert.NotContains(t, out, "Other")
+
+		code, out, _ = bookctl("--output", "json", "list", "--sort", "title", "--limit", "1")
+		assert.Equal(t, exitOK, code)
+		var books []model.BookModel
+		assert.NoError(t, json.Unmarshal([]byte(out), &books))
+		if assert.Len(t, books, 1) {
+			assert.Equal(t, "Other", books[0].Title)
+		}
+
+		code, out, _ = bookctl("--output", "json", "list", "--author", "nobody")
+		assert.Equal(t, exitOK, code)
+		assert.Equal(t, "[]", strings.TrimSpace(out))
+	})
+
+	t.Run("rate", func(t *testing.T) {
+		code, out, _ := bookctl("--output", "json", "rate", b.ID, "2")
+		assert.Equal(t, exitOK, code)
+		assert.Contains(t, out, `"rating": 2`)
+
+		code, _, errOut := bookctl("rate", b.ID, "9")
+		assert.Equal(t, exitError, code)
+		assert.Contains(t, errOut, "rating:")
+	})
+
+	t.Run("checkout", func(t *testing.T) {
+		res, err := http.Post(url+"/patron", "application/json", strings.NewReader(`{"name":"Jane Doe","email":"jane@example.com"}`))
+		assert.NoError(t, err)
+		var p model.PatronModel
+		json.NewDecoder(res.Body).Decode(&p)
+		res.Body.Close()
+
+		code, out, _ := bookctl("checkout", b.ID, "--patron", p.ID, "--due", "2099-01-31")
+		assert.Equal(t, exitOK, code)
+		assert.Contains(t, out, "2099-01-31")
+
+		code, _, errOut := bookctl("checkout", b.ID, "--patron", p.ID)
+		assert.Equal(t, exitError, code)
+		assert.Contains(t, errOut, "checked out")
+	})
+
+	t.Run("rm", func(t *testing.T) {
+		code, _, errOut := bookctl("rm", b.ID)
+		assert.Equal(t, exitError, code)
+		assert.Contains(t, errOut, "checked out or on hold")
+
+		_, out, _ := bookctl(append([]string{"--output", "json"}, addArgs...)...)
+		var other model.BookModel
+		assert.NoError(t, json.Unmarshal([]byte(out), &other))
+		code, _, errOut = bookctl("rm", b.ID, other.ID)
+		assert.Equal(t, exitError, code)
+		assert.Contains(t, errOut, b.ID+": ")
+		assert.Contains(t, errOut, "1 of 2 books were not removed")
+		assert.NotContains(t, errOut, other.ID)
+
+		code, _, errOut = bookctl("get", other.ID)
+		assert.Equal(t, exitError, code)
+		assert.Contains(t, errOut, "not found")
+	})
+}
+
+func TestBookctlListPageSize(t *testing.T) {
+	var limits []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limits = append(limits, r.URL.Query().Get("limit"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"items":[]}`))
+	}))
+	defer ts.Close()
+	config := writeConfig(t, `{"url":"`+ts.URL+`"}`)
+
+	// a limit over the largest page is listed in pages of the default size
+	for _, limit := range []string{"1000", "1001"} {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, exitOK, run([]string{"--config", config, "list", "--limit", limit}, &stdout, &stderr))
+	}
+	assert.Equal(t, []string{"1000", ""}, limits)
+}
+
+func TestBookctlImportExport(t *testing.T) {
+	bookctl, _ := newBookctl(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "books.csv")
+	ioutil.WriteFile(file, []byte("isbn,title,author,publisher,pubdate,rating,status\n"+
+		",Imported,john smith,acme,2020-01-01,2,CheckedIn\n"+
+		",,john smith,acme,2020-01-01,2,CheckedIn\n"), 0600)
+
+	t.Run("a failed row fails the import", func(t *testing.T) {
+		code, out, errOut := bookctl("import", file, "--best-effort")
+		assert.Equal(t, exitError, code)
+		assert.Contains(t, out, "created 1, duplicates 0, failed 1")
+		assert.Contains(t, errOut, "1 of 2 rows failed")
+	})
+
+	t.Run("export", func(t *testing.T) {
+		code, out, _ := bookctl("export", "--author", "john smith")
+		assert.Equal(t, exitOK, code)
+		assert.True(t, strings.HasPrefix(out, "id,isbn,title"), out)
+		assert.Contains(t, out, "Imported")
+
+		exported := filepath.Join(dir, "export.ndjson")
+		code, out, _ = bookctl("export", "--format", "ndjson", "--file", exported)
+		assert.Equal(t, exitOK, code)
+		assert.Empty(t, out)
+		raw, _ := ioutil.ReadFile(exported)
+		assert.Contains(t, string(raw), `"title":"Imported"`)
+	})
+
+	t.Run("unsupported file", func(t *testing.T) {
+		code, _, _ := bookctl("import", filepath.Join(dir, "books.xlsx"))
+		assert.Equal(t, exitUsage, code)
+	})
+}
+
+func TestBookctlErrors(t *testing.T) {
+	bookctl, _ := newBookctl(t)
+
+	t.Run("every invalid field", func(t *testing.T) {
+		code, _, errOut := bookctl("add", "--title", "", "--pubdate", "1999")
+		assert.Equal(t, exitError, code)
+		for _, field := range []string{"pubdate:", "title:", "author:", "publisher:"} {
+			assert.Contains(t, errOut, field)
+		}
+	})
+
+	tt := map[string][]string{
+		"no command":         {},
+		"unknown command":    {"shelve"},
+		"unknown flag":       {"list", "--color", "red"},
+		"missing argument":   {"get"},
+		"too many arguments": {"rate", "id"},
+		"missing patron":     {"checkout", "id"},
+		"invalid date":       {"list", "--pubdate-from", "1999"},
+	}
+	for name, args := range tt {
+		t.Run(name, func(t *testing.T) {
+			code, _, errOut := bookctl(args...)
+			assert.Equal(t, exitUsage, code)
+			assert.Contains(t, errOut, "usage: bookctl")
+		})
+	}
+
+	t.Run("server not running", func(t *testing.T) {
+		code, _, errOut := bookctl("--server", "http://127.0.0.1:0", "get", "id")
+		assert.Equal(t, exitError, code)
+		assert.Contains(t, errOut, "bookctl: ")
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tempcke/books/api/model"
+)
+
+// printer writes what a command returns in the output mode of the config
+type printer struct {
+	w    io.Writer
+	mode string
+}
+
+// print writes v as json, or as the table the rows are, a header then a row
+// per item
+func (p printer) print(v interface{}, rows ...[]string) error {
+	if p.mode == OutputJSON {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+var bookHeader = []string{"ID", "ISBN", "TITLE", "AUTHOR", "PUBLISHER", "PUBDATE", "RATING", "STATUS", "AVAILABLE"}
+
+func bookRow(b model.BookModel) []string {
+	available := ""
+	if b.Copies != nil {
+		available = fmt.Sprintf("%v/%v", b.Copies.Available, b.Copies.Total)
+	}
+	return []string{
+		b.ID, b.ISBN, b.Title, b.Author, b.Publisher, b.PubDate,
+		fmt.Sprint(b.Rating), b.Status, available,
+	}
+}
+
+func (p printer) book(b model.BookModel) error {
+	return p.print(b, bookHeader, bookRow(b))
+}
+
+func (p printer) books(books []model.BookModel) error {
+	rows := [][]string{bookHeader}
+	for _, b := range books {
+		rows = append(rows, bookRow(b))
+	}
+	if books == nil {
+		books = []model.BookModel{}
+	}
+	return p.print(books, rows...)
+}
+
+func (p printer) loan(l model.LoanModel) error {
+	return p.print(l,
+		[]string{"ID", "BOOK", "PATRON", "CHECKED OUT", "DUE"},
+		[]string{l.ID, l.BookID, l.PatronID, l.CheckedOutAt, l.DueDate})
+}
+
+// importReport has a row for every row of the import, then the totals
+func (p printer) importReport(r model.ImportReport) error {
+	rows := [][]string{{"ROW", "STATUS", "BOOK", "ERROR"}}
+	for _, row := range r.Rows {
+		rows = append(rows, []string{fmt.Sprint(row.Row), row.Status, row.BookID, row.Error})
+	}
+	total := fmt.Sprintf("created %v, duplicates %v, failed %v", r.Created, r.Duplicates, r.Failed)
+	if r.DryRun {
+		total = "dry run: " + total
+	}
+	rows = append(rows, nil, []string{total})
+	return p.print(r, rows...)
+}
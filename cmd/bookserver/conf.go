@@ -2,32 +2,126 @@ package main
 
 import (
 	"os"
+	"strconv"
+	"time"
+
+	"github.com/tempcke/books/entity/hold"
+	"github.com/tempcke/books/entity/loan"
+	"github.com/tempcke/books/repository"
+	"github.com/tempcke/books/usecase"
 )
 
 // env vars
 const (
-	EnvPort = "APP_PORT"
-	EnvDSN  = "DB_DSN"
+	EnvPort           = "APP_PORT"
+	EnvDriver         = "DB_DRIVER"
+	EnvDSN            = "DB_DSN"
+	EnvLoanPeriodDays = "LOAN_PERIOD_DAYS"
+	EnvPickupDays     = "HOLD_PICKUP_DAYS"
+	EnvTrashDays      = "TRASH_RETENTION_DAYS"
+	EnvSweepInterval  = "SWEEP_INTERVAL"
+	EnvReadTimeout    = "DB_READ_TIMEOUT"
+	EnvWriteTimeout   = "DB_WRITE_TIMEOUT"
+)
+
+const defaultSweepInterval = time.Hour
+
+// supported DB_DRIVER values
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
 )
 
 // Config contains the required details to start the app
 type Config struct {
-	Port string
-	DSN  string
+	Port          string
+	Driver        string
+	DSN           string
+	LoanPeriod    time.Duration
+	PickupWindow  time.Duration
+	Retention     time.Duration
+	SweepInterval time.Duration
+	ReadTimeout   time.Duration
+	WriteTimeout  time.Duration
+
+	// Invalid lists the env vars which are set to a value that could not be
+	// parsed, eg: LOAN_PERIOD_DAYS=14d
+	Invalid []string
 }
 
 // NewConfigFromEnv builds a Config from the env vars
+// optional settings fall back to their defaults when not set
 func NewConfigFromEnv() Config {
-	return Config{
-		Port: os.Getenv(EnvPort),
-		DSN:  os.Getenv(EnvDSN),
+	conf := Config{
+		Port:          os.Getenv(EnvPort),
+		Driver:        DriverPostgres,
+		DSN:           os.Getenv(EnvDSN),
+		LoanPeriod:    loan.DefaultPeriod,
+		PickupWindow:  hold.DefaultPickupWindow,
+		Retention:     usecase.DefaultTrashRetention,
+		SweepInterval: defaultSweepInterval,
+		ReadTimeout:   repository.DefaultReadTimeout,
+		WriteTimeout:  repository.DefaultWriteTimeout,
+	}
+	if driver := os.Getenv(EnvDriver); driver != "" {
+		conf.Driver = driver
 	}
+	for _, v := range []struct {
+		key   string
+		parse func(string) (time.Duration, error)
+		value *time.Duration
+	}{
+		{EnvLoanPeriodDays, parseDays, &conf.LoanPeriod},
+		{EnvPickupDays, parseDays, &conf.PickupWindow},
+		{EnvTrashDays, parseDays, &conf.Retention},
+		{EnvSweepInterval, time.ParseDuration, &conf.SweepInterval},
+		{EnvReadTimeout, time.ParseDuration, &conf.ReadTimeout},
+		{EnvWriteTimeout, time.ParseDuration, &conf.WriteTimeout},
+	} {
+		s := os.Getenv(v.key)
+		if s == "" {
+			continue
+		}
+		d, err := v.parse(s)
+		if err != nil {
+			conf.Invalid = append(conf.Invalid, v.key+"="+s)
+			continue
+		}
+		*v.value = d
+	}
+	return conf
 }
 
 // IsValid tells if the Config object is in a valid state
 func (c Config) IsValid() bool {
-	if c.Port == "" || c.DSN == "" {
+	if c.Port == "" || len(c.Invalid) > 0 {
+		return false
+	}
+	switch c.Driver {
+	case DriverPostgres, DriverSQLite:
+		if c.DSN == "" {
+			return false
+		}
+	case DriverMemory:
+		// the dsn is optional, without it nothing is persisted
+	default:
+		return false
+	}
+	if c.LoanPeriod <= 0 || c.PickupWindow <= 0 || c.Retention <= 0 || c.SweepInterval <= 0 {
+		return false
+	}
+	if c.ReadTimeout <= 0 || c.WriteTimeout <= 0 {
 		return false
 	}
 	return true
 }
+
+// parseDays parses a whole number of days, eg: 14
+func parseDays(s string) (time.Duration, error) {
+	days, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
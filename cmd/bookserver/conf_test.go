@@ -2,20 +2,54 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestConf(t *testing.T) {
+	day := 24 * time.Hour
+	valid := func() Config {
+		return Config{
+			Port:          "80",
+			Driver:        DriverPostgres,
+			DSN:           "uri",
+			LoanPeriod:    14 * day,
+			PickupWindow:  3 * day,
+			Retention:     30 * day,
+			SweepInterval: time.Hour,
+			ReadTimeout:   5 * time.Second,
+			WriteTimeout:  5 * time.Second,
+		}
+	}
+	with := func(change func(*Config)) Config {
+		c := valid()
+		change(&c)
+		return c
+	}
 	tt := []struct {
 		conf  Config
 		valid bool
 	}{
-		{Config{"", ""}, false},
-		{Config{"80", ""}, false},
-		{Config{"", "uri"}, false},
-		{Config{"80", "uri"}, true},
+		{Config{}, false},
+		{with(func(c *Config) { c.Port = "" }), false},
+		{with(func(c *Config) { c.DSN = "" }), false},
+		{with(func(c *Config) { c.Driver = "" }), false},
+		{with(func(c *Config) { c.Driver = "mysql" }), false},
+		{with(func(c *Config) { c.Driver = DriverSQLite }), true},
+		{with(func(c *Config) { c.Driver = DriverMemory }), true},
+		{with(func(c *Config) { c.Driver, c.DSN = DriverMemory, "" }), true},
+		{with(func(c *Config) { c.Driver, c.DSN = DriverSQLite, "" }), false},
+		{with(func(c *Config) { c.LoanPeriod = 0 }), false},
+		{with(func(c *Config) { c.PickupWindow = 0 }), false},
+		{with(func(c *Config) { c.Retention = 0 }), false},
+		{with(func(c *Config) { c.SweepInterval = 0 }), false},
+		{with(func(c *Config) { c.ReadTimeout = 0 }), false},
+		{with(func(c *Config) { c.WriteTimeout = 0 }), false},
+		{with(func(c *Config) { c.Invalid = []string{EnvLoanPeriodDays + "=14d"} }), false},
+		{valid(), true},
 	}
 	for i, tc := range tt {
 		t.Run(fmt.Sprintf("%v: %+v", i, tc.conf), func(t *testing.T) {
@@ -23,3 +57,50 @@ func TestConf(t *testing.T) {
 		})
 	}
 }
+
+func TestConfFromEnv(t *testing.T) {
+	vars := []string{
+		EnvDriver, EnvLoanPeriodDays, EnvPickupDays, EnvTrashDays, EnvSweepInterval,
+		EnvReadTimeout, EnvWriteTimeout,
+	}
+	for _, v := range vars {
+		defer os.Unsetenv(v)
+		os.Unsetenv(v)
+	}
+
+	conf := NewConfigFromEnv()
+	assert.Equal(t, DriverPostgres, conf.Driver)
+	assert.Equal(t, 14*24*time.Hour, conf.LoanPeriod)
+	assert.Equal(t, 3*24*time.Hour, conf.PickupWindow)
+	assert.Equal(t, 30*24*time.Hour, conf.Retention)
+	assert.Equal(t, time.Hour, conf.SweepInterval)
+	assert.Equal(t, 5*time.Second, conf.ReadTimeout)
+	assert.Equal(t, 5*time.Second, conf.WriteTimeout)
+
+	os.Setenv(EnvDriver, DriverSQLite)
+	os.Setenv(EnvLoanPeriodDays, "7")
+	os.Setenv(EnvPickupDays, "2")
+	os.Setenv(EnvTrashDays, "90")
+	os.Setenv(EnvSweepInterval, "15m")
+	os.Setenv(EnvReadTimeout, "2s")
+	os.Setenv(EnvWriteTimeout, "500ms")
+	conf = NewConfigFromEnv()
+	assert.Equal(t, DriverSQLite, conf.Driver)
+	assert.Equal(t, 7*24*time.Hour, conf.LoanPeriod)
+	assert.Equal(t, 2*24*time.Hour, conf.PickupWindow)
+	assert.Equal(t, 90*24*time.Hour, conf.Retention)
+	assert.Equal(t, 15*time.Minute, conf.SweepInterval)
+	assert.Equal(t, 2*time.Second, conf.ReadTimeout)
+	assert.Equal(t, 500*time.Millisecond, conf.WriteTimeout)
+	assert.Empty(t, conf.Invalid)
+
+	t.Run("values which do not parse", func(t *testing.T) {
+		os.Setenv(EnvLoanPeriodDays, "14d")
+		os.Setenv(EnvTrashDays, "thirty")
+		os.Setenv(EnvSweepInterval, "hourly")
+		conf := NewConfigFromEnv()
+		assert.Equal(t, []string{EnvLoanPeriodDays + "=14d", EnvTrashDays + "=thirty", EnvSweepInterval + "=hourly"}, conf.Invalid)
+		conf.Port, conf.DSN = "80", "uri"
+		assert.False(t, conf.IsValid())
+	})
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"database/sql"
+
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/tempcke/books/internal"
+	"github.com/tempcke/books/internal/sqlitemigrate"
 )
 
 const verboseLogging = false
@@ -21,3 +24,22 @@ func dbMigrateUp(dsn string, log *internal.Logger) error {
 	}
 	return nil
 }
+
+func sqliteMigrateUp(db *sql.DB, log *internal.Logger) error {
+	driver, err := sqlitemigrate.WithInstance(db)
+	if err != nil {
+		return err
+	}
+
+	m, err := migrate.NewWithDatabaseInstance(
+		"file://db/sqlite/migrations", sqlitemigrate.DriverName, driver)
+	if err != nil {
+		return err
+	}
+
+	m.Log = log
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return err
+	}
+	return nil
+}
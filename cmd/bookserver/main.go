@@ -1,18 +1,25 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/tempcke/books/api/rest"
-	"github.com/tempcke/books/fake"
 	"github.com/tempcke/books/internal"
 	"github.com/tempcke/books/repository"
+	"github.com/tempcke/books/repository/memory"
 	"github.com/tempcke/books/usecase"
 )
 
-const dbDriver = "postgres"
+// shutdownTimeout is how long open connections get to close on shutdown
+const shutdownTimeout = 10 * time.Second
 
 func main() {
 	log := internal.NewLogger()
@@ -27,34 +34,114 @@ func run(conf Config, log *internal.Logger) error {
 		return fmt.Errorf("Invalid Config: %+v", conf)
 	}
 
-	repo, err := pgRepo(conf, log)
+	repo, err := dbRepo(conf, log)
 	if err != nil {
 		return err
 	}
-	// repo := fakeRepo()
 
-	server := rest.NewServer(repo, log)
+	// cancelled on SIGINT or SIGTERM, along with every query still running
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		cancel()
+	}()
+
+	sweeper := sweeper{
+		repo:         repo,
+		events:       logPublisher{log},
+		clock:        time.Now,
+		interval:     conf.SweepInterval,
+		pickupWindow: conf.PickupWindow,
+		retention:    conf.Retention,
+		log:          log,
+	}
+	go sweeper.run(ctx)
+
+	server := &http.Server{
+		Addr: ":" + conf.Port,
+		Handler: rest.NewServer(repo, log,
+			rest.WithLoanPeriod(conf.LoanPeriod),
+			rest.WithPickupWindow(conf.PickupWindow),
+			rest.WithTrashRetention(conf.Retention)),
+		// request contexts are derived from ctx so shutdown cancels them
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		log.Info("Shutting down")
+		shutdownCtx, done := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer done()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Error(err)
+		}
+	}()
 
 	log.Info("Listening on " + conf.Port)
 	fmt.Println("Listening on " + conf.Port)
-	return http.ListenAndServe(":"+conf.Port, server)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
 }
 
-func pgRepo(conf Config, log *internal.Logger) (usecase.BookReaderWriter, error) {
+// dbRepo is the repository of the configured DB_DRIVER
+func dbRepo(conf Config, log *internal.Logger) (usecase.LibraryRepo, error) {
+	switch conf.Driver {
+	case DriverSQLite:
+		return sqliteRepo(conf, log)
+	case DriverMemory:
+		return memoryRepo(conf)
+	}
+	return pgRepo(conf, log)
+}
+
+func pgRepo(conf Config, log *internal.Logger) (usecase.LibraryRepo, error) {
 
 	if err := dbMigrateUp(conf.DSN, log); err != nil {
 		return nil, err
 	}
 
-	db, err := sql.Open(dbDriver, conf.DSN)
+	db, err := sql.Open(DriverPostgres, conf.DSN)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to connect to postgres: %s", err.Error())
 	}
 
-	repo := repository.NewPostgresRepo(db)
+	repo := repository.NewPostgresRepo(db,
+		repository.WithReadTimeout(conf.ReadTimeout),
+		repository.WithWriteTimeout(conf.WriteTimeout))
+	return repo, nil
+}
+
+// sqliteRepo uses the database file DB_DSN, it is created when missing
+func sqliteRepo(conf Config, log *internal.Logger) (usecase.LibraryRepo, error) {
+	db, err := sql.Open(DriverSQLite, conf.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open sqlite: %s", err.Error())
+	}
+
+	// constructed first so the migrations run on the single connection
+	repo := repository.NewSQLiteRepo(db,
+		repository.WithReadTimeout(conf.ReadTimeout),
+		repository.WithWriteTimeout(conf.WriteTimeout))
+
+	if err := sqliteMigrateUp(db, log); err != nil {
+		return nil, err
+	}
 	return repo, nil
 }
 
-func fakeRepo() usecase.BookReaderWriter {
-	return fake.NewBookRepo()
+// memoryRepo is kept in memory only, unless DB_DSN is the path of a
+// json snapshot to persist it to
+func memoryRepo(conf Config) (usecase.LibraryRepo, error) {
+	if conf.DSN == "" {
+		return memory.NewRepo(), nil
+	}
+	repo, err := memory.Open(conf.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open snapshot: %s", err.Error())
+	}
+	return repo, nil
 }
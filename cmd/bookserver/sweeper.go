@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tempcke/books/entity/hold"
+	"github.com/tempcke/books/entity/loan"
+	"github.com/tempcke/books/internal"
+	"github.com/tempcke/books/usecase"
+)
+
+// sweeperActor is recorded in the book history for changes made by the sweeper
+const sweeperActor = "bookserver"
+
+// sweeper periodically marks loans which are past their due date, expires
+// holds which were not picked up in time and purges the trash
+type sweeper struct {
+	repo         usecase.LibraryRepo
+	events       usecase.EventPublisher
+	clock        func() time.Time
+	interval     time.Duration
+	pickupWindow time.Duration
+	retention    time.Duration
+	log          *internal.Logger
+}
+
+// run sweeps once right away and then on every interval until ctx is done,
+// a sweep in progress is cancelled along with ctx
+func (s sweeper) run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s sweeper) sweep(ctx context.Context) {
+	s.markOverdueLoans(ctx)
+	s.expireHolds(ctx)
+	s.purgeTrash(ctx)
+}
+
+// markOverdueLoans marks the overdue loans found as of now
+func (s sweeper) markOverdueLoans(ctx context.Context) []loan.Loan {
+	marked, err := usecase.MarkOverdueLoans(ctx, s.repo, s.events, s.clock())
+	if err != nil {
+		s.log.Error("Overdue sweep failed: " + err.Error())
+	}
+	return marked
+}
+
+// expireHolds closes the holds whose pickup window ended
+func (s sweeper) expireHolds(ctx context.Context) []hold.Hold {
+	expired, err := usecase.ExpireHolds(ctx, s.repo, s.clock(), s.pickupWindow, sweeperActor)
+	if err != nil {
+		s.log.Error("Hold expiry sweep failed: " + err.Error())
+	}
+	return expired
+}
+
+// purgeTrash permanently deletes the books which were in the trash for
+// longer than the retention period
+func (s sweeper) purgeTrash(ctx context.Context) int {
+	purged, err := usecase.PurgeTrash(ctx, s.repo, s.clock(), s.retention)
+	if err != nil {
+		s.log.Error("Trash purge failed: " + err.Error())
+	}
+	return purged
+}
+
+// logPublisher publishes domain events by writing them to the log
+type logPublisher struct {
+	log *internal.Logger
+}
+
+// Publish an event
+func (p logPublisher) Publish(event interface{}) error {
+	switch e := event.(type) {
+	case loan.OverdueEvent:
+		p.log.WithFields(map[string]interface{}{
+			"loan_id":   e.Loan.ID,
+			"book_id":   e.Loan.BookID,
+			"patron_id": e.Loan.PatronID,
+			"days_late": e.DaysLate,
+		}).Info("Loan is overdue")
+	default:
+		p.log.Info(fmt.Sprintf("Event: %+v", event))
+	}
+	return nil
+}
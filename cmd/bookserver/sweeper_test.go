@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/entity/hold"
+	"github.com/tempcke/books/entity/loan"
+	"github.com/tempcke/books/entity/patron"
+	"github.com/tempcke/books/internal"
+	"github.com/tempcke/books/repository/memory"
+	"github.com/tempcke/books/usecase"
+)
+
+const pickupWindow = 3 * 24 * time.Hour
+
+var ctx = context.Background()
+
+func TestSweeperOverdueLoans(t *testing.T) {
+	repo, b, jane := sweeperRepo()
+
+	now := time.Now()
+	l, err := usecase.CheckOut(ctx, repo, b.ID, jane.ID, now, now.AddDate(0, 0, 14), "librarian")
+	assert.NoError(t, err)
+
+	clock := now
+	events := make(chanPublisher, 1)
+	s := newTestSweeper(repo, events, func() time.Time { return clock })
+
+	assert.Len(t, s.markOverdueLoans(ctx), 0)
+
+	clock = now.AddDate(0, 0, 15)
+	marked := s.markOverdueLoans(ctx)
+	if assert.Len(t, marked, 1) {
+		assert.Equal(t, l.ID, marked[0].ID)
+		assert.Equal(t, clock, marked[0].OverdueAt)
+	}
+	e := (<-events).(loan.OverdueEvent)
+	assert.Equal(t, 1, e.DaysLate)
+
+	assert.Len(t, s.markOverdueLoans(ctx), 0)
+}
+
+func TestSweeperExpireHolds(t *testing.T) {
+	repo, b, jane := sweeperRepo()
+	john := patron.NewPatron("John Doe", "john@example.com")
+	repo.AddPatron(ctx, john)
+
+	now := time.Now()
+	usecase.CheckOut(ctx, repo, b.ID, jane.ID, now, now.AddDate(0, 0, 14), "librarian")
+	h, err := usecase.PlaceHold(ctx, repo, b.ID, john.ID)
+	assert.NoError(t, err)
+	usecase.CheckIn(ctx, repo, b.ID, "", now, pickupWindow, "librarian")
+
+	clock := now
+	s := newTestSweeper(repo, make(chanPublisher, 1), func() time.Time { return clock })
+
+	assert.Len(t, s.expireHolds(ctx), 0)
+
+	clock = now.Add(pickupWindow + time.Hour)
+	expired := s.expireHolds(ctx)
+	if assert.Len(t, expired, 1) {
+		assert.Equal(t, h.ID, expired[0].ID)
+		assert.Equal(t, hold.StatusExpired, expired[0].Status)
+	}
+	b2, _ := repo.GetBookByID(ctx, b.ID)
+	assert.Equal(t, book.StatusCheckedIn, b2.Status)
+
+	history, _ := repo.BookHistory(ctx, b.ID)
+	assert.Equal(t, sweeperActor, history[len(history)-1].Actor)
+}
+
+func TestSweeperPurgeTrash(t *testing.T) {
+	repo, b, _ := sweeperRepo()
+	usecase.RemoveBook(ctx, repo, b.ID, 0)
+
+	now := time.Now()
+	clock := now
+	s := newTestSweeper(repo, make(chanPublisher, 1), func() time.Time { return clock })
+
+	assert.Equal(t, 0, s.purgeTrash(ctx))
+	trash, _ := repo.TrashedBooks(ctx)
+	assert.Len(t, trash, 1)
+
+	clock = now.Add(usecase.DefaultTrashRetention + time.Hour)
+	assert.Equal(t, 1, s.purgeTrash(ctx))
+	trash, _ = repo.TrashedBooks(ctx)
+	assert.Len(t, trash, 0)
+}
+
+func TestSweeperRun(t *testing.T) {
+	repo, b, jane := sweeperRepo()
+
+	now := time.Now()
+	_, err := usecase.CheckOut(ctx, repo, b.ID, jane.ID, now, now.AddDate(0, 0, 14), "librarian")
+	assert.NoError(t, err)
+
+	events := make(chanPublisher, 1)
+	s := newTestSweeper(repo, events, func() time.Time { return now.AddDate(0, 0, 30) })
+
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		s.run(runCtx)
+		close(done)
+	}()
+
+	select {
+	case e := <-events:
+		assert.IsType(t, loan.OverdueEvent{}, e)
+	case <-time.After(time.Second):
+		t.Error("expected the sweeper to run right away")
+	}
+	stop()
+	<-done
+}
+
+func sweeperRepo() (memory.Repo, book.Book, patron.Patron) {
+	repo := memory.NewRepo()
+	p := patron.NewPatron("Jane Doe", "jane@example.com")
+	b := book.NewBook("Sweep", "Some Author", "acme publishing",
+		time.Now(), book.RateOne, book.StatusCheckedIn)
+	repo.AddPatron(ctx, p)
+	repo.AddBook(ctx, b)
+	return repo, b, p
+}
+
+func newTestSweeper(repo usecase.LibraryRepo, events usecase.EventPublisher, clock func() time.Time) sweeper {
+	return sweeper{
+		repo:         repo,
+		events:       events,
+		clock:        clock,
+		interval:     time.Hour,
+		pickupWindow: pickupWindow,
+		retention:    usecase.DefaultTrashRetention,
+		log:          internal.NewLogger(),
+	}
+}
+
+// chanPublisher sends every event published down the channel
+type chanPublisher chan interface{}
+
+func (p chanPublisher) Publish(event interface{}) error {
+	p <- event
+	return nil
+}
@@ -0,0 +1 @@
+ALTER TABLE books DROP COLUMN IF EXISTS publisher;
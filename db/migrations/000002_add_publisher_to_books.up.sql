@@ -0,0 +1,3 @@
+ALTER TABLE books ADD COLUMN IF NOT EXISTS publisher VARCHAR(128);
+UPDATE books SET publisher = 'Unknown' WHERE publisher IS NULL;
+ALTER TABLE books ALTER COLUMN publisher SET NOT NULL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS books_title_id_idx;
+DROP INDEX IF EXISTS books_pubdate_id_idx;
+DROP INDEX IF EXISTS books_lower_author_idx;
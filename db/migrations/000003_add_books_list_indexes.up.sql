@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS books_title_id_idx ON books (title, id);
+CREATE INDEX IF NOT EXISTS books_pubdate_id_idx ON books (pubdate, id);
+CREATE INDEX IF NOT EXISTS books_lower_author_idx ON books (lower(author));
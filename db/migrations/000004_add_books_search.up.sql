@@ -0,0 +1,7 @@
+ALTER TABLE books ADD COLUMN IF NOT EXISTS search tsvector
+  GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(author, '')), 'B') ||
+    setweight(to_tsvector('english', coalesce(publisher, '')), 'C')
+  ) STORED;
+CREATE INDEX IF NOT EXISTS books_search_idx ON books USING GIN (search);
@@ -0,0 +1,5 @@
+ALTER TABLE books ADD COLUMN rating INT, ADD COLUMN status VARCHAR(16);
+UPDATE books b SET rating = c.rating, status = c.status
+  FROM books_current c WHERE c.id = b.id;
+DROP VIEW IF EXISTS books_current;
+DROP TABLE IF EXISTS book_history;
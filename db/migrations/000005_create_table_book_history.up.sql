@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS book_history (
+  id         BIGSERIAL    PRIMARY KEY,
+  book_id    VARCHAR(36)  NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+  field      VARCHAR(16)  NOT NULL,
+  old_value  VARCHAR(16)  NOT NULL DEFAULT '',
+  new_value  VARCHAR(16)  NOT NULL,
+  actor      VARCHAR(128) NOT NULL DEFAULT '',
+  changed_at TIMESTAMPTZ  NOT NULL
+);
+CREATE INDEX IF NOT EXISTS book_history_book_field_idx
+  ON book_history (book_id, field, id DESC);
+
+-- the current values become the first history entry of every book
+INSERT INTO book_history (book_id, field, new_value, changed_at)
+  SELECT id, 'status', status, coalesce(updated_at, now())
+  FROM books WHERE status IS NOT NULL;
+INSERT INTO book_history (book_id, field, new_value, changed_at)
+  SELECT id, 'rating', rating::text, coalesce(updated_at, now())
+  FROM books WHERE rating IS NOT NULL;
+
+ALTER TABLE books DROP COLUMN status, DROP COLUMN rating;
+
+-- books with the status and rating derived from the latest history entry
+CREATE VIEW books_current AS
+  SELECT b.id, b.title, b.author, b.publisher, b.pubdate,
+    (
+      SELECT h.new_value::int FROM book_history h
+      WHERE h.book_id = b.id AND h.field = 'rating'
+      ORDER BY h.id DESC LIMIT 1
+    ) AS rating,
+    (
+      SELECT h.new_value FROM book_history h
+      WHERE h.book_id = b.id AND h.field = 'status'
+      ORDER BY h.id DESC LIMIT 1
+    ) AS status,
+    b.search, b.created_at, b.updated_at
+  FROM books b;
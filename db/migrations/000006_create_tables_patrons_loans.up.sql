@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS patrons (
+  id         VARCHAR(36)  PRIMARY KEY,
+  name       VARCHAR(128) NOT NULL,
+  email      VARCHAR(256) NOT NULL,
+  created_at TIMESTAMPTZ,
+  updated_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS loans (
+  id             VARCHAR(36) PRIMARY KEY,
+  book_id        VARCHAR(36) NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+  patron_id      VARCHAR(36) NOT NULL REFERENCES patrons (id),
+  checked_out_at TIMESTAMPTZ NOT NULL,
+  due_date       DATE        NOT NULL,
+  returned_at    TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS loans_book_idx ON loans (book_id, checked_out_at DESC);
+
+-- a book can only be lent to one patron at a time
+CREATE UNIQUE INDEX IF NOT EXISTS loans_open_book_idx
+  ON loans (book_id) WHERE returned_at IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS loans_open_due_date_idx;
+ALTER TABLE loans DROP COLUMN IF EXISTS overdue_at;
@@ -0,0 +1,3 @@
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS overdue_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS loans_open_due_date_idx
+  ON loans (due_date) WHERE returned_at IS NULL;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS holds (
+  id         VARCHAR(36) PRIMARY KEY,
+  book_id    VARCHAR(36) NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+  patron_id  VARCHAR(36) NOT NULL REFERENCES patrons (id),
+  status     VARCHAR(16) NOT NULL,
+  placed_at  TIMESTAMPTZ NOT NULL,
+  ready_at   TIMESTAMPTZ,
+  expires_at TIMESTAMPTZ,
+  closed_at  TIMESTAMPTZ
+);
+
+-- the hold queue of a book, first placed first
+CREATE INDEX IF NOT EXISTS holds_queue_idx
+  ON holds (book_id, placed_at, id) WHERE closed_at IS NULL;
+
+-- a patron can only be in the queue of a book once
+CREATE UNIQUE INDEX IF NOT EXISTS holds_open_patron_idx
+  ON holds (book_id, patron_id) WHERE closed_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS holds_expires_at_idx
+  ON holds (expires_at) WHERE status = 'Ready';
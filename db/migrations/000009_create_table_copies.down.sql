@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS holds_ready_copy_idx;
+ALTER TABLE holds DROP COLUMN IF EXISTS copy_id;
+
+DROP INDEX IF EXISTS loans_open_copy_idx;
+ALTER TABLE loans DROP COLUMN IF EXISTS copy_id;
+CREATE UNIQUE INDEX IF NOT EXISTS loans_open_book_idx
+  ON loans (book_id) WHERE returned_at IS NULL;
+
+DROP TABLE IF EXISTS copies;
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS copies (
+  id         VARCHAR(36) PRIMARY KEY,
+  book_id    VARCHAR(36) NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+  barcode    VARCHAR(64) NOT NULL UNIQUE,
+  status     VARCHAR(16) NOT NULL,
+  condition  VARCHAR(16) NOT NULL,
+  created_at TIMESTAMPTZ,
+  updated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS copies_book_idx ON copies (book_id, barcode);
+
+-- every book so far was a single copy, it shares the id of the book
+INSERT INTO copies (id, book_id, barcode, status, condition, created_at, updated_at)
+  SELECT id, id, id, status, 'Good', now(), now() FROM books_current;
+
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS copy_id VARCHAR(36)
+  REFERENCES copies (id) ON DELETE SET NULL;
+UPDATE loans SET copy_id = book_id;
+
+-- a copy can only be lent to one patron at a time, a book to many
+DROP INDEX IF EXISTS loans_open_book_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS loans_open_copy_idx
+  ON loans (copy_id) WHERE returned_at IS NULL;
+
+ALTER TABLE holds ADD COLUMN IF NOT EXISTS copy_id VARCHAR(36)
+  REFERENCES copies (id) ON DELETE SET NULL;
+UPDATE holds SET copy_id = book_id WHERE status = 'Ready';
+
+-- a copy can only be held for one patron at a time
+CREATE UNIQUE INDEX IF NOT EXISTS holds_ready_copy_idx
+  ON holds (copy_id) WHERE status = 'Ready';
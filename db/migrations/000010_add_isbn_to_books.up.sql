@@ -0,0 +1,18 @@
+ALTER TABLE books ADD COLUMN IF NOT EXISTS isbn VARCHAR(13);
+CREATE UNIQUE INDEX IF NOT EXISTS books_isbn_idx ON books (isbn);
+
+-- new columns of a view can only be appended
+CREATE OR REPLACE VIEW books_current AS
+  SELECT b.id, b.title, b.author, b.publisher, b.pubdate,
+    (
+      SELECT h.new_value::int FROM book_history h
+      WHERE h.book_id = b.id AND h.field = 'rating'
+      ORDER BY h.id DESC LIMIT 1
+    ) AS rating,
+    (
+      SELECT h.new_value FROM book_history h
+      WHERE h.book_id = b.id AND h.field = 'status'
+      ORDER BY h.id DESC LIMIT 1
+    ) AS status,
+    b.search, b.created_at, b.updated_at, b.isbn
+  FROM books b;
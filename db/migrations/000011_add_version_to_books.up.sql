@@ -0,0 +1,16 @@
+ALTER TABLE books ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE VIEW books_current AS
+  SELECT b.id, b.title, b.author, b.publisher, b.pubdate,
+    (
+      SELECT h.new_value::int FROM book_history h
+      WHERE h.book_id = b.id AND h.field = 'rating'
+      ORDER BY h.id DESC LIMIT 1
+    ) AS rating,
+    (
+      SELECT h.new_value FROM book_history h
+      WHERE h.book_id = b.id AND h.field = 'status'
+      ORDER BY h.id DESC LIMIT 1
+    ) AS status,
+    b.search, b.created_at, b.updated_at, b.isbn, b.version
+  FROM books b;
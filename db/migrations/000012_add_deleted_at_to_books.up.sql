@@ -0,0 +1,24 @@
+ALTER TABLE books ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS books_deleted_at_idx
+  ON books (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- books in the trash give up their isbn
+DROP INDEX IF EXISTS books_isbn_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS books_isbn_idx
+  ON books (isbn) WHERE deleted_at IS NULL;
+
+-- new columns of a view can only be appended
+CREATE OR REPLACE VIEW books_current AS
+  SELECT b.id, b.title, b.author, b.publisher, b.pubdate,
+    (
+      SELECT h.new_value::int FROM book_history h
+      WHERE h.book_id = b.id AND h.field = 'rating'
+      ORDER BY h.id DESC LIMIT 1
+    ) AS rating,
+    (
+      SELECT h.new_value FROM book_history h
+      WHERE h.book_id = b.id AND h.field = 'status'
+      ORDER BY h.id DESC LIMIT 1
+    ) AS status,
+    b.search, b.created_at, b.updated_at, b.isbn, b.version, b.deleted_at
+  FROM books b;
@@ -0,0 +1,19 @@
+DROP VIEW IF EXISTS books_current;
+CREATE VIEW books_current AS
+  SELECT b.id, b.title, b.author, b.publisher, b.pubdate,
+    (
+      SELECT h.new_value::int FROM book_history h
+      WHERE h.book_id = b.id AND h.field = 'rating'
+      ORDER BY h.id DESC LIMIT 1
+    ) AS rating,
+    (
+      SELECT h.new_value FROM book_history h
+      WHERE h.book_id = b.id AND h.field = 'status'
+      ORDER BY h.id DESC LIMIT 1
+    ) AS status,
+    b.search, b.created_at, b.updated_at, b.isbn, b.version, b.deleted_at
+  FROM books b;
+
+DROP INDEX IF EXISTS books_status_id_idx;
+DROP INDEX IF EXISTS books_rating_id_idx;
+ALTER TABLE books DROP COLUMN IF EXISTS status, DROP COLUMN IF EXISTS rating;
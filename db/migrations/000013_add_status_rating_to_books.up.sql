@@ -0,0 +1,17 @@
+-- the current status and rating are kept on books beside their history so
+-- books can be filtered and sorted by them with an index
+ALTER TABLE books
+  ADD COLUMN IF NOT EXISTS status VARCHAR(16),
+  ADD COLUMN IF NOT EXISTS rating INT;
+
+UPDATE books b SET status = c.status, rating = c.rating
+  FROM books_current c WHERE c.id = b.id;
+
+CREATE INDEX IF NOT EXISTS books_status_id_idx ON books (status, id);
+CREATE INDEX IF NOT EXISTS books_rating_id_idx ON books (rating, id);
+
+DROP VIEW IF EXISTS books_current;
+CREATE VIEW books_current AS
+  SELECT b.id, b.title, b.author, b.publisher, b.pubdate, b.rating, b.status,
+    b.search, b.created_at, b.updated_at, b.isbn, b.version, b.deleted_at
+  FROM books b;
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS holds;
+DROP TABLE IF EXISTS loans;
+DROP TABLE IF EXISTS patrons;
+DROP TABLE IF EXISTS copies;
+DROP VIEW IF EXISTS books_current;
+DROP TABLE IF EXISTS book_history;
+DROP TABLE IF EXISTS books_search;
+DROP TABLE IF EXISTS books;
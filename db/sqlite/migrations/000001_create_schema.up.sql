@@ -0,0 +1,131 @@
+-- the schema of db/migrations as of 000011 for the sqlite repository
+-- times are stored as text in UTC which sorts in time order,
+-- dates as yyyy-mm-dd
+CREATE TABLE IF NOT EXISTS books (
+  id         VARCHAR(36)  PRIMARY KEY,
+  isbn       VARCHAR(13),
+  title      VARCHAR(128),
+  author     VARCHAR(128),
+  publisher  VARCHAR(128) NOT NULL,
+  pubdate    TEXT,
+  version    INT          NOT NULL DEFAULT 1,
+  created_at TEXT,
+  updated_at TEXT
+);
+CREATE INDEX IF NOT EXISTS books_title_id_idx ON books (title, id);
+CREATE INDEX IF NOT EXISTS books_pubdate_id_idx ON books (pubdate, id);
+CREATE INDEX IF NOT EXISTS books_lower_author_idx ON books (lower(author));
+CREATE UNIQUE INDEX IF NOT EXISTS books_isbn_idx ON books (isbn);
+
+-- full text search kept in sync with the books by triggers
+CREATE VIRTUAL TABLE IF NOT EXISTS books_search USING fts5 (
+  title, author, publisher,
+  content = 'books', tokenize = 'porter unicode61'
+);
+CREATE TRIGGER IF NOT EXISTS books_search_insert AFTER INSERT ON books BEGIN
+  INSERT INTO books_search (rowid, title, author, publisher)
+  VALUES (new.rowid, new.title, new.author, new.publisher);
+END;
+CREATE TRIGGER IF NOT EXISTS books_search_delete AFTER DELETE ON books BEGIN
+  INSERT INTO books_search (books_search, rowid, title, author, publisher)
+  VALUES ('delete', old.rowid, old.title, old.author, old.publisher);
+END;
+CREATE TRIGGER IF NOT EXISTS books_search_update
+  AFTER UPDATE OF title, author, publisher ON books BEGIN
+  INSERT INTO books_search (books_search, rowid, title, author, publisher)
+  VALUES ('delete', old.rowid, old.title, old.author, old.publisher);
+  INSERT INTO books_search (rowid, title, author, publisher)
+  VALUES (new.rowid, new.title, new.author, new.publisher);
+END;
+
+CREATE TABLE IF NOT EXISTS book_history (
+  id         INTEGER      PRIMARY KEY AUTOINCREMENT,
+  book_id    VARCHAR(36)  NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+  field      VARCHAR(16)  NOT NULL,
+  old_value  VARCHAR(16)  NOT NULL DEFAULT '',
+  new_value  VARCHAR(16)  NOT NULL,
+  actor      VARCHAR(128) NOT NULL DEFAULT '',
+  changed_at TEXT         NOT NULL
+);
+CREATE INDEX IF NOT EXISTS book_history_book_field_idx
+  ON book_history (book_id, field, id DESC);
+
+-- books with the status and rating derived from the latest history entry
+CREATE VIEW IF NOT EXISTS books_current AS
+  SELECT b.id, b.title, b.author, b.publisher, b.pubdate,
+    (
+      SELECT CAST(h.new_value AS INT) FROM book_history h
+      WHERE h.book_id = b.id AND h.field = 'rating'
+      ORDER BY h.id DESC LIMIT 1
+    ) AS rating,
+    (
+      SELECT h.new_value FROM book_history h
+      WHERE h.book_id = b.id AND h.field = 'status'
+      ORDER BY h.id DESC LIMIT 1
+    ) AS status,
+    b.rowid AS search_id, b.created_at, b.updated_at, b.isbn, b.version
+  FROM books b;
+
+CREATE TABLE IF NOT EXISTS copies (
+  id         VARCHAR(36) PRIMARY KEY,
+  book_id    VARCHAR(36) NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+  barcode    VARCHAR(64) NOT NULL UNIQUE,
+  status     VARCHAR(16) NOT NULL,
+  condition  VARCHAR(16) NOT NULL,
+  created_at TEXT,
+  updated_at TEXT
+);
+CREATE INDEX IF NOT EXISTS copies_book_idx ON copies (book_id, barcode);
+
+CREATE TABLE IF NOT EXISTS patrons (
+  id         VARCHAR(36)  PRIMARY KEY,
+  name       VARCHAR(128) NOT NULL,
+  email      VARCHAR(256) NOT NULL,
+  created_at TEXT,
+  updated_at TEXT
+);
+
+CREATE TABLE IF NOT EXISTS loans (
+  id             VARCHAR(36) PRIMARY KEY,
+  book_id        VARCHAR(36) NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+  copy_id        VARCHAR(36) REFERENCES copies (id) ON DELETE SET NULL,
+  patron_id      VARCHAR(36) NOT NULL REFERENCES patrons (id),
+  checked_out_at TEXT        NOT NULL,
+  due_date       TEXT        NOT NULL,
+  returned_at    TEXT,
+  overdue_at     TEXT
+);
+CREATE INDEX IF NOT EXISTS loans_book_idx ON loans (book_id, checked_out_at DESC);
+CREATE INDEX IF NOT EXISTS loans_open_due_date_idx
+  ON loans (due_date) WHERE returned_at IS NULL;
+
+-- a copy can only be lent to one patron at a time, a book to many
+CREATE UNIQUE INDEX IF NOT EXISTS loans_open_copy_idx
+  ON loans (copy_id) WHERE returned_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS holds (
+  id         VARCHAR(36) PRIMARY KEY,
+  book_id    VARCHAR(36) NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+  copy_id    VARCHAR(36) REFERENCES copies (id) ON DELETE SET NULL,
+  patron_id  VARCHAR(36) NOT NULL REFERENCES patrons (id),
+  status     VARCHAR(16) NOT NULL,
+  placed_at  TEXT        NOT NULL,
+  ready_at   TEXT,
+  expires_at TEXT,
+  closed_at  TEXT
+);
+
+-- the hold queue of a book, first placed first
+CREATE INDEX IF NOT EXISTS holds_queue_idx
+  ON holds (book_id, placed_at, id) WHERE closed_at IS NULL;
+
+-- a patron can only be in the queue of a book once
+CREATE UNIQUE INDEX IF NOT EXISTS holds_open_patron_idx
+  ON holds (book_id, patron_id) WHERE closed_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS holds_expires_at_idx
+  ON holds (expires_at) WHERE status = 'Ready';
+
+-- a copy can only be held for one patron at a time
+CREATE UNIQUE INDEX IF NOT EXISTS holds_ready_copy_idx
+  ON holds (copy_id) WHERE status = 'Ready';
@@ -0,0 +1,26 @@
+-- 000012 of db/migrations
+ALTER TABLE books ADD COLUMN deleted_at TEXT;
+CREATE INDEX IF NOT EXISTS books_deleted_at_idx
+  ON books (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- books in the trash give up their isbn
+DROP INDEX IF EXISTS books_isbn_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS books_isbn_idx
+  ON books (isbn) WHERE deleted_at IS NULL;
+
+DROP VIEW IF EXISTS books_current;
+CREATE VIEW books_current AS
+  SELECT b.id, b.title, b.author, b.publisher, b.pubdate,
+    (
+      SELECT CAST(h.new_value AS INT) FROM book_history h
+      WHERE h.book_id = b.id AND h.field = 'rating'
+      ORDER BY h.id DESC LIMIT 1
+    ) AS rating,
+    (
+      SELECT h.new_value FROM book_history h
+      WHERE h.book_id = b.id AND h.field = 'status'
+      ORDER BY h.id DESC LIMIT 1
+    ) AS status,
+    b.rowid AS search_id, b.created_at, b.updated_at, b.isbn, b.version,
+    b.deleted_at
+  FROM books b;
@@ -0,0 +1,21 @@
+DROP VIEW IF EXISTS books_current;
+CREATE VIEW books_current AS
+  SELECT b.id, b.title, b.author, b.publisher, b.pubdate,
+    (
+      SELECT CAST(h.new_value AS INT) FROM book_history h
+      WHERE h.book_id = b.id AND h.field = 'rating'
+      ORDER BY h.id DESC LIMIT 1
+    ) AS rating,
+    (
+      SELECT h.new_value FROM book_history h
+      WHERE h.book_id = b.id AND h.field = 'status'
+      ORDER BY h.id DESC LIMIT 1
+    ) AS status,
+    b.rowid AS search_id, b.created_at, b.updated_at, b.isbn, b.version,
+    b.deleted_at
+  FROM books b;
+
+DROP INDEX IF EXISTS books_status_id_idx;
+DROP INDEX IF EXISTS books_rating_id_idx;
+ALTER TABLE books DROP COLUMN rating;
+ALTER TABLE books DROP COLUMN status;
@@ -0,0 +1,17 @@
+-- 000013 of db/migrations
+ALTER TABLE books ADD COLUMN status TEXT;
+ALTER TABLE books ADD COLUMN rating INTEGER;
+
+UPDATE books SET
+  status = (SELECT c.status FROM books_current c WHERE c.id = books.id),
+  rating = (SELECT c.rating FROM books_current c WHERE c.id = books.id);
+
+CREATE INDEX IF NOT EXISTS books_status_id_idx ON books (status, id);
+CREATE INDEX IF NOT EXISTS books_rating_id_idx ON books (rating, id);
+
+DROP VIEW IF EXISTS books_current;
+CREATE VIEW books_current AS
+  SELECT b.id, b.title, b.author, b.publisher, b.pubdate, b.rating, b.status,
+    b.rowid AS search_id, b.created_at, b.updated_at, b.isbn, b.version,
+    b.deleted_at
+  FROM books b;
@@ -6,15 +6,17 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/tempcke/books/entity/validation"
 )
 
 // Validation Errors
 var (
-	ErrTitleIsRequired   = errors.New("Title is required")
-	ErrAuthorIsRequired  = errors.New("Author is required")
-	ErrPubDateIsRequired = errors.New("PubDate is required")
-	ErrRatingInvalid     = errors.New("Rating value is not supported")
-	ErrStatusInvalid     = errors.New("Status value is not supported")
+	ErrTitleIsRequired     = errors.New("Title is required")
+	ErrAuthorIsRequired    = errors.New("Author is required")
+	ErrPublisherIsRequired = errors.New("Publisher is required")
+	ErrPubDateIsRequired   = errors.New("PubDate is required")
+	ErrRatingInvalid       = errors.New("Rating value is not supported")
+	ErrStatusInvalid       = errors.New("Status value is not supported")
 )
 
 // Rating is a book rating from 1 to 3
@@ -35,7 +37,7 @@ const (
 	RateThree
 )
 
-// Status is the status of the book, checked in or out
+// Status is the status of the book, checked in, out or on hold for a patron
 type Status string
 
 func (s Status) String() string {
@@ -46,51 +48,78 @@ func (s Status) String() string {
 const (
 	StatusCheckedIn  = Status("CheckedIn")
 	StatusCheckedOut = Status("CheckedOut")
+	StatusOnHold     = Status("OnHold")
 )
 
-// Book entity
+// Book entity, ISBN is optional
+// Version counts the changes to a stored book starting at 1, it is used to
+// detect conflicting changes
+// DeletedAt is when the book was moved to the trash, zero for other books
 type Book struct {
-	ID      string
-	Title   string
-	Author  string
-	PubDate time.Time
-	Rating  Rating
-	Status  Status
+	ID        string
+	Version   int
+	ISBN      string
+	Title     string
+	Author    string
+	Publisher string
+	PubDate   time.Time
+	Rating    Rating
+	Status    Status
+	DeletedAt time.Time
+}
+
+// IsDeleted tells if the book is in the trash
+func (b Book) IsDeleted() bool {
+	return !b.DeletedAt.IsZero()
 }
 
 // NewBook creates a new Book
 func NewBook(
-	title, author string,
+	title, author, publisher string,
 	pubdate time.Time,
 	rating Rating,
 	status Status,
 ) Book {
 	return Book{
-		ID:      uuid.New().String(),
-		Title:   title,
-		Author:  author,
-		PubDate: pubdate,
-		Rating:  rating,
-		Status:  status,
+		ID:        uuid.New().String(),
+		Version:   1,
+		Title:     title,
+		Author:    author,
+		Publisher: publisher,
+		PubDate:   pubdate,
+		Rating:    rating,
+		Status:    status,
 	}
 }
 
 // Validate the Book object
 func (b Book) Validate() error {
+	var errs validation.Errors
 	var zeroTime time.Time
 	if len(b.Title) == 0 {
-		return ErrTitleIsRequired
+		errs.Add("Title", ErrTitleIsRequired)
 	}
 	if len(b.Author) == 0 {
-		return ErrAuthorIsRequired
+		errs.Add("Author", ErrAuthorIsRequired)
+	}
+	if len(b.Publisher) == 0 {
+		errs.Add("Publisher", ErrPublisherIsRequired)
 	}
 	if b.PubDate == zeroTime {
-		return ErrPubDateIsRequired
+		errs.Add("PubDate", ErrPubDateIsRequired)
+	}
+	if b.ISBN != "" {
+		if _, err := NormalizeISBN(b.ISBN); err != nil {
+			errs.Add("ISBN", err)
+		}
 	}
 	if err := b.validateRating(); err != nil {
-		return err
+		errs.Add("Rating", err)
+	}
+	if err := b.validateStatus(); err != nil {
+		errs.Add("Status", err)
 	}
-	return b.validateStatus()
+	return errs.Err()
 }
 
 func (b Book) validateRating() error {
@@ -103,7 +132,7 @@ func (b Book) validateRating() error {
 
 func (b Book) validateStatus() error {
 	switch b.Status {
-	case StatusCheckedIn, StatusCheckedOut:
+	case StatusCheckedIn, StatusCheckedOut, StatusOnHold:
 		return nil
 	}
 	return ErrStatusInvalid
@@ -1,10 +1,12 @@
 package book_test
 
 import (
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/entity/validation"
 )
 
 // dateFormat is the format I would expect a date value to be passed as a string
@@ -12,11 +14,12 @@ import (
 const dateFormat = "2006-01-02"
 
 const (
-	title   = "Refactoring"
-	author  = "Martin Fowler"
-	pubdate = "1999-06-28"
-	rating  = book.RateThree
-	status  = book.StatusCheckedIn
+	title     = "Refactoring"
+	author    = "Martin Fowler"
+	publisher = "Addison-Wesley"
+	pubdate   = "1999-06-28"
+	rating    = book.RateThree
+	status    = book.StatusCheckedIn
 )
 
 func TestBook(t *testing.T) {
@@ -24,9 +27,10 @@ func TestBook(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	b := book.NewBook(title, author, pubDate, rating, status)
+	b := book.NewBook(title, author, publisher, pubDate, rating, status)
 	assertEqual(t, title, b.Title)
 	assertEqual(t, author, b.Author)
+	assertEqual(t, publisher, b.Publisher)
 	assertEqual(t, pubDate, b.PubDate)
 	assertEqual(t, rating, b.Rating)
 	assertEqual(t, status, b.Status)
@@ -40,40 +44,80 @@ func TestBookValidation(t *testing.T) {
 	}
 
 	t.Run("Empty Title", func(t *testing.T) {
-		b := book.NewBook("", author, pubDate, rating, status)
-		assertEqual(t, book.ErrTitleIsRequired, b.Validate())
+		b := book.NewBook("", author, publisher, pubDate, rating, status)
+		assertIs(t, book.ErrTitleIsRequired, b.Validate())
 	})
 
 	t.Run("Empty Author", func(t *testing.T) {
-		b := book.NewBook(title, "", pubDate, rating, status)
-		assertEqual(t, book.ErrAuthorIsRequired, b.Validate())
+		b := book.NewBook(title, "", publisher, pubDate, rating, status)
+		assertIs(t, book.ErrAuthorIsRequired, b.Validate())
+	})
+
+	t.Run("Empty Publisher", func(t *testing.T) {
+		b := book.NewBook(title, author, "", pubDate, rating, status)
+		assertIs(t, book.ErrPublisherIsRequired, b.Validate())
 	})
 
 	t.Run("Zero PubDate", func(t *testing.T) {
-		b := book.NewBook(title, author, time.Time{}, rating, status)
-		assertEqual(t, book.ErrPubDateIsRequired, b.Validate())
+		b := book.NewBook(title, author, publisher, time.Time{}, rating, status)
+		assertIs(t, book.ErrPubDateIsRequired, b.Validate())
 	})
 
 	t.Run("Invalid Rating", func(t *testing.T) {
-		b := book.NewBook(title, author, pubDate, 42, status)
-		assertEqual(t, book.ErrRatingInvalid, b.Validate())
+		b := book.NewBook(title, author, publisher, pubDate, 42, status)
+		assertIs(t, book.ErrRatingInvalid, b.Validate())
 	})
 
 	t.Run("Invalid Status", func(t *testing.T) {
-		b := book.NewBook(title, author, pubDate, rating, "SomeInvalidStatus")
-		assertEqual(t, book.ErrStatusInvalid, b.Validate())
+		b := book.NewBook(title, author, publisher, pubDate, rating, "SomeInvalidStatus")
+		assertIs(t, book.ErrStatusInvalid, b.Validate())
+	})
+
+	t.Run("Invalid ISBN", func(t *testing.T) {
+		b := book.NewBook(title, author, publisher, pubDate, rating, status)
+		b.ISBN = "0-201-48567-3"
+		assertIs(t, book.ErrISBNInvalid, b.Validate())
+	})
+
+	t.Run("Valid ISBN-10", func(t *testing.T) {
+		b := book.NewBook(title, author, publisher, pubDate, rating, status)
+		b.ISBN = "0-201-48567-2"
+		assertEqual(t, nil, b.Validate())
+	})
+
+	t.Run("Every failed rule", func(t *testing.T) {
+		b := book.NewBook("", author, "", pubDate, 42, status)
+		err := b.Validate()
+		for _, want := range []error{book.ErrTitleIsRequired, book.ErrPublisherIsRequired, book.ErrRatingInvalid} {
+			assertIs(t, want, err)
+		}
+		var errs validation.Errors
+		if !errors.As(err, &errs) {
+			t.Fatalf("Want validation.Errors, got %T", err)
+		}
+		assertEqual(t, 3, len(errs))
+		assertEqual(t, "Title", errs[0].Field)
+		assertEqual(t, "Publisher", errs[1].Field)
+		assertEqual(t, "Rating", errs[2].Field)
 	})
 }
 
 func TestBookID(t *testing.T) {
-	b1 := book.NewBook("first book", "john smith", time.Now(), rating, status)
-	b2 := book.NewBook("second one", "john smith", time.Now(), rating, status)
+	b1 := book.NewBook("first book", "john smith", publisher, time.Now(), rating, status)
+	b2 := book.NewBook("second one", "john smith", publisher, time.Now(), rating, status)
 	// book id should be a uuid string, which is 36 chars long
 	assertEqual(t, 36, len(b1.ID))
 	assertEqual(t, 36, len(b2.ID))
 	assertNotEqual(t, b1.ID, b2.ID)
 }
 
+func assertIs(t *testing.T, want, got error) {
+	t.Helper()
+	if !errors.Is(got, want) {
+		t.Errorf("Want: %v\nGot:  %v", want, got)
+	}
+}
+
 func assertEqual(t *testing.T, want, got interface{}) {
 	t.Helper()
 	if got != want {
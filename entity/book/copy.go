@@ -0,0 +1,127 @@
+package book
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/tempcke/books/entity/validation"
+)
+
+// Copy Validation Errors
+var (
+	ErrBookIDIsRequired  = errors.New("BookID is required")
+	ErrBarcodeIsRequired = errors.New("Barcode is required")
+	ErrConditionInvalid  = errors.New("Condition value is not supported")
+)
+
+// Condition is the physical condition of a copy
+type Condition string
+
+func (c Condition) String() string {
+	return string(c)
+}
+
+// Condition values
+const (
+	ConditionNew     = Condition("New")
+	ConditionGood    = Condition("Good")
+	ConditionFair    = Condition("Fair")
+	ConditionPoor    = Condition("Poor")
+	ConditionDamaged = Condition("Damaged")
+)
+
+// Copy entity, a physical item of a book which can be lent out
+type Copy struct {
+	ID        string
+	BookID    string
+	Barcode   string
+	Status    Status
+	Condition Condition
+}
+
+// NewCopy creates a new checked in Copy of a book
+func NewCopy(bookID, barcode string, condition Condition) Copy {
+	return Copy{
+		ID:        uuid.New().String(),
+		BookID:    bookID,
+		Barcode:   barcode,
+		Status:    StatusCheckedIn,
+		Condition: condition,
+	}
+}
+
+// FirstCopy is the copy every book starts with, it shares the id of the book
+// and is labelled with it until a copy with a real barcode replaces it
+func FirstCopy(b Book) Copy {
+	return Copy{
+		ID:        b.ID,
+		BookID:    b.ID,
+		Barcode:   b.ID,
+		Status:    b.Status,
+		Condition: ConditionGood,
+	}
+}
+
+// IsAvailable tells if the copy can be checked out by anyone
+func (c Copy) IsAvailable() bool {
+	return c.Status == StatusCheckedIn
+}
+
+// Validate the Copy object
+func (c Copy) Validate() error {
+	var errs validation.Errors
+	if len(c.BookID) == 0 {
+		errs.Add("BookID", ErrBookIDIsRequired)
+	}
+	if len(c.Barcode) == 0 {
+		errs.Add("Barcode", ErrBarcodeIsRequired)
+	}
+	switch c.Condition {
+	case ConditionNew, ConditionGood, ConditionFair, ConditionPoor, ConditionDamaged:
+	default:
+		errs.Add("Condition", ErrConditionInvalid)
+	}
+	switch c.Status {
+	case StatusCheckedIn, StatusCheckedOut, StatusOnHold:
+	default:
+		errs.Add("Status", ErrStatusInvalid)
+	}
+	return errs.Err()
+}
+
+// Availability counts how many copies of a book can be checked out
+type Availability struct {
+	Total     int
+	Available int
+}
+
+// NewAvailability counts the available copies
+func NewAvailability(copies []Copy) Availability {
+	a := Availability{Total: len(copies)}
+	for _, c := range copies {
+		if c.IsAvailable() {
+			a.Available++
+		}
+	}
+	return a
+}
+
+// StatusOf summarises the copies as the status of their book, checked in
+// while any copy is available, on hold while any copy is held for a patron
+func StatusOf(copies []Copy) Status {
+	status := StatusCheckedOut
+	for _, c := range copies {
+		switch c.Status {
+		case StatusCheckedIn:
+			return StatusCheckedIn
+		case StatusOnHold:
+			status = StatusOnHold
+		}
+	}
+	return status
+}
+
+func (a Availability) String() string {
+	return fmt.Sprintf("%d of %d available", a.Available, a.Total)
+}
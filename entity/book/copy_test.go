@@ -0,0 +1,88 @@
+package book_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tempcke/books/entity/book"
+)
+
+const (
+	bookID  = "ee3b4b4e-6c8b-4b55-8a0b-0d4e3ef0b1a1"
+	barcode = "31234000123456"
+)
+
+func TestCopy(t *testing.T) {
+	c := book.NewCopy(bookID, barcode, book.ConditionNew)
+	assertEqual(t, bookID, c.BookID)
+	assertEqual(t, barcode, c.Barcode)
+	assertEqual(t, book.StatusCheckedIn, c.Status)
+	assertEqual(t, book.ConditionNew, c.Condition)
+	assertEqual(t, 36, len(c.ID))
+	assertEqual(t, true, c.IsAvailable())
+	assertEqual(t, nil, c.Validate())
+
+	c.Status = book.StatusOnHold
+	assertEqual(t, false, c.IsAvailable())
+}
+
+func TestFirstCopy(t *testing.T) {
+	b := book.NewBook(title, author, publisher, time.Now(), rating, book.StatusCheckedOut)
+	c := book.FirstCopy(b)
+	assertEqual(t, b.ID, c.ID)
+	assertEqual(t, b.ID, c.BookID)
+	assertEqual(t, b.ID, c.Barcode)
+	assertEqual(t, book.StatusCheckedOut, c.Status)
+	assertEqual(t, nil, c.Validate())
+}
+
+func TestCopyValidation(t *testing.T) {
+	t.Run("Empty BookID", func(t *testing.T) {
+		c := book.NewCopy("", barcode, book.ConditionGood)
+		assertIs(t, book.ErrBookIDIsRequired, c.Validate())
+	})
+
+	t.Run("Empty Barcode", func(t *testing.T) {
+		c := book.NewCopy(bookID, "", book.ConditionGood)
+		assertIs(t, book.ErrBarcodeIsRequired, c.Validate())
+	})
+
+	t.Run("Invalid Condition", func(t *testing.T) {
+		c := book.NewCopy(bookID, barcode, "Shiny")
+		assertIs(t, book.ErrConditionInvalid, c.Validate())
+	})
+
+	t.Run("Invalid Status", func(t *testing.T) {
+		c := book.NewCopy(bookID, barcode, book.ConditionGood)
+		c.Status = "Lost"
+		assertIs(t, book.ErrStatusInvalid, c.Validate())
+	})
+}
+
+func TestAvailability(t *testing.T) {
+	copy := func(status book.Status) book.Copy {
+		c := book.NewCopy(bookID, barcode, book.ConditionGood)
+		c.Status = status
+		return c
+	}
+	in := copy(book.StatusCheckedIn)
+	out := copy(book.StatusCheckedOut)
+	held := copy(book.StatusOnHold)
+
+	tt := []struct {
+		copies    []book.Copy
+		available string
+		status    book.Status
+	}{
+		{[]book.Copy{in}, "1 of 1 available", book.StatusCheckedIn},
+		{[]book.Copy{out, in, held}, "1 of 3 available", book.StatusCheckedIn},
+		{[]book.Copy{out, held}, "0 of 2 available", book.StatusOnHold},
+		{[]book.Copy{out, out}, "0 of 2 available", book.StatusCheckedOut},
+	}
+	for _, tc := range tt {
+		t.Run(tc.available, func(t *testing.T) {
+			assertEqual(t, tc.available, book.NewAvailability(tc.copies).String())
+			assertEqual(t, tc.status, book.StatusOf(tc.copies))
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package book
+
+import "time"
+
+// Field is a book attribute whose changes are kept as history
+type Field string
+
+func (f Field) String() string {
+	return string(f)
+}
+
+// Field values
+const (
+	FieldStatus = Field("status")
+	FieldRating = Field("rating")
+)
+
+// Change is a single entry in the history of a book
+// the latest change of a field holds the current value of that field
+type Change struct {
+	BookID    string
+	Field     Field
+	OldValue  string
+	NewValue  string
+	Actor     string
+	ChangedAt time.Time
+}
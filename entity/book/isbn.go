@@ -0,0 +1,74 @@
+package book
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrISBNInvalid is returned for an ISBN with a bad length or checksum
+var ErrISBNInvalid = errors.New("ISBN is not a valid ISBN-10 or ISBN-13")
+
+// NormalizeISBN returns the ISBN-13 form of an ISBN-10 or ISBN-13
+// hyphens and spaces are ignored, the checksum must be valid
+func NormalizeISBN(isbn string) (string, error) {
+	isbn = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(isbn))
+
+	switch len(isbn) {
+	case 10:
+		if !validISBN10(isbn) {
+			return "", ErrISBNInvalid
+		}
+		isbn13 := "978" + isbn[:9]
+		return isbn13 + string(isbn13CheckDigit(isbn13)), nil
+	case 13:
+		if !validISBN13(isbn) {
+			return "", ErrISBNInvalid
+		}
+		return isbn, nil
+	}
+	return "", ErrISBNInvalid
+}
+
+// validISBN10 checks the weighted mod 11 checksum, X is a check digit of 10
+func validISBN10(isbn string) bool {
+	sum := 0
+	for i, c := range isbn {
+		var d int
+		switch {
+		case c >= '0' && c <= '9':
+			d = int(c - '0')
+		case c == 'X' && i == 9:
+			d = 10
+		default:
+			return false
+		}
+		sum += (10 - i) * d
+	}
+	return sum%11 == 0
+}
+
+// validISBN13 checks the EAN-13 checksum and the 978 or 979 prefix
+func validISBN13(isbn string) bool {
+	if !strings.HasPrefix(isbn, "978") && !strings.HasPrefix(isbn, "979") {
+		return false
+	}
+	for _, c := range isbn {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return isbn13CheckDigit(isbn[:12]) == isbn[12]
+}
+
+// isbn13CheckDigit computes the last digit of an ISBN-13 from the first 12
+func isbn13CheckDigit(first12 string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(first12[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
@@ -0,0 +1,38 @@
+package book_test
+
+import (
+	"testing"
+
+	"github.com/tempcke/books/entity/book"
+)
+
+func TestNormalizeISBN(t *testing.T) {
+	tt := []struct {
+		isbn string
+		want string
+		err  error
+	}{
+		{"9780201485677", "9780201485677", nil},
+		{"978-0-201-48567-7", "9780201485677", nil},
+		{"0201485672", "9780201485677", nil},
+		{"0-201-48567-2", "9780201485677", nil},
+		{"0 306 40615 2", "9780306406157", nil},
+		{"0-8044-2957-X", "9780804429573", nil},
+		{"0-8044-2957-x", "9780804429573", nil},
+		{"979-10-90636-07-1", "9791090636071", nil},
+		{"", "", book.ErrISBNInvalid},
+		{"0201485673", "", book.ErrISBNInvalid},
+		{"9780201485678", "", book.ErrISBNInvalid},
+		{"9770201485677", "", book.ErrISBNInvalid},
+		{"020148567", "", book.ErrISBNInvalid},
+		{"02014X5672", "", book.ErrISBNInvalid},
+		{"978020148567X", "", book.ErrISBNInvalid},
+	}
+	for _, tc := range tt {
+		t.Run(tc.isbn, func(t *testing.T) {
+			got, err := book.NormalizeISBN(tc.isbn)
+			assertEqual(t, tc.err, err)
+			assertEqual(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package hold
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tempcke/books/entity/validation"
+)
+
+// Validation Errors
+var (
+	ErrBookIDIsRequired   = errors.New("BookID is required")
+	ErrPatronIDIsRequired = errors.New("PatronID is required")
+)
+
+// DefaultPickupWindow is how long a returned book is held for the patron
+// at the head of the queue before the hold expires
+const DefaultPickupWindow = 3 * 24 * time.Hour
+
+// Status is where a hold is in its life
+type Status string
+
+func (s Status) String() string {
+	return string(s)
+}
+
+// Status values
+// a hold waits in the queue until the book is returned, it is then ready for
+// pickup and is closed once fulfilled by a checkout, cancelled or expired
+const (
+	StatusWaiting   = Status("Waiting")
+	StatusReady     = Status("Ready")
+	StatusFulfilled = Status("Fulfilled")
+	StatusCancelled = Status("Cancelled")
+	StatusExpired   = Status("Expired")
+)
+
+// Hold entity, a patron waiting for a checked out book
+// CopyID, ReadyAt and ExpiresAt are empty until a copy is held for pickup
+// ClosedAt is the zero time while the hold is open
+type Hold struct {
+	ID        string
+	BookID    string
+	CopyID    string
+	PatronID  string
+	Status    Status
+	PlacedAt  time.Time
+	ReadyAt   time.Time
+	ExpiresAt time.Time
+	ClosedAt  time.Time
+}
+
+// NewHold creates a new Hold, waiting in the queue
+func NewHold(bookID, patronID string, placedAt time.Time) Hold {
+	return Hold{
+		ID:       uuid.New().String(),
+		BookID:   bookID,
+		PatronID: patronID,
+		Status:   StatusWaiting,
+		PlacedAt: placedAt,
+	}
+}
+
+// IsOpen tells if the hold is still waiting or ready for pickup
+func (h Hold) IsOpen() bool {
+	return h.Status == StatusWaiting || h.Status == StatusReady
+}
+
+// IsExpired tells if the pickup window of a ready hold ended before now
+func (h Hold) IsExpired(now time.Time) bool {
+	return h.Status == StatusReady && now.After(h.ExpiresAt)
+}
+
+// Validate the Hold object
+func (h Hold) Validate() error {
+	var errs validation.Errors
+	if len(h.BookID) == 0 {
+		errs.Add("BookID", ErrBookIDIsRequired)
+	}
+	if len(h.PatronID) == 0 {
+		errs.Add("PatronID", ErrPatronIDIsRequired)
+	}
+	return errs.Err()
+}
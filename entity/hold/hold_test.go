@@ -0,0 +1,92 @@
+package hold_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tempcke/books/entity/hold"
+)
+
+const (
+	bookID   = "ee3b4b4e-6c8b-4b55-8a0b-0d4e3ef0b1a1"
+	patronID = "5b0f7d3c-2f38-4c0a-9e43-1f1e6d1c7a52"
+)
+
+func TestHold(t *testing.T) {
+	now := time.Now()
+	h := hold.NewHold(bookID, patronID, now)
+	assertEqual(t, bookID, h.BookID)
+	assertEqual(t, patronID, h.PatronID)
+	assertEqual(t, now, h.PlacedAt)
+	assertEqual(t, hold.StatusWaiting, h.Status)
+	assertEqual(t, 36, len(h.ID))
+	assertEqual(t, true, h.IsOpen())
+	assertEqual(t, nil, h.Validate())
+
+	h.Status = hold.StatusReady
+	assertEqual(t, true, h.IsOpen())
+
+	for _, status := range []hold.Status{hold.StatusFulfilled, hold.StatusCancelled, hold.StatusExpired} {
+		h.Status = status
+		assertEqual(t, false, h.IsOpen())
+	}
+}
+
+func TestHoldExpired(t *testing.T) {
+	ready := time.Date(2021, 1, 1, 15, 0, 0, 0, time.UTC)
+	h := hold.NewHold(bookID, patronID, ready.AddDate(0, 0, -7))
+
+	t.Run("waiting holds do not expire", func(t *testing.T) {
+		assertEqual(t, false, h.IsExpired(ready.AddDate(1, 0, 0)))
+	})
+
+	h.Status = hold.StatusReady
+	h.ReadyAt = ready
+	h.ExpiresAt = ready.Add(hold.DefaultPickupWindow)
+
+	tt := []struct {
+		now     time.Time
+		expired bool
+	}{
+		{ready, false},
+		{h.ExpiresAt, false},
+		{h.ExpiresAt.Add(time.Second), true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.now.String(), func(t *testing.T) {
+			assertEqual(t, tc.expired, h.IsExpired(tc.now))
+		})
+	}
+}
+
+func TestHoldValidation(t *testing.T) {
+	now := time.Now()
+
+	t.Run("Empty BookID", func(t *testing.T) {
+		h := hold.NewHold("", patronID, now)
+		assertIs(t, hold.ErrBookIDIsRequired, h.Validate())
+	})
+
+	t.Run("Empty PatronID", func(t *testing.T) {
+		h := hold.NewHold(bookID, "", now)
+		assertIs(t, hold.ErrPatronIDIsRequired, h.Validate())
+	})
+}
+
+func assertIs(t *testing.T, want, got error) {
+	t.Helper()
+	if !errors.Is(got, want) {
+		t.Errorf("Want: %v\nGot:  %v", want, got)
+	}
+}
+
+func assertEqual(t *testing.T, want, got interface{}) {
+	t.Helper()
+	if got != want {
+		t.Errorf(
+			"Not Equal!\nWant: %v\t%T\nGot:  %v\t%T",
+			want, want,
+			got, got)
+	}
+}
@@ -0,0 +1,98 @@
+package loan
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tempcke/books/entity/validation"
+)
+
+// dateFormat is used to compare dates without their time of day
+const dateFormat = "2006-01-02"
+
+// Validation Errors
+var (
+	ErrBookIDIsRequired   = errors.New("BookID is required")
+	ErrPatronIDIsRequired = errors.New("PatronID is required")
+	ErrDueDateInvalid     = errors.New("DueDate must not be before the checkout date")
+)
+
+// DefaultPeriod is how long a book is lent for when no due date is given
+const DefaultPeriod = 14 * 24 * time.Hour
+
+// Loan entity, a copy of a book checked out by a patron
+// ReturnedAt is the zero time until the book is checked back in
+// OverdueAt is the zero time until the loan is found past its due date
+type Loan struct {
+	ID           string
+	BookID       string
+	CopyID       string
+	PatronID     string
+	CheckedOutAt time.Time
+	DueDate      time.Time
+	ReturnedAt   time.Time
+	OverdueAt    time.Time
+}
+
+// OverdueEvent is raised the first time a loan is found past its due date
+type OverdueEvent struct {
+	Loan       Loan
+	DaysLate   int
+	OccurredAt time.Time
+}
+
+// NewLoan creates a new Loan
+func NewLoan(bookID, patronID string, checkedOutAt, dueDate time.Time) Loan {
+	return Loan{
+		ID:           uuid.New().String(),
+		BookID:       bookID,
+		PatronID:     patronID,
+		CheckedOutAt: checkedOutAt,
+		DueDate:      dueDate,
+	}
+}
+
+// IsReturned tells if the book has been checked back in
+func (l Loan) IsReturned() bool {
+	return !l.ReturnedAt.IsZero()
+}
+
+// IsOverdue tells if the book should have been returned before now
+func (l Loan) IsOverdue(now time.Time) bool {
+	return !l.IsReturned() && l.DaysLate(now) > 0
+}
+
+// DaysLate is the number of days past the due date the book was returned,
+// or still is when it has not been returned yet
+func (l Loan) DaysLate(now time.Time) int {
+	if l.IsReturned() {
+		now = l.ReturnedAt
+	}
+	days := int(date(now).Sub(date(l.DueDate)).Hours() / 24)
+	if days < 0 {
+		return 0
+	}
+	return days
+}
+
+// date drops the time of day, keeping the calendar date
+func date(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Validate the Loan object
+func (l Loan) Validate() error {
+	var errs validation.Errors
+	if len(l.BookID) == 0 {
+		errs.Add("BookID", ErrBookIDIsRequired)
+	}
+	if len(l.PatronID) == 0 {
+		errs.Add("PatronID", ErrPatronIDIsRequired)
+	}
+	// the due date is a date, it may be the same day as the checkout
+	if l.DueDate.Format(dateFormat) < l.CheckedOutAt.Format(dateFormat) {
+		errs.Add("DueDate", ErrDueDateInvalid)
+	}
+	return errs.Err()
+}
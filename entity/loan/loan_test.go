@@ -0,0 +1,104 @@
+package loan_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tempcke/books/entity/loan"
+)
+
+const (
+	bookID   = "ee3b4b4e-6c8b-4b55-8a0b-0d4e3ef0b1a1"
+	patronID = "5b0f7d3c-2f38-4c0a-9e43-1f1e6d1c7a52"
+)
+
+func TestLoan(t *testing.T) {
+	now := time.Now()
+	due := now.AddDate(0, 0, 14)
+	l := loan.NewLoan(bookID, patronID, now, due)
+	assertEqual(t, bookID, l.BookID)
+	assertEqual(t, patronID, l.PatronID)
+	assertEqual(t, now, l.CheckedOutAt)
+	assertEqual(t, due, l.DueDate)
+	assertEqual(t, 36, len(l.ID))
+	assertEqual(t, false, l.IsReturned())
+	assertEqual(t, nil, l.Validate())
+
+	l.ReturnedAt = now
+	assertEqual(t, true, l.IsReturned())
+}
+
+func TestLoanOverdue(t *testing.T) {
+	checkedOut := time.Date(2021, 1, 1, 15, 0, 0, 0, time.UTC)
+	due := time.Date(2021, 1, 15, 0, 0, 0, 0, time.UTC)
+	l := loan.NewLoan(bookID, patronID, checkedOut, due)
+
+	tt := []struct {
+		now      time.Time
+		overdue  bool
+		daysLate int
+	}{
+		{checkedOut, false, 0},
+		{due, false, 0},
+		{due.Add(23 * time.Hour), false, 0},
+		{due.AddDate(0, 0, 1), true, 1},
+		{due.AddDate(0, 1, 0), true, 31},
+	}
+	for _, tc := range tt {
+		t.Run(tc.now.String(), func(t *testing.T) {
+			assertEqual(t, tc.overdue, l.IsOverdue(tc.now))
+			assertEqual(t, tc.daysLate, l.DaysLate(tc.now))
+		})
+	}
+
+	t.Run("returned loans are not overdue", func(t *testing.T) {
+		returned := l
+		returned.ReturnedAt = due.AddDate(0, 0, 3)
+		now := due.AddDate(0, 0, 10)
+		assertEqual(t, false, returned.IsOverdue(now))
+		assertEqual(t, 3, returned.DaysLate(now))
+	})
+}
+
+func TestLoanValidation(t *testing.T) {
+	now := time.Now()
+
+	t.Run("Empty BookID", func(t *testing.T) {
+		l := loan.NewLoan("", patronID, now, now)
+		assertIs(t, loan.ErrBookIDIsRequired, l.Validate())
+	})
+
+	t.Run("Empty PatronID", func(t *testing.T) {
+		l := loan.NewLoan(bookID, "", now, now)
+		assertIs(t, loan.ErrPatronIDIsRequired, l.Validate())
+	})
+
+	t.Run("Due the same day", func(t *testing.T) {
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		l := loan.NewLoan(bookID, patronID, now, today)
+		assertEqual(t, nil, l.Validate())
+	})
+
+	t.Run("Due before checkout", func(t *testing.T) {
+		l := loan.NewLoan(bookID, patronID, now, now.AddDate(0, 0, -1))
+		assertIs(t, loan.ErrDueDateInvalid, l.Validate())
+	})
+}
+
+func assertIs(t *testing.T, want, got error) {
+	t.Helper()
+	if !errors.Is(got, want) {
+		t.Errorf("Want: %v\nGot:  %v", want, got)
+	}
+}
+
+func assertEqual(t *testing.T, want, got interface{}) {
+	t.Helper()
+	if got != want {
+		t.Errorf(
+			"Not Equal!\nWant: %v\t%T\nGot:  %v\t%T",
+			want, want,
+			got, got)
+	}
+}
@@ -0,0 +1,45 @@
+package patron
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/tempcke/books/entity/validation"
+)
+
+// Validation Errors
+var (
+	ErrNameIsRequired = errors.New("Name is required")
+	ErrEmailInvalid   = errors.New("Email is not valid")
+)
+
+// Patron entity, a library member who can borrow books
+type Patron struct {
+	ID    string
+	Name  string
+	Email string
+}
+
+// NewPatron creates a new Patron
+func NewPatron(name, email string) Patron {
+	return Patron{
+		ID:    uuid.New().String(),
+		Name:  name,
+		Email: email,
+	}
+}
+
+// Validate the Patron object
+func (p Patron) Validate() error {
+	var errs validation.Errors
+	if len(p.Name) == 0 {
+		errs.Add("Name", ErrNameIsRequired)
+	}
+	// good enough to catch typos, the only real test is sending an email
+	at := strings.Index(p.Email, "@")
+	if at < 1 || at == len(p.Email)-1 {
+		errs.Add("Email", ErrEmailInvalid)
+	}
+	return errs.Err()
+}
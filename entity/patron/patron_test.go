@@ -0,0 +1,52 @@
+package patron_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tempcke/books/entity/patron"
+)
+
+const (
+	name  = "Jane Doe"
+	email = "jane@example.com"
+)
+
+func TestPatron(t *testing.T) {
+	p := patron.NewPatron(name, email)
+	assertEqual(t, name, p.Name)
+	assertEqual(t, email, p.Email)
+	assertEqual(t, 36, len(p.ID))
+	assertEqual(t, nil, p.Validate())
+}
+
+func TestPatronValidation(t *testing.T) {
+	t.Run("Empty Name", func(t *testing.T) {
+		p := patron.NewPatron("", email)
+		assertIs(t, patron.ErrNameIsRequired, p.Validate())
+	})
+
+	for _, e := range []string{"", "jane", "@example.com", "jane@"} {
+		t.Run("Invalid Email "+e, func(t *testing.T) {
+			p := patron.NewPatron(name, e)
+			assertIs(t, patron.ErrEmailInvalid, p.Validate())
+		})
+	}
+}
+
+func assertIs(t *testing.T, want, got error) {
+	t.Helper()
+	if !errors.Is(got, want) {
+		t.Errorf("Want: %v\nGot:  %v", want, got)
+	}
+}
+
+func assertEqual(t *testing.T, want, got interface{}) {
+	t.Helper()
+	if got != want {
+		t.Errorf(
+			"Not Equal!\nWant: %v\t%T\nGot:  %v\t%T",
+			want, want,
+			got, got)
+	}
+}
@@ -0,0 +1,58 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+)
+
+// Error is a rule a field of an entity failed, Rule is the sentinel error of
+// the rule such as book.ErrTitleIsRequired
+type Error struct {
+	Field string
+	Rule  error
+}
+
+func (e Error) Error() string {
+	return e.Rule.Error()
+}
+
+// Unwrap makes errors.Is(e, e.Rule) true
+func (e Error) Unwrap() error {
+	return e.Rule
+}
+
+// Errors is every rule an entity failed, in the order they were checked
+// the Validate method of every entity returns one rather than stopping at the
+// first rule, so a caller can report all of them at once
+type Errors []Error
+
+// Add records that field failed rule
+func (e *Errors) Add(field string, rule error) {
+	*e = append(*e, Error{Field: field, Rule: rule})
+}
+
+// Err is e as an error, nil when no rule failed
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is tells if any of the rules which failed is target
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package validation_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/tempcke/books/entity/validation"
+)
+
+var (
+	errRequired = errors.New("Name is required")
+	errInvalid  = errors.New("Email is not valid")
+	errOther    = errors.New("other")
+)
+
+func TestErrors(t *testing.T) {
+	t.Run("no failed rules is a nil error", func(t *testing.T) {
+		var errs validation.Errors
+		if err := errs.Err(); err != nil {
+			t.Errorf("Want nil, got %v", err)
+		}
+	})
+
+	t.Run("every failed rule", func(t *testing.T) {
+		var errs validation.Errors
+		errs.Add("Name", errRequired)
+		errs.Add("Email", errInvalid)
+		err := fmt.Errorf("adding patron: %w", errs.Err())
+
+		for _, rule := range []error{errRequired, errInvalid} {
+			if !errors.Is(err, rule) {
+				t.Errorf("errors.Is(err, %v) is false", rule)
+			}
+		}
+		if errors.Is(err, errOther) {
+			t.Errorf("errors.Is(err, %v) is true", errOther)
+		}
+
+		var got validation.Errors
+		if !errors.As(err, &got) || len(got) != 2 {
+			t.Fatalf("Want 2 validation errors, got %v", err)
+		}
+		if got[1].Field != "Email" || got[1].Rule != errInvalid {
+			t.Errorf("Want Email failed %v, got %v", errInvalid, got[1])
+		}
+		if want := "Name is required; Email is not valid"; errs.Error() != want {
+			t.Errorf("Want %q, got %q", want, errs.Error())
+		}
+	})
+}
@@ -0,0 +1,171 @@
+// Package sqlitemigrate is a go-migrate database driver for the pure go
+// modernc.org/sqlite driver, the sqlite3 driver of go-migrate needs cgo
+package sqlitemigrate
+
+import (
+	"database/sql"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/database"
+
+	// registers the "sqlite" database/sql driver
+	_ "modernc.org/sqlite"
+)
+
+// DriverName is the name of the database/sql driver and the url scheme
+const DriverName = "sqlite"
+
+const migrationsTable = "schema_migrations"
+
+func init() {
+	database.Register(DriverName, &Driver{})
+}
+
+// Driver runs migrations on a sqlite database
+type Driver struct {
+	db       *sql.DB
+	isLocked bool
+}
+
+// WithInstance runs the migrations on an open database, which is required for
+// in memory databases as each connection to :memory: is a new database
+func WithInstance(db *sql.DB) (database.Driver, error) {
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	query := `
+		CREATE TABLE IF NOT EXISTS ` + migrationsTable + ` (version INT, dirty BOOL);
+		CREATE UNIQUE INDEX IF NOT EXISTS version_unique ON ` + migrationsTable + ` (version);
+	`
+	if _, err := db.Exec(query); err != nil {
+		return nil, err
+	}
+	return &Driver{db: db}, nil
+}
+
+// Open opens the database file of a sqlite://path/to/file.db url
+func (d *Driver) Open(url string) (database.Driver, error) {
+	db, err := sql.Open(DriverName, strings.TrimPrefix(url, DriverName+"://"))
+	if err != nil {
+		return nil, err
+	}
+	return WithInstance(db)
+}
+
+// Close closes the database
+func (d *Driver) Close() error {
+	return d.db.Close()
+}
+
+// Lock is a no-op beyond guarding against concurrent use of the driver,
+// sqlite itself only allows one writer at a time
+func (d *Driver) Lock() error {
+	if d.isLocked {
+		return database.ErrLocked
+	}
+	d.isLocked = true
+	return nil
+}
+
+// Unlock releases Lock
+func (d *Driver) Unlock() error {
+	d.isLocked = false
+	return nil
+}
+
+// Run runs a migration in a transaction
+func (d *Driver) Run(migration io.Reader) error {
+	raw, err := ioutil.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction start failed"}
+	}
+	if _, err := tx.Exec(string(raw)); err != nil {
+		tx.Rollback()
+		return &database.Error{OrigErr: err, Query: raw}
+	}
+	if err := tx.Commit(); err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction commit failed"}
+	}
+	return nil
+}
+
+// SetVersion records the version the database was migrated to
+func (d *Driver) SetVersion(version int, dirty bool) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction start failed"}
+	}
+
+	query := "DELETE FROM " + migrationsTable
+	if _, err := tx.Exec(query); err != nil {
+		tx.Rollback()
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+
+	// a dirty nil version is kept so a failed first migration is noticed
+	if version >= 0 || (version == database.NilVersion && dirty) {
+		query = "INSERT INTO " + migrationsTable + " (version, dirty) VALUES (?1, ?2)"
+		if _, err := tx.Exec(query, version, dirty); err != nil {
+			tx.Rollback()
+			return &database.Error{OrigErr: err, Query: []byte(query)}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction commit failed"}
+	}
+	return nil
+}
+
+// Version is the version the database was migrated to
+func (d *Driver) Version() (version int, dirty bool, err error) {
+	query := "SELECT version, dirty FROM " + migrationsTable + " LIMIT 1"
+	err = d.db.QueryRow(query).Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return database.NilVersion, false, nil
+	}
+	return version, dirty, err
+}
+
+// Drop removes every table and view, along with their indexes and triggers
+// full text search tables go before the tables they are made of
+func (d *Driver) Drop() error {
+	query := `
+		SELECT type, name FROM sqlite_master
+		WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%'
+		ORDER BY type = 'view' DESC, sql LIKE 'CREATE VIRTUAL%' DESC
+	`
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return &database.Error{OrigErr: err, Query: []byte(query)}
+	}
+
+	var drops []string
+	for rows.Next() {
+		var kind, name string
+		if err := rows.Scan(&kind, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		drops = append(drops, "DROP "+strings.ToUpper(kind)+" IF EXISTS "+name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, query := range drops {
+		if _, err := d.db.Exec(query); err != nil {
+			return &database.Error{OrigErr: err, Query: []byte(query)}
+		}
+	}
+	return nil
+}
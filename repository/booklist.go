@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/usecase"
+)
+
+// exportFetchSize is how many books an export reads at a time
+const exportFetchSize = 500
+
+// dialect is what differs between the sql of the Postgres and SQLite
+// repositories when a query is built
+type dialect struct {
+	// param is the placeholder of the nth arg
+	param func(n int) string
+	// date is the placeholder of the nth arg, a date in dateFormat
+	date func(n int) string
+	// contains is the condition that substr is within s
+	contains func(s, substr string) string
+}
+
+var postgresDialect = dialect{
+	param: func(n int) string { return "$" + strconv.Itoa(n) },
+	date:  func(n int) string { return "$" + strconv.Itoa(n) + "::date" },
+	contains: func(s, substr string) string {
+		return "strpos(" + s + ", " + substr + ") > 0"
+	},
+}
+
+// sqlite reads $1 as a named parameter, ?1 is the first arg
+var sqliteDialect = dialect{
+	param: func(n int) string { return "?" + strconv.Itoa(n) },
+	date:  func(n int) string { return "?" + strconv.Itoa(n) },
+	contains: func(s, substr string) string {
+		return "instr(" + s + ", " + substr + ") > 0"
+	},
+}
+
+// sortColumns maps the sort fields onto their column, the only values
+// ever concatenated into a query
+var sortColumns = map[usecase.SortField]string{
+	usecase.SortByTitle:     "title",
+	usecase.SortByAuthor:    "author",
+	usecase.SortByPublisher: "publisher",
+	usecase.SortByPubDate:   "pubdate",
+	usecase.SortByRating:    "rating",
+	usecase.SortByStatus:    "status",
+}
+
+// bookListQuery builds the sql and args for a BookQuery, pagination is done
+// with a keyset on the sort columns rather than an offset
+func bookListQuery(q usecase.BookQuery, d dialect) (string, []interface{}, error) {
+	var (
+		where = []string{"deleted_at IS NULL"}
+		args  []interface{}
+	)
+	arg := func(v interface{}) string {
+		if t, ok := v.(time.Time); ok {
+			args = append(args, t.Format(dateFormat))
+			return d.date(len(args))
+		}
+		args = append(args, v)
+		return d.param(len(args))
+	}
+
+	f := q.Filter
+	if f.Author != "" {
+		where = append(where, "lower(author) = lower("+arg(f.Author)+")")
+	}
+	if f.Status != "" {
+		where = append(where, "status = "+arg(f.Status))
+	}
+	if f.Rating != 0 {
+		where = append(where, "rating = "+arg(f.Rating))
+	}
+	if !f.PubDateFrom.IsZero() {
+		where = append(where, "pubdate >= "+arg(f.PubDateFrom))
+	}
+	if !f.PubDateTo.IsZero() {
+		where = append(where, "pubdate <= "+arg(f.PubDateTo))
+	}
+	if f.TitleContains != "" {
+		where = append(where, d.contains("lower(title)", "lower("+arg(f.TitleContains)+")"))
+	}
+
+	type orderCol struct {
+		name string
+		desc bool
+	}
+	var order []orderCol
+	for _, s := range q.OrderBy() {
+		col, ok := sortColumns[s.Field]
+		if !ok {
+			return "", nil, usecase.ErrSortFieldInvalid
+		}
+		order = append(order, orderCol{col, s.Desc})
+	}
+	order = append(order, orderCol{"id", false})
+
+	if q.After != "" {
+		after, err := usecase.ParseCursor(q.After)
+		if err != nil {
+			return "", nil, err
+		}
+		values := map[string]interface{}{
+			"title":     after.Title,
+			"author":    after.Author,
+			"publisher": after.Publisher,
+			"pubdate":   after.PubDate,
+			"rating":    after.Rating,
+			"status":    after.Status,
+			"id":        after.ID,
+		}
+
+		// (a > x) OR (a = x AND b > y) OR (a = x AND b = y AND c > z) ...
+		var keyset []string
+		for i, col := range order {
+			var terms []string
+			for _, prev := range order[:i] {
+				terms = append(terms, prev.name+" = "+arg(values[prev.name]))
+			}
+			op := " > "
+			if col.desc {
+				op = " < "
+			}
+			terms = append(terms, col.name+op+arg(values[col.name]))
+			keyset = append(keyset, "("+strings.Join(terms, " AND ")+")")
+		}
+		where = append(where, "("+strings.Join(keyset, " OR ")+")")
+	}
+
+	query := `
+		SELECT id, version, coalesce(isbn, ''), title, author, publisher, pubdate, rating, status
+		FROM books_current
+		WHERE ` + strings.Join(where, " AND ")
+
+	orderBy := make([]string, len(order))
+	for i, col := range order {
+		orderBy[i] = col.name
+		if col.desc {
+			orderBy[i] += " DESC"
+		}
+	}
+	query += " ORDER BY " + strings.Join(orderBy, ", ")
+
+	if q.Limit > 0 {
+		query += " LIMIT " + arg(q.Limit+1)
+	}
+
+	return query, args, nil
+}
+
+// exportByPage calls fn with every book matching q, the books are listed a
+// page at a time so nothing is held open while fn runs
+func exportByPage(
+	ctx context.Context,
+	list func(context.Context, usecase.BookQuery) (usecase.BookPage, error),
+	q usecase.BookQuery,
+	fn func(book.Book) error,
+) error {
+	q.Limit, q.After = exportFetchSize, ""
+	for {
+		page, err := list(ctx, q)
+		if err != nil {
+			return err
+		}
+		for _, b := range page.Books {
+			if err := fn(b); err != nil {
+				return err
+			}
+		}
+		if page.Next == "" {
+			return nil
+		}
+		q.After = page.Next
+	}
+}
@@ -0,0 +1,305 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/repository/repoerr"
+	"github.com/tempcke/books/usecase"
+)
+
+// AddBook adds a book along with its first copy,
+// its status and rating start the book history
+func (r Repo) AddBook(ctx context.Context, b book.Book) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.write(func() error {
+		if _, ok := r.books[b.ID]; ok || r.isbnTaken(b) {
+			return repoerr.ErrRecordNotUnique
+		}
+		b.Version = 1
+		r.books[b.ID] = b
+		r.copies[b.ID] = book.FirstCopy(b)
+		now := time.Now()
+		r.history[b.ID] = []book.Change{
+			{BookID: b.ID, Field: book.FieldStatus, NewValue: b.Status.String(), ChangedAt: now},
+			{BookID: b.ID, Field: book.FieldRating, NewValue: b.Rating.String(), ChangedAt: now},
+		}
+		return nil
+	})
+}
+
+// RemoveBook moves a book to the trash
+func (r Repo) RemoveBook(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.write(func() error {
+		b, ok := r.book(id)
+		if !ok {
+			return repoerr.ErrRecordNotFound
+		}
+		b.DeletedAt = time.Now()
+		b.Version++
+		r.books[id] = b
+		return nil
+	})
+}
+
+// GetBookByID gets a book by id
+func (r Repo) GetBookByID(ctx context.Context, id string) (book.Book, error) {
+	if err := ctx.Err(); err != nil {
+		return book.Book{}, err
+	}
+	defer r.read()()
+
+	b, ok := r.book(id)
+	if !ok {
+		return b, repoerr.ErrRecordNotFound
+	}
+	return b, nil
+}
+
+// book gets a book by id unless it is in the trash
+func (r Repo) book(id string) (book.Book, bool) {
+	b, ok := r.books[id]
+	if !ok || b.IsDeleted() {
+		return book.Book{}, false
+	}
+	return b, true
+}
+
+// GetBookByISBN gets a book by its ISBN-13
+func (r Repo) GetBookByISBN(ctx context.Context, isbn string) (book.Book, error) {
+	if err := ctx.Err(); err != nil {
+		return book.Book{}, err
+	}
+	defer r.read()()
+
+	if b, ok := r.bookByISBN(isbn); ok {
+		return b, nil
+	}
+	return book.Book{}, repoerr.ErrRecordNotFound
+}
+
+func (r Repo) bookByISBN(isbn string) (book.Book, bool) {
+	for _, b := range r.books {
+		if isbn != "" && b.ISBN == isbn && !b.IsDeleted() {
+			return b, true
+		}
+	}
+	return book.Book{}, false
+}
+
+func (r Repo) isbnTaken(b book.Book) bool {
+	other, ok := r.bookByISBN(b.ISBN)
+	return ok && other.ID != b.ID
+}
+
+// BookList lists a page of books matching the query
+func (r Repo) BookList(ctx context.Context, q usecase.BookQuery) (usecase.BookPage, error) {
+	if err := ctx.Err(); err != nil {
+		return usecase.BookPage{}, err
+	}
+	defer r.read()()
+
+	page := usecase.BookPage{Books: make([]book.Book, 0)}
+
+	var after *book.Book
+	if q.After != "" {
+		b, err := usecase.ParseCursor(q.After)
+		if err != nil {
+			return page, err
+		}
+		after = &b
+	}
+
+	list := make([]book.Book, 0, len(r.books))
+	for _, b := range r.books {
+		if b.IsDeleted() || !q.Filter.Match(b) {
+			continue
+		}
+		if after != nil && !q.Less(*after, b) {
+			continue
+		}
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return q.Less(list[i], list[j])
+	})
+
+	if q.Limit > 0 && len(list) > q.Limit {
+		list = list[:q.Limit]
+		page.Next = usecase.NewCursor(list[len(list)-1])
+	}
+	page.Books = list
+
+	return page, nil
+}
+
+// SearchBooks is a naive search, every term of the query must be contained
+// in the title, author or publisher and title matches score the highest
+func (r Repo) SearchBooks(ctx context.Context, query string, limit int) ([]usecase.SearchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer r.read()()
+
+	results := make([]usecase.SearchResult, 0)
+	terms := strings.Fields(strings.ToLower(query))
+
+	for _, b := range r.books {
+		if b.IsDeleted() {
+			continue
+		}
+		res := usecase.SearchResult{Book: b, Highlights: make(map[string]string)}
+		fields := []struct {
+			name, value string
+			weight      float64
+		}{
+			{"title", b.Title, 1},
+			{"author", b.Author, 0.4},
+			{"publisher", b.Publisher, 0.2},
+		}
+
+		matchedAll := true
+		for _, term := range terms {
+			matched := false
+			for _, f := range fields {
+				if strings.Contains(strings.ToLower(f.value), term) {
+					matched = true
+					res.Score += f.weight
+					res.Highlights[f.name], _ = usecase.Highlight(highlight(f.value, terms))
+				}
+			}
+			matchedAll = matchedAll && matched
+		}
+
+		if matchedAll && len(terms) > 0 {
+			results = append(results, res)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Book.ID < results[j].Book.ID
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+// highlight wraps every case insensitive occurrence of the terms in s in the
+// match markers
+func highlight(s string, terms []string) string {
+	lower := strings.ToLower(s)
+	if len(lower) != len(s) {
+		return s
+	}
+	marked := make([]bool, len(s))
+	for _, term := range terms {
+		for i := 0; i+len(term) <= len(lower); i++ {
+			if lower[i:i+len(term)] == term {
+				for j := i; j < i+len(term); j++ {
+					marked[j] = true
+				}
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if marked[i] && (i == 0 || !marked[i-1]) {
+			sb.WriteString(usecase.MatchStart)
+		}
+		sb.WriteByte(s[i])
+		if marked[i] && (i == len(s)-1 || !marked[i+1]) {
+			sb.WriteString(usecase.MatchStop)
+		}
+	}
+	return sb.String()
+}
+
+// UpdateBook updates a book record except for status and rating
+func (r Repo) UpdateBook(ctx context.Context, b book.Book) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.write(func() error {
+		stored, ok := r.book(b.ID)
+		if !ok {
+			return repoerr.ErrRecordNotFound
+		}
+		if b.Version != stored.Version {
+			return usecase.ErrVersionConflict
+		}
+		if r.isbnTaken(b) {
+			return repoerr.ErrRecordNotUnique
+		}
+		b.Status, b.Rating = stored.Status, stored.Rating
+		b.Version++
+		r.books[b.ID] = b
+		return nil
+	})
+}
+
+// bump increments the version of a book after a change to it or its copies
+func (r Repo) bump(bookID string) {
+	if b, ok := r.books[bookID]; ok {
+		b.Version++
+		r.books[bookID] = b
+	}
+}
+
+// RecordChange appends to the book history and applies the new value
+func (r Repo) RecordChange(ctx context.Context, c book.Change) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.write(func() error {
+		b, ok := r.book(c.BookID)
+		if !ok {
+			return repoerr.ErrRecordNotFound
+		}
+
+		switch c.Field {
+		case book.FieldStatus:
+			b.Status = book.Status(c.NewValue)
+		case book.FieldRating:
+			rating, err := strconv.Atoi(c.NewValue)
+			if err != nil {
+				return err
+			}
+			b.Rating = book.Rating(rating)
+		default:
+			return errors.New("field has no history: " + c.Field.String())
+		}
+
+		b.Version++
+		r.books[c.BookID] = b
+		r.history[c.BookID] = append(r.history[c.BookID], c)
+		return nil
+	})
+}
+
+// BookHistory lists the changes of a book, oldest first
+func (r Repo) BookHistory(ctx context.Context, id string) ([]book.Change, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer r.read()()
+
+	list := make([]book.Change, len(r.history[id]))
+	copy(list, r.history[id])
+	return list, nil
+}
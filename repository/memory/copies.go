@@ -0,0 +1,131 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/repository/repoerr"
+)
+
+// AddCopy adds a copy of a book
+func (r Repo) AddCopy(ctx context.Context, c book.Copy) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.write(func() error {
+		if _, ok := r.copies[c.ID]; ok {
+			return repoerr.ErrRecordNotUnique
+		}
+		if _, ok := r.copyByBarcode(c.Barcode); ok {
+			return repoerr.ErrRecordNotUnique
+		}
+		r.copies[c.ID] = c
+		r.bump(c.BookID)
+		return nil
+	})
+}
+
+// UpdateCopy updates a copy of a book
+func (r Repo) UpdateCopy(ctx context.Context, c book.Copy) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.write(func() error {
+		if _, ok := r.copies[c.ID]; !ok {
+			return repoerr.ErrRecordNotFound
+		}
+		r.copies[c.ID] = c
+		r.bump(c.BookID)
+		return nil
+	})
+}
+
+// RemoveCopy removes a copy of a book
+func (r Repo) RemoveCopy(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.write(func() error {
+		c, ok := r.copies[id]
+		if !ok {
+			return repoerr.ErrRecordNotFound
+		}
+		delete(r.copies, id)
+		r.bump(c.BookID)
+		return nil
+	})
+}
+
+// GetCopyByID gets a copy by id
+func (r Repo) GetCopyByID(ctx context.Context, id string) (book.Copy, error) {
+	if err := ctx.Err(); err != nil {
+		return book.Copy{}, err
+	}
+	defer r.read()()
+
+	c, ok := r.copies[id]
+	if !ok {
+		return c, repoerr.ErrRecordNotFound
+	}
+	return c, nil
+}
+
+// GetCopyByBarcode gets a copy by barcode
+func (r Repo) GetCopyByBarcode(ctx context.Context, barcode string) (book.Copy, error) {
+	if err := ctx.Err(); err != nil {
+		return book.Copy{}, err
+	}
+	defer r.read()()
+
+	if c, ok := r.copyByBarcode(barcode); ok {
+		return c, nil
+	}
+	return book.Copy{}, repoerr.ErrRecordNotFound
+}
+
+func (r Repo) copyByBarcode(barcode string) (book.Copy, bool) {
+	for _, c := range r.copies {
+		if c.Barcode == barcode {
+			return c, true
+		}
+	}
+	return book.Copy{}, false
+}
+
+// BookCopies lists the copies of a book ordered by barcode
+func (r Repo) BookCopies(ctx context.Context, bookID string) ([]book.Copy, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer r.read()()
+
+	return r.bookCopies(bookID), nil
+}
+
+func (r Repo) bookCopies(bookID string) []book.Copy {
+	list := make([]book.Copy, 0)
+	for _, c := range r.copies {
+		if c.BookID == bookID {
+			list = append(list, c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Barcode < list[j].Barcode
+	})
+	return list
+}
+
+// BookAvailability counts the copies of each of the books
+func (r Repo) BookAvailability(ctx context.Context, bookIDs ...string) (map[string]book.Availability, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer r.read()()
+
+	counts := make(map[string]book.Availability, len(bookIDs))
+	for _, id := range bookIDs {
+		counts[id] = book.NewAvailability(r.bookCopies(id))
+	}
+	return counts, nil
+}
@@ -0,0 +1,24 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/usecase"
+)
+
+// ExportBooks calls fn with every book matching the query, fn is called
+// once the store is unlocked so it may take its time
+func (r Repo) ExportBooks(ctx context.Context, q usecase.BookQuery, fn func(book.Book) error) error {
+	q.Limit, q.After = 0, ""
+	page, err := r.BookList(ctx, q)
+	if err != nil {
+		return err
+	}
+	for _, b := range page.Books {
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/tempcke/books/entity/hold"
+	"github.com/tempcke/books/repository/repoerr"
+)
+
+// AddHold adds a hold, a patron can only have one open hold on a book
+func (r Repo) AddHold(ctx context.Context, h hold.Hold) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.write(func() error {
+		if _, ok := r.holds[h.ID]; ok {
+			return repoerr.ErrRecordNotUnique
+		}
+		for _, open := range r.holds {
+			if open.BookID == h.BookID && open.PatronID == h.PatronID && open.IsOpen() {
+				return repoerr.ErrRecordNotUnique
+			}
+		}
+		r.holds[h.ID] = h
+		return nil
+	})
+}
+
+// UpdateHold updates a hold record
+func (r Repo) UpdateHold(ctx context.Context, h hold.Hold) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.write(func() error {
+		if _, ok := r.holds[h.ID]; !ok {
+			return repoerr.ErrRecordNotFound
+		}
+		r.holds[h.ID] = h
+		return nil
+	})
+}
+
+// GetHoldByID gets a hold by id
+func (r Repo) GetHoldByID(ctx context.Context, id string) (hold.Hold, error) {
+	if err := ctx.Err(); err != nil {
+		return hold.Hold{}, err
+	}
+	defer r.read()()
+
+	h, ok := r.holds[id]
+	if !ok {
+		return h, repoerr.ErrRecordNotFound
+	}
+	return h, nil
+}
+
+// BookHolds lists the open holds of a book, first placed first
+func (r Repo) BookHolds(ctx context.Context, bookID string) ([]hold.Hold, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer r.read()()
+
+	list := make([]hold.Hold, 0)
+	for _, h := range r.holds {
+		if h.BookID == bookID && h.IsOpen() {
+			list = append(list, h)
+		}
+	}
+	sortHolds(list)
+	return list, nil
+}
+
+// ExpiredHolds lists the ready holds which expired before asOf
+func (r Repo) ExpiredHolds(ctx context.Context, asOf time.Time) ([]hold.Hold, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer r.read()()
+
+	list := make([]hold.Hold, 0)
+	for _, h := range r.holds {
+		if h.IsExpired(asOf) {
+			list = append(list, h)
+		}
+	}
+	sortHolds(list)
+	return list, nil
+}
+
+func sortHolds(list []hold.Hold) {
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].PlacedAt.Equal(list[j].PlacedAt) {
+			return list[i].PlacedAt.Before(list[j].PlacedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+}
@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/tempcke/books/entity/loan"
+	"github.com/tempcke/books/repository/repoerr"
+)
+
+// AddLoan adds a loan, a copy can only be in one open loan
+func (r Repo) AddLoan(ctx context.Context, l loan.Loan) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.write(func() error {
+		if _, ok := r.loans[l.ID]; ok {
+			return repoerr.ErrRecordNotUnique
+		}
+		for _, open := range r.loans {
+			if l.CopyID != "" && open.CopyID == l.CopyID && !open.IsReturned() {
+				return repoerr.ErrRecordNotUnique
+			}
+		}
+		r.loans[l.ID] = l
+		return nil
+	})
+}
+
+// UpdateLoan updates a loan record
+func (r Repo) UpdateLoan(ctx context.Context, l loan.Loan) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.write(func() error {
+		if _, ok := r.loans[l.ID]; !ok {
+			return repoerr.ErrRecordNotFound
+		}
+		r.loans[l.ID] = l
+		return nil
+	})
+}
+
+// BookLoans lists the loans of a book, most recent first
+func (r Repo) BookLoans(ctx context.Context, bookID string) ([]loan.Loan, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer r.read()()
+
+	list := make([]loan.Loan, 0)
+	for _, l := range r.loans {
+		if l.BookID == bookID {
+			list = append(list, l)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CheckedOutAt.After(list[j].CheckedOutAt)
+	})
+	return list, nil
+}
+
+// OverdueLoans lists the open loans due before asOf, oldest due date first
+func (r Repo) OverdueLoans(ctx context.Context, asOf time.Time) ([]loan.Loan, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer r.read()()
+
+	list := make([]loan.Loan, 0)
+	for _, l := range r.loans {
+		if l.IsOverdue(asOf) {
+			list = append(list, l)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].DueDate.Equal(list[j].DueDate) {
+			return list[i].DueDate.Before(list[j].DueDate)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
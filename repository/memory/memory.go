@@ -0,0 +1,192 @@
+// Package memory is a usecase.LibraryRepo which keeps everything in memory,
+// for tests, demos and local development.  It can be persisted to a json
+// snapshot on disk so the library survives a restart.
+package memory
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/entity/hold"
+	"github.com/tempcke/books/entity/loan"
+	"github.com/tempcke/books/entity/patron"
+)
+
+// Repo stores books, copies, patrons, loans and holds in memory
+// it is safe for concurrent use, readers share the store while writers
+// and units of work have it to themselves
+// every method fails with ctx.Err() once ctx is done
+type Repo struct {
+	*store
+	mu     *sync.RWMutex
+	path   string
+	inWork bool
+}
+
+// store holds everything in the repo, it is shared by every copy of a
+// Repo so it can be rolled back in place
+type store struct {
+	books   map[string]book.Book
+	history map[string][]book.Change
+	copies  map[string]book.Copy
+	patrons map[string]patron.Patron
+	loans   map[string]loan.Loan
+	holds   map[string]hold.Hold
+}
+
+// NewRepo constructs an empty Repo
+func NewRepo() Repo {
+	s := newStore()
+	return Repo{
+		store: &s,
+		mu:    &sync.RWMutex{},
+	}
+}
+
+// Open constructs a Repo persisted to a json snapshot at path, the snapshot
+// is loaded when it exists and rewritten after every change
+func Open(path string) (Repo, error) {
+	r := NewRepo()
+	r.path = path
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return r, err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return r, err
+	}
+	snap.restore(r.store)
+	return r, nil
+}
+
+func newStore() store {
+	return store{
+		books:   make(map[string]book.Book),
+		history: make(map[string][]book.Change),
+		copies:  make(map[string]book.Copy),
+		patrons: make(map[string]patron.Patron),
+		loans:   make(map[string]loan.Loan),
+		holds:   make(map[string]hold.Hold),
+	}
+}
+
+// read locks the store for reading, the returned func unlocks it
+// within a unit of work the store is locked already
+func (r Repo) read() func() {
+	if r.inWork {
+		return func() {}
+	}
+	r.mu.RLock()
+	return r.mu.RUnlock
+}
+
+// write runs fn with the store locked for writing and saves the snapshot
+// when fn succeeds, within a unit of work it is saved when the work is done
+func (r Repo) write(fn func() error) error {
+	if r.inWork {
+		return fn()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.path == "" {
+		return fn()
+	}
+	saved := r.store.clone()
+	if err := fn(); err != nil {
+		return err
+	}
+	return r.saveOrRollback(saved)
+}
+
+// saveOrRollback saves the snapshot, when that fails the store is restored
+// to saved so a change which was not persisted is not kept either
+func (r Repo) saveOrRollback(saved store) error {
+	if err := r.save(); err != nil {
+		*r.store = saved
+		return err
+	}
+	return nil
+}
+
+// save writes the snapshot next to the previous one and then replaces it,
+// so a crash while saving does not lose the previous snapshot
+func (r Repo) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(newSnapshot(*r.store))
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(r.path), filepath.Base(r.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
+
+// snapshot is the json document a Repo is persisted as
+type snapshot struct {
+	Books   map[string]book.Book     `json:"books"`
+	History map[string][]book.Change `json:"history"`
+	Copies  map[string]book.Copy     `json:"copies"`
+	Patrons map[string]patron.Patron `json:"patrons"`
+	Loans   map[string]loan.Loan     `json:"loans"`
+	Holds   map[string]hold.Hold     `json:"holds"`
+}
+
+func newSnapshot(s store) snapshot {
+	return snapshot{
+		Books:   s.books,
+		History: s.history,
+		Copies:  s.copies,
+		Patrons: s.patrons,
+		Loans:   s.loans,
+		Holds:   s.holds,
+	}
+}
+
+// restore copies the snapshot into s, sections missing from it stay empty
+func (snap snapshot) restore(s *store) {
+	for k, v := range snap.Books {
+		s.books[k] = v
+	}
+	for k, v := range snap.History {
+		s.history[k] = v
+	}
+	for k, v := range snap.Copies {
+		s.copies[k] = v
+	}
+	for k, v := range snap.Patrons {
+		s.patrons[k] = v
+	}
+	for k, v := range snap.Loans {
+		s.loans[k] = v
+	}
+	for k, v := range snap.Holds {
+		s.holds[k] = v
+	}
+}
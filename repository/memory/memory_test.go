@@ -0,0 +1,134 @@
+package memory_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/entity/patron"
+	"github.com/tempcke/books/repository/memory"
+	"github.com/tempcke/books/repository/repotest"
+	"github.com/tempcke/books/usecase"
+)
+
+var ctx = context.Background()
+
+func TestRepo(t *testing.T) {
+	repotest.Run(t, func(*testing.T) usecase.LibraryRepo {
+		return memory.NewRepo()
+	})
+}
+
+func TestConcurrentUse(t *testing.T) {
+	r := memory.NewRepo()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b := makeBook("concurrent book")
+			assert.NoError(t, r.AddBook(ctx, b))
+			_, err := r.GetBookByID(ctx, b.ID)
+			assert.NoError(t, err)
+			_, err = r.BookList(ctx, usecase.BookQuery{Limit: 5})
+			assert.NoError(t, err)
+			_, err = r.SearchBooks(ctx, "concurrent", 0)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	page, err := r.BookList(ctx, usecase.BookQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, page.Books, 20)
+}
+
+func TestSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "library.json")
+
+	r, err := memory.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := makeBook("snapshot book")
+	p := patron.NewPatron("Jane Doe", "jane@example.com")
+	assert.NoError(t, r.AddBook(ctx, b))
+	assert.NoError(t, r.AddPatron(ctx, p))
+	_, err = usecase.CheckOut(ctx, r, b.ID, p.ID, time.Now(), time.Now().AddDate(0, 0, 14), "jane")
+	assert.NoError(t, err)
+
+	t.Run("reopened with everything stored", func(t *testing.T) {
+		r, err := memory.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bOut, err := r.GetBookByID(ctx, b.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, b.Title, bOut.Title)
+		assert.Equal(t, book.StatusCheckedOut, bOut.Status)
+		assert.True(t, b.PubDate.Equal(bOut.PubDate))
+
+		pOut, err := r.GetPatronByID(ctx, p.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, p, pOut)
+
+		loans, err := r.BookLoans(ctx, b.ID)
+		assert.NoError(t, err)
+		assert.Len(t, loans, 1)
+
+		history, err := r.BookHistory(ctx, b.ID)
+		assert.NoError(t, err)
+		assert.Len(t, history, 3)
+	})
+
+	t.Run("change which could not be saved is rolled back", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "memory")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := memory.Open(filepath.Join(dir, "library.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.RemoveAll(dir)
+
+		b := makeBook("unsaved book")
+		assert.Error(t, r.AddBook(ctx, b))
+		_, err = r.GetBookByID(ctx, b.ID)
+		assert.Error(t, err)
+
+		err = r.Atomic(ctx, func(r usecase.LibraryRepo) error {
+			return r.AddBook(ctx, b)
+		})
+		assert.Error(t, err)
+		_, err = r.GetBookByID(ctx, b.ID)
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid snapshot", func(t *testing.T) {
+		invalid := filepath.Join(dir, "invalid.json")
+		if err := ioutil.WriteFile(invalid, []byte("{"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := memory.Open(invalid)
+		assert.Error(t, err)
+	})
+}
+
+func makeBook(title string) book.Book {
+	return book.NewBook(title, "john smith", "acme publishing", time.Now(), book.RateOne, book.StatusCheckedIn)
+}
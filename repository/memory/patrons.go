@@ -0,0 +1,36 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/tempcke/books/entity/patron"
+	"github.com/tempcke/books/repository/repoerr"
+)
+
+// AddPatron adds a patron
+func (r Repo) AddPatron(ctx context.Context, p patron.Patron) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.write(func() error {
+		if _, ok := r.patrons[p.ID]; ok {
+			return repoerr.ErrRecordNotUnique
+		}
+		r.patrons[p.ID] = p
+		return nil
+	})
+}
+
+// GetPatronByID gets a patron by id
+func (r Repo) GetPatronByID(ctx context.Context, id string) (patron.Patron, error) {
+	if err := ctx.Err(); err != nil {
+		return patron.Patron{}, err
+	}
+	defer r.read()()
+
+	p, ok := r.patrons[id]
+	if !ok {
+		return p, repoerr.ErrRecordNotFound
+	}
+	return p, nil
+}
@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/repository/repoerr"
+	"github.com/tempcke/books/usecase"
+)
+
+// TrashedBooks lists the books in the trash, most recently removed first
+func (r Repo) TrashedBooks(ctx context.Context) ([]book.Book, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer r.read()()
+
+	list := make([]book.Book, 0)
+	for _, b := range r.books {
+		if b.IsDeleted() {
+			list = append(list, b)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].DeletedAt.Equal(list[j].DeletedAt) {
+			return list[i].DeletedAt.After(list[j].DeletedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+// RestoreBook takes a book out of the trash
+func (r Repo) RestoreBook(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.write(func() error {
+		b, ok := r.books[id]
+		if !ok || !b.IsDeleted() {
+			return repoerr.ErrRecordNotFound
+		}
+		if r.isbnTaken(b) {
+			return usecase.ErrISBNExists
+		}
+		b.DeletedAt = time.Time{}
+		b.Version++
+		r.books[id] = b
+		return nil
+	})
+}
+
+// PurgeBooks deletes the books removed before the given time along with
+// their history, copies, loans and holds
+func (r Repo) PurgeBooks(ctx context.Context, removedBefore time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	var n int
+	err := r.write(func() error {
+		for id, b := range r.books {
+			if !b.IsDeleted() || !b.DeletedAt.Before(removedBefore) {
+				continue
+			}
+			delete(r.books, id)
+			delete(r.history, id)
+			for _, c := range r.copies {
+				if c.BookID == id {
+					delete(r.copies, c.ID)
+				}
+			}
+			for _, l := range r.loans {
+				if l.BookID == id {
+					delete(r.loans, l.ID)
+				}
+			}
+			for _, h := range r.holds {
+				if h.BookID == id {
+					delete(r.holds, h.ID)
+				}
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
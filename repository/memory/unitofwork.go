@@ -0,0 +1,56 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/usecase"
+)
+
+// Atomic runs fn as a unit of work, everything fn changed is rolled back
+// when it returns an error, units of work run one at a time and nothing
+// else reads or writes the store until they are done
+func (r Repo) Atomic(ctx context.Context, fn func(usecase.LibraryRepo) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r.inWork {
+		return fn(r)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	saved := r.store.clone()
+	w := r
+	w.inWork = true
+	if err := fn(w); err != nil {
+		*r.store = saved
+		return err
+	}
+	return r.saveOrRollback(saved)
+}
+
+// clone copies everything stored so it can be restored on rollback
+func (s store) clone() store {
+	c := newStore()
+	for k, v := range s.books {
+		c.books[k] = v
+	}
+	for k, v := range s.history {
+		c.history[k] = append([]book.Change(nil), v...)
+	}
+	for k, v := range s.copies {
+		c.copies[k] = v
+	}
+	for k, v := range s.patrons {
+		c.patrons[k] = v
+	}
+	for k, v := range s.loans {
+		c.loans[k] = v
+	}
+	for k, v := range s.holds {
+		c.holds[k] = v
+	}
+	return c
+}
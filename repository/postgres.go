@@ -7,127 +7,204 @@ import (
 	"log"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/repository/repoerr"
+	"github.com/tempcke/books/usecase"
 )
 
-// Errors
-var (
-	ErrRecordNotFound  = errors.New("Record not found")
-	ErrRecordNotUnique = errors.New("Record not unique")
-)
+// pgUniqueViolation is the postgres error code of a unique constraint violation
+const pgUniqueViolation = "23505"
 
 // Postgres repository should NOT be used in production
 type Postgres struct {
-	db *sql.DB
+	timeouts
+	db   *sql.DB
+	q    querier
+	inTx bool
 }
 
 // NewPostgresRepo constructs an Postgres repository
-func NewPostgresRepo(db *sql.DB) Postgres {
+func NewPostgresRepo(db *sql.DB, options ...Option) Postgres {
 	if err := db.Ping(); err != nil {
 		log.Fatal("Could not connect to db: " + err.Error())
 	}
 
-	return Postgres{
-		db: db,
+	r := Postgres{
+		timeouts: defaultTimeouts(),
+		db:       db,
+		q:        db,
+	}
+	for _, option := range options {
+		option(&r.timeouts)
 	}
+	return r
 }
 
-// AddBook persists a book
-func (r Postgres) AddBook(b book.Book) error {
-	// custom error in case record already exists
-	if _, err := r.GetBookByID(b.ID); err == nil {
-		return ErrRecordNotUnique
-	}
+// isUniqueViolation tells if err is a unique constraint violation, a writer
+// can take an isbn after another one checked it was free
+func (r Postgres) isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pgUniqueViolation
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// AddBook persists a book along with its first copy,
+// its status and rating start the book history
+func (r Postgres) AddBook(ctx context.Context, b book.Book) error {
+	ctx, cancel := r.writeContext(ctx)
 	defer cancel()
 
+	// a single statement so a book is never stored without a history or copy
 	query := `
-		INSERT INTO books
-		(id, title, author, pubdate, rating, status, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		WITH b AS (
+			INSERT INTO books
+			(id, isbn, title, author, publisher, pubdate, created_at, updated_at)
+			VALUES ($1, $12, $2, $3, $4, $5, $8, $8)
+			ON CONFLICT DO NOTHING
+			RETURNING id
+		), c AS (
+			INSERT INTO copies
+			(id, book_id, barcode, status, condition, created_at, updated_at)
+			SELECT $9::text, b.id, $10::text, $6::text, $11::text, $8::timestamptz, $8::timestamptz
+			FROM b
+		)
+		INSERT INTO book_history (book_id, field, new_value, changed_at)
+		SELECT b.id, f.field, f.value, $8::timestamptz
+		FROM b, (VALUES ('status', $6::text), ('rating', $7::text)) f (field, value)
 	`
 
-	stmt, err := r.db.PrepareContext(ctx, query)
+	stmt, err := r.q.PrepareContext(ctx, query)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx,
+	first := book.FirstCopy(b)
+	result, err := stmt.ExecContext(ctx,
 		b.ID,
 		b.Title,
 		b.Author,
+		b.Publisher,
 		b.PubDate,
-		b.Rating,
 		b.Status,
+		b.Rating.String(),
 		time.Now(),
-		time.Now(),
+		first.ID,
+		first.Barcode,
+		first.Condition.String(),
+		nullString(b.ISBN),
+		b.Rating.Int(),
 	)
+	if err != nil {
+		return err
+	}
 
-	return err
+	// nothing is inserted when the id or isbn belongs to another book
+	if n, _ := result.RowsAffected(); n == 0 {
+		return repoerr.ErrRecordNotUnique
+	}
+
+	return nil
 }
 
-// RemoveBook removes a previously stored book
-func (r Postgres) RemoveBook(id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// RemoveBook moves a previously stored book to the trash
+func (r Postgres) RemoveBook(ctx context.Context, id string) error {
+	ctx, cancel := r.writeContext(ctx)
 	defer cancel()
 
-	query := "DELETE FROM books WHERE id = $1"
-	stmt, err := r.db.PrepareContext(ctx, query)
+	query := `
+		UPDATE books
+		SET deleted_at = $2, updated_at = $2, version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+	stmt, err := r.q.PrepareContext(ctx, query)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	result, err := stmt.ExecContext(ctx, id)
+	result, err := stmt.ExecContext(ctx, id, time.Now())
 
 	if err != nil {
 		return err
 	}
 
 	if n, _ := result.RowsAffected(); n == 0 {
-		return ErrRecordNotFound
+		return repoerr.ErrRecordNotFound
 	}
 
 	return nil
 }
 
 // GetBookByID returns a previously stored book
-func (r Postgres) GetBookByID(id string) (b book.Book, err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// within a transaction the book is locked until the transaction ends
+func (r Postgres) GetBookByID(ctx context.Context, id string) (b book.Book, err error) {
+	ctx, cancel := r.readContext(ctx)
 	defer cancel()
 
+	if r.inTx {
+		lock := "SELECT id FROM books WHERE id = $1 AND deleted_at IS NULL FOR UPDATE"
+		err := r.q.QueryRowContext(ctx, lock, id).Scan(&b.ID)
+		if err == sql.ErrNoRows {
+			return b, repoerr.ErrRecordNotFound
+		}
+		if err != nil {
+			return b, err
+		}
+	}
+
 	query := `
-		SELECT id, title, author, pubdate, rating, status
-		FROM books WHERE id = $1
+		SELECT id, version, coalesce(isbn, ''), title, author, publisher, pubdate, rating, status
+		FROM books_current WHERE id = $1 AND deleted_at IS NULL
 	`
 
-	err = r.db.QueryRowContext(ctx, query, id).Scan(
-		&b.ID, &b.Title, &b.Author,
+	err = r.q.QueryRowContext(ctx, query, id).Scan(
+		&b.ID, &b.Version, &b.ISBN, &b.Title, &b.Author, &b.Publisher,
 		&b.PubDate, &b.Rating, &b.Status,
 	)
+	if err == sql.ErrNoRows {
+		return b, repoerr.ErrRecordNotFound
+	}
 
 	return b, err
 }
 
-// BookList returns all books previously stored
-// idealy this would be filterable at some point...
-func (r Postgres) BookList() ([]book.Book, error) {
-	bookList := make([]book.Book, 0)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// GetBookByISBN returns a previously stored book by its ISBN-13
+func (r Postgres) GetBookByISBN(ctx context.Context, isbn string) (b book.Book, err error) {
+	ctx, cancel := r.readContext(ctx)
 	defer cancel()
 
 	query := `
-		SELECT id, title, author, pubdate, rating, status
-		FROM books
+		SELECT id, version, isbn, title, author, publisher, pubdate, rating, status
+		FROM books_current WHERE isbn = $1 AND deleted_at IS NULL
 	`
 
-	rows, err := r.db.QueryContext(ctx, query)
+	err = r.q.QueryRowContext(ctx, query, isbn).Scan(
+		&b.ID, &b.Version, &b.ISBN, &b.Title, &b.Author, &b.Publisher,
+		&b.PubDate, &b.Rating, &b.Status,
+	)
+	if err == sql.ErrNoRows {
+		return b, repoerr.ErrRecordNotFound
+	}
+
+	return b, err
+}
+
+// BookList returns a page of the stored books which match the query
+func (r Postgres) BookList(ctx context.Context, q usecase.BookQuery) (usecase.BookPage, error) {
+	page := usecase.BookPage{Books: make([]book.Book, 0)}
+
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+
+	query, args, err := bookListQuery(q, postgresDialect)
+	if err != nil {
+		return page, err
+	}
 
+	rows, err := r.q.QueryContext(ctx, query, args...)
 	if err != nil {
-		return bookList, err
+		return page, err
 	}
 	defer rows.Close()
 
@@ -135,33 +212,109 @@ func (r Postgres) BookList() ([]book.Book, error) {
 		b := book.Book{}
 
 		err = rows.Scan(
-			&b.ID, &b.Title, &b.Author,
+			&b.ID, &b.Version, &b.ISBN, &b.Title, &b.Author, &b.Publisher,
+			&b.PubDate, &b.Rating, &b.Status,
+		)
+		if err != nil {
+			return page, err
+		}
+
+		page.Books = append(page.Books, b)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	// one extra row was requested to know if there is another page
+	if q.Limit > 0 && len(page.Books) > q.Limit {
+		page.Books = page.Books[:q.Limit]
+		page.Next = usecase.NewCursor(page.Books[q.Limit-1])
+	}
+
+	return page, nil
+}
+
+// SearchBooks ranks the books matching a web search style query
+// eg: `fowler refactoring`, `"domain driven" -evans`, `rust or go`
+func (r Postgres) SearchBooks(ctx context.Context, query string, limit int) ([]usecase.SearchResult, error) {
+	results := make([]usecase.SearchResult, 0)
+
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+
+	// a NULL limit is the same as no limit
+	var maxRows interface{}
+	if limit > 0 {
+		maxRows = limit
+	}
+
+	sqlQuery := `
+		SELECT id, version, coalesce(isbn, ''), title, author, publisher, pubdate, rating, status,
+			ts_rank(search, q) AS score,
+			ts_headline('english', title, q, $3),
+			ts_headline('english', author, q, $3),
+			ts_headline('english', coalesce(publisher, ''), q, $3)
+		FROM books_current, websearch_to_tsquery('english', $1) q
+		WHERE search @@ q AND deleted_at IS NULL
+		ORDER BY score DESC, id
+		LIMIT $2
+	`
+	headlineOpts := `HighlightAll=true, StartSel="` + usecase.MatchStart +
+		`", StopSel="` + usecase.MatchStop + `"`
+
+	rows, err := r.q.QueryContext(ctx, sqlQuery, query, maxRows, headlineOpts)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			res                      usecase.SearchResult
+			title, author, publisher string
+		)
+		b := &res.Book
+
+		err = rows.Scan(
+			&b.ID, &b.Version, &b.ISBN, &b.Title, &b.Author, &b.Publisher,
 			&b.PubDate, &b.Rating, &b.Status,
+			&res.Score, &title, &author, &publisher,
 		)
 		if err != nil {
-			return bookList, err
+			return results, err
 		}
 
-		bookList = append(bookList, b)
+		res.Highlights = searchHighlights(title, author, publisher)
+		results = append(results, res)
 	}
 
-	return bookList, nil
+	return results, rows.Err()
 }
 
 // UpdateBook updates a previously stored book record
-func (r Postgres) UpdateBook(b book.Book) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// status and rating are left as is, use RecordChange to modify them
+func (r Postgres) UpdateBook(ctx context.Context, b book.Book) error {
+	// custom error in case the isbn belongs to another book
+	if other, err := r.GetBookByISBN(ctx, b.ISBN); err == nil && other.ID != b.ID {
+		return repoerr.ErrRecordNotUnique
+	}
+
+	ctx, cancel := r.writeContext(ctx)
 	defer cancel()
 
 	query := `
 		UPDATE books
-		SET rating = $2,
-				status = $3,
-				updated_at = $4
-		WHERE id = $1;
+		SET title = $2,
+				author = $3,
+				publisher = $4,
+				pubdate = $5,
+				updated_at = $6,
+				isbn = $7,
+				version = version + 1
+		WHERE id = $1 AND version = $8 AND deleted_at IS NULL;
 	`
 
-	stmt, err := r.db.PrepareContext(ctx, query)
+	stmt, err := r.q.PrepareContext(ctx, query)
 	if err != nil {
 		return err
 	}
@@ -169,9 +322,73 @@ func (r Postgres) UpdateBook(b book.Book) error {
 
 	result, err := stmt.ExecContext(ctx,
 		b.ID,
-		b.Rating,
-		b.Status,
+		b.Title,
+		b.Author,
+		b.Publisher,
+		b.PubDate,
 		time.Now(),
+		nullString(b.ISBN),
+		b.Version,
+	)
+
+	if r.isUniqueViolation(err) {
+		return repoerr.ErrRecordNotUnique
+	}
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := r.GetBookByID(ctx, b.ID); err == nil {
+			return usecase.ErrVersionConflict
+		}
+		return repoerr.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// RecordChange appends a change to the book history, the latest change
+// of a field is the current value of that field
+func (r Postgres) RecordChange(ctx context.Context, c book.Change) error {
+	status, rating, err := changedColumns(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := r.writeContext(ctx)
+	defer cancel()
+
+	// the current value on books changes in the same statement as its history
+	query := `
+		WITH b AS (
+			UPDATE books
+			SET version = version + 1,
+					status = coalesce($7, status),
+					rating = coalesce($8, rating)
+			WHERE id = $1 AND deleted_at IS NULL RETURNING id
+		)
+		INSERT INTO book_history
+		(book_id, field, old_value, new_value, actor, changed_at)
+		SELECT id, $2::text, $3::text, $4::text, $5::text, $6::timestamptz
+		FROM b
+	`
+
+	stmt, err := r.q.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx,
+		c.BookID,
+		c.Field,
+		c.OldValue,
+		c.NewValue,
+		c.Actor,
+		c.ChangedAt,
+		status,
+		rating,
 	)
 
 	if err != nil {
@@ -179,8 +396,45 @@ func (r Postgres) UpdateBook(b book.Book) error {
 	}
 
 	if n, _ := result.RowsAffected(); n == 0 {
-		return ErrRecordNotFound
+		return repoerr.ErrRecordNotFound
 	}
 
 	return nil
 }
+
+// BookHistory lists the status and rating changes of a book, oldest first
+func (r Postgres) BookHistory(ctx context.Context, id string) ([]book.Change, error) {
+	history := make([]book.Change, 0)
+
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+
+	query := `
+		SELECT book_id, field, old_value, new_value, actor, changed_at
+		FROM book_history
+		WHERE book_id = $1
+		ORDER BY id
+	`
+
+	rows, err := r.q.QueryContext(ctx, query, id)
+	if err != nil {
+		return history, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c := book.Change{}
+
+		err = rows.Scan(
+			&c.BookID, &c.Field, &c.OldValue,
+			&c.NewValue, &c.Actor, &c.ChangedAt,
+		)
+		if err != nil {
+			return history, err
+		}
+
+		history = append(history, c)
+	}
+
+	return history, rows.Err()
+}
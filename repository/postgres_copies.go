@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/repository/repoerr"
+)
+
+const copyColumns = `id, book_id, barcode, status, condition`
+
+// bumpVersion follows a CTE named c returning the book_id of a changed copy,
+// a change to a copy is a change to the version of its book
+const bumpVersion = `
+	UPDATE books SET version = version + 1
+	FROM c WHERE books.id = c.book_id
+`
+
+// AddCopy persists a copy of a book, barcodes are unique
+func (r Postgres) AddCopy(ctx context.Context, c book.Copy) error {
+	ctx, cancel := r.writeContext(ctx)
+	defer cancel()
+
+	query := `
+		WITH c AS (
+			INSERT INTO copies
+			(` + copyColumns + `, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $6)
+			ON CONFLICT (barcode) DO NOTHING
+			RETURNING book_id
+		)
+	` + bumpVersion
+
+	stmt, err := r.q.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx,
+		c.ID,
+		c.BookID,
+		c.Barcode,
+		c.Status.String(),
+		c.Condition.String(),
+		time.Now(),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return repoerr.ErrRecordNotUnique
+	}
+
+	return nil
+}
+
+// UpdateCopy updates the status and condition of a stored copy
+func (r Postgres) UpdateCopy(ctx context.Context, c book.Copy) error {
+	ctx, cancel := r.writeContext(ctx)
+	defer cancel()
+
+	query := `
+		WITH c AS (
+			UPDATE copies
+			SET status = $2,
+					condition = $3,
+					updated_at = $4
+			WHERE id = $1
+			RETURNING book_id
+		)
+	` + bumpVersion
+
+	stmt, err := r.q.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx,
+		c.ID,
+		c.Status.String(),
+		c.Condition.String(),
+		time.Now(),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return repoerr.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// RemoveCopy removes a stored copy
+func (r Postgres) RemoveCopy(ctx context.Context, id string) error {
+	ctx, cancel := r.writeContext(ctx)
+	defer cancel()
+
+	query := `
+		WITH c AS (
+			DELETE FROM copies WHERE id = $1 RETURNING book_id
+		)
+	` + bumpVersion
+	stmt, err := r.q.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return repoerr.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetCopyByID gets a copy by id
+func (r Postgres) GetCopyByID(ctx context.Context, id string) (book.Copy, error) {
+	query := `SELECT ` + copyColumns + ` FROM copies WHERE id = $1`
+	return r.copy(ctx, query, id)
+}
+
+// GetCopyByBarcode gets a copy by barcode
+func (r Postgres) GetCopyByBarcode(ctx context.Context, barcode string) (book.Copy, error) {
+	query := `SELECT ` + copyColumns + ` FROM copies WHERE barcode = $1`
+	return r.copy(ctx, query, barcode)
+}
+
+// BookCopies lists the copies of a book ordered by barcode
+func (r Postgres) BookCopies(ctx context.Context, bookID string) ([]book.Copy, error) {
+	query := `SELECT ` + copyColumns + ` FROM copies WHERE book_id = $1 ORDER BY barcode`
+	return r.copies(ctx, query, bookID)
+}
+
+// BookAvailability counts the copies of each of the books
+func (r Postgres) BookAvailability(ctx context.Context, bookIDs ...string) (map[string]book.Availability, error) {
+	counts := make(map[string]book.Availability, len(bookIDs))
+	if len(bookIDs) == 0 {
+		return counts, nil
+	}
+
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+
+	placeholders := make([]string, len(bookIDs))
+	args := make([]interface{}, len(bookIDs)+1)
+	args[0] = book.StatusCheckedIn.String()
+	for i, id := range bookIDs {
+		placeholders[i] = "$" + strconv.Itoa(i+2)
+		args[i+1] = id
+		counts[id] = book.Availability{}
+	}
+
+	query := `
+		SELECT book_id, count(*), count(*) FILTER (WHERE status = $1)
+		FROM copies
+		WHERE book_id IN (` + strings.Join(placeholders, ", ") + `)
+		GROUP BY book_id
+	`
+
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return counts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id string
+			a  book.Availability
+		)
+		if err := rows.Scan(&id, &a.Total, &a.Available); err != nil {
+			return counts, err
+		}
+		counts[id] = a
+	}
+
+	return counts, rows.Err()
+}
+
+func (r Postgres) copy(ctx context.Context, query string, args ...interface{}) (book.Copy, error) {
+	copies, err := r.copies(ctx, query, args...)
+	if err != nil {
+		return book.Copy{}, err
+	}
+	if len(copies) == 0 {
+		return book.Copy{}, repoerr.ErrRecordNotFound
+	}
+	return copies[0], nil
+}
+
+func (r Postgres) copies(ctx context.Context, query string, args ...interface{}) ([]book.Copy, error) {
+	copies := make([]book.Copy, 0)
+
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return copies, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			c                 book.Copy
+			status, condition string
+		)
+
+		err = rows.Scan(&c.ID, &c.BookID, &c.Barcode, &status, &condition)
+		if err != nil {
+			return copies, err
+		}
+		c.Status = book.Status(status)
+		c.Condition = book.Condition(condition)
+
+		copies = append(copies, c)
+	}
+
+	return copies, rows.Err()
+}
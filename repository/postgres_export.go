@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/usecase"
+)
+
+// ExportBooks streams the books matching the query through a cursor, a
+// batch is fetched within the read timeout and then passed to fn
+func (r Postgres) ExportBooks(ctx context.Context, q usecase.BookQuery, fn func(book.Book) error) error {
+	q.Limit, q.After = 0, ""
+	query, args, err := bookListQuery(q, postgresDialect)
+	if err != nil {
+		return err
+	}
+
+	// a cursor only lives as long as the transaction it is declared in
+	if r.inTx {
+		return r.exportBooks(ctx, query, args, fn)
+	}
+
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	txRepo := r
+	txRepo.q = tx
+	txRepo.inTx = true
+	if err := txRepo.exportBooks(ctx, query, args, fn); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r Postgres) exportBooks(ctx context.Context, query string, args []interface{}, fn func(book.Book) error) error {
+	if err := r.declareExport(ctx, query, args); err != nil {
+		return err
+	}
+	defer r.q.ExecContext(ctx, "CLOSE books_export")
+
+	for {
+		books, err := r.fetchExport(ctx)
+		if err != nil {
+			return err
+		}
+		for _, b := range books {
+			if err := fn(b); err != nil {
+				return err
+			}
+		}
+		if len(books) < exportFetchSize {
+			return nil
+		}
+	}
+}
+
+func (r Postgres) declareExport(ctx context.Context, query string, args []interface{}) error {
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+
+	_, err := r.q.ExecContext(ctx, "DECLARE books_export NO SCROLL CURSOR FOR "+query, args...)
+	return err
+}
+
+// fetchExport reads the next batch of books from the cursor
+func (r Postgres) fetchExport(ctx context.Context) ([]book.Book, error) {
+	books := make([]book.Book, 0, exportFetchSize)
+
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+
+	rows, err := r.q.QueryContext(ctx, "FETCH "+strconv.Itoa(exportFetchSize)+" FROM books_export")
+	if err != nil {
+		return books, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		b := book.Book{}
+
+		err = rows.Scan(
+			&b.ID, &b.Version, &b.ISBN, &b.Title, &b.Author, &b.Publisher,
+			&b.PubDate, &b.Rating, &b.Status,
+		)
+		if err != nil {
+			return books, err
+		}
+
+		books = append(books, b)
+	}
+
+	return books, rows.Err()
+}
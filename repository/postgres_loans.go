@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/tempcke/books/entity/loan"
+	"github.com/tempcke/books/repository/repoerr"
+)
+
+// AddLoan persists a loan
+func (r Postgres) AddLoan(ctx context.Context, l loan.Loan) error {
+	ctx, cancel := r.writeContext(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO loans
+		(id, book_id, copy_id, patron_id, checked_out_at, due_date, returned_at, overdue_at)
+		VALUES ($1, $2, $3, $4, $5, $6::date, $7, $8)
+		ON CONFLICT DO NOTHING
+	`
+
+	stmt, err := r.q.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx,
+		l.ID,
+		l.BookID,
+		nullString(l.CopyID),
+		l.PatronID,
+		l.CheckedOutAt,
+		l.DueDate.Format(dateFormat),
+		nullTime(l.ReturnedAt),
+		nullTime(l.OverdueAt),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	// nothing is inserted when the copy is already lent out
+	if n, _ := result.RowsAffected(); n == 0 {
+		return repoerr.ErrRecordNotUnique
+	}
+
+	return nil
+}
+
+// UpdateLoan updates a previously stored loan
+func (r Postgres) UpdateLoan(ctx context.Context, l loan.Loan) error {
+	ctx, cancel := r.writeContext(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE loans
+		SET due_date = $2::date,
+				returned_at = $3,
+				overdue_at = $4
+		WHERE id = $1;
+	`
+
+	stmt, err := r.q.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx,
+		l.ID,
+		l.DueDate.Format(dateFormat),
+		nullTime(l.ReturnedAt),
+		nullTime(l.OverdueAt),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return repoerr.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// BookLoans lists every loan of a book, most recent first
+func (r Postgres) BookLoans(ctx context.Context, bookID string) ([]loan.Loan, error) {
+	query := `
+		SELECT id, book_id, copy_id, patron_id, checked_out_at, due_date, returned_at, overdue_at
+		FROM loans
+		WHERE book_id = $1
+		ORDER BY checked_out_at DESC
+	`
+	return r.loans(ctx, query, bookID)
+}
+
+// OverdueLoans lists the open loans due before asOf, oldest due date first
+func (r Postgres) OverdueLoans(ctx context.Context, asOf time.Time) ([]loan.Loan, error) {
+	query := `
+		SELECT id, book_id, copy_id, patron_id, checked_out_at, due_date, returned_at, overdue_at
+		FROM loans
+		WHERE returned_at IS NULL AND due_date < $1::date
+		ORDER BY due_date, id
+	`
+	return r.loans(ctx, query, asOf.Format(dateFormat))
+}
+
+func (r Postgres) loans(ctx context.Context, query string, args ...interface{}) ([]loan.Loan, error) {
+	loans := make([]loan.Loan, 0)
+
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return loans, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			l                     loan.Loan
+			copyID                sql.NullString
+			returnedAt, overdueAt sql.NullTime
+		)
+
+		err = rows.Scan(
+			&l.ID, &l.BookID, &copyID, &l.PatronID,
+			&l.CheckedOutAt, &l.DueDate, &returnedAt, &overdueAt,
+		)
+		if err != nil {
+			return loans, err
+		}
+		l.CopyID = copyID.String
+		l.ReturnedAt = returnedAt.Time
+		l.OverdueAt = overdueAt.Time
+
+		loans = append(loans, l)
+	}
+
+	return loans, rows.Err()
+}
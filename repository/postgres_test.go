@@ -5,166 +5,141 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
-	"os"
 	"strconv"
 	"testing"
 	"time"
 
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/lib/pq"
 	"github.com/ory/dockertest"
 	"github.com/ory/dockertest/docker"
 	"github.com/stretchr/testify/assert"
 	"github.com/tempcke/books/entity/book"
 	"github.com/tempcke/books/repository"
+	"github.com/tempcke/books/repository/repotest"
 	"github.com/tempcke/books/usecase"
 )
 
-const dateFormat = "2006-01-02"
-
-var pgRepo repository.Postgres
+var (
+	pgDB   *sql.DB
+	pgRepo repository.Postgres
+)
 
 func TestPostgresRepo(t *testing.T) {
-	r := pgRepo
-
-	t.Run("ensure PostgresRepository is a BookReadWriter", func(t *testing.T) {
-		assert.Implements(t, (*usecase.BookReaderWriter)(nil), pgRepo)
+	skipWithoutPostgres(t)
+	t.Run("ensure PostgresRepository is a LibraryRepo", func(t *testing.T) {
+		assert.Implements(t, (*usecase.LibraryRepo)(nil), pgRepo)
 	})
-
-	t.Run("GetBookByID should return error when book not found", func(t *testing.T) {
-		b := makeBook("non existing book")
-		_, err := r.GetBookByID(b.ID)
-		assert.Error(t, err)
+	repotest.Run(t, func(*testing.T) usecase.LibraryRepo {
+		return pgRepo
 	})
+}
 
-	t.Run("add and get book", func(t *testing.T) {
-		b := makeBook("add book")
+func TestPostgresTimeouts(t *testing.T) {
+	skipWithoutPostgres(t)
+	testTimeouts(t, pgRepo, func(options ...repository.Option) usecase.LibraryRepo {
+		return repository.NewPostgresRepo(pgDB, options...)
+	})
+}
 
-		if err := r.AddBook(b); err != nil {
-			t.Fatal(err)
+// TestPostgresStatusAndRating filters and sorts on the status and rating
+// columns of books, which must follow the history as it changes
+func TestPostgresStatusAndRating(t *testing.T) {
+	skipWithoutPostgres(t)
+	author := "status rating " + strconv.Itoa(rand.Int())
+	var ids []string
+	for i, rating := range []book.Rating{book.RateOne, book.RateTwo, book.RateThree} {
+		b := book.NewBook(fmt.Sprintf("book %v", i), author, "acme publishing", time.Now(), rating, book.StatusCheckedIn)
+		assert.NoError(t, pgRepo.AddBook(ctx, b))
+		ids = append(ids, b.ID)
+	}
+	_, err := usecase.ChangeBookRating(ctx, pgRepo, ids[0], 0, book.RateThree, "librarian")
+	assert.NoError(t, err)
+	_, err = usecase.ChangeBookStatus(ctx, pgRepo, ids[1], book.StatusCheckedOut, "librarian")
+	assert.NoError(t, err)
+
+	titles := func(q usecase.BookQuery) []string {
+		q.Filter.Author = author
+		page, err := pgRepo.BookList(ctx, q)
+		assert.NoError(t, err)
+		var titles []string
+		for _, b := range page.Books {
+			titles = append(titles, b.Title)
 		}
+		return titles
+	}
 
-		bOut, err := r.GetBookByID(b.ID)
-		assert.NoError(t, err)
-		assert.Equal(t, b.ID, bOut.ID)
-		assert.Equal(t, b.Title, bOut.Title)
-		assert.Equal(t, b.Author, bOut.Author)
-		assert.Equal(t, b.PubDate.Format(dateFormat), bOut.PubDate.Format(dateFormat))
-		assert.Equal(t, b.Rating, bOut.Rating)
-		assert.Equal(t, b.Status, bOut.Status)
+	t.Run("filtered by rating", func(t *testing.T) {
+		q := usecase.BookQuery{Filter: usecase.BookFilter{Rating: book.RateThree}, Sort: []usecase.Sort{{Field: usecase.SortByTitle}}}
+		assert.Equal(t, []string{"book 0", "book 2"}, titles(q))
 	})
 
-	t.Run("expect error when adding a book that already exists", func(t *testing.T) {
-		b := makeBook("already exists book")
-		r.AddBook(b)
-		err := r.AddBook(b)
-		assert.Equal(t, repository.ErrRecordNotUnique, err)
+	t.Run("filtered by status", func(t *testing.T) {
+		q := usecase.BookQuery{Filter: usecase.BookFilter{Status: book.StatusCheckedOut}}
+		assert.Equal(t, []string{"book 1"}, titles(q))
 	})
 
-	t.Run("list books", func(t *testing.T) {
-		// create books
-		a := makeBook("list book A")
-		b := makeBook("list book B")
-		c := makeBook("list book C")
-
-		books := map[string]book.Book{
-			a.ID: a,
-			b.ID: b,
-			c.ID: c,
-		}
-
-		// store books
-		r.AddBook(a)
-		r.AddBook(b)
-		r.AddBook(c)
+	t.Run("sorted by status and rating", func(t *testing.T) {
+		q := usecase.BookQuery{Sort: []usecase.Sort{
+			{Field: usecase.SortByStatus, Desc: true},
+			{Field: usecase.SortByRating},
+			{Field: usecase.SortByTitle, Desc: true},
+		}}
+		assert.Equal(t, []string{"book 1", "book 2", "book 0"}, titles(q))
+	})
 
-		// list entities, this is what we want to test!
-		bookList, err := r.BookList()
+	t.Run("sorted by rating over pages", func(t *testing.T) {
+		q := usecase.BookQuery{Sort: []usecase.Sort{{Field: usecase.SortByRating, Desc: true}}, Limit: 2}
+		q.Filter.Author = author
+		first, err := pgRepo.BookList(ctx, q)
 		assert.NoError(t, err)
-
-		// iterate over list counting the times each id is seen
-		seen := make(map[string]int, 3)
-		for _, bk := range bookList {
-			delete(books, bk.ID)
-			seen[bk.ID]++
-		}
-
-		// ensure the list does not repeat any books
-		for _, n := range seen {
-			assert.Equal(t, 1, n, "book ids are repeated in the list")
+		if assert.Len(t, first.Books, 2) {
+			assert.Equal(t, book.RateThree, first.Books[1].Rating)
 		}
-
-		// books are removed from map as they are found so there should be none left
-		assert.Len(t, books, 0)
-	})
-
-	t.Run("remove book", func(t *testing.T) {
-		// create and store book
-		b := makeBook("remove book")
-
-		t.Run("delete a book that does not exist should error", func(t *testing.T) {
-			err := r.RemoveBook(b.ID)
-			assert.Equal(t, repository.ErrRecordNotFound, err)
-		})
-
-		t.Run("add then remove book", func(t *testing.T) {
-			r.AddBook(b)
-
-			// remove book
-			if err := r.RemoveBook(b.ID); err != nil {
-				t.Fatal(err)
-			}
-
-			// try to retrieve Book
-			if _, err := r.GetBookByID(b.ID); err == nil {
-				t.Fatal("book found when it should have been deleted")
-			}
-		})
+		q.After = first.Next
+		assert.Equal(t, []string{"book 1"}, titles(q))
 	})
 
-	t.Run("update book", func(t *testing.T) {
-		b := makeBook("update book")
-
-		t.Run("can not update book that does not exist", func(t *testing.T) {
-			err := r.UpdateBook(b)
-			assert.Equal(t, repository.ErrRecordNotFound, err)
-		})
-
-		t.Run("add then update book", func(t *testing.T) {
-			r.AddBook(b)
-			b.Status = book.StatusCheckedOut
-			b.Rating = book.RateTwo
-			err := r.UpdateBook(b)
-			assert.NoError(t, err)
-		})
+	t.Run("columns agree with the history", func(t *testing.T) {
+		var drifted int
+		err := pgDB.QueryRow(`
+			SELECT count(*) FROM books b
+			WHERE b.author = $1 AND (
+				b.status IS DISTINCT FROM (
+					SELECT h.new_value FROM book_history h
+					WHERE h.book_id = b.id AND h.field = 'status'
+					ORDER BY h.id DESC LIMIT 1
+				) OR b.rating IS DISTINCT FROM (
+					SELECT h.new_value::int FROM book_history h
+					WHERE h.book_id = b.id AND h.field = 'rating'
+					ORDER BY h.id DESC LIMIT 1
+				)
+			)
+		`, author).Scan(&drifted)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, drifted)
 	})
 }
 
-func makeBook(title string) book.Book {
-	return book.NewBook(title, "john smith", time.Now(), book.RateOne, book.StatusCheckedIn)
-}
-
-func loadMigrations(db *sql.DB) error {
-	query := `
-	  CREATE TABLE IF NOT EXISTS books (
-			id         VARCHAR(36)  PRIMARY KEY,
-			title      VARCHAR(128),
-			author     VARCHAR(128),
-			pubdate    date,
-			rating     INT,
-			status     VARCHAR(16),
-			created_at TIMESTAMPTZ,
-			updated_at TIMESTAMPTZ
-		)
-	`
-	_, err := db.Exec(query)
-	return err
+// loadMigrations runs the same migrations the bookserver runs on startup
+// so the tests can not drift from the real schema
+func loadMigrations(dsn string) error {
+	m, err := migrate.New("file://../db/migrations", dsn)
+	if err != nil {
+		return err
+	}
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return err
+	}
+	return nil
 }
 
-// this setup uses dockertest to create a postgres instance in docker for testing
-// it also constructs the pgRepo var used by all the tests
+// setupPostgres uses dockertest to create a postgres instance in docker for
+// testing, it also constructs the pgRepo var used by all the tests
 // this way all the tests can test aginst a real postgres instance
-func TestMain(m *testing.M) {
-	// Setup docker postgres instance
+// the returned func removes the container
+func setupPostgres() (func(), error) {
 	rand.Seed(time.Now().UnixNano())
 	var (
 		db *sql.DB
@@ -183,9 +158,8 @@ func TestMain(m *testing.M) {
 	)
 
 	pool, err := dockertest.NewPool("")
-
 	if err != nil {
-		log.Fatalf("Could not connect to docker: %s", err)
+		return nil, fmt.Errorf("Could not connect to docker: %s", err)
 	}
 
 	opts := dockertest.RunOptions{
@@ -211,11 +185,17 @@ func TestMain(m *testing.M) {
 			Name: "no",
 		}
 	})
-	resource.Expire(containerTTL)
-	defer resource.Close()
-
 	if err != nil {
-		log.Fatalf("Could not start resource: %s", err.Error())
+		return nil, fmt.Errorf("Could not start resource: %s", err)
+	}
+	resource.Expire(containerTTL)
+	cleanup := func() {
+		if db != nil {
+			db.Close()
+		}
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
 	}
 
 	if err = pool.Retry(func() error {
@@ -226,27 +206,25 @@ func TestMain(m *testing.M) {
 		if err = db.Ping(); err != nil {
 			return err
 		}
-		if err = loadMigrations(db); err != nil {
+		if err = loadMigrations(dsn); err != nil {
 			return err
 		}
 		return nil
 	}); err != nil {
-		log.Fatalf("Could not connect to docker: %s", err.Error())
+		cleanup()
+		return nil, fmt.Errorf("Could not connect to docker: %s", err)
 	}
 
-	// deferred cleanup
-	defer func() {
-		db.Close()
-
-		// cleanup
-		if err := pool.Purge(resource); err != nil {
-			log.Fatalf("Could not purge resource: %s", err)
-		}
-	}()
-
 	// construct repository
+	pgDB = db
 	pgRepo = repository.NewPostgresRepo(db)
+	return cleanup, nil
+}
 
-	// run the tests
-	os.Exit(m.Run())
+// skipWithoutPostgres skips a test when docker could not start postgres, so
+// the other repositories are still tested
+func skipWithoutPostgres(t *testing.T) {
+	if pgDB == nil {
+		t.Skip("postgres is not available, docker could not start it")
+	}
 }
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/repository/repoerr"
+	"github.com/tempcke/books/usecase"
+)
+
+// TrashedBooks lists the books in the trash, most recently removed first
+func (r Postgres) TrashedBooks(ctx context.Context) ([]book.Book, error) {
+	books := make([]book.Book, 0)
+
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, version, coalesce(isbn, ''), title, author, publisher, pubdate, rating, status,
+			deleted_at
+		FROM books_current
+		WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id
+	`
+
+	rows, err := r.q.QueryContext(ctx, query)
+	if err != nil {
+		return books, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		b := book.Book{}
+
+		err = rows.Scan(
+			&b.ID, &b.Version, &b.ISBN, &b.Title, &b.Author, &b.Publisher,
+			&b.PubDate, &b.Rating, &b.Status, &b.DeletedAt,
+		)
+		if err != nil {
+			return books, err
+		}
+
+		books = append(books, b)
+	}
+
+	return books, rows.Err()
+}
+
+// RestoreBook takes a book out of the trash
+func (r Postgres) RestoreBook(ctx context.Context, id string) error {
+	ctx, cancel := r.writeContext(ctx)
+	defer cancel()
+
+	var isbn sql.NullString
+	err := r.q.QueryRowContext(ctx,
+		"SELECT isbn FROM books WHERE id = $1 AND deleted_at IS NOT NULL", id,
+	).Scan(&isbn)
+	if err == sql.ErrNoRows {
+		return repoerr.ErrRecordNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	// the isbn may have been given to another book in the meantime
+	if isbn.Valid {
+		if _, err := r.GetBookByISBN(ctx, isbn.String); err == nil {
+			return usecase.ErrISBNExists
+		}
+	}
+
+	query := `
+		UPDATE books
+		SET deleted_at = NULL, updated_at = $2, version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL
+	`
+
+	stmt, err := r.q.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx, id, time.Now())
+	if r.isUniqueViolation(err) {
+		return usecase.ErrISBNExists
+	}
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return repoerr.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// PurgeBooks permanently deletes the books removed before the given time,
+// their history, copies, loans and holds are deleted with them
+func (r Postgres) PurgeBooks(ctx context.Context, removedBefore time.Time) (int, error) {
+	ctx, cancel := r.writeContext(ctx)
+	defer cancel()
+
+	query := "DELETE FROM books WHERE deleted_at < $1"
+	stmt, err := r.q.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx, removedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
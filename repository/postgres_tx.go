@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tempcke/books/usecase"
+)
+
+// Atomic runs fn in a transaction which is committed when fn returns nil and
+// rolled back otherwise, books read by fn are locked until it ends
+// calls made within fn join the transaction
+func (r Postgres) Atomic(ctx context.Context, fn func(usecase.LibraryRepo) error) error {
+	if r.inTx {
+		return fn(r)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	txRepo := r
+	txRepo.q = tx
+	txRepo.inTx = true
+	if err := fn(txRepo); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,50 @@
+package repository_test
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/repository"
+	"github.com/tempcke/books/usecase"
+)
+
+var ctx = context.Background()
+
+// TestMain sets up the repositories, the sqlite one runs on an in memory
+// database and the postgres one in docker, without docker only the postgres
+// tests are skipped
+func TestMain(m *testing.M) {
+	if err := setupSQLite(); err != nil {
+		log.Fatalf("Could not setup sqlite: %s", err)
+	}
+
+	cleanup, err := setupPostgres()
+	if err != nil {
+		log.Printf("Skipping the postgres tests: %s", err)
+		cleanup = func() {}
+	}
+
+	code := m.Run()
+	cleanup()
+	sqliteDB.Close()
+	os.Exit(code)
+}
+
+// testTimeouts is given a constructor of the repository with options
+func testTimeouts(t *testing.T, r usecase.LibraryRepo, newRepo func(...repository.Option) usecase.LibraryRepo) {
+	b := book.NewBook("timeouts book", "john smith", "acme publishing", time.Now(), book.RateOne, book.StatusCheckedIn)
+	r.AddBook(ctx, b)
+
+	r = newRepo(
+		repository.WithReadTimeout(time.Nanosecond),
+		repository.WithWriteTimeout(time.Nanosecond))
+	_, err := r.GetBookByID(ctx, b.ID)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Error(t, r.UpdateBook(ctx, b))
+}
@@ -0,0 +1,11 @@
+// Package repoerr has the errors every repository fails with, it is apart
+// from the repositories so that using them does not link a database driver
+package repoerr
+
+import "errors"
+
+// Errors
+var (
+	ErrRecordNotFound  = errors.New("Record not found")
+	ErrRecordNotUnique = errors.New("Record not unique")
+)
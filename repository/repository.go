@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/usecase"
+)
+
+const dateFormat = "2006-01-02"
+
+// Default time limits of a single database operation
+const (
+	DefaultReadTimeout  = 5 * time.Second
+	DefaultWriteTimeout = 5 * time.Second
+)
+
+// querier is used to run queries on either the db or a transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// timeouts limit how long a single database operation of a repository may take
+type timeouts struct {
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+func defaultTimeouts() timeouts {
+	return timeouts{
+		readTimeout:  DefaultReadTimeout,
+		writeTimeout: DefaultWriteTimeout,
+	}
+}
+
+// readContext is cancelled along with ctx or when the read timeout is reached
+func (t timeouts) readContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, t.readTimeout)
+}
+
+// writeContext is cancelled along with ctx or when the write timeout is reached
+func (t timeouts) writeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, t.writeTimeout)
+}
+
+// Option is used to configure the Postgres and SQLite repositories
+type Option func(*timeouts)
+
+// WithReadTimeout limits how long a single query may take
+func WithReadTimeout(d time.Duration) Option {
+	return func(t *timeouts) {
+		t.readTimeout = d
+	}
+}
+
+// WithWriteTimeout limits how long a single insert, update or delete may take
+func WithWriteTimeout(d time.Duration) Option {
+	return func(t *timeouts) {
+		t.writeTimeout = d
+	}
+}
+
+// nullTime stores the zero time as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// nullString stores the empty string as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// changedColumns is the status or rating a change leaves on the books row,
+// the column the change is not about is NULL and keeps its value
+func changedColumns(c book.Change) (status sql.NullString, rating sql.NullInt64, err error) {
+	switch c.Field {
+	case book.FieldStatus:
+		status = sql.NullString{String: c.NewValue, Valid: true}
+	case book.FieldRating:
+		n, err := strconv.Atoi(c.NewValue)
+		if err != nil {
+			return status, rating, err
+		}
+		rating = sql.NullInt64{Int64: int64(n), Valid: true}
+	}
+	return status, rating, nil
+}
+
+// searchHighlights keeps the snippets of the fields which matched a search,
+// escaped as html
+func searchHighlights(title, author, publisher string) map[string]string {
+	highlights := make(map[string]string)
+	for field, snippet := range map[string]string{
+		"title":     title,
+		"author":    author,
+		"publisher": publisher,
+	} {
+		if h, ok := usecase.Highlight(snippet); ok {
+			highlights[field] = h
+		}
+	}
+	return highlights
+}
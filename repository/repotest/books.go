@@ -0,0 +1,376 @@
+package repotest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/repository/repoerr"
+	"github.com/tempcke/books/usecase"
+)
+
+func testBooks(t *testing.T, r usecase.LibraryRepo) {
+	t.Run("GetBookByID should return error when book not found", func(t *testing.T) {
+		b := makeBook("non existing book")
+		_, err := r.GetBookByID(ctx, b.ID)
+		assert.Equal(t, repoerr.ErrRecordNotFound, err)
+	})
+
+	t.Run("add and get book", func(t *testing.T) {
+		b := makeBook("add book")
+
+		if err := r.AddBook(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+
+		bOut, err := r.GetBookByID(ctx, b.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, b.ID, bOut.ID)
+		assert.Equal(t, b.Title, bOut.Title)
+		assert.Equal(t, b.Author, bOut.Author)
+		assert.Equal(t, b.Publisher, bOut.Publisher)
+		assert.Equal(t, b.PubDate.Format(dateFormat), bOut.PubDate.Format(dateFormat))
+		assert.Equal(t, b.Rating, bOut.Rating)
+		assert.Equal(t, b.Status, bOut.Status)
+	})
+
+	t.Run("expect error when adding a book that already exists", func(t *testing.T) {
+		b := makeBook("already exists book")
+		r.AddBook(ctx, b)
+		err := r.AddBook(ctx, b)
+		assert.Equal(t, repoerr.ErrRecordNotUnique, err)
+	})
+
+	t.Run("books are unique by isbn", func(t *testing.T) {
+		a, b := makeBook("isbn book A"), makeBook("isbn book B")
+		a.ISBN, b.ISBN = "9780201485677", "9780201485677"
+		assert.NoError(t, r.AddBook(ctx, a))
+		assert.Equal(t, repoerr.ErrRecordNotUnique, r.AddBook(ctx, b))
+		_, err := r.GetBookByID(ctx, b.ID)
+		assert.Error(t, err)
+
+		bOut, err := r.GetBookByISBN(ctx, a.ISBN)
+		assert.NoError(t, err)
+		assert.Equal(t, a.ID, bOut.ID)
+		assert.Equal(t, a.ISBN, bOut.ISBN)
+
+		b.ISBN = ""
+		assert.NoError(t, r.AddBook(ctx, b))
+		b.ISBN = a.ISBN
+		assert.Equal(t, repoerr.ErrRecordNotUnique, r.UpdateBook(ctx, b))
+
+		b.ISBN = "9780306406157"
+		assert.NoError(t, r.UpdateBook(ctx, b))
+		bOut, err = r.GetBookByID(ctx, b.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, b.ISBN, bOut.ISBN)
+
+		_, err = r.GetBookByISBN(ctx, "9791090636071")
+		assert.Equal(t, repoerr.ErrRecordNotFound, err)
+	})
+
+	t.Run("list books", func(t *testing.T) {
+		// create books
+		a := makeBook("list book A")
+		b := makeBook("list book B")
+		c := makeBook("list book C")
+
+		books := map[string]book.Book{
+			a.ID: a,
+			b.ID: b,
+			c.ID: c,
+		}
+
+		// store books
+		r.AddBook(ctx, a)
+		r.AddBook(ctx, b)
+		r.AddBook(ctx, c)
+
+		// list entities, this is what we want to test!
+		page, err := r.BookList(ctx, usecase.BookQuery{})
+		assert.NoError(t, err)
+		bookList := page.Books
+
+		// iterate over list counting the times each id is seen
+		seen := make(map[string]int, 3)
+		for _, bk := range bookList {
+			delete(books, bk.ID)
+			seen[bk.ID]++
+		}
+
+		// ensure the list does not repeat any books
+		for _, n := range seen {
+			assert.Equal(t, 1, n, "book ids are repeated in the list")
+		}
+
+		// books are removed from map as they are found so there should be none left
+		assert.Len(t, books, 0)
+	})
+
+	t.Run("filter, sort and paginate books", func(t *testing.T) {
+		// a unique author keeps other tests books out of the results
+		author := "query author " + uuid.New().String()
+		pubDate := func(s string) time.Time {
+			d, _ := time.Parse(dateFormat, s)
+			return d
+		}
+		a := book.NewBook("Alpha", author, "acme", pubDate("2001-01-01"), book.RateOne, book.StatusCheckedIn)
+		b := book.NewBook("Beta", author, "acme", pubDate("2002-01-01"), book.RateTwo, book.StatusCheckedOut)
+		c := book.NewBook("Gamma", author, "acme", pubDate("2003-01-01"), book.RateThree, book.StatusCheckedIn)
+		d := book.NewBook("Delta", author, "acme", pubDate("2004-01-01"), book.RateThree, book.StatusCheckedOut)
+		for _, bk := range []book.Book{a, b, c, d} {
+			r.AddBook(ctx, bk)
+		}
+		titles := func(page usecase.BookPage) []string {
+			list := make([]string, len(page.Books))
+			for i, bk := range page.Books {
+				list[i] = bk.Title
+			}
+			return list
+		}
+		filter := usecase.BookFilter{Author: author}
+
+		t.Run("filters", func(t *testing.T) {
+			f := filter
+			f.Status = book.StatusCheckedIn
+			f.TitleContains = "MM"
+			page, err := r.BookList(ctx, usecase.BookQuery{Filter: f})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Gamma"}, titles(page))
+
+			f = filter
+			f.Rating = book.RateThree
+			f.PubDateFrom = pubDate("2004-01-01")
+			page, err = r.BookList(ctx, usecase.BookQuery{Filter: f})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Delta"}, titles(page))
+		})
+
+		t.Run("sort and paginate", func(t *testing.T) {
+			q := usecase.BookQuery{
+				Filter: filter,
+				Sort: []usecase.Sort{
+					{Field: usecase.SortByRating, Desc: true},
+					{Field: usecase.SortByPubDate},
+				},
+				Limit: 3,
+			}
+			page, err := r.BookList(ctx, q)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Gamma", "Delta", "Beta"}, titles(page))
+			assert.NotEmpty(t, page.Next)
+
+			q.After = page.Next
+			page, err = r.BookList(ctx, q)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Alpha"}, titles(page))
+			assert.Empty(t, page.Next)
+		})
+	})
+
+	t.Run("search books", func(t *testing.T) {
+		// unique words keep other tests books out of the results
+		word := "zq" + uuid.New().String()[:8]
+		a := book.NewBook("Refactoring "+word, "Martin Fowler", "Addison-Wesley", time.Now(), book.RateThree, book.StatusCheckedIn)
+		b := book.NewBook("Other Book", "Jane "+word, "Addison-Wesley", time.Now(), book.RateThree, book.StatusCheckedIn)
+		r.AddBook(ctx, a)
+		r.AddBook(ctx, b)
+
+		results, err := r.SearchBooks(ctx, word, 10)
+		assert.NoError(t, err)
+		if assert.Len(t, results, 2) {
+			// title matches are weighted higher than author matches
+			assert.Equal(t, a.ID, results[0].Book.ID)
+			assert.Equal(t, b.ID, results[1].Book.ID)
+			assert.Greater(t, results[0].Score, results[1].Score)
+			assert.Contains(t, results[0].Highlights["title"], "<b>"+word+"</b>")
+			assert.Contains(t, results[1].Highlights["author"], "<b>"+word+"</b>")
+		}
+
+		results, err = r.SearchBooks(ctx, word+" refactoring", 10)
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+	})
+
+	t.Run("search highlights are html escaped", func(t *testing.T) {
+		word := "zq" + uuid.New().String()[:8]
+		b := book.NewBook(word+` <script>alert("b")</script>`, "Jane <b>Doe</b>", "Addison-Wesley", time.Now(), book.RateThree, book.StatusCheckedIn)
+		r.AddBook(ctx, b)
+
+		results, err := r.SearchBooks(ctx, word, 10)
+		assert.NoError(t, err)
+		if assert.Len(t, results, 1) {
+			title := results[0].Highlights["title"]
+			assert.True(t, strings.HasPrefix(title, "<b>"+word+"</b>"), title)
+			assert.NotContains(t, title, "<script>")
+			assert.Contains(t, title, "&lt;script&gt;")
+			// markup in a field which did not match is not a match
+			assert.NotContains(t, results[0].Highlights, "author")
+		}
+	})
+
+	t.Run("remove book", func(t *testing.T) {
+		// create and store book
+		b := makeBook("remove book")
+
+		t.Run("delete a book that does not exist should error", func(t *testing.T) {
+			err := r.RemoveBook(ctx, b.ID)
+			assert.Equal(t, repoerr.ErrRecordNotFound, err)
+		})
+
+		t.Run("add then remove book", func(t *testing.T) {
+			r.AddBook(ctx, b)
+
+			// remove book
+			if err := r.RemoveBook(ctx, b.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			// try to retrieve Book
+			if _, err := r.GetBookByID(ctx, b.ID); err == nil {
+				t.Fatal("book found when it should have been deleted")
+			}
+		})
+
+		t.Run("a removed book can not be removed again", func(t *testing.T) {
+			assert.Equal(t, repoerr.ErrRecordNotFound, r.RemoveBook(ctx, b.ID))
+		})
+	})
+
+	t.Run("update book", func(t *testing.T) {
+		b := makeBook("update book")
+
+		t.Run("can not update book that does not exist", func(t *testing.T) {
+			err := r.UpdateBook(ctx, b)
+			assert.Equal(t, repoerr.ErrRecordNotFound, err)
+		})
+
+		t.Run("add then update book", func(t *testing.T) {
+			r.AddBook(ctx, b)
+			b.Title = "updated book"
+			b.Author = "jane doe"
+			b.Publisher = "other publishing"
+			b.PubDate = b.PubDate.AddDate(-1, 0, 0)
+			err := r.UpdateBook(ctx, b)
+			assert.NoError(t, err)
+
+			bOut, err := r.GetBookByID(ctx, b.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, b.Version+1, bOut.Version)
+			b.Version = bOut.Version
+			assert.Equal(t, b.Title, bOut.Title)
+			assert.Equal(t, b.Author, bOut.Author)
+			assert.Equal(t, b.Publisher, bOut.Publisher)
+			assert.Equal(t, b.PubDate.Format(dateFormat), bOut.PubDate.Format(dateFormat))
+		})
+
+		t.Run("status and rating are not updated in place", func(t *testing.T) {
+			changed := b
+			changed.Status = book.StatusCheckedOut
+			changed.Rating = book.RateTwo
+			assert.NoError(t, r.UpdateBook(ctx, changed))
+
+			bOut, err := r.GetBookByID(ctx, b.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, b.Status, bOut.Status)
+			assert.Equal(t, b.Rating, bOut.Rating)
+			b.Version = bOut.Version
+		})
+
+		t.Run("can not update an old version", func(t *testing.T) {
+			old := b
+			old.Version--
+			old.Title = "lost update"
+			assert.Equal(t, usecase.ErrVersionConflict, r.UpdateBook(ctx, old))
+
+			bOut, err := r.GetBookByID(ctx, b.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, b.Version, bOut.Version)
+			assert.Equal(t, b.Title, bOut.Title)
+		})
+
+		t.Run("changes to history and copies count", func(t *testing.T) {
+			assert.NoError(t, r.RecordChange(ctx, book.Change{
+				BookID:    b.ID,
+				Field:     book.FieldRating,
+				OldValue:  b.Rating.String(),
+				NewValue:  book.RateTwo.String(),
+				ChangedAt: time.Now(),
+			}))
+			c := book.NewCopy(b.ID, "update-book-2", book.ConditionGood)
+			assert.NoError(t, r.AddCopy(ctx, c))
+			c.Status = book.StatusCheckedOut
+			assert.NoError(t, r.UpdateCopy(ctx, c))
+			assert.NoError(t, r.RemoveCopy(ctx, c.ID))
+
+			bOut, err := r.GetBookByID(ctx, b.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, b.Version+4, bOut.Version)
+		})
+	})
+
+	t.Run("book history", func(t *testing.T) {
+		b := makeBook("history book")
+
+		t.Run("can not record change of book that does not exist", func(t *testing.T) {
+			err := r.RecordChange(ctx, book.Change{
+				BookID:    b.ID,
+				Field:     book.FieldStatus,
+				NewValue:  book.StatusCheckedOut.String(),
+				ChangedAt: time.Now(),
+			})
+			assert.Equal(t, repoerr.ErrRecordNotFound, err)
+		})
+
+		t.Run("latest change is the current value", func(t *testing.T) {
+			r.AddBook(ctx, b)
+
+			history, err := r.BookHistory(ctx, b.ID)
+			assert.NoError(t, err)
+			assert.Len(t, history, 2)
+
+			changes := []book.Change{
+				{
+					BookID:    b.ID,
+					Field:     book.FieldStatus,
+					OldValue:  book.StatusCheckedIn.String(),
+					NewValue:  book.StatusCheckedOut.String(),
+					Actor:     "jane",
+					ChangedAt: time.Now(),
+				},
+				{
+					BookID:    b.ID,
+					Field:     book.FieldRating,
+					OldValue:  book.RateOne.String(),
+					NewValue:  book.RateThree.String(),
+					Actor:     "john",
+					ChangedAt: time.Now(),
+				},
+			}
+			for _, c := range changes {
+				assert.NoError(t, r.RecordChange(ctx, c))
+			}
+
+			bOut, err := r.GetBookByID(ctx, b.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, book.StatusCheckedOut, bOut.Status)
+			assert.Equal(t, book.RateThree, bOut.Rating)
+
+			history, err = r.BookHistory(ctx, b.ID)
+			assert.NoError(t, err)
+			if assert.Len(t, history, 4) {
+				for i, c := range changes {
+					got := history[i+2]
+					assert.Equal(t, c.Field, got.Field)
+					assert.Equal(t, c.OldValue, got.OldValue)
+					assert.Equal(t, c.NewValue, got.NewValue)
+					assert.Equal(t, c.Actor, got.Actor)
+					assert.WithinDuration(t, c.ChangedAt, got.ChangedAt, time.Second)
+				}
+			}
+		})
+	})
+}
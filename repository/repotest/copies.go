@@ -0,0 +1,70 @@
+package repotest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/repository/repoerr"
+	"github.com/tempcke/books/usecase"
+)
+
+func testCopies(t *testing.T, r usecase.LibraryRepo) {
+	b := makeBook("copies book")
+	r.AddBook(ctx, b)
+	first := book.FirstCopy(b)
+	c := book.NewCopy(b.ID, "31234000000100", book.ConditionNew)
+
+	t.Run("books are added with their first copy", func(t *testing.T) {
+		copies, err := r.BookCopies(ctx, b.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, []book.Copy{first}, copies)
+	})
+
+	t.Run("copy not found", func(t *testing.T) {
+		_, err := r.GetCopyByID(ctx, c.ID)
+		assert.Equal(t, repoerr.ErrRecordNotFound, err)
+		_, err = r.GetCopyByBarcode(ctx, c.Barcode)
+		assert.Equal(t, repoerr.ErrRecordNotFound, err)
+		assert.Equal(t, repoerr.ErrRecordNotFound, r.UpdateCopy(ctx, c))
+		assert.Equal(t, repoerr.ErrRecordNotFound, r.RemoveCopy(ctx, c.ID))
+	})
+
+	t.Run("add and get copy", func(t *testing.T) {
+		assert.NoError(t, r.AddCopy(ctx, c))
+
+		got, err := r.GetCopyByID(ctx, c.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, c, got)
+
+		got, err = r.GetCopyByBarcode(ctx, c.Barcode)
+		assert.NoError(t, err)
+		assert.Equal(t, c, got)
+	})
+
+	t.Run("barcodes are unique", func(t *testing.T) {
+		dup := book.NewCopy(b.ID, c.Barcode, book.ConditionGood)
+		assert.Equal(t, repoerr.ErrRecordNotUnique, r.AddCopy(ctx, dup))
+	})
+
+	t.Run("update copy and count availability", func(t *testing.T) {
+		c.Status = book.StatusCheckedOut
+		c.Condition = book.ConditionFair
+		assert.NoError(t, r.UpdateCopy(ctx, c))
+
+		got, _ := r.GetCopyByID(ctx, c.ID)
+		assert.Equal(t, c, got)
+
+		other := makeBook("no copies counted")
+		counts, err := r.BookAvailability(ctx, b.ID, other.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, book.Availability{Total: 2, Available: 1}, counts[b.ID])
+		assert.Equal(t, book.Availability{}, counts[other.ID])
+	})
+
+	t.Run("remove copy", func(t *testing.T) {
+		assert.NoError(t, r.RemoveCopy(ctx, c.ID))
+		copies, _ := r.BookCopies(ctx, b.ID)
+		assert.Len(t, copies, 1)
+	})
+}
@@ -0,0 +1,60 @@
+package repotest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/usecase"
+)
+
+func testExport(t *testing.T, r usecase.LibraryRepo) {
+	// more books than are read at a time, by an author of their own
+	const count = 501
+	author := "export " + uuid.New().String()[:8]
+	for i := 0; i < count; i++ {
+		b := makeBook(fmt.Sprintf("export book %03d", i))
+		b.Author = author
+		if err := r.AddBook(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q := usecase.BookQuery{
+		Filter: usecase.BookFilter{Author: author},
+		Sort:   []usecase.Sort{{Field: usecase.SortByTitle, Desc: true}},
+		Limit:  10,
+	}
+
+	t.Run("every matching book in order", func(t *testing.T) {
+		var titles []string
+		err := r.ExportBooks(ctx, q, func(b book.Book) error {
+			titles = append(titles, b.Title)
+			return nil
+		})
+		assert.NoError(t, err)
+		if assert.Len(t, titles, count) {
+			assert.Equal(t, "export book 500", titles[0])
+			assert.Equal(t, "export book 000", titles[count-1])
+		}
+	})
+
+	t.Run("stops at the first error", func(t *testing.T) {
+		stop := errors.New("stop")
+		var n int
+		err := r.ExportBooks(ctx, q, func(b book.Book) error {
+			n++
+			return stop
+		})
+		assert.Equal(t, stop, err)
+		assert.Equal(t, 1, n)
+	})
+
+	t.Run("the repository is usable after an export", func(t *testing.T) {
+		page, err := r.BookList(ctx, q)
+		assert.NoError(t, err)
+		assert.Len(t, page.Books, 10)
+	})
+}
@@ -0,0 +1,102 @@
+package repotest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/entity/hold"
+	"github.com/tempcke/books/entity/patron"
+	"github.com/tempcke/books/repository/repoerr"
+	"github.com/tempcke/books/usecase"
+)
+
+func testHolds(t *testing.T, r usecase.LibraryRepo) {
+	b := makeBook("hold book")
+	john := patron.NewPatron("John Doe", "john@example.com")
+	mary := patron.NewPatron("Mary Roe", "mary@example.com")
+	r.AddBook(ctx, b)
+	r.AddPatron(ctx, john)
+	r.AddPatron(ctx, mary)
+	now := time.Now()
+
+	first := hold.NewHold(b.ID, john.ID, now)
+	second := hold.NewHold(b.ID, mary.ID, now.Add(time.Minute))
+
+	t.Run("can not update hold that does not exist", func(t *testing.T) {
+		assert.Equal(t, repoerr.ErrRecordNotFound, r.UpdateHold(ctx, first))
+	})
+
+	t.Run("hold not found", func(t *testing.T) {
+		_, err := r.GetHoldByID(ctx, first.ID)
+		assert.Equal(t, repoerr.ErrRecordNotFound, err)
+	})
+
+	t.Run("add and list holds in queue order", func(t *testing.T) {
+		assert.NoError(t, r.AddHold(ctx, second))
+		assert.NoError(t, r.AddHold(ctx, first))
+
+		holds, err := r.BookHolds(ctx, b.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, holds, 2) {
+			assertHoldsEqual(t, first, holds[0])
+			assertHoldsEqual(t, second, holds[1])
+		}
+
+		got, err := r.GetHoldByID(ctx, first.ID)
+		assert.NoError(t, err)
+		assertHoldsEqual(t, first, got)
+	})
+
+	t.Run("only one open hold per patron and book", func(t *testing.T) {
+		again := hold.NewHold(b.ID, john.ID, now)
+		assert.Equal(t, repoerr.ErrRecordNotUnique, r.AddHold(ctx, again))
+	})
+
+	t.Run("ready holds expire", func(t *testing.T) {
+		first.Status = hold.StatusReady
+		first.CopyID = book.FirstCopy(b).ID
+		first.ReadyAt = now
+		first.ExpiresAt = now.Add(hold.DefaultPickupWindow)
+		assert.NoError(t, r.UpdateHold(ctx, first))
+
+		holds, err := r.ExpiredHolds(ctx, first.ExpiresAt)
+		assert.NoError(t, err)
+		assert.Len(t, holds, 0)
+
+		holds, err = r.ExpiredHolds(ctx, first.ExpiresAt.Add(time.Second))
+		assert.NoError(t, err)
+		if assert.Len(t, holds, 1) {
+			assertHoldsEqual(t, first, holds[0])
+		}
+	})
+
+	t.Run("closed holds leave the queue", func(t *testing.T) {
+		first.Status = hold.StatusExpired
+		first.ClosedAt = now.Add(hold.DefaultPickupWindow)
+		assert.NoError(t, r.UpdateHold(ctx, first))
+
+		holds, err := r.BookHolds(ctx, b.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, holds, 1) {
+			assertHoldsEqual(t, second, holds[0])
+		}
+
+		// the patron may join the queue again
+		assert.NoError(t, r.AddHold(ctx, hold.NewHold(b.ID, john.ID, now.Add(time.Hour))))
+	})
+}
+
+func assertHoldsEqual(t *testing.T, want, got hold.Hold) {
+	t.Helper()
+	assert.Equal(t, want.ID, got.ID)
+	assert.Equal(t, want.BookID, got.BookID)
+	assert.Equal(t, want.CopyID, got.CopyID)
+	assert.Equal(t, want.PatronID, got.PatronID)
+	assert.Equal(t, want.Status, got.Status)
+	assert.WithinDuration(t, want.PlacedAt, got.PlacedAt, time.Millisecond)
+	assert.WithinDuration(t, want.ReadyAt, got.ReadyAt, time.Millisecond)
+	assert.WithinDuration(t, want.ExpiresAt, got.ExpiresAt, time.Millisecond)
+	assert.WithinDuration(t, want.ClosedAt, got.ClosedAt, time.Millisecond)
+}
@@ -0,0 +1,130 @@
+package repotest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/entity/loan"
+	"github.com/tempcke/books/entity/patron"
+	"github.com/tempcke/books/repository/repoerr"
+	"github.com/tempcke/books/usecase"
+)
+
+func testLoans(t *testing.T, r usecase.LibraryRepo) {
+	b := makeBook("loan book")
+	p := patron.NewPatron("Jane Doe", "jane@example.com")
+	r.AddBook(ctx, b)
+	r.AddPatron(ctx, p)
+	now := time.Now()
+
+	l := loan.NewLoan(b.ID, p.ID, now, now.AddDate(0, 0, 14))
+	l.CopyID = book.FirstCopy(b).ID
+
+	t.Run("can not update loan that does not exist", func(t *testing.T) {
+		assert.Equal(t, repoerr.ErrRecordNotFound, r.UpdateLoan(ctx, l))
+	})
+
+	t.Run("add and list loans", func(t *testing.T) {
+		assert.NoError(t, r.AddLoan(ctx, l))
+
+		loans, err := r.BookLoans(ctx, b.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, loans, 1) {
+			assertLoansEqual(t, l, loans[0])
+		}
+	})
+
+	t.Run("only one open loan per copy", func(t *testing.T) {
+		other := loan.NewLoan(b.ID, p.ID, now, now.AddDate(0, 0, 7))
+		other.CopyID = l.CopyID
+		assert.Equal(t, repoerr.ErrRecordNotUnique, r.AddLoan(ctx, other))
+	})
+
+	t.Run("return a loan", func(t *testing.T) {
+		l.ReturnedAt = time.Now()
+		assert.NoError(t, r.UpdateLoan(ctx, l))
+
+		next := loan.NewLoan(b.ID, p.ID, now.Add(time.Minute), now.AddDate(0, 0, 7))
+		next.CopyID = l.CopyID
+		assert.NoError(t, r.AddLoan(ctx, next))
+
+		loans, err := r.BookLoans(ctx, b.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, loans, 2) {
+			// most recent first
+			assertLoansEqual(t, next, loans[0])
+			assertLoansEqual(t, l, loans[1])
+		}
+	})
+}
+
+func testOverdueLoans(t *testing.T, r usecase.LibraryRepo) {
+	b := makeBook("overdue loan book")
+	p := patron.NewPatron("John Doe", "john@example.com")
+	r.AddBook(ctx, b)
+	r.AddPatron(ctx, p)
+	now := time.Now()
+
+	l := loan.NewLoan(b.ID, p.ID, now, now.AddDate(0, 0, 14))
+	assert.NoError(t, r.AddLoan(ctx, l))
+
+	findLoan := func(loans []loan.Loan, id string) (loan.Loan, bool) {
+		for _, l := range loans {
+			if l.ID == id {
+				return l, true
+			}
+		}
+		return loan.Loan{}, false
+	}
+
+	t.Run("not overdue on the due date", func(t *testing.T) {
+		loans, err := r.OverdueLoans(ctx, now.AddDate(0, 0, 14))
+		assert.NoError(t, err)
+		_, found := findLoan(loans, l.ID)
+		assert.False(t, found)
+	})
+
+	t.Run("overdue after the due date", func(t *testing.T) {
+		loans, err := r.OverdueLoans(ctx, now.AddDate(0, 0, 15))
+		assert.NoError(t, err)
+		got, found := findLoan(loans, l.ID)
+		assert.True(t, found)
+		assert.True(t, got.OverdueAt.IsZero())
+	})
+
+	t.Run("mark overdue", func(t *testing.T) {
+		l.OverdueAt = now.AddDate(0, 0, 15)
+		assert.NoError(t, r.UpdateLoan(ctx, l))
+
+		loans, err := r.OverdueLoans(ctx, now.AddDate(0, 0, 15))
+		assert.NoError(t, err)
+		got, _ := findLoan(loans, l.ID)
+		assert.WithinDuration(t, l.OverdueAt, got.OverdueAt, time.Millisecond)
+	})
+
+	t.Run("returned loans are not overdue", func(t *testing.T) {
+		l.ReturnedAt = now.AddDate(0, 0, 16)
+		assert.NoError(t, r.UpdateLoan(ctx, l))
+
+		loans, err := r.OverdueLoans(ctx, now.AddDate(0, 0, 20))
+		assert.NoError(t, err)
+		_, found := findLoan(loans, l.ID)
+		assert.False(t, found)
+	})
+}
+
+func assertLoansEqual(t *testing.T, want, got loan.Loan) {
+	t.Helper()
+	assert.Equal(t, want.ID, got.ID)
+	assert.Equal(t, want.BookID, got.BookID)
+	assert.Equal(t, want.CopyID, got.CopyID)
+	assert.Equal(t, want.PatronID, got.PatronID)
+	assert.WithinDuration(t, want.CheckedOutAt, got.CheckedOutAt, time.Millisecond)
+	assert.Equal(t, want.DueDate.Format(dateFormat), got.DueDate.Format(dateFormat))
+	assert.Equal(t, want.IsReturned(), got.IsReturned())
+	if want.IsReturned() {
+		assert.WithinDuration(t, want.ReturnedAt, got.ReturnedAt, time.Millisecond)
+	}
+}
@@ -0,0 +1,30 @@
+package repotest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/entity/patron"
+	"github.com/tempcke/books/repository/repoerr"
+	"github.com/tempcke/books/usecase"
+)
+
+func testPatrons(t *testing.T, r usecase.LibraryRepo) {
+	p := patron.NewPatron("Jane Doe", "jane@example.com")
+
+	t.Run("GetPatronByID should return error when patron not found", func(t *testing.T) {
+		_, err := r.GetPatronByID(ctx, p.ID)
+		assert.Equal(t, repoerr.ErrRecordNotFound, err)
+	})
+
+	t.Run("add and get patron", func(t *testing.T) {
+		assert.NoError(t, r.AddPatron(ctx, p))
+		pOut, err := r.GetPatronByID(ctx, p.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, p, pOut)
+	})
+
+	t.Run("expect error when adding a patron that already exists", func(t *testing.T) {
+		assert.Equal(t, repoerr.ErrRecordNotUnique, r.AddPatron(ctx, p))
+	})
+}
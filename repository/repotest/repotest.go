@@ -0,0 +1,78 @@
+// Package repotest is the contract every usecase.LibraryRepo must meet,
+// the tests of each implementation run it with Run
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/usecase"
+)
+
+const dateFormat = "2006-01-02"
+
+var ctx = context.Background()
+
+// Factory returns the repository to test, it is called once for each group
+// of tests.  A shared repository will do as well as a new one, the tests only
+// depend on the records they add themselves
+type Factory func(t *testing.T) usecase.LibraryRepo
+
+// Run tests that the repositories made by newRepo behave as expected of a
+// usecase.LibraryRepo, failing with repoerr.ErrRecordNotFound and
+// repoerr.ErrRecordNotUnique where records are missing or taken
+func Run(t *testing.T, newRepo Factory) {
+	t.Run("books", func(t *testing.T) {
+		testBooks(t, newRepo(t))
+	})
+	t.Run("export", func(t *testing.T) {
+		testExport(t, newRepo(t))
+	})
+	t.Run("trash", func(t *testing.T) {
+		testTrash(t, newRepo(t))
+	})
+	t.Run("copies", func(t *testing.T) {
+		testCopies(t, newRepo(t))
+	})
+	t.Run("context", func(t *testing.T) {
+		testContext(t, newRepo(t))
+	})
+	t.Run("unit of work", func(t *testing.T) {
+		testUnitOfWork(t, newRepo(t))
+	})
+	t.Run("patrons", func(t *testing.T) {
+		testPatrons(t, newRepo(t))
+	})
+	t.Run("loans", func(t *testing.T) {
+		testLoans(t, newRepo(t))
+	})
+	t.Run("overdue loans", func(t *testing.T) {
+		testOverdueLoans(t, newRepo(t))
+	})
+	t.Run("holds", func(t *testing.T) {
+		testHolds(t, newRepo(t))
+	})
+}
+
+func testContext(t *testing.T, r usecase.LibraryRepo) {
+	b := makeBook("context book")
+	r.AddBook(ctx, b)
+
+	t.Run("cancelled context", func(t *testing.T) {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := r.GetBookByID(cancelled, b.ID)
+		assert.Equal(t, context.Canceled, err)
+		assert.Error(t, r.AddBook(cancelled, makeBook("cancelled book")))
+		assert.Error(t, r.Atomic(cancelled, func(usecase.LibraryRepo) error {
+			return nil
+		}))
+	})
+}
+
+func makeBook(title string) book.Book {
+	return book.NewBook(title, "john smith", "acme publishing", time.Now(), book.RateOne, book.StatusCheckedIn)
+}
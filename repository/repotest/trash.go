@@ -0,0 +1,145 @@
+package repotest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/entity/hold"
+	"github.com/tempcke/books/entity/patron"
+	"github.com/tempcke/books/repository/repoerr"
+	"github.com/tempcke/books/usecase"
+)
+
+func testTrash(t *testing.T, r usecase.LibraryRepo) {
+	t.Run("removed books are hidden", func(t *testing.T) {
+		// a unique author and word keep other tests books out of the results
+		word := "zq" + uuid.New().String()[:8]
+		b := book.NewBook("Trash "+word, "Trash "+word, "acme publishing", time.Now(), book.RateOne, book.StatusCheckedIn)
+		b.ISBN = "9780596007126"
+		assert.NoError(t, r.AddBook(ctx, b))
+		assert.NoError(t, r.RemoveBook(ctx, b.ID))
+
+		_, err := r.GetBookByID(ctx, b.ID)
+		assert.Equal(t, repoerr.ErrRecordNotFound, err)
+		_, err = r.GetBookByISBN(ctx, b.ISBN)
+		assert.Equal(t, repoerr.ErrRecordNotFound, err)
+
+		page, err := r.BookList(ctx, usecase.BookQuery{Filter: usecase.BookFilter{Author: b.Author}})
+		assert.NoError(t, err)
+		assert.Len(t, page.Books, 0)
+
+		results, err := r.SearchBooks(ctx, word, 10)
+		assert.NoError(t, err)
+		assert.Len(t, results, 0)
+
+		c := book.Change{BookID: b.ID, Field: book.FieldRating, NewValue: "2", ChangedAt: time.Now()}
+		assert.Equal(t, repoerr.ErrRecordNotFound, r.RecordChange(ctx, c))
+		assert.Equal(t, repoerr.ErrRecordNotFound, r.UpdateBook(ctx, b))
+
+		// the isbn is free while the book is in the trash
+		other := makeBook("trash isbn book")
+		other.ISBN = b.ISBN
+		assert.NoError(t, r.AddBook(ctx, other))
+		assert.Equal(t, usecase.ErrISBNExists, r.RestoreBook(ctx, b.ID))
+		assert.NoError(t, r.RemoveBook(ctx, other.ID))
+	})
+
+	t.Run("list the trash", func(t *testing.T) {
+		a, b := makeBook("trash book A"), makeBook("trash book B")
+		r.AddBook(ctx, a)
+		r.AddBook(ctx, b)
+		assert.NoError(t, r.RemoveBook(ctx, a.ID))
+		time.Sleep(time.Millisecond)
+		assert.NoError(t, r.RemoveBook(ctx, b.ID))
+
+		trash, err := r.TrashedBooks(ctx)
+		assert.NoError(t, err)
+		removed := make(map[string]book.Book)
+		var order []string
+		for _, tb := range trash {
+			assert.True(t, tb.IsDeleted())
+			removed[tb.ID] = tb
+			order = append(order, tb.ID)
+		}
+		if assert.Contains(t, removed, a.ID) && assert.Contains(t, removed, b.ID) {
+			assert.Equal(t, a.Title, removed[a.ID].Title)
+			assert.WithinDuration(t, time.Now(), removed[a.ID].DeletedAt, time.Minute)
+		}
+		// most recently removed first
+		if assert.NotEmpty(t, order) {
+			assert.Equal(t, b.ID, order[0])
+		}
+	})
+
+	t.Run("restore book", func(t *testing.T) {
+		b := makeBook("restore book")
+		r.AddBook(ctx, b)
+
+		assert.Equal(t, repoerr.ErrRecordNotFound, r.RestoreBook(ctx, b.ID))
+		assert.NoError(t, r.RemoveBook(ctx, b.ID))
+		assert.NoError(t, r.RestoreBook(ctx, b.ID))
+		assert.Equal(t, repoerr.ErrRecordNotFound, r.RestoreBook(ctx, b.ID))
+
+		bOut, err := r.GetBookByID(ctx, b.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, b.Title, bOut.Title)
+		assert.Equal(t, 3, bOut.Version)
+		assert.False(t, bOut.IsDeleted())
+
+		_, err = r.GetCopyByID(ctx, book.FirstCopy(b).ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("purge books", func(t *testing.T) {
+		b := makeBook("purge book")
+		r.AddBook(ctx, b)
+		assert.NoError(t, r.RemoveBook(ctx, b.ID))
+
+		// nothing was removed before an hour ago
+		n, err := r.PurgeBooks(ctx, time.Now().Add(-time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, n)
+
+		n, err = r.PurgeBooks(ctx, time.Now().Add(time.Hour))
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, n, 1)
+
+		assert.Equal(t, repoerr.ErrRecordNotFound, r.RestoreBook(ctx, b.ID))
+		_, err = r.GetCopyByID(ctx, book.FirstCopy(b).ID)
+		assert.Equal(t, repoerr.ErrRecordNotFound, err)
+		history, err := r.BookHistory(ctx, b.ID)
+		assert.NoError(t, err)
+		assert.Len(t, history, 0)
+
+		trash, err := r.TrashedBooks(ctx)
+		assert.NoError(t, err)
+		for _, tb := range trash {
+			assert.NotEqual(t, b.ID, tb.ID)
+		}
+	})
+
+	t.Run("books with a copy in use are not removed", func(t *testing.T) {
+		b := makeBook("in use trash book")
+		assert.NoError(t, r.AddBook(ctx, b))
+		reader, waiting := patron.NewPatron("Jane Doe", "jane@example.com"), patron.NewPatron("John Doe", "john@example.com")
+		assert.NoError(t, r.AddPatron(ctx, reader))
+		assert.NoError(t, r.AddPatron(ctx, waiting))
+
+		_, err := usecase.CheckOut(ctx, r, b.ID, reader.ID, time.Now(), time.Now().AddDate(0, 0, 14), "librarian")
+		assert.NoError(t, err)
+		assert.Equal(t, usecase.ErrCopyIsInUse, usecase.RemoveBook(ctx, r, b.ID, 0))
+
+		h, err := usecase.PlaceHold(ctx, r, b.ID, waiting.ID)
+		assert.NoError(t, err)
+		_, err = usecase.CheckIn(ctx, r, b.ID, "", time.Now(), hold.DefaultPickupWindow, "librarian")
+		assert.NoError(t, err)
+		assert.Equal(t, usecase.ErrCopyIsInUse, usecase.RemoveBook(ctx, r, b.ID, 0))
+
+		_, err = usecase.CancelHold(ctx, r, h.ID, hold.DefaultPickupWindow, "librarian")
+		assert.NoError(t, err)
+		assert.NoError(t, usecase.RemoveBook(ctx, r, b.ID, 0))
+	})
+}
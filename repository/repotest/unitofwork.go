@@ -0,0 +1,110 @@
+package repotest
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/entity/patron"
+	"github.com/tempcke/books/repository/repoerr"
+	"github.com/tempcke/books/usecase"
+)
+
+func testUnitOfWork(t *testing.T, r usecase.LibraryRepo) {
+	errFailed := errors.New("failed")
+
+	t.Run("changes are rolled back when it fails", func(t *testing.T) {
+		b := makeBook("rolled back book")
+		err := r.Atomic(ctx, func(tx usecase.LibraryRepo) error {
+			if err := tx.AddBook(ctx, b); err != nil {
+				return err
+			}
+			if _, err := tx.GetBookByID(ctx, b.ID); err != nil {
+				return err
+			}
+			return errFailed
+		})
+		assert.Equal(t, errFailed, err)
+		_, err = r.GetBookByID(ctx, b.ID)
+		assert.Error(t, err)
+	})
+
+	t.Run("changes are committed", func(t *testing.T) {
+		b := makeBook("committed book")
+		err := r.Atomic(ctx, func(tx usecase.LibraryRepo) error {
+			return tx.AddBook(ctx, b)
+		})
+		assert.NoError(t, err)
+		_, err = r.GetBookByID(ctx, b.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("one of many concurrent check outs of a copy", func(t *testing.T) {
+		b := makeBook("concurrent book")
+		assert.NoError(t, r.AddBook(ctx, b))
+		patrons := make([]patron.Patron, 5)
+		for i := range patrons {
+			patrons[i] = patron.NewPatron("Jane Doe", "jane@example.com")
+			assert.NoError(t, r.AddPatron(ctx, patrons[i]))
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, len(patrons))
+		for i, p := range patrons {
+			wg.Add(1)
+			go func(i int, p patron.Patron) {
+				defer wg.Done()
+				due := time.Now().AddDate(0, 0, 14)
+				_, errs[i] = usecase.CheckOut(ctx, r, b.ID, p.ID, time.Now(), due, "librarian")
+			}(i, p)
+		}
+		wg.Wait()
+
+		var lent int
+		for _, err := range errs {
+			if err == nil {
+				lent++
+				continue
+			}
+			assert.Equal(t, usecase.ErrBookIsCheckedOut, err)
+		}
+		assert.Equal(t, 1, lent)
+
+		history, err := r.BookHistory(ctx, b.ID)
+		assert.NoError(t, err)
+		assert.Len(t, history, 3)
+	})
+
+	t.Run("one of many concurrent updates to the same isbn", func(t *testing.T) {
+		books := make([]book.Book, 5)
+		for i := range books {
+			books[i] = makeBook("concurrent isbn book")
+			assert.NoError(t, r.AddBook(ctx, books[i]))
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, len(books))
+		for i, b := range books {
+			wg.Add(1)
+			go func(i int, b book.Book) {
+				defer wg.Done()
+				b.ISBN = "9780262033848"
+				errs[i] = r.UpdateBook(ctx, b)
+			}(i, b)
+		}
+		wg.Wait()
+
+		var updated int
+		for _, err := range errs {
+			if err == nil {
+				updated++
+				continue
+			}
+			assert.Equal(t, repoerr.ErrRecordNotUnique, err)
+		}
+		assert.Equal(t, 1, updated)
+	})
+}
@@ -0,0 +1,546 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/repository/repoerr"
+	"github.com/tempcke/books/usecase"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqlite has no date or time types, times are stored as text in UTC which
+// sorts in time order and dates in dateFormat
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000000"
+
+// SQLite repository for single node deployments, the schema is created by the
+// migrations in db/sqlite/migrations
+type SQLite struct {
+	timeouts
+	db   *sql.DB
+	q    querier
+	inTx bool
+}
+
+// NewSQLiteRepo constructs a SQLite repository.  The db is limited to a single
+// connection as sqlite allows one writer at a time, so units of work wait for
+// each other rather than failing with SQLITE_BUSY.  It also keeps an in memory
+// database alive, each connection to :memory: is a new database.
+func NewSQLiteRepo(db *sql.DB, options ...Option) SQLite {
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+
+	// foreign keys are enforced per connection
+	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
+		log.Fatal("Could not connect to db: " + err.Error())
+	}
+
+	r := SQLite{
+		timeouts: defaultTimeouts(),
+		db:       db,
+		q:        db,
+	}
+	for _, option := range options {
+		option(&r.timeouts)
+	}
+	return r
+}
+
+// exec runs an insert, update or delete and counts the rows it affected
+func (r SQLite) exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	result, err := r.q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// isUniqueViolation tells if err is a unique constraint violation, a writer
+// can take an isbn after another one checked it was free
+func (r SQLite) isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// AddBook persists a book along with its first copy,
+// its status and rating start the book history
+func (r SQLite) AddBook(ctx context.Context, b book.Book) error {
+	ctx, cancel := r.writeContext(ctx)
+	defer cancel()
+
+	now := sqliteTime(time.Now())
+	first := book.FirstCopy(b)
+
+	// a single transaction so a book is never stored without a history or copy
+	return r.atomic(ctx, func(r SQLite) error {
+		n, err := r.exec(ctx, `
+			INSERT INTO books
+			(id, isbn, title, author, publisher, pubdate, status, rating, created_at, updated_at)
+			VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?9)
+			ON CONFLICT DO NOTHING
+		`,
+			b.ID,
+			nullString(b.ISBN),
+			b.Title,
+			b.Author,
+			b.Publisher,
+			b.PubDate.Format(dateFormat),
+			b.Status.String(),
+			b.Rating.Int(),
+			now,
+		)
+		if err != nil {
+			return err
+		}
+
+		// nothing is inserted when the id or isbn belongs to another book
+		if n == 0 {
+			return repoerr.ErrRecordNotUnique
+		}
+
+		_, err = r.exec(ctx, `
+			INSERT INTO copies
+			(`+copyColumns+`, created_at, updated_at)
+			VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?6)
+		`,
+			first.ID,
+			b.ID,
+			first.Barcode,
+			b.Status.String(),
+			first.Condition.String(),
+			now,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = r.exec(ctx, `
+			INSERT INTO book_history (book_id, field, new_value, changed_at)
+			VALUES (?1, 'status', ?2, ?4), (?1, 'rating', ?3, ?4)
+		`,
+			b.ID,
+			b.Status.String(),
+			b.Rating.String(),
+			now,
+		)
+		return err
+	})
+}
+
+// RemoveBook moves a previously stored book to the trash
+func (r SQLite) RemoveBook(ctx context.Context, id string) error {
+	ctx, cancel := r.writeContext(ctx)
+	defer cancel()
+
+	n, err := r.exec(ctx, `
+		UPDATE books
+		SET deleted_at = ?2, updated_at = ?2, version = version + 1
+		WHERE id = ?1 AND deleted_at IS NULL
+	`, id, sqliteTime(time.Now()))
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return repoerr.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetBookByID returns a previously stored book
+func (r SQLite) GetBookByID(ctx context.Context, id string) (b book.Book, err error) {
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, version, coalesce(isbn, ''), title, author, publisher, pubdate, rating, status
+		FROM books_current WHERE id = ?1 AND deleted_at IS NULL
+	`
+
+	err = r.q.QueryRowContext(ctx, query, id).Scan(
+		&b.ID, &b.Version, &b.ISBN, &b.Title, &b.Author, &b.Publisher,
+		scanTime(&b.PubDate), &b.Rating, &b.Status,
+	)
+	if err == sql.ErrNoRows {
+		return b, repoerr.ErrRecordNotFound
+	}
+
+	return b, err
+}
+
+// GetBookByISBN returns a previously stored book by its ISBN-13
+func (r SQLite) GetBookByISBN(ctx context.Context, isbn string) (b book.Book, err error) {
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, version, isbn, title, author, publisher, pubdate, rating, status
+		FROM books_current WHERE isbn = ?1 AND deleted_at IS NULL
+	`
+
+	err = r.q.QueryRowContext(ctx, query, isbn).Scan(
+		&b.ID, &b.Version, &b.ISBN, &b.Title, &b.Author, &b.Publisher,
+		scanTime(&b.PubDate), &b.Rating, &b.Status,
+	)
+	if err == sql.ErrNoRows {
+		return b, repoerr.ErrRecordNotFound
+	}
+
+	return b, err
+}
+
+// BookList returns a page of the stored books which match the query
+func (r SQLite) BookList(ctx context.Context, q usecase.BookQuery) (usecase.BookPage, error) {
+	page := usecase.BookPage{Books: make([]book.Book, 0)}
+
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+
+	query, args, err := bookListQuery(q, sqliteDialect)
+	if err != nil {
+		return page, err
+	}
+
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		b := book.Book{}
+
+		err = rows.Scan(
+			&b.ID, &b.Version, &b.ISBN, &b.Title, &b.Author, &b.Publisher,
+			scanTime(&b.PubDate), &b.Rating, &b.Status,
+		)
+		if err != nil {
+			return page, err
+		}
+
+		page.Books = append(page.Books, b)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	// one extra row was requested to know if there is another page
+	if q.Limit > 0 && len(page.Books) > q.Limit {
+		page.Books = page.Books[:q.Limit]
+		page.Next = usecase.NewCursor(page.Books[q.Limit-1])
+	}
+
+	return page, nil
+}
+
+// SearchBooks ranks the books matching a web search style query
+// eg: `fowler refactoring`, `"domain driven" -evans`, `rust or go`
+func (r SQLite) SearchBooks(ctx context.Context, query string, limit int) ([]usecase.SearchResult, error) {
+	results := make([]usecase.SearchResult, 0)
+
+	match := ftsQuery(query)
+	if match == "" {
+		return results, nil
+	}
+
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+
+	// a negative limit is the same as no limit
+	if limit <= 0 {
+		limit = -1
+	}
+
+	// bm25 is better the lower it is, its weights match the postgres ts_rank
+	// weights of the title, author and publisher
+	sqlQuery := `
+		SELECT b.id, b.version, coalesce(b.isbn, ''), b.title, b.author, b.publisher,
+			b.pubdate, b.rating, b.status,
+			-bm25(books_search, 1.0, 0.4, 0.2) AS score,
+			highlight(books_search, 0, ?3, ?4),
+			highlight(books_search, 1, ?3, ?4),
+			coalesce(highlight(books_search, 2, ?3, ?4), '')
+		FROM books_search JOIN books_current b ON b.search_id = books_search.rowid
+		WHERE books_search MATCH ?1 AND b.deleted_at IS NULL
+		ORDER BY score DESC, b.id
+		LIMIT ?2
+	`
+
+	rows, err := r.q.QueryContext(ctx, sqlQuery,
+		match, limit, usecase.MatchStart, usecase.MatchStop)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			res                      usecase.SearchResult
+			title, author, publisher string
+		)
+		b := &res.Book
+
+		err = rows.Scan(
+			&b.ID, &b.Version, &b.ISBN, &b.Title, &b.Author, &b.Publisher,
+			scanTime(&b.PubDate), &b.Rating, &b.Status,
+			&res.Score, &title, &author, &publisher,
+		)
+		if err != nil {
+			return results, err
+		}
+
+		res.Highlights = searchHighlights(title, author, publisher)
+		results = append(results, res)
+	}
+
+	return results, rows.Err()
+}
+
+// ftsQuery translates a web search style query, as postgres reads it, into
+// an fts5 query: words and "quoted phrases" must all match unless or is
+// between them and -words must not match.  Every term is quoted so nothing
+// a user types is read as fts5 syntax, empty when nothing can match.
+func ftsQuery(query string) string {
+	var (
+		match, exclude []string
+		or             bool
+	)
+	for query = strings.TrimSpace(query); query != ""; query = strings.TrimSpace(query) {
+		negate := query[0] == '-'
+		if negate {
+			query = query[1:]
+		}
+
+		var term string
+		quoted := strings.HasPrefix(query, `"`)
+		if quoted {
+			end := strings.Index(query[1:], `"`)
+			if end < 0 {
+				end = len(query) - 1
+			}
+			term, query = query[1:end+1], query[end+1:]
+			query = strings.TrimPrefix(query, `"`)
+		} else {
+			end := strings.IndexFunc(query, unicode.IsSpace)
+			if end < 0 {
+				end = len(query)
+			}
+			term, query = query[:end], query[end:]
+		}
+
+		if !quoted && !negate && strings.EqualFold(term, "or") {
+			or = len(match) > 0
+			continue
+		}
+		if strings.TrimSpace(term) == "" {
+			continue
+		}
+
+		phrase := `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		switch {
+		case negate:
+			exclude = append(exclude, phrase)
+		case or:
+			match = append(match, "OR", phrase)
+		default:
+			match = append(match, phrase)
+		}
+		or = false
+	}
+
+	if len(match) == 0 {
+		return ""
+	}
+	if len(exclude) == 0 {
+		return strings.Join(match, " ")
+	}
+	return "(" + strings.Join(match, " ") + ") NOT (" + strings.Join(exclude, " OR ") + ")"
+}
+
+// UpdateBook updates a previously stored book record
+// status and rating are left as is, use RecordChange to modify them
+func (r SQLite) UpdateBook(ctx context.Context, b book.Book) error {
+	// custom error in case the isbn belongs to another book
+	if other, err := r.GetBookByISBN(ctx, b.ISBN); err == nil && other.ID != b.ID {
+		return repoerr.ErrRecordNotUnique
+	}
+
+	ctx, cancel := r.writeContext(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE books
+		SET title = ?2,
+				author = ?3,
+				publisher = ?4,
+				pubdate = ?5,
+				updated_at = ?6,
+				isbn = ?7,
+				version = version + 1
+		WHERE id = ?1 AND version = ?8 AND deleted_at IS NULL;
+	`
+
+	n, err := r.exec(ctx, query,
+		b.ID,
+		b.Title,
+		b.Author,
+		b.Publisher,
+		b.PubDate.Format(dateFormat),
+		sqliteTime(time.Now()),
+		nullString(b.ISBN),
+		b.Version,
+	)
+
+	if r.isUniqueViolation(err) {
+		return repoerr.ErrRecordNotUnique
+	}
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		if _, err := r.GetBookByID(ctx, b.ID); err == nil {
+			return usecase.ErrVersionConflict
+		}
+		return repoerr.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// RecordChange appends a change to the book history, the latest change
+// of a field is the current value of that field
+func (r SQLite) RecordChange(ctx context.Context, c book.Change) error {
+	status, rating, err := changedColumns(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := r.writeContext(ctx)
+	defer cancel()
+
+	return r.atomic(ctx, func(r SQLite) error {
+		n, err := r.exec(ctx, `
+			UPDATE books
+			SET version = version + 1,
+					status = coalesce(?2, status),
+					rating = coalesce(?3, rating)
+			WHERE id = ?1 AND deleted_at IS NULL
+		`, c.BookID, status, rating)
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return repoerr.ErrRecordNotFound
+		}
+
+		_, err = r.exec(ctx, `
+			INSERT INTO book_history
+			(book_id, field, old_value, new_value, actor, changed_at)
+			VALUES (?1, ?2, ?3, ?4, ?5, ?6)
+		`,
+			c.BookID,
+			c.Field.String(),
+			c.OldValue,
+			c.NewValue,
+			c.Actor,
+			sqliteTime(c.ChangedAt),
+		)
+		return err
+	})
+}
+
+// BookHistory lists the status and rating changes of a book, oldest first
+func (r SQLite) BookHistory(ctx context.Context, id string) ([]book.Change, error) {
+	history := make([]book.Change, 0)
+
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+
+	query := `
+		SELECT book_id, field, old_value, new_value, actor, changed_at
+		FROM book_history
+		WHERE book_id = ?1
+		ORDER BY id
+	`
+
+	rows, err := r.q.QueryContext(ctx, query, id)
+	if err != nil {
+		return history, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c := book.Change{}
+
+		err = rows.Scan(
+			&c.BookID, &c.Field, &c.OldValue,
+			&c.NewValue, &c.Actor, scanTime(&c.ChangedAt),
+		)
+		if err != nil {
+			return history, err
+		}
+
+		history = append(history, c)
+	}
+
+	return history, rows.Err()
+}
+
+// sqliteTime is a time as sqlite stores it, the zero time is stored as NULL
+func sqliteTime(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.UTC().Format(sqliteTimeFormat), Valid: true}
+}
+
+// timeScanner reads a time or date stored as text by sqlite
+type timeScanner struct {
+	t *time.Time
+}
+
+// scanTime scans a time or date column into t, NULL is the zero time
+func scanTime(t *time.Time) timeScanner {
+	return timeScanner{t}
+}
+
+// Scan implements sql.Scanner
+func (s timeScanner) Scan(src interface{}) error {
+	var text string
+	switch v := src.(type) {
+	case nil:
+		*s.t = time.Time{}
+		return nil
+	case time.Time:
+		*s.t = v
+		return nil
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return fmt.Errorf("can not scan %T into a time", src)
+	}
+
+	layout := sqliteTimeFormat
+	if len(text) == len(dateFormat) {
+		layout = dateFormat
+	}
+	t, err := time.Parse(layout, text)
+	if err != nil {
+		return err
+	}
+	*s.t = t
+	return nil
+}
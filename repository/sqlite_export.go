@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/usecase"
+)
+
+// ExportBooks reads the books matching the query a page at a time, sqlite
+// has a single connection which a cursor would hold for the whole export
+func (r SQLite) ExportBooks(ctx context.Context, q usecase.BookQuery, fn func(book.Book) error) error {
+	return exportByPage(ctx, r.BookList, q, fn)
+}
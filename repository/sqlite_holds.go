@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/tempcke/books/entity/hold"
+	"github.com/tempcke/books/repository/repoerr"
+)
+
+// AddHold persists a hold, a patron can only have one open hold per book
+func (r SQLite) AddHold(ctx context.Context, h hold.Hold) error {
+	ctx, cancel := r.writeContext(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO holds
+		(` + holdColumns + `)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9)
+		ON CONFLICT (book_id, patron_id) WHERE closed_at IS NULL DO NOTHING
+	`
+
+	n, err := r.exec(ctx, query,
+		h.ID,
+		h.BookID,
+		nullString(h.CopyID),
+		h.PatronID,
+		h.Status.String(),
+		sqliteTime(h.PlacedAt),
+		sqliteTime(h.ReadyAt),
+		sqliteTime(h.ExpiresAt),
+		sqliteTime(h.ClosedAt),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return repoerr.ErrRecordNotUnique
+	}
+
+	return nil
+}
+
+// UpdateHold updates a previously stored hold
+func (r SQLite) UpdateHold(ctx context.Context, h hold.Hold) error {
+	ctx, cancel := r.writeContext(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE holds
+		SET copy_id = ?2,
+				status = ?3,
+				ready_at = ?4,
+				expires_at = ?5,
+				closed_at = ?6
+		WHERE id = ?1;
+	`
+
+	n, err := r.exec(ctx, query,
+		h.ID,
+		nullString(h.CopyID),
+		h.Status.String(),
+		sqliteTime(h.ReadyAt),
+		sqliteTime(h.ExpiresAt),
+		sqliteTime(h.ClosedAt),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return repoerr.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetHoldByID gets a hold by id
+func (r SQLite) GetHoldByID(ctx context.Context, id string) (hold.Hold, error) {
+	query := `SELECT ` + holdColumns + ` FROM holds WHERE id = ?1`
+	holds, err := r.holds(ctx, query, id)
+	if err != nil {
+		return hold.Hold{}, err
+	}
+	if len(holds) == 0 {
+		return hold.Hold{}, repoerr.ErrRecordNotFound
+	}
+	return holds[0], nil
+}
+
+// BookHolds lists the open holds of a book, first placed first
+func (r SQLite) BookHolds(ctx context.Context, bookID string) ([]hold.Hold, error) {
+	query := `
+		SELECT ` + holdColumns + `
+		FROM holds
+		WHERE book_id = ?1 AND closed_at IS NULL
+		ORDER BY placed_at, id
+	`
+	return r.holds(ctx, query, bookID)
+}
+
+// ExpiredHolds lists the ready holds which expired before asOf
+func (r SQLite) ExpiredHolds(ctx context.Context, asOf time.Time) ([]hold.Hold, error) {
+	query := `
+		SELECT ` + holdColumns + `
+		FROM holds
+		WHERE status = ?1 AND expires_at < ?2
+		ORDER BY placed_at, id
+	`
+	return r.holds(ctx, query, hold.StatusReady.String(), sqliteTime(asOf))
+}
+
+func (r SQLite) holds(ctx context.Context, query string, args ...interface{}) ([]hold.Hold, error) {
+	holds := make([]hold.Hold, 0)
+
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return holds, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			h      hold.Hold
+			copyID sql.NullString
+			status string
+		)
+
+		err = rows.Scan(
+			&h.ID, &h.BookID, &copyID, &h.PatronID, &status,
+			scanTime(&h.PlacedAt), scanTime(&h.ReadyAt),
+			scanTime(&h.ExpiresAt), scanTime(&h.ClosedAt),
+		)
+		if err != nil {
+			return holds, err
+		}
+		h.CopyID = copyID.String
+		h.Status = hold.Status(status)
+
+		holds = append(holds, h)
+	}
+
+	return holds, rows.Err()
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/tempcke/books/entity/loan"
+	"github.com/tempcke/books/repository/repoerr"
+)
+
+// AddLoan persists a loan
+func (r SQLite) AddLoan(ctx context.Context, l loan.Loan) error {
+	ctx, cancel := r.writeContext(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO loans
+		(id, book_id, copy_id, patron_id, checked_out_at, due_date, returned_at, overdue_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)
+		ON CONFLICT DO NOTHING
+	`
+
+	n, err := r.exec(ctx, query,
+		l.ID,
+		l.BookID,
+		nullString(l.CopyID),
+		l.PatronID,
+		sqliteTime(l.CheckedOutAt),
+		l.DueDate.Format(dateFormat),
+		sqliteTime(l.ReturnedAt),
+		sqliteTime(l.OverdueAt),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	// nothing is inserted when the copy is already lent out
+	if n == 0 {
+		return repoerr.ErrRecordNotUnique
+	}
+
+	return nil
+}
+
+// UpdateLoan updates a previously stored loan
+func (r SQLite) UpdateLoan(ctx context.Context, l loan.Loan) error {
+	ctx, cancel := r.writeContext(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE loans
+		SET due_date = ?2,
+				returned_at = ?3,
+				overdue_at = ?4
+		WHERE id = ?1;
+	`
+
+	n, err := r.exec(ctx, query,
+		l.ID,
+		l.DueDate.Format(dateFormat),
+		sqliteTime(l.ReturnedAt),
+		sqliteTime(l.OverdueAt),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return repoerr.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// BookLoans lists every loan of a book, most recent first
+func (r SQLite) BookLoans(ctx context.Context, bookID string) ([]loan.Loan, error) {
+	query := `
+		SELECT id, book_id, copy_id, patron_id, checked_out_at, due_date, returned_at, overdue_at
+		FROM loans
+		WHERE book_id = ?1
+		ORDER BY checked_out_at DESC
+	`
+	return r.loans(ctx, query, bookID)
+}
+
+// OverdueLoans lists the open loans due before asOf, oldest due date first
+func (r SQLite) OverdueLoans(ctx context.Context, asOf time.Time) ([]loan.Loan, error) {
+	query := `
+		SELECT id, book_id, copy_id, patron_id, checked_out_at, due_date, returned_at, overdue_at
+		FROM loans
+		WHERE returned_at IS NULL AND due_date < ?1
+		ORDER BY due_date, id
+	`
+	return r.loans(ctx, query, asOf.Format(dateFormat))
+}
+
+func (r SQLite) loans(ctx context.Context, query string, args ...interface{}) ([]loan.Loan, error) {
+	loans := make([]loan.Loan, 0)
+
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return loans, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			l      loan.Loan
+			copyID sql.NullString
+		)
+
+		err = rows.Scan(
+			&l.ID, &l.BookID, &copyID, &l.PatronID,
+			scanTime(&l.CheckedOutAt), scanTime(&l.DueDate),
+			scanTime(&l.ReturnedAt), scanTime(&l.OverdueAt),
+		)
+		if err != nil {
+			return loans, err
+		}
+		l.CopyID = copyID.String
+
+		loans = append(loans, l)
+	}
+
+	return loans, rows.Err()
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/tempcke/books/entity/patron"
+	"github.com/tempcke/books/repository/repoerr"
+)
+
+// AddPatron persists a patron
+func (r SQLite) AddPatron(ctx context.Context, p patron.Patron) error {
+	ctx, cancel := r.writeContext(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO patrons
+		(id, name, email, created_at, updated_at)
+		VALUES (?1, ?2, ?3, ?4, ?4)
+		ON CONFLICT (id) DO NOTHING
+	`
+
+	n, err := r.exec(ctx, query,
+		p.ID,
+		p.Name,
+		p.Email,
+		sqliteTime(time.Now()),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return repoerr.ErrRecordNotUnique
+	}
+
+	return nil
+}
+
+// GetPatronByID returns a previously stored patron
+func (r SQLite) GetPatronByID(ctx context.Context, id string) (p patron.Patron, err error) {
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, name, email
+		FROM patrons WHERE id = ?1
+	`
+
+	err = r.q.QueryRowContext(ctx, query, id).Scan(
+		&p.ID, &p.Name, &p.Email,
+	)
+	if err == sql.ErrNoRows {
+		err = repoerr.ErrRecordNotFound
+	}
+
+	return p, err
+}
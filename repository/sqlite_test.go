@@ -0,0 +1,58 @@
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/internal/sqlitemigrate"
+	"github.com/tempcke/books/repository"
+	"github.com/tempcke/books/repository/repotest"
+	"github.com/tempcke/books/usecase"
+)
+
+var (
+	sqliteDB   *sql.DB
+	sqliteRepo repository.SQLite
+)
+
+func TestSQLiteRepo(t *testing.T) {
+	t.Run("ensure SQLiteRepository is a LibraryRepo", func(t *testing.T) {
+		assert.Implements(t, (*usecase.LibraryRepo)(nil), sqliteRepo)
+	})
+	repotest.Run(t, func(*testing.T) usecase.LibraryRepo {
+		return sqliteRepo
+	})
+}
+
+func TestSQLiteTimeouts(t *testing.T) {
+	testTimeouts(t, sqliteRepo, func(options ...repository.Option) usecase.LibraryRepo {
+		return repository.NewSQLiteRepo(sqliteDB, options...)
+	})
+}
+
+// setupSQLite constructs the sqliteRepo var on an in memory database
+// migrated the same way the bookserver migrates it on startup
+func setupSQLite() error {
+	db, err := sql.Open(sqlitemigrate.DriverName, ":memory:")
+	if err != nil {
+		return err
+	}
+	sqliteDB = db
+	sqliteRepo = repository.NewSQLiteRepo(db)
+
+	driver, err := sqlitemigrate.WithInstance(db)
+	if err != nil {
+		return err
+	}
+	m, err := migrate.NewWithDatabaseInstance(
+		"file://../db/sqlite/migrations", sqlitemigrate.DriverName, driver)
+	if err != nil {
+		return err
+	}
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return err
+	}
+	return nil
+}
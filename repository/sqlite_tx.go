@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tempcke/books/usecase"
+)
+
+// Atomic runs fn in a transaction which is committed when fn returns nil and
+// rolled back otherwise, the transaction holds the only connection to the db
+// so books read by fn are locked until it ends
+// calls made within fn join the transaction
+func (r SQLite) Atomic(ctx context.Context, fn func(usecase.LibraryRepo) error) error {
+	return r.atomic(ctx, func(tx SQLite) error {
+		return fn(tx)
+	})
+}
+
+// atomic runs fn in a transaction, or the one r is in, so the statements
+// which postgres runs as a single statement are all or nothing
+func (r SQLite) atomic(ctx context.Context, fn func(SQLite) error) error {
+	if r.inTx {
+		return fn(r)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	txRepo := r
+	txRepo.q = tx
+	txRepo.inTx = true
+	if err := fn(txRepo); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
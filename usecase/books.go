@@ -1,18 +1,42 @@
 package usecase
 
-import "github.com/tempcke/books/entity/book"
+import (
+	"context"
+	"errors"
+
+	"github.com/tempcke/books/entity/book"
+)
+
+// Book Errors
+var (
+	ErrStatusIsNotEditable = errors.New("Status can only be changed by checking a book out or in")
+	ErrISBNExists          = errors.New("ISBN belongs to another book")
+	ErrVersionConflict     = errors.New("Book was changed since it was read")
+)
 
 // BookReader is used to fetch information about books
 type BookReader interface {
-	GetBookByID(id string) (book.Book, error)
-	BookList() ([]book.Book, error)
+	GetBookByID(ctx context.Context, id string) (book.Book, error)
+	GetBookByISBN(ctx context.Context, isbn string) (book.Book, error)
+	BookList(ctx context.Context, q BookQuery) (BookPage, error)
+	SearchBooks(ctx context.Context, query string, limit int) ([]SearchResult, error)
+	BookHistory(ctx context.Context, id string) ([]book.Change, error)
 }
 
 // BookWriter is used to add and remove books
+// AddBook also stores the first copy of the book, see book.FirstCopy
+// RemoveBook moves a book to the trash, see TrashReaderWriter, from then on
+// the book readers and writers act as if the book does not exist
+// status and rating are never updated in place, UpdateBook leaves them
+// untouched and RecordChange appends their new value to the book history
+// UpdateBook fails with ErrVersionConflict unless the version of the book is
+// the stored version, every change to a book, its history or its copies
+// increments the stored version
 type BookWriter interface {
-	AddBook(book.Book) error
-	RemoveBook(id string) error
-	UpdateBook(book.Book) error
+	AddBook(ctx context.Context, b book.Book) error
+	RemoveBook(ctx context.Context, id string) error
+	UpdateBook(ctx context.Context, b book.Book) error
+	RecordChange(ctx context.Context, c book.Change) error
 }
 
 // BookReaderWriter is used for updates
@@ -21,63 +45,177 @@ type BookReaderWriter interface {
 	BookWriter
 }
 
-// AddBook is used to store a book
-func AddBook(r BookWriter, book book.Book) error {
-	if err := book.Validate(); err != nil {
-		return err
+// AddBook is used to store a book, the ISBN is stored in its ISBN-13 form
+func AddBook(ctx context.Context, r BookReaderWriter, b book.Book) (book.Book, error) {
+	if err := b.Validate(); err != nil {
+		return b, err
+	}
+
+	b = normalizeISBN(b)
+	if err := checkISBNIsFree(ctx, r, b); err != nil {
+		return b, err
 	}
-	return r.AddBook(book)
+
+	return b, r.AddBook(ctx, b)
 }
 
 // GetBook gets a book by id
-func GetBook(r BookReader, id string) (book.Book, error) {
-	return r.GetBookByID(id)
+func GetBook(ctx context.Context, r BookReader, id string) (book.Book, error) {
+	return r.GetBookByID(ctx, id)
 }
 
-// ListBooks lists all books from storage
-func ListBooks(r BookReader) ([]book.Book, error) {
-	return r.BookList()
+// GetBookByISBN gets a book by its ISBN-10 or ISBN-13, hyphens are ignored
+func GetBookByISBN(ctx context.Context, r BookReader, isbn string) (book.Book, error) {
+	isbn, err := book.NormalizeISBN(isbn)
+	if err != nil {
+		return book.Book{}, err
+	}
+	return r.GetBookByISBN(ctx, isbn)
 }
 
-// RemoveBook removes a book, error if does not exist or storage fails
-func RemoveBook(r BookWriter, id string) error {
-	return r.RemoveBook(id)
+// ListBooks lists a page of the books in storage which match the query
+func ListBooks(ctx context.Context, r BookReader, q BookQuery) (BookPage, error) {
+	if err := q.Validate(); err != nil {
+		return BookPage{}, err
+	}
+	return r.BookList(ctx, q)
 }
 
-// ChangeBookStatus is used to modify the status of a book
-func ChangeBookStatus(r BookReaderWriter, id string, status book.Status) (book.Book, error) {
-	book, err := r.GetBookByID(id)
+// RemoveBook moves a book to the trash, error if does not exist or storage fails
+// version is the version of the book the caller read, 0 removes any version
+// a book with a copy checked out or on hold is not removed, ErrCopyIsInUse,
+// its loans and holds would be deleted along with it when the trash is purged
+func RemoveBook(ctx context.Context, r LibraryRepo, id string, version int) error {
+	return r.Atomic(ctx, func(r LibraryRepo) error {
+		stored, err := r.GetBookByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if version != 0 && version != stored.Version {
+			return ErrVersionConflict
+		}
+
+		copies, err := r.BookCopies(ctx, id)
+		if err != nil {
+			return err
+		}
+		for _, c := range copies {
+			if !c.IsAvailable() {
+				return ErrCopyIsInUse
+			}
+		}
+		return r.RemoveBook(ctx, id)
+	})
+}
+
+// UpdateBook replaces every field of a stored book, error if it does not exist
+// a changed rating is recorded in the book history under actor, the status
+// can only be changed by checking the book out or in
+// b.Version is the version the caller read, ErrVersionConflict is returned
+// when the book changed since then, 0 replaces any version
+func UpdateBook(ctx context.Context, r LibraryRepo, b book.Book, actor string) (book.Book, error) {
+	err := r.Atomic(ctx, func(r LibraryRepo) (err error) {
+		b, err = updateBook(ctx, r, b, actor)
+		return err
+	})
+	return b, err
+}
+
+// updateBook is UpdateBook within a unit of work
+func updateBook(ctx context.Context, r LibraryRepo, b book.Book, actor string) (book.Book, error) {
+	stored, err := r.GetBookByID(ctx, b.ID)
 	if err != nil {
-		return book, err
+		return b, err
 	}
 
-	book.Status = status
-	if err := book.Validate(); err != nil {
-		return book, err
+	if b.Version != 0 && b.Version != stored.Version {
+		return b, ErrVersionConflict
 	}
+	b.Version = stored.Version
 
-	if err := r.UpdateBook(book); err != nil {
-		return book, err
+	if b.Status != stored.Status {
+		return b, ErrStatusIsNotEditable
 	}
 
-	return book, nil
-}
+	if err := b.Validate(); err != nil {
+		return b, err
+	}
 
-// ChangeBookRating is used to modify the rating of a book
-func ChangeBookRating(r BookReaderWriter, id string, rating book.Rating) (book.Book, error) {
-	book, err := r.GetBookByID(id)
-	if err != nil {
-		return book, err
+	b = normalizeISBN(b)
+	if err := checkISBNIsFree(ctx, r, b); err != nil {
+		return b, err
 	}
 
-	book.Rating = rating
-	if err := book.Validate(); err != nil {
-		return book, err
+	if err := r.UpdateBook(ctx, b); err != nil {
+		return b, err
 	}
 
-	if err := r.UpdateBook(book); err != nil {
-		return book, err
+	if err := recordChanges(ctx, r, stored, b, actor); err != nil {
+		return b, err
 	}
+	return r.GetBookByID(ctx, b.ID)
+}
+
+// ChangeBookStatus is used to modify the status of a book
+func ChangeBookStatus(ctx context.Context, r LibraryRepo, id string, status book.Status, actor string) (book.Book, error) {
+	return changeBook(ctx, r, id, 0, actor, func(b *book.Book) {
+		b.Status = status
+	})
+}
+
+// ChangeBookRating is used to modify the rating of a book
+// version is the version of the book the caller read, 0 changes any version
+func ChangeBookRating(ctx context.Context, r LibraryRepo, id string, version int, rating book.Rating, actor string) (book.Book, error) {
+	return changeBook(ctx, r, id, version, actor, func(b *book.Book) {
+		b.Rating = rating
+	})
+}
 
-	return book, nil
+// changeBook reads, changes and records a book as a single unit of work
+// so concurrent changes are recorded one after the other, ErrVersionConflict
+// unless the book is at version or version is 0
+func changeBook(ctx context.Context, r LibraryRepo, id string, version int, actor string, change func(*book.Book)) (book.Book, error) {
+	var b book.Book
+	err := r.Atomic(ctx, func(r LibraryRepo) error {
+		stored, err := r.GetBookByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if version != 0 && version != stored.Version {
+			return ErrVersionConflict
+		}
+
+		b = stored
+		change(&b)
+		if err := b.Validate(); err != nil {
+			return err
+		}
+
+		if err := recordChanges(ctx, r, stored, b, actor); err != nil {
+			return err
+		}
+		b, err = r.GetBookByID(ctx, id)
+		return err
+	})
+	return b, err
+}
+
+// normalizeISBN expects a valid book
+func normalizeISBN(b book.Book) book.Book {
+	if b.ISBN != "" {
+		b.ISBN, _ = book.NormalizeISBN(b.ISBN)
+	}
+	return b
+}
+
+// checkISBNIsFree errors when another book has the ISBN of b
+func checkISBNIsFree(ctx context.Context, r BookReader, b book.Book) error {
+	if b.ISBN == "" {
+		return nil
+	}
+	other, err := r.GetBookByISBN(ctx, b.ISBN)
+	if err == nil && other.ID != b.ID {
+		return ErrISBNExists
+	}
+	return nil
 }
@@ -1,66 +1,142 @@
 package usecase_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/tempcke/books/entity/book"
-	"github.com/tempcke/books/fake"
+	"github.com/tempcke/books/repository/memory"
 	"github.com/tempcke/books/usecase"
 )
 
+const actor = "librarian"
+
+var ctx = context.Background()
+
 func TestAddBook(t *testing.T) {
-	repo := fake.NewBookRepo()
+	repo := memory.NewRepo()
 	goodBook := makeBook("add book")
 	badBook := makeBook("") // empty title will not validate
-	assert.NoError(t, usecase.AddBook(repo, goodBook))
-	assert.Error(t, usecase.AddBook(repo, badBook))
+	_, err := usecase.AddBook(ctx, repo, goodBook)
+	assert.NoError(t, err)
+	_, err = usecase.AddBook(ctx, repo, badBook)
+	assert.Error(t, err)
+}
+
+func TestBookISBN(t *testing.T) {
+	repo := memory.NewRepo()
+	b := makeBook("Refactoring")
+	b.ISBN = "0-201-48567-2"
+
+	t.Run("stored as ISBN-13", func(t *testing.T) {
+		stored, err := usecase.AddBook(ctx, repo, b)
+		assert.NoError(t, err)
+		assert.Equal(t, "9780201485677", stored.ISBN)
+		b = stored
+	})
+
+	t.Run("invalid isbn", func(t *testing.T) {
+		bad := makeBook("bad isbn")
+		bad.ISBN = "0201485673"
+		_, err := usecase.AddBook(ctx, repo, bad)
+		assert.ErrorIs(t, err, book.ErrISBNInvalid)
+	})
+
+	t.Run("isbn belongs to another book", func(t *testing.T) {
+		other := makeBook("same isbn")
+		other.ISBN = "978-0-201-48567-7"
+		_, err := usecase.AddBook(ctx, repo, other)
+		assert.Equal(t, usecase.ErrISBNExists, err)
+
+		other.ISBN = ""
+		_, err = usecase.AddBook(ctx, repo, other)
+		assert.NoError(t, err)
+		other.ISBN = b.ISBN
+		_, err = usecase.UpdateBook(ctx, repo, other, actor)
+		assert.Equal(t, usecase.ErrISBNExists, err)
+	})
+
+	t.Run("update keeps its own isbn", func(t *testing.T) {
+		b.Title = "Refactoring: Improving the Design of Existing Code"
+		_, err := usecase.UpdateBook(ctx, repo, b, actor)
+		assert.NoError(t, err)
+	})
+
+	t.Run("get by isbn", func(t *testing.T) {
+		got, err := usecase.GetBookByISBN(ctx, repo, "0201485672")
+		assert.NoError(t, err)
+		assert.Equal(t, b.ID, got.ID)
+
+		_, err = usecase.GetBookByISBN(ctx, repo, "0201485673")
+		assert.Equal(t, book.ErrISBNInvalid, err)
+
+		_, err = usecase.GetBookByISBN(ctx, repo, "9780306406157")
+		assert.Error(t, err)
+	})
+}
+
+func TestCancelledContext(t *testing.T) {
+	repo := memory.NewRepo()
+	b := makeBook("cancelled")
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	_, err := usecase.AddBook(cancelled, repo, b)
+	assert.Equal(t, context.Canceled, err)
+	_, err = usecase.GetBook(ctx, repo, b.ID)
+	assert.Error(t, err)
+
+	repo.AddBook(ctx, b)
+	_, err = usecase.GetBook(cancelled, repo, b.ID)
+	assert.Equal(t, context.Canceled, err)
 }
 
 func TestGetBook(t *testing.T) {
-	repo := fake.NewBookRepo()
+	repo := memory.NewRepo()
 	bIn := makeBook("get book")
 
 	t.Run("expect error if book not found", func(t *testing.T) {
-		_, err := usecase.GetBook(repo, bIn.ID)
+		_, err := usecase.GetBook(ctx, repo, bIn.ID)
 		assert.Error(t, err)
 	})
 
 	t.Run("get a book that exists", func(t *testing.T) {
-		repo.AddBook(bIn)
-		bOut, err := usecase.GetBook(repo, bIn.ID)
+		repo.AddBook(ctx, bIn)
+		bOut, err := usecase.GetBook(ctx, repo, bIn.ID)
 		assert.NoError(t, err)
 		assert.Equal(t, bIn, bOut)
 	})
 }
 
 func TestRemoveBook(t *testing.T) {
-	repo := fake.NewBookRepo()
+	repo := memory.NewRepo()
 	b := makeBook("remove book")
 
 	// this is not a great test as the error is currently coming from the repo
 	// will have to be sure to test this on the real repo itself
 	t.Run("expect error if book not found", func(t *testing.T) {
-		err := usecase.RemoveBook(repo, b.ID)
+		err := usecase.RemoveBook(ctx, repo, b.ID, 0)
 		assert.Error(t, err)
 	})
 
 	t.Run("remove an existing book", func(t *testing.T) {
-		repo.AddBook(b)
-		err := usecase.RemoveBook(repo, b.ID)
+		repo.AddBook(ctx, b)
+		err := usecase.RemoveBook(ctx, repo, b.ID, 0)
 		assert.NoError(t, err)
-		_, err = repo.GetBookByID(b.ID)
+		_, err = repo.GetBookByID(ctx, b.ID)
 		assert.Error(t, err)
 	})
 }
 
 func TestListBooks(t *testing.T) {
-	repo := fake.NewBookRepo()
+	repo := memory.NewRepo()
 	a, b := makeBook("A"), makeBook("B")
-	repo.AddBook(a)
-	repo.AddBook(b)
-	books, err := usecase.ListBooks(repo)
+	repo.AddBook(ctx, a)
+	repo.AddBook(ctx, b)
+	page, err := usecase.ListBooks(ctx, repo, usecase.BookQuery{})
+	books := page.Books
 
 	// error should only happen on a db connection or query error
 	// we are using a fake repo so it won't happen but check it anyway?
@@ -78,52 +154,325 @@ func TestListBooks(t *testing.T) {
 	}
 }
 
+func TestListBooksQuery(t *testing.T) {
+	repo := memory.NewRepo()
+	date := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	a := book.NewBook("Alpha", "ann", "acme", date("2001-01-01"), book.RateOne, book.StatusCheckedIn)
+	b := book.NewBook("Beta", "bob", "acme", date("2002-01-01"), book.RateTwo, book.StatusCheckedOut)
+	c := book.NewBook("Gamma", "ann", "acme", date("2003-01-01"), book.RateThree, book.StatusCheckedIn)
+	d := book.NewBook("Delta", "ann", "acme", date("2004-01-01"), book.RateThree, book.StatusCheckedOut)
+	for _, bk := range []book.Book{a, b, c, d} {
+		repo.AddBook(ctx, bk)
+	}
+	titles := func(page usecase.BookPage) []string {
+		list := make([]string, len(page.Books))
+		for i, bk := range page.Books {
+			list[i] = bk.Title
+		}
+		return list
+	}
+
+	tt := []struct {
+		name  string
+		query usecase.BookQuery
+		want  []string
+	}{
+		{"default order is title", usecase.BookQuery{}, []string{"Alpha", "Beta", "Delta", "Gamma"}},
+		{"author", usecase.BookQuery{Filter: usecase.BookFilter{Author: "ANN"}}, []string{"Alpha", "Delta", "Gamma"}},
+		{"status", usecase.BookQuery{Filter: usecase.BookFilter{Status: book.StatusCheckedOut}}, []string{"Beta", "Delta"}},
+		{"rating", usecase.BookQuery{Filter: usecase.BookFilter{Rating: book.RateThree}}, []string{"Delta", "Gamma"}},
+		{"title contains", usecase.BookQuery{Filter: usecase.BookFilter{TitleContains: "ta"}}, []string{"Beta", "Delta"}},
+		{"pubdate range", usecase.BookQuery{Filter: usecase.BookFilter{
+			PubDateFrom: date("2002-01-01"),
+			PubDateTo:   date("2003-01-01"),
+		}}, []string{"Beta", "Gamma"}},
+		{"sort desc", usecase.BookQuery{Sort: []usecase.Sort{{Field: usecase.SortByPubDate, Desc: true}}}, []string{"Delta", "Gamma", "Beta", "Alpha"}},
+		{"multiple sorts", usecase.BookQuery{Sort: []usecase.Sort{
+			{Field: usecase.SortByRating, Desc: true},
+			{Field: usecase.SortByTitle},
+		}}, []string{"Delta", "Gamma", "Beta", "Alpha"}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := usecase.ListBooks(ctx, repo, tc.query)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, titles(page))
+			assert.Empty(t, page.Next)
+		})
+	}
+
+	t.Run("paginate with cursor", func(t *testing.T) {
+		q := usecase.BookQuery{
+			Sort: []usecase.Sort{
+				{Field: usecase.SortByRating, Desc: true},
+				{Field: usecase.SortByTitle},
+			},
+			Limit: 3,
+		}
+		page, err := usecase.ListBooks(ctx, repo, q)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Delta", "Gamma", "Beta"}, titles(page))
+		assert.NotEmpty(t, page.Next)
+
+		q.After = page.Next
+		page, err = usecase.ListBooks(ctx, repo, q)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Alpha"}, titles(page))
+		assert.Empty(t, page.Next)
+	})
+
+	t.Run("invalid queries", func(t *testing.T) {
+		_, err := usecase.ListBooks(ctx, repo, usecase.BookQuery{Limit: -1})
+		assert.Equal(t, usecase.ErrLimitInvalid, err)
+		_, err = usecase.ListBooks(ctx, repo, usecase.BookQuery{Sort: []usecase.Sort{{Field: "color"}}})
+		assert.Equal(t, usecase.ErrSortFieldInvalid, err)
+		_, err = usecase.ListBooks(ctx, repo, usecase.BookQuery{After: "not a cursor"})
+		assert.Equal(t, usecase.ErrCursorInvalid, err)
+	})
+}
+
+func TestSearchBooks(t *testing.T) {
+	repo := memory.NewRepo()
+	a := book.NewBook("Refactoring", "Martin Fowler", "Addison-Wesley", time.Now(), book.RateThree, book.StatusCheckedIn)
+	b := book.NewBook("Patterns of Enterprise Application Architecture", "Martin Fowler", "Addison-Wesley", time.Now(), book.RateTwo, book.StatusCheckedIn)
+	repo.AddBook(ctx, a)
+	repo.AddBook(ctx, b)
+
+	t.Run("query is required", func(t *testing.T) {
+		_, err := usecase.SearchBooks(ctx, repo, "", 10)
+		assert.Equal(t, usecase.ErrSearchQueryRequired, err)
+	})
+
+	t.Run("every term must match", func(t *testing.T) {
+		results, err := usecase.SearchBooks(ctx, repo, "fowler patterns", 10)
+		assert.NoError(t, err)
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, b.ID, results[0].Book.ID)
+			assert.Contains(t, results[0].Highlights["title"], "<b>Patterns</b>")
+		}
+	})
+
+	t.Run("highlights are html escaped", func(t *testing.T) {
+		h, ok := usecase.Highlight("a <script>" + usecase.MatchStart + "x&y" + usecase.MatchStop)
+		assert.True(t, ok)
+		assert.Equal(t, "a &lt;script&gt;<b>x&amp;y</b>", h)
+
+		_, ok = usecase.Highlight("<b>no match</b>")
+		assert.False(t, ok)
+	})
+
+	t.Run("limit results", func(t *testing.T) {
+		results, err := usecase.SearchBooks(ctx, repo, "fowler", 1)
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+	})
+}
+
+func TestUpdateBook(t *testing.T) {
+	repo := memory.NewRepo()
+	a := makeBook("update book")
+
+	t.Run("expect error when book does not exist", func(t *testing.T) {
+		_, err := usecase.UpdateBook(ctx, repo, a, actor)
+		assert.Error(t, err)
+	})
+
+	repo.AddBook(ctx, a)
+
+	t.Run("expect error on invalid book", func(t *testing.T) {
+		b := a
+		b.Author = ""
+		_, err := usecase.UpdateBook(ctx, repo, b, actor)
+		assert.Error(t, err)
+		stored, _ := repo.GetBookByID(ctx, a.ID)
+		assert.Equal(t, a, stored)
+	})
+
+	t.Run("expect error when changing the status", func(t *testing.T) {
+		b := a
+		b.Status = book.StatusCheckedOut
+		_, err := usecase.UpdateBook(ctx, repo, b, actor)
+		assert.Equal(t, usecase.ErrStatusIsNotEditable, err)
+		stored, _ := repo.GetBookByID(ctx, a.ID)
+		assert.Equal(t, a, stored)
+	})
+
+	t.Run("should replace every other field", func(t *testing.T) {
+		b := book.NewBook("updated", "jane doe", "other publishing", time.Now(), book.RateThree, book.StatusCheckedIn)
+		b.ID = a.ID
+		updated, err := usecase.UpdateBook(ctx, repo, b, actor)
+		assert.NoError(t, err)
+		stored, _ := repo.GetBookByID(ctx, a.ID)
+		assert.Equal(t, updated, stored)
+		assert.Greater(t, stored.Version, a.Version)
+		b.Version = stored.Version
+		assert.Equal(t, b, stored)
+	})
+}
+
+func TestBookVersion(t *testing.T) {
+	repo := memory.NewRepo()
+	b, err := usecase.AddBook(ctx, repo, makeBook("versioned"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, b.Version)
+
+	t.Run("update at the stored version", func(t *testing.T) {
+		b.Title = "versioned twice"
+		updated, err := usecase.UpdateBook(ctx, repo, b, actor)
+		assert.NoError(t, err)
+		assert.Greater(t, updated.Version, b.Version)
+		b = updated
+	})
+
+	t.Run("update at an old version", func(t *testing.T) {
+		old := b
+		old.Version--
+		old.Title = "lost update"
+		_, err := usecase.UpdateBook(ctx, repo, old, actor)
+		assert.Equal(t, usecase.ErrVersionConflict, err)
+		stored, _ := repo.GetBookByID(ctx, b.ID)
+		assert.Equal(t, b, stored)
+	})
+
+	t.Run("changes to ratings and copies count", func(t *testing.T) {
+		rated, err := usecase.ChangeBookRating(ctx, repo, b.ID, 0, book.RateThree, actor)
+		assert.NoError(t, err)
+		assert.Greater(t, rated.Version, b.Version)
+
+		_, err = usecase.AddCopy(ctx, repo, book.NewCopy(b.ID, "versioned-2", book.ConditionGood), time.Hour, actor)
+		assert.NoError(t, err)
+		stored, _ := repo.GetBookByID(ctx, b.ID)
+		assert.Greater(t, stored.Version, rated.Version)
+		b = stored
+	})
+
+	t.Run("remove at an old version", func(t *testing.T) {
+		err := usecase.RemoveBook(ctx, repo, b.ID, b.Version-1)
+		assert.Equal(t, usecase.ErrVersionConflict, err)
+		err = usecase.RemoveBook(ctx, repo, b.ID, b.Version)
+		assert.NoError(t, err)
+	})
+}
+
 func TestUpdateBookStatus(t *testing.T) {
-	repo := fake.NewBookRepo()
+	repo := memory.NewRepo()
 	a := makeBook("update status")
 
 	t.Run("expect error when book does not exist", func(t *testing.T) {
-		_, err := usecase.ChangeBookStatus(repo, a.ID, book.StatusCheckedOut)
+		_, err := usecase.ChangeBookStatus(ctx, repo, a.ID, book.StatusCheckedOut, actor)
 		assert.Error(t, err)
 	})
 
-	repo.AddBook(a)
+	repo.AddBook(ctx, a)
 
 	t.Run("expect error on invalid status", func(t *testing.T) {
-		_, err := usecase.ChangeBookStatus(repo, a.ID, "invalid-status")
+		_, err := usecase.ChangeBookStatus(ctx, repo, a.ID, "invalid-status", actor)
 		assert.Error(t, err)
 	})
 
 	t.Run("should update the status", func(t *testing.T) {
-		b, err := usecase.ChangeBookStatus(repo, a.ID, book.StatusCheckedOut)
+		b, err := usecase.ChangeBookStatus(ctx, repo, a.ID, book.StatusCheckedOut, actor)
 		assert.NoError(t, err)
 		assert.Equal(t, book.StatusCheckedOut, b.Status)
 	})
 }
 
 func TestUpdateBookRating(t *testing.T) {
-	repo := fake.NewBookRepo()
+	repo := memory.NewRepo()
 	a := makeBook("update rating")
 
 	t.Run("expect error when book does not exist", func(t *testing.T) {
-		_, err := usecase.ChangeBookRating(repo, a.ID, book.RateTwo)
+		_, err := usecase.ChangeBookRating(ctx, repo, a.ID, 0, book.RateTwo, actor)
 		assert.Error(t, err)
 	})
 
-	repo.AddBook(a)
+	repo.AddBook(ctx, a)
 
 	t.Run("expect error on invalid rating", func(t *testing.T) {
-		_, err := usecase.ChangeBookRating(repo, a.ID, 42)
+		_, err := usecase.ChangeBookRating(ctx, repo, a.ID, 0, 42, actor)
 		assert.Error(t, err)
 	})
 
 	t.Run("should update the rating", func(t *testing.T) {
-		b, err := usecase.ChangeBookRating(repo, a.ID, book.RateTwo)
+		b, err := usecase.ChangeBookRating(ctx, repo, a.ID, 0, book.RateTwo, actor)
 		assert.NoError(t, err)
 		assert.Equal(t, book.RateTwo, b.Rating)
 	})
+
+	t.Run("expect version conflict when the book changed since it was read", func(t *testing.T) {
+		stored, _ := repo.GetBookByID(ctx, a.ID)
+		_, err := usecase.ChangeBookRating(ctx, repo, a.ID, stored.Version-1, book.RateThree, actor)
+		assert.Equal(t, usecase.ErrVersionConflict, err)
+
+		b, err := usecase.ChangeBookRating(ctx, repo, a.ID, stored.Version, book.RateThree, actor)
+		assert.NoError(t, err)
+		assert.Equal(t, book.RateThree, b.Rating)
+	})
+}
+
+func TestBookHistory(t *testing.T) {
+	repo := memory.NewRepo()
+	a := makeBook("book history")
+
+	t.Run("expect error when book does not exist", func(t *testing.T) {
+		_, err := usecase.BookHistory(ctx, repo, a.ID)
+		assert.Error(t, err)
+	})
+
+	repo.AddBook(ctx, a)
+
+	t.Run("new book has its initial values", func(t *testing.T) {
+		history, err := usecase.BookHistory(ctx, repo, a.ID)
+		assert.NoError(t, err)
+		assert.Len(t, history, 2)
+	})
+
+	t.Run("changes are appended", func(t *testing.T) {
+		_, err := usecase.ChangeBookStatus(ctx, repo, a.ID, book.StatusCheckedOut, actor)
+		assert.NoError(t, err)
+		_, err = usecase.ChangeBookRating(ctx, repo, a.ID, 0, book.RateThree, "critic")
+		assert.NoError(t, err)
+
+		history, err := usecase.BookHistory(ctx, repo, a.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, history, 4) {
+			status, rating := history[2], history[3]
+			assert.Equal(t, book.FieldStatus, status.Field)
+			assert.Equal(t, book.StatusCheckedIn.String(), status.OldValue)
+			assert.Equal(t, book.StatusCheckedOut.String(), status.NewValue)
+			assert.Equal(t, actor, status.Actor)
+			assert.False(t, status.ChangedAt.IsZero())
+
+			assert.Equal(t, book.FieldRating, rating.Field)
+			assert.Equal(t, book.RateOne.String(), rating.OldValue)
+			assert.Equal(t, book.RateThree.String(), rating.NewValue)
+			assert.Equal(t, "critic", rating.Actor)
+		}
+
+		// the current values come from the latest history entries
+		b, _ := usecase.GetBook(ctx, repo, a.ID)
+		assert.Equal(t, book.StatusCheckedOut, b.Status)
+		assert.Equal(t, book.RateThree, b.Rating)
+	})
+
+	t.Run("no entry when the value does not change", func(t *testing.T) {
+		_, err := usecase.ChangeBookStatus(ctx, repo, a.ID, book.StatusCheckedOut, actor)
+		assert.NoError(t, err)
+		history, _ := usecase.BookHistory(ctx, repo, a.ID)
+		assert.Len(t, history, 4)
+	})
+
+	t.Run("invalid values are not recorded", func(t *testing.T) {
+		_, err := usecase.ChangeBookRating(ctx, repo, a.ID, 0, 42, actor)
+		assert.Error(t, err)
+		history, _ := usecase.BookHistory(ctx, repo, a.ID)
+		assert.Len(t, history, 4)
+	})
 }
 
 func makeBook(title string) book.Book {
-	return book.NewBook(title, "john smith", time.Now(), book.RateOne, book.StatusCheckedIn)
+	return book.NewBook(title, "john smith", "acme publishing", time.Now(), book.RateOne, book.StatusCheckedIn)
 }
@@ -0,0 +1,148 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/tempcke/books/entity/book"
+)
+
+// Copy Errors
+var (
+	ErrCopyNotFound   = errors.New("Copy not found")
+	ErrBarcodeExists  = errors.New("Barcode is already in use")
+	ErrCopyIsInUse    = errors.New("Copy is checked out or on hold")
+	ErrLastCopy       = errors.New("A book must have a copy, remove the book instead")
+	ErrCopyIsRequired = errors.New("More than one copy is checked out, which copy is required")
+)
+
+// CopyReader is used to fetch the physical copies of books
+type CopyReader interface {
+	GetCopyByID(ctx context.Context, id string) (book.Copy, error)
+	GetCopyByBarcode(ctx context.Context, barcode string) (book.Copy, error)
+	// BookCopies lists the copies of a book ordered by barcode
+	BookCopies(ctx context.Context, bookID string) ([]book.Copy, error)
+	// BookAvailability counts the copies of each of the books
+	BookAvailability(ctx context.Context, bookIDs ...string) (map[string]book.Availability, error)
+}
+
+// CopyWriter is used to store the physical copies of books
+// the first copy of a book is stored along with it by BookWriter.AddBook
+type CopyWriter interface {
+	AddCopy(ctx context.Context, c book.Copy) error
+	UpdateCopy(ctx context.Context, c book.Copy) error
+	RemoveCopy(ctx context.Context, id string) error
+}
+
+// CopyReaderWriter is used to manage the physical copies of books
+type CopyReaderWriter interface {
+	CopyReader
+	CopyWriter
+}
+
+// AddCopy adds a copy of a book, when patrons are waiting for the book
+// the new copy is held for the first one in the queue
+func AddCopy(ctx context.Context, r LibraryRepo, c book.Copy, pickupWindow time.Duration, actor string) (book.Copy, error) {
+	if err := c.Validate(); err != nil {
+		return c, err
+	}
+
+	err := r.Atomic(ctx, func(r LibraryRepo) (err error) {
+		c, err = addCopy(ctx, r, c, pickupWindow, actor)
+		return err
+	})
+	return c, err
+}
+
+// addCopy is AddCopy within a unit of work
+func addCopy(ctx context.Context, r LibraryRepo, c book.Copy, pickupWindow time.Duration, actor string) (book.Copy, error) {
+	if _, err := r.GetBookByID(ctx, c.BookID); err != nil {
+		return c, err
+	}
+	if _, err := r.GetCopyByBarcode(ctx, c.Barcode); err == nil {
+		return c, ErrBarcodeExists
+	}
+
+	if err := r.AddCopy(ctx, c); err != nil {
+		return c, err
+	}
+
+	h, err := holdForNext(ctx, r, c, time.Now(), pickupWindow, actor)
+	if h.CopyID == c.ID {
+		c.Status = book.StatusOnHold
+	}
+	return c, err
+}
+
+// GetCopy gets a copy of a book by its id
+func GetCopy(ctx context.Context, r CopyReader, bookID, id string) (book.Copy, error) {
+	c, err := r.GetCopyByID(ctx, id)
+	if err != nil || c.BookID != bookID {
+		return c, ErrCopyNotFound
+	}
+	return c, nil
+}
+
+// BookCopies lists the copies of a book
+func BookCopies(ctx context.Context, r LibraryRepo, bookID string) ([]book.Copy, error) {
+	if _, err := r.GetBookByID(ctx, bookID); err != nil {
+		return nil, err
+	}
+	return r.BookCopies(ctx, bookID)
+}
+
+// BookAvailability counts the copies of each of the books
+func BookAvailability(ctx context.Context, r CopyReader, bookIDs ...string) (map[string]book.Availability, error) {
+	return r.BookAvailability(ctx, bookIDs...)
+}
+
+// RemoveCopy removes a checked in copy of a book, the last copy of a book
+// can not be removed
+func RemoveCopy(ctx context.Context, r LibraryRepo, bookID, id string, actor string) error {
+	return r.Atomic(ctx, func(r LibraryRepo) error {
+		return removeCopy(ctx, r, bookID, id, actor)
+	})
+}
+
+// removeCopy is RemoveCopy within a unit of work
+func removeCopy(ctx context.Context, r LibraryRepo, bookID, id string, actor string) error {
+	if _, err := GetCopy(ctx, r, bookID, id); err != nil {
+		return err
+	}
+
+	// the copy is read again once its book is locked
+	if _, err := r.GetBookByID(ctx, bookID); err != nil {
+		return err
+	}
+	c, err := GetCopy(ctx, r, bookID, id)
+	if err != nil {
+		return err
+	}
+	if !c.IsAvailable() {
+		return ErrCopyIsInUse
+	}
+
+	copies, err := r.BookCopies(ctx, bookID)
+	if err != nil {
+		return err
+	}
+	if len(copies) == 1 {
+		return ErrLastCopy
+	}
+
+	if err := r.RemoveCopy(ctx, id); err != nil {
+		return err
+	}
+	return refreshBookStatus(ctx, r, bookID, actor)
+}
+
+// refreshBookStatus records the status of a book summarised from its copies
+func refreshBookStatus(ctx context.Context, r LibraryRepo, bookID, actor string) error {
+	copies, err := r.BookCopies(ctx, bookID)
+	if err != nil || len(copies) == 0 {
+		return err
+	}
+	_, err = ChangeBookStatus(ctx, r, bookID, book.StatusOf(copies), actor)
+	return err
+}
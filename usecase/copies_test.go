@@ -0,0 +1,184 @@
+package usecase_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/entity/hold"
+	"github.com/tempcke/books/entity/patron"
+	"github.com/tempcke/books/repository/memory"
+	"github.com/tempcke/books/usecase"
+)
+
+func TestAddCopy(t *testing.T) {
+	repo := memory.NewRepo()
+	b := makeBook("add copy")
+	c := book.NewCopy(b.ID, "31234000000001", book.ConditionNew)
+
+	t.Run("expect error when book does not exist", func(t *testing.T) {
+		_, err := usecase.AddCopy(ctx, repo, c, pickupWindow, actor)
+		assert.Error(t, err)
+	})
+
+	repo.AddBook(ctx, b)
+
+	t.Run("expect error when invalid", func(t *testing.T) {
+		_, err := usecase.AddCopy(ctx, repo, book.NewCopy(b.ID, "", book.ConditionNew), pickupWindow, actor)
+		assert.ErrorIs(t, err, book.ErrBarcodeIsRequired)
+	})
+
+	t.Run("every book has a first copy", func(t *testing.T) {
+		copies, err := usecase.BookCopies(ctx, repo, b.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, []book.Copy{book.FirstCopy(b)}, copies)
+	})
+
+	t.Run("should add a copy", func(t *testing.T) {
+		added, err := usecase.AddCopy(ctx, repo, c, pickupWindow, actor)
+		assert.NoError(t, err)
+		assert.Equal(t, c, added)
+
+		copies, _ := usecase.BookCopies(ctx, repo, b.ID)
+		assert.Len(t, copies, 2)
+
+		counts, _ := usecase.BookAvailability(ctx, repo, b.ID)
+		assert.Equal(t, book.Availability{Total: 2, Available: 2}, counts[b.ID])
+	})
+
+	t.Run("expect error when barcode is in use", func(t *testing.T) {
+		_, err := usecase.AddCopy(ctx, repo, book.NewCopy(b.ID, c.Barcode, book.ConditionNew), pickupWindow, actor)
+		assert.Equal(t, usecase.ErrBarcodeExists, err)
+	})
+}
+
+func TestAddCopyForWaitingPatron(t *testing.T) {
+	repo := memory.NewRepo()
+	b := makeBook("add copy on hold")
+	jane := patron.NewPatron("Jane Doe", "jane@example.com")
+	john := patron.NewPatron("John Doe", "john@example.com")
+	repo.AddBook(ctx, b)
+	repo.AddPatron(ctx, jane)
+	repo.AddPatron(ctx, john)
+
+	usecase.CheckOut(ctx, repo, b.ID, jane.ID, time.Now(), time.Now().AddDate(0, 0, 14), actor)
+	h, _ := usecase.PlaceHold(ctx, repo, b.ID, john.ID)
+
+	c, err := usecase.AddCopy(ctx, repo, book.NewCopy(b.ID, "31234000000002", book.ConditionNew), pickupWindow, actor)
+	assert.NoError(t, err)
+	assert.Equal(t, book.StatusOnHold, c.Status)
+	assertStatus(t, repo, b.ID, book.StatusOnHold)
+
+	h, _ = usecase.GetHold(ctx, repo, h.ID)
+	assert.Equal(t, hold.StatusReady, h.Status)
+	assert.Equal(t, c.ID, h.CopyID)
+}
+
+func TestRemoveCopy(t *testing.T) {
+	repo := memory.NewRepo()
+	b := makeBook("remove copy")
+	p := patron.NewPatron("Jane Doe", "jane@example.com")
+	repo.AddBook(ctx, b)
+	repo.AddPatron(ctx, p)
+	first := book.FirstCopy(b)
+
+	t.Run("expect error when copy does not exist", func(t *testing.T) {
+		err := usecase.RemoveCopy(ctx, repo, b.ID, "nope", actor)
+		assert.Equal(t, usecase.ErrCopyNotFound, err)
+	})
+
+	t.Run("expect error when copy is of another book", func(t *testing.T) {
+		other := makeBook("another book")
+		repo.AddBook(ctx, other)
+		err := usecase.RemoveCopy(ctx, repo, b.ID, other.ID, actor)
+		assert.Equal(t, usecase.ErrCopyNotFound, err)
+	})
+
+	t.Run("expect error when removing the last copy", func(t *testing.T) {
+		err := usecase.RemoveCopy(ctx, repo, b.ID, first.ID, actor)
+		assert.Equal(t, usecase.ErrLastCopy, err)
+	})
+
+	c, _ := usecase.AddCopy(ctx, repo, book.NewCopy(b.ID, "31234000000003", book.ConditionPoor), pickupWindow, actor)
+	l, _ := usecase.CheckOut(ctx, repo, b.ID, p.ID, time.Now(), time.Now().AddDate(0, 0, 14), actor)
+	out, available := l.CopyID, c.ID
+	if out == c.ID {
+		available = first.ID
+	}
+
+	t.Run("expect error when copy is checked out", func(t *testing.T) {
+		err := usecase.RemoveCopy(ctx, repo, b.ID, out, actor)
+		assert.Equal(t, usecase.ErrCopyIsInUse, err)
+	})
+
+	t.Run("removing the last available copy changes the book status", func(t *testing.T) {
+		assertStatus(t, repo, b.ID, book.StatusCheckedIn)
+		err := usecase.RemoveCopy(ctx, repo, b.ID, available, actor)
+		assert.NoError(t, err)
+		assertStatus(t, repo, b.ID, book.StatusCheckedOut)
+
+		copies, _ := usecase.BookCopies(ctx, repo, b.ID)
+		assert.Len(t, copies, 1)
+	})
+}
+
+func TestCheckOutCopies(t *testing.T) {
+	repo := memory.NewRepo()
+	b := makeBook("several copies")
+	jane := patron.NewPatron("Jane Doe", "jane@example.com")
+	john := patron.NewPatron("John Doe", "john@example.com")
+	repo.AddBook(ctx, b)
+	repo.AddPatron(ctx, jane)
+	repo.AddPatron(ctx, john)
+	second, _ := usecase.AddCopy(ctx, repo, book.NewCopy(b.ID, "31234000000004", book.ConditionGood), pickupWindow, actor)
+	due := time.Now().AddDate(0, 0, 14)
+
+	var janeCopy, johnCopy string
+
+	t.Run("book is checked in while a copy is available", func(t *testing.T) {
+		l, err := usecase.CheckOut(ctx, repo, b.ID, jane.ID, time.Now(), due, actor)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, l.CopyID)
+		janeCopy = l.CopyID
+		assertStatus(t, repo, b.ID, book.StatusCheckedIn)
+
+		counts, _ := usecase.BookAvailability(ctx, repo, b.ID)
+		assert.Equal(t, "1 of 2 available", counts[b.ID].String())
+	})
+
+	t.Run("book is checked out once every copy is", func(t *testing.T) {
+		l, err := usecase.CheckOut(ctx, repo, b.ID, john.ID, time.Now(), due, actor)
+		assert.NoError(t, err)
+		johnCopy = l.CopyID
+		assertStatus(t, repo, b.ID, book.StatusCheckedOut)
+
+		_, err = usecase.CheckOut(ctx, repo, b.ID, john.ID, time.Now(), due, actor)
+		assert.Equal(t, usecase.ErrBookIsCheckedOut, err)
+	})
+
+	assert.ElementsMatch(t, []string{b.ID, second.ID}, []string{janeCopy, johnCopy})
+
+	t.Run("expect error when the copy to check in is ambiguous", func(t *testing.T) {
+		_, err := usecase.CheckIn(ctx, repo, b.ID, "", time.Now(), pickupWindow, actor)
+		assert.Equal(t, usecase.ErrCopyIsRequired, err)
+	})
+
+	t.Run("check in a copy closes its loan", func(t *testing.T) {
+		l, err := usecase.CheckIn(ctx, repo, b.ID, johnCopy, time.Now(), pickupWindow, actor)
+		assert.NoError(t, err)
+		assert.Equal(t, john.ID, l.PatronID)
+		assert.True(t, l.IsReturned())
+		assertStatus(t, repo, b.ID, book.StatusCheckedIn)
+
+		_, err = usecase.CheckIn(ctx, repo, b.ID, johnCopy, time.Now(), pickupWindow, actor)
+		assert.Equal(t, usecase.ErrBookIsNotCheckedOut, err)
+	})
+
+	t.Run("the only checked out copy needs no id", func(t *testing.T) {
+		l, err := usecase.CheckIn(ctx, repo, b.ID, "", time.Now(), pickupWindow, actor)
+		assert.NoError(t, err)
+		assert.Equal(t, jane.ID, l.PatronID)
+		assert.Equal(t, janeCopy, l.CopyID)
+	})
+}
@@ -0,0 +1,26 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/tempcke/books/entity/book"
+)
+
+// BookExporter is used to read every book matching a query
+// ExportBooks calls fn with each book in the order of the query as they are
+// read from storage, rather than loading them all first, it stops at the first
+// error returned by fn and returns it.  The limit and cursor of the query are
+// ignored
+type BookExporter interface {
+	ExportBooks(ctx context.Context, q BookQuery, fn func(book.Book) error) error
+}
+
+// ExportBooks calls fn with every book in storage which matches the filter
+// and sort of the query, in order
+func ExportBooks(ctx context.Context, r BookExporter, q BookQuery, fn func(book.Book) error) error {
+	q.Limit, q.After = 0, ""
+	if err := q.Validate(); err != nil {
+		return err
+	}
+	return r.ExportBooks(ctx, q, fn)
+}
@@ -0,0 +1,53 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/tempcke/books/entity/book"
+)
+
+// BookHistory lists every status and rating change of a book, oldest first
+func BookHistory(ctx context.Context, r BookReader, id string) ([]book.Change, error) {
+	if _, err := r.GetBookByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return r.BookHistory(ctx, id)
+}
+
+// recordChanges appends the status and rating changes to the book history
+func recordChanges(ctx context.Context, r BookWriter, before, after book.Book, actor string) error {
+	for _, c := range changes(before, after, actor) {
+		if err := r.RecordChange(ctx, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changes lists the history entries needed to go from book before to after
+func changes(before, after book.Book, actor string) []book.Change {
+	var list []book.Change
+	now := time.Now()
+	if before.Status != after.Status {
+		list = append(list, book.Change{
+			BookID:    after.ID,
+			Field:     book.FieldStatus,
+			OldValue:  before.Status.String(),
+			NewValue:  after.Status.String(),
+			Actor:     actor,
+			ChangedAt: now,
+		})
+	}
+	if before.Rating != after.Rating {
+		list = append(list, book.Change{
+			BookID:    after.ID,
+			Field:     book.FieldRating,
+			OldValue:  before.Rating.String(),
+			NewValue:  after.Rating.String(),
+			Actor:     actor,
+			ChangedAt: now,
+		})
+	}
+	return list
+}
@@ -0,0 +1,237 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/entity/hold"
+)
+
+// Hold Errors
+var (
+	ErrBookIsAvailable = errors.New("Book is checked in, check it out instead")
+	ErrHoldExists      = errors.New("Patron already has a hold on this book")
+	ErrHoldIsClosed    = errors.New("Hold is no longer open")
+	ErrBookIsOnHold    = errors.New("Book is on hold for another patron")
+)
+
+// HoldReader is used to fetch information about holds
+type HoldReader interface {
+	GetHoldByID(ctx context.Context, id string) (hold.Hold, error)
+	// BookHolds lists the open holds of a book in queue order, first placed first
+	BookHolds(ctx context.Context, bookID string) ([]hold.Hold, error)
+	// ExpiredHolds lists the ready holds whose pickup window ended before asOf
+	ExpiredHolds(ctx context.Context, asOf time.Time) ([]hold.Hold, error)
+}
+
+// HoldWriter is used to record holds
+type HoldWriter interface {
+	AddHold(ctx context.Context, h hold.Hold) error
+	UpdateHold(ctx context.Context, h hold.Hold) error
+}
+
+// HoldReaderWriter is used to manage holds
+type HoldReaderWriter interface {
+	HoldReader
+	HoldWriter
+}
+
+// PlaceHold puts a patron at the end of the hold queue of a checked out book
+func PlaceHold(ctx context.Context, r LibraryRepo, bookID, patronID string) (hold.Hold, error) {
+	h := hold.NewHold(bookID, patronID, time.Now())
+	if err := h.Validate(); err != nil {
+		return h, err
+	}
+
+	return h, r.Atomic(ctx, func(r LibraryRepo) error {
+		return placeHold(ctx, r, h)
+	})
+}
+
+// placeHold is PlaceHold within a unit of work
+func placeHold(ctx context.Context, r LibraryRepo, h hold.Hold) error {
+	b, err := r.GetBookByID(ctx, h.BookID)
+	if err != nil {
+		return err
+	}
+	if b.Status == book.StatusCheckedIn {
+		return ErrBookIsAvailable
+	}
+
+	if _, err := r.GetPatronByID(ctx, h.PatronID); err != nil {
+		return err
+	}
+
+	queue, err := r.BookHolds(ctx, h.BookID)
+	if err != nil {
+		return err
+	}
+	for _, queued := range queue {
+		if queued.PatronID == h.PatronID {
+			return ErrHoldExists
+		}
+	}
+
+	return r.AddHold(ctx, h)
+}
+
+// GetHold is used to get a hold by its id
+func GetHold(ctx context.Context, r HoldReader, id string) (hold.Hold, error) {
+	return r.GetHoldByID(ctx, id)
+}
+
+// BookHolds lists the hold queue of a book, the ready hold first if any
+func BookHolds(ctx context.Context, r LibraryRepo, bookID string) ([]hold.Hold, error) {
+	if _, err := r.GetBookByID(ctx, bookID); err != nil {
+		return nil, err
+	}
+	return r.BookHolds(ctx, bookID)
+}
+
+// CancelHold removes a patron from the hold queue, when a copy was being
+// held for them it is passed on to the next patron in the queue
+func CancelHold(ctx context.Context, r LibraryRepo, id string, pickupWindow time.Duration, actor string) (hold.Hold, error) {
+	var h hold.Hold
+	err := r.Atomic(ctx, func(r LibraryRepo) (err error) {
+		h, err = cancelHold(ctx, r, id, pickupWindow, actor)
+		return err
+	})
+	return h, err
+}
+
+// cancelHold is CancelHold within a unit of work
+func cancelHold(ctx context.Context, r LibraryRepo, id string, pickupWindow time.Duration, actor string) (hold.Hold, error) {
+	h, err := lockedHold(ctx, r, id)
+	if err != nil {
+		return h, err
+	}
+	if !h.IsOpen() {
+		return h, ErrHoldIsClosed
+	}
+
+	wasReady := h.Status == hold.StatusReady
+	now := time.Now()
+	h.Status = hold.StatusCancelled
+	h.ClosedAt = now
+	if err := r.UpdateHold(ctx, h); err != nil {
+		return h, err
+	}
+
+	if wasReady {
+		err = passOnHeldCopy(ctx, r, h, now, pickupWindow, actor)
+	}
+	return h, err
+}
+
+// ExpireHolds closes the ready holds which were not picked up in time,
+// passing each held copy on to the next patron in the queue
+func ExpireHolds(ctx context.Context, r LibraryRepo, now time.Time, pickupWindow time.Duration, actor string) ([]hold.Hold, error) {
+	holds, err := r.ExpiredHolds(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	expired := make([]hold.Hold, 0, len(holds))
+	for _, h := range holds {
+		var ok bool
+		err := r.Atomic(ctx, func(r LibraryRepo) (err error) {
+			h, ok, err = expireHold(ctx, r, h.ID, now, pickupWindow, actor)
+			return err
+		})
+		if err != nil {
+			return expired, err
+		}
+		if ok {
+			expired = append(expired, h)
+		}
+	}
+	return expired, nil
+}
+
+// expireHold closes a hold unless it was picked up or closed since it was
+// listed, ok tells if it expired
+func expireHold(ctx context.Context, r LibraryRepo, id string, now time.Time, pickupWindow time.Duration, actor string) (hold.Hold, bool, error) {
+	h, err := lockedHold(ctx, r, id)
+	if err != nil || !h.IsExpired(now) {
+		return h, false, err
+	}
+
+	h.Status = hold.StatusExpired
+	h.ClosedAt = now
+	if err := r.UpdateHold(ctx, h); err != nil {
+		return h, false, err
+	}
+	return h, true, passOnHeldCopy(ctx, r, h, now, pickupWindow, actor)
+}
+
+// lockedHold reads a hold after locking its book, so the hold is current
+// and stays that way until the unit of work ends
+func lockedHold(ctx context.Context, r LibraryRepo, id string) (hold.Hold, error) {
+	h, err := r.GetHoldByID(ctx, id)
+	if err != nil {
+		return h, err
+	}
+	if _, err := r.GetBookByID(ctx, h.BookID); err != nil {
+		return h, err
+	}
+	return r.GetHoldByID(ctx, id)
+}
+
+// passOnHeldCopy offers the copy held by a closed hold to the next patron
+func passOnHeldCopy(ctx context.Context, r LibraryRepo, h hold.Hold, now time.Time, pickupWindow time.Duration, actor string) error {
+	c, err := r.GetCopyByID(ctx, h.CopyID)
+	if err != nil {
+		return err
+	}
+	_, err = holdForNext(ctx, r, c, now, pickupWindow, actor)
+	return err
+}
+
+// holdForNext holds a copy for pickup by the first patron waiting for the
+// book, the copy is checked in when nobody is waiting
+func holdForNext(ctx context.Context, r LibraryRepo, c book.Copy, now time.Time, pickupWindow time.Duration, actor string) (hold.Hold, error) {
+	var next hold.Hold
+
+	queue, err := r.BookHolds(ctx, c.BookID)
+	if err != nil {
+		return next, err
+	}
+
+	c.Status = book.StatusCheckedIn
+	for _, h := range queue {
+		if h.Status != hold.StatusWaiting {
+			continue
+		}
+		next = h
+		next.Status = hold.StatusReady
+		next.CopyID = c.ID
+		next.ReadyAt = now
+		next.ExpiresAt = now.Add(pickupWindow)
+		if err := r.UpdateHold(ctx, next); err != nil {
+			return next, err
+		}
+		c.Status = book.StatusOnHold
+		break
+	}
+
+	if err := r.UpdateCopy(ctx, c); err != nil {
+		return next, err
+	}
+	return next, refreshBookStatus(ctx, r, c.BookID, actor)
+}
+
+// patronHold finds the copy held for a patron, if any
+func patronHold(ctx context.Context, r HoldReader, bookID, patronID string) (hold.Hold, bool, error) {
+	queue, err := r.BookHolds(ctx, bookID)
+	if err != nil {
+		return hold.Hold{}, false, err
+	}
+	for _, h := range queue {
+		if h.Status == hold.StatusReady && h.PatronID == patronID {
+			return h, true, nil
+		}
+	}
+	return hold.Hold{}, false, nil
+}
@@ -0,0 +1,182 @@
+package usecase_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/entity/hold"
+	"github.com/tempcke/books/entity/patron"
+	"github.com/tempcke/books/repository/memory"
+	"github.com/tempcke/books/usecase"
+)
+
+const pickupWindow = hold.DefaultPickupWindow
+
+func TestPlaceHold(t *testing.T) {
+	repo := memory.NewRepo()
+	b := makeBook("place hold")
+	jane := patron.NewPatron("Jane Doe", "jane@example.com")
+	john := patron.NewPatron("John Doe", "john@example.com")
+	repo.AddPatron(ctx, jane)
+	repo.AddPatron(ctx, john)
+
+	t.Run("expect error when book does not exist", func(t *testing.T) {
+		_, err := usecase.PlaceHold(ctx, repo, b.ID, john.ID)
+		assert.Error(t, err)
+	})
+
+	repo.AddBook(ctx, b)
+
+	t.Run("expect error when book is checked in", func(t *testing.T) {
+		_, err := usecase.PlaceHold(ctx, repo, b.ID, john.ID)
+		assert.Equal(t, usecase.ErrBookIsAvailable, err)
+	})
+
+	usecase.CheckOut(ctx, repo, b.ID, jane.ID, time.Now(), time.Now().AddDate(0, 0, 14), actor)
+
+	t.Run("expect error when patron does not exist", func(t *testing.T) {
+		unknown := patron.NewPatron("Nobody", "nobody@example.com")
+		_, err := usecase.PlaceHold(ctx, repo, b.ID, unknown.ID)
+		assert.Error(t, err)
+	})
+
+	t.Run("should queue a hold", func(t *testing.T) {
+		h, err := usecase.PlaceHold(ctx, repo, b.ID, john.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, hold.StatusWaiting, h.Status)
+
+		holds, _ := usecase.BookHolds(ctx, repo, b.ID)
+		assert.Equal(t, []hold.Hold{h}, holds)
+	})
+
+	t.Run("expect error when patron already has a hold", func(t *testing.T) {
+		_, err := usecase.PlaceHold(ctx, repo, b.ID, john.ID)
+		assert.Equal(t, usecase.ErrHoldExists, err)
+	})
+}
+
+func TestHoldQueue(t *testing.T) {
+	repo := memory.NewRepo()
+	b := makeBook("hold queue")
+	jane := patron.NewPatron("Jane Doe", "jane@example.com")
+	john := patron.NewPatron("John Doe", "john@example.com")
+	mary := patron.NewPatron("Mary Roe", "mary@example.com")
+	repo.AddBook(ctx, b)
+	repo.AddPatron(ctx, jane)
+	repo.AddPatron(ctx, john)
+	repo.AddPatron(ctx, mary)
+
+	due := time.Now().AddDate(0, 0, 14)
+	usecase.CheckOut(ctx, repo, b.ID, jane.ID, time.Now(), due, actor)
+	first, _ := usecase.PlaceHold(ctx, repo, b.ID, john.ID)
+	second, _ := usecase.PlaceHold(ctx, repo, b.ID, mary.ID)
+
+	t.Run("check in holds the book for the first in the queue", func(t *testing.T) {
+		_, err := usecase.CheckIn(ctx, repo, b.ID, "", time.Now(), pickupWindow, actor)
+		assert.NoError(t, err)
+		assertStatus(t, repo, b.ID, book.StatusOnHold)
+
+		holds, _ := usecase.BookHolds(ctx, repo, b.ID)
+		if assert.Len(t, holds, 2) {
+			assert.Equal(t, first.ID, holds[0].ID)
+			assert.Equal(t, hold.StatusReady, holds[0].Status)
+			assert.Equal(t, pickupWindow, holds[0].ExpiresAt.Sub(holds[0].ReadyAt))
+			assert.Equal(t, hold.StatusWaiting, holds[1].Status)
+		}
+	})
+
+	t.Run("only the patron the book is held for can check it out", func(t *testing.T) {
+		_, err := usecase.CheckOut(ctx, repo, b.ID, mary.ID, time.Now(), due, actor)
+		assert.Equal(t, usecase.ErrBookIsOnHold, err)
+		assertStatus(t, repo, b.ID, book.StatusOnHold)
+	})
+
+	t.Run("cancelling a ready hold passes the book on", func(t *testing.T) {
+		h, err := usecase.CancelHold(ctx, repo, first.ID, pickupWindow, actor)
+		assert.NoError(t, err)
+		assert.Equal(t, hold.StatusCancelled, h.Status)
+		assert.False(t, h.ClosedAt.IsZero())
+
+		holds, _ := usecase.BookHolds(ctx, repo, b.ID)
+		if assert.Len(t, holds, 1) {
+			assert.Equal(t, second.ID, holds[0].ID)
+			assert.Equal(t, hold.StatusReady, holds[0].Status)
+		}
+		assertStatus(t, repo, b.ID, book.StatusOnHold)
+	})
+
+	t.Run("expect error when cancelling a closed hold", func(t *testing.T) {
+		_, err := usecase.CancelHold(ctx, repo, first.ID, pickupWindow, actor)
+		assert.Equal(t, usecase.ErrHoldIsClosed, err)
+	})
+
+	t.Run("checking out fulfills the hold", func(t *testing.T) {
+		_, err := usecase.CheckOut(ctx, repo, b.ID, mary.ID, time.Now(), due, actor)
+		assert.NoError(t, err)
+		assertStatus(t, repo, b.ID, book.StatusCheckedOut)
+
+		h, _ := usecase.GetHold(ctx, repo, second.ID)
+		assert.Equal(t, hold.StatusFulfilled, h.Status)
+		holds, _ := usecase.BookHolds(ctx, repo, b.ID)
+		assert.Len(t, holds, 0)
+	})
+
+	t.Run("check in without a queue checks the book in", func(t *testing.T) {
+		_, err := usecase.CheckIn(ctx, repo, b.ID, "", time.Now(), pickupWindow, actor)
+		assert.NoError(t, err)
+		assertStatus(t, repo, b.ID, book.StatusCheckedIn)
+	})
+}
+
+func TestExpireHolds(t *testing.T) {
+	repo := memory.NewRepo()
+	b := makeBook("expire holds")
+	jane := patron.NewPatron("Jane Doe", "jane@example.com")
+	john := patron.NewPatron("John Doe", "john@example.com")
+	mary := patron.NewPatron("Mary Roe", "mary@example.com")
+	repo.AddBook(ctx, b)
+	repo.AddPatron(ctx, jane)
+	repo.AddPatron(ctx, john)
+	repo.AddPatron(ctx, mary)
+
+	usecase.CheckOut(ctx, repo, b.ID, jane.ID, time.Now(), time.Now().AddDate(0, 0, 14), actor)
+	first, _ := usecase.PlaceHold(ctx, repo, b.ID, john.ID)
+	second, _ := usecase.PlaceHold(ctx, repo, b.ID, mary.ID)
+	usecase.CheckIn(ctx, repo, b.ID, "", time.Now(), pickupWindow, actor)
+
+	now := time.Now()
+
+	t.Run("nothing expires within the pickup window", func(t *testing.T) {
+		expired, err := usecase.ExpireHolds(ctx, repo, now, pickupWindow, actor)
+		assert.NoError(t, err)
+		assert.Len(t, expired, 0)
+	})
+
+	later := now.Add(pickupWindow + time.Minute)
+
+	t.Run("expired hold passes the book to the next patron", func(t *testing.T) {
+		expired, err := usecase.ExpireHolds(ctx, repo, later, pickupWindow, actor)
+		assert.NoError(t, err)
+		if assert.Len(t, expired, 1) {
+			assert.Equal(t, first.ID, expired[0].ID)
+			assert.Equal(t, hold.StatusExpired, expired[0].Status)
+		}
+
+		holds, _ := usecase.BookHolds(ctx, repo, b.ID)
+		if assert.Len(t, holds, 1) {
+			assert.Equal(t, second.ID, holds[0].ID)
+			assert.Equal(t, hold.StatusReady, holds[0].Status)
+			assert.Equal(t, later.Add(pickupWindow), holds[0].ExpiresAt)
+		}
+		assertStatus(t, repo, b.ID, book.StatusOnHold)
+	})
+
+	t.Run("book is checked in once the queue is empty", func(t *testing.T) {
+		expired, err := usecase.ExpireHolds(ctx, repo, later.Add(pickupWindow+time.Minute), pickupWindow, actor)
+		assert.NoError(t, err)
+		assert.Len(t, expired, 1)
+		assertStatus(t, repo, b.ID, book.StatusCheckedIn)
+	})
+}
@@ -0,0 +1,215 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+
+	"github.com/tempcke/books/entity/book"
+)
+
+// Import Errors
+var (
+	ErrISBNRepeated = errors.New("ISBN is on an earlier row of the import")
+	ErrNotImported  = errors.New("Another row failed so nothing was imported")
+)
+
+// DefaultImportBatchSize is how many rows a best effort import writes in
+// each unit of work
+const DefaultImportBatchSize = 100
+
+// ImportStatus is the outcome of importing a row
+type ImportStatus string
+
+func (s ImportStatus) String() string {
+	return string(s)
+}
+
+// ImportStatus values, a valid row was not written because the import
+// was a dry run or another row failed
+const (
+	ImportCreated   = ImportStatus("created")
+	ImportValid     = ImportStatus("valid")
+	ImportDuplicate = ImportStatus("duplicate")
+	ImportFailed    = ImportStatus("failed")
+)
+
+// ImportRow is a book read from a row of an import
+// Err is why the row could not be read as a book, it fails the row
+type ImportRow struct {
+	Row  int
+	Book book.Book
+	Err  error
+}
+
+// ImportResult is the outcome of importing a row, Err is why it failed
+// or is a duplicate
+type ImportResult struct {
+	Row    int
+	Status ImportStatus
+	BookID string
+	Err    error
+}
+
+// ImportReport has a result for every row of an import, in row order
+type ImportReport struct {
+	Results []ImportResult
+}
+
+// Count counts the rows with the given status
+func (r ImportReport) Count(status ImportStatus) int {
+	var n int
+	for _, res := range r.Results {
+		if res.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// ImportOptions are how the rows of an import are written
+// DryRun checks every row and writes nothing
+// BestEffort writes the valid rows even when others fail, in units of work
+// of BatchSize rows.  Otherwise an import is all or nothing, one failed or
+// duplicate row and nothing is written
+type ImportOptions struct {
+	DryRun     bool
+	BestEffort bool
+	BatchSize  int
+}
+
+// ImportBooks adds the books of an import, a book is a duplicate when its
+// ISBN belongs to a stored book or is on an earlier row.  The report has the
+// outcome of every row, error only when storage fails, which leaves the rows
+// of the failed unit of work unwritten
+func ImportBooks(ctx context.Context, r LibraryRepo, rows []ImportRow, opts ImportOptions) (ImportReport, error) {
+	report := ImportReport{Results: make([]ImportResult, len(rows))}
+	books := make([]book.Book, len(rows))
+	isbns := make(map[string]bool)
+
+	var valid []int
+	for i, row := range rows {
+		b, err := checkImportRow(ctx, r, row, isbns)
+		books[i] = b
+		report.Results[i] = ImportResult{Row: row.Row, Status: importStatus(err), Err: err}
+		if err == nil {
+			report.Results[i].BookID = b.ID
+			valid = append(valid, i)
+		}
+	}
+
+	if opts.DryRun || len(valid) == 0 {
+		return report, nil
+	}
+
+	if !opts.BestEffort {
+		if len(valid) < len(rows) {
+			for _, i := range valid {
+				report.Results[i].Err = ErrNotImported
+			}
+			return report, nil
+		}
+		_, err := importBatch(ctx, r, &report, books, valid, false)
+		return report, err
+	}
+
+	size := opts.BatchSize
+	if size <= 0 {
+		size = DefaultImportBatchSize
+	}
+	for pending := valid; len(pending) > 0; {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		batch := pending
+		if len(batch) > size {
+			batch = batch[:size]
+		}
+		failed, err := importBatch(ctx, r, &report, books, batch, true)
+		if err != nil {
+			return report, err
+		}
+		if failed < 0 {
+			pending = pending[len(batch):]
+			continue
+		}
+		// the rows before the failed one were rolled back with it
+		pending = append(append([]int{}, batch[:failed]...), pending[failed+1:]...)
+	}
+	return report, nil
+}
+
+// checkImportRow returns the book of a row as it would be stored, the error
+// is why the row can not be
+func checkImportRow(ctx context.Context, r BookReader, row ImportRow, isbns map[string]bool) (book.Book, error) {
+	b := row.Book
+	if row.Err != nil {
+		return b, row.Err
+	}
+	if err := b.Validate(); err != nil {
+		return b, err
+	}
+
+	b = normalizeISBN(b)
+	if b.ISBN == "" {
+		return b, nil
+	}
+	if isbns[b.ISBN] {
+		return b, ErrISBNRepeated
+	}
+	isbns[b.ISBN] = true
+	return b, checkISBNIsFree(ctx, r, b)
+}
+
+// importBatch writes the rows at the given indexes in a unit of work.  A row
+// which fails rolls back the unit of work, a failed statement may have
+// aborted the transaction, failed is its index in the batch or -1.  In best
+// effort mode a duplicate row is skipped instead, its ISBN is checked before
+// it is written, and the rows which were rolled back are left valid so they
+// can be written again
+func importBatch(ctx context.Context, r LibraryRepo, report *ImportReport, books []book.Book, batch []int, bestEffort bool) (failed int, err error) {
+	failed = -1
+	err = r.Atomic(ctx, func(r LibraryRepo) error {
+		for k, i := range batch {
+			res := &report.Results[i]
+			if _, err := AddBook(ctx, r, books[i]); err != nil {
+				res.Status, res.Err, res.BookID = importStatus(err), err, ""
+				if bestEffort && res.Status == ImportDuplicate {
+					continue
+				}
+				failed = k
+				return ErrNotImported
+			}
+			res.Status = ImportCreated
+		}
+		return nil
+	})
+	if err == nil {
+		return -1, nil
+	}
+
+	// nothing in the batch was written
+	for _, i := range batch {
+		res := &report.Results[i]
+		if res.Status == ImportCreated || res.Status == ImportValid {
+			res.Status = ImportValid
+			if err == ErrNotImported && !bestEffort {
+				res.Err = ErrNotImported
+			}
+		}
+	}
+	if err == ErrNotImported {
+		return failed, nil
+	}
+	return -1, err
+}
+
+// importStatus is the status of a row which was checked or written with err
+func importStatus(err error) ImportStatus {
+	switch err {
+	case nil:
+		return ImportValid
+	case ErrISBNExists, ErrISBNRepeated:
+		return ImportDuplicate
+	}
+	return ImportFailed
+}
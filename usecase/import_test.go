@@ -0,0 +1,143 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/repository/memory"
+	"github.com/tempcke/books/usecase"
+)
+
+func TestImportBooks(t *testing.T) {
+	// rows 1 and 4 are valid, 2 is invalid, 3 could not be read and 5
+	// repeats the isbn of row 1
+	importRows := func() []usecase.ImportRow {
+		a, b, c, d := makeBook("import A"), makeBook(""), makeBook("import C"), makeBook("import D")
+		a.ISBN = "0-201-48567-2"
+		e := makeBook("import E")
+		e.ISBN = "9780201485677"
+		return []usecase.ImportRow{
+			{Row: 1, Book: a},
+			{Row: 2, Book: b},
+			{Row: 3, Book: c, Err: errors.New("rating must be a number")},
+			{Row: 4, Book: d},
+			{Row: 5, Book: e},
+		}
+	}
+	statuses := func(report usecase.ImportReport) []usecase.ImportStatus {
+		var list []usecase.ImportStatus
+		for _, res := range report.Results {
+			list = append(list, res.Status)
+		}
+		return list
+	}
+	listed := func(repo memory.Repo) int {
+		page, _ := usecase.ListBooks(ctx, repo, usecase.BookQuery{})
+		return len(page.Books)
+	}
+
+	t.Run("dry run writes nothing", func(t *testing.T) {
+		repo := memory.NewRepo()
+		report, err := usecase.ImportBooks(ctx, repo, importRows(), usecase.ImportOptions{DryRun: true, BestEffort: true})
+		assert.NoError(t, err)
+		assert.Equal(t, []usecase.ImportStatus{
+			usecase.ImportValid, usecase.ImportFailed, usecase.ImportFailed,
+			usecase.ImportValid, usecase.ImportDuplicate,
+		}, statuses(report))
+		assert.ErrorIs(t, report.Results[1].Err, book.ErrTitleIsRequired)
+		assert.Equal(t, usecase.ErrISBNRepeated, report.Results[4].Err)
+		assert.Equal(t, 0, listed(repo))
+	})
+
+	t.Run("all or nothing", func(t *testing.T) {
+		repo := memory.NewRepo()
+		report, err := usecase.ImportBooks(ctx, repo, importRows(), usecase.ImportOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, report.Count(usecase.ImportCreated))
+		assert.Equal(t, 2, report.Count(usecase.ImportValid))
+		assert.Equal(t, usecase.ErrNotImported, report.Results[0].Err)
+		assert.Equal(t, 0, listed(repo))
+
+		rows := importRows()
+		report, err = usecase.ImportBooks(ctx, repo, []usecase.ImportRow{rows[0], rows[3]}, usecase.ImportOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, report.Count(usecase.ImportCreated))
+		assert.Equal(t, 2, listed(repo))
+
+		stored, err := usecase.GetBook(ctx, repo, report.Results[0].BookID)
+		assert.NoError(t, err)
+		assert.Equal(t, "9780201485677", stored.ISBN)
+	})
+
+	t.Run("best effort in batches", func(t *testing.T) {
+		repo := memory.NewRepo()
+		existing := makeBook("existing")
+		existing.ISBN = "9780306406157"
+		repo.AddBook(ctx, existing)
+
+		rows := importRows()
+		rows[3].Book.ISBN = existing.ISBN
+		report, err := usecase.ImportBooks(ctx, repo, rows, usecase.ImportOptions{BestEffort: true, BatchSize: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, []usecase.ImportStatus{
+			usecase.ImportCreated, usecase.ImportFailed, usecase.ImportFailed,
+			usecase.ImportDuplicate, usecase.ImportDuplicate,
+		}, statuses(report))
+		assert.Equal(t, usecase.ErrISBNExists, report.Results[3].Err)
+		assert.Equal(t, 2, listed(repo))
+	})
+
+	t.Run("best effort after a row aborted the unit of work", func(t *testing.T) {
+		repo := memory.NewRepo()
+		rows := importRows()
+		rows[1].Book.Title = "import abort"
+		rows[2].Err = nil
+		report, err := usecase.ImportBooks(ctx, abortingRepo{repo, new(bool)}, rows, usecase.ImportOptions{BestEffort: true})
+		assert.NoError(t, err)
+		assert.Equal(t, []usecase.ImportStatus{
+			usecase.ImportCreated, usecase.ImportFailed, usecase.ImportCreated,
+			usecase.ImportCreated, usecase.ImportDuplicate,
+		}, statuses(report))
+		assert.Equal(t, errValueTooLong, report.Results[1].Err)
+		assert.Equal(t, 3, listed(repo))
+	})
+}
+
+var (
+	errValueTooLong = errors.New("value too long")
+	errAborted      = errors.New("current transaction is aborted")
+)
+
+// abortingRepo fails to add a book titled "import abort" the way postgres
+// fails a statement, every later statement of the unit of work fails too
+type abortingRepo struct {
+	usecase.LibraryRepo
+	aborted *bool
+}
+
+func (r abortingRepo) Atomic(ctx context.Context, fn func(usecase.LibraryRepo) error) error {
+	return r.LibraryRepo.Atomic(ctx, func(tx usecase.LibraryRepo) error {
+		aborted := false
+		if err := fn(abortingRepo{tx, &aborted}); err != nil {
+			return err
+		}
+		if aborted {
+			return errAborted
+		}
+		return nil
+	})
+}
+
+func (r abortingRepo) AddBook(ctx context.Context, b book.Book) error {
+	if *r.aborted {
+		return errAborted
+	}
+	if b.Title == "import abort" {
+		*r.aborted = true
+		return errValueTooLong
+	}
+	return r.LibraryRepo.AddBook(ctx, b)
+}
@@ -0,0 +1,304 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/entity/hold"
+	"github.com/tempcke/books/entity/loan"
+	"github.com/tempcke/books/entity/patron"
+)
+
+// Loan Errors
+var (
+	ErrBookIsCheckedOut    = errors.New("Every copy of the book is checked out")
+	ErrBookIsNotCheckedOut = errors.New("Book is not checked out")
+)
+
+// LoanReader is used to fetch information about loans
+type LoanReader interface {
+	// BookLoans lists every loan of a book, most recent first
+	BookLoans(ctx context.Context, bookID string) ([]loan.Loan, error)
+	// OverdueLoans lists the open loans due before the date of asOf,
+	// oldest due date first
+	OverdueLoans(ctx context.Context, asOf time.Time) ([]loan.Loan, error)
+}
+
+// LoanWriter is used to record loans
+type LoanWriter interface {
+	AddLoan(ctx context.Context, l loan.Loan) error
+	UpdateLoan(ctx context.Context, l loan.Loan) error
+}
+
+// LoanReaderWriter is used to manage loans
+type LoanReaderWriter interface {
+	LoanReader
+	LoanWriter
+}
+
+// EventPublisher is used to announce domain events, such as loan.OverdueEvent
+type EventPublisher interface {
+	Publish(event interface{}) error
+}
+
+// OverdueLoan is an overdue loan along with who has the book
+type OverdueLoan struct {
+	Loan     loan.Loan
+	Patron   patron.Patron
+	DaysLate int
+}
+
+// LibraryRepo is all the storage used by the library
+type LibraryRepo interface {
+	BookReaderWriter
+	BookExporter
+	TrashReaderWriter
+	PatronReaderWriter
+	CopyReaderWriter
+	LoanReaderWriter
+	HoldReaderWriter
+	UnitOfWork
+}
+
+// CheckOut lends a copy of a book to a patron from now until the due date
+// the copy held for the patron is lent when they have a hold ready for pickup,
+// otherwise any available copy, copies on hold are kept for their patrons
+func CheckOut(ctx context.Context, r LibraryRepo, bookID, patronID string, now, dueDate time.Time, actor string) (loan.Loan, error) {
+	l := loan.NewLoan(bookID, patronID, now, dueDate)
+	if err := l.Validate(); err != nil {
+		return l, err
+	}
+
+	err := r.Atomic(ctx, func(r LibraryRepo) (err error) {
+		l, err = checkOut(ctx, r, l, actor)
+		return err
+	})
+	return l, err
+}
+
+// checkOut is CheckOut within a unit of work
+func checkOut(ctx context.Context, r LibraryRepo, l loan.Loan, actor string) (loan.Loan, error) {
+	bookID, patronID := l.BookID, l.PatronID
+	if _, err := r.GetBookByID(ctx, bookID); err != nil {
+		return l, err
+	}
+
+	if _, err := r.GetPatronByID(ctx, patronID); err != nil {
+		return l, err
+	}
+
+	h, held, err := patronHold(ctx, r, bookID, patronID)
+	if err != nil {
+		return l, err
+	}
+
+	var c book.Copy
+	if held {
+		c, err = r.GetCopyByID(ctx, h.CopyID)
+	} else {
+		c, err = availableCopy(ctx, r, bookID)
+	}
+	if err != nil {
+		return l, err
+	}
+
+	l.CopyID = c.ID
+	if err := r.AddLoan(ctx, l); err != nil {
+		return l, err
+	}
+
+	if held {
+		h.Status = hold.StatusFulfilled
+		h.ClosedAt = l.CheckedOutAt
+		if err := r.UpdateHold(ctx, h); err != nil {
+			return l, err
+		}
+	}
+
+	c.Status = book.StatusCheckedOut
+	if err := r.UpdateCopy(ctx, c); err != nil {
+		return l, err
+	}
+	return l, refreshBookStatus(ctx, r, bookID, actor)
+}
+
+// CheckIn returns a checked out copy of a book, closing its open loan
+// the copy may be left empty when only one copy of the book is checked out
+// when patrons are waiting the copy is held for the first one in the queue
+// until the pickup window ends, otherwise it is checked in
+// now is when the copy is returned, the pickup window starts from it
+func CheckIn(ctx context.Context, r LibraryRepo, bookID, copyID string, now time.Time, pickupWindow time.Duration, actor string) (loan.Loan, error) {
+	var l loan.Loan
+	err := r.Atomic(ctx, func(r LibraryRepo) (err error) {
+		l, err = checkIn(ctx, r, bookID, copyID, now, pickupWindow, actor)
+		return err
+	})
+	return l, err
+}
+
+// checkIn is CheckIn within a unit of work
+func checkIn(ctx context.Context, r LibraryRepo, bookID, copyID string, now time.Time, pickupWindow time.Duration, actor string) (loan.Loan, error) {
+	var l loan.Loan
+
+	if _, err := r.GetBookByID(ctx, bookID); err != nil {
+		return l, err
+	}
+
+	c, err := checkedOutCopy(ctx, r, bookID, copyID)
+	if err != nil {
+		return l, err
+	}
+
+	loans, err := r.BookLoans(ctx, bookID)
+	if err != nil {
+		return l, err
+	}
+
+	// books checked out before loans were recorded have no open loan
+	for _, open := range loans {
+		if !open.IsReturned() && open.CopyID == c.ID {
+			l = open
+			l.ReturnedAt = now
+			if err := r.UpdateLoan(ctx, l); err != nil {
+				return l, err
+			}
+			break
+		}
+	}
+
+	_, err = holdForNext(ctx, r, c, now, pickupWindow, actor)
+	return l, err
+}
+
+// availableCopy finds a copy of a book which can be checked out
+func availableCopy(ctx context.Context, r CopyReader, bookID string) (book.Copy, error) {
+	copies, err := r.BookCopies(ctx, bookID)
+	if err != nil {
+		return book.Copy{}, err
+	}
+	for _, c := range copies {
+		if c.IsAvailable() {
+			return c, nil
+		}
+	}
+	if book.StatusOf(copies) == book.StatusOnHold {
+		return book.Copy{}, ErrBookIsOnHold
+	}
+	return book.Copy{}, ErrBookIsCheckedOut
+}
+
+// checkedOutCopy finds the copy to check in, when no copy is given it is
+// the only checked out copy of the book
+func checkedOutCopy(ctx context.Context, r CopyReader, bookID, copyID string) (book.Copy, error) {
+	if copyID != "" {
+		c, err := GetCopy(ctx, r, bookID, copyID)
+		if err == nil && c.Status != book.StatusCheckedOut {
+			err = ErrBookIsNotCheckedOut
+		}
+		return c, err
+	}
+
+	copies, err := r.BookCopies(ctx, bookID)
+	if err != nil {
+		return book.Copy{}, err
+	}
+	var out []book.Copy
+	for _, c := range copies {
+		if c.Status == book.StatusCheckedOut {
+			out = append(out, c)
+		}
+	}
+	switch len(out) {
+	case 0:
+		return book.Copy{}, ErrBookIsNotCheckedOut
+	case 1:
+		return out[0], nil
+	}
+	return book.Copy{}, ErrCopyIsRequired
+}
+
+// OverdueLoans lists the loans which are overdue as of now, most late first
+func OverdueLoans(ctx context.Context, r LibraryRepo, now time.Time) ([]OverdueLoan, error) {
+	loans, err := r.OverdueLoans(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	overdue := make([]OverdueLoan, len(loans))
+	for i, l := range loans {
+		p, err := r.GetPatronByID(ctx, l.PatronID)
+		if err != nil {
+			return nil, err
+		}
+		overdue[i] = OverdueLoan{
+			Loan:     l,
+			Patron:   p,
+			DaysLate: l.DaysLate(now),
+		}
+	}
+	return overdue, nil
+}
+
+// MarkOverdueLoans flags the loans which became overdue since the last time
+// it ran and publishes a loan.OverdueEvent for each of them
+func MarkOverdueLoans(ctx context.Context, r LibraryRepo, events EventPublisher, now time.Time) ([]loan.Loan, error) {
+	loans, err := r.OverdueLoans(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	marked := make([]loan.Loan, 0)
+	for _, l := range loans {
+		if !l.OverdueAt.IsZero() {
+			continue
+		}
+
+		var ok bool
+		err := r.Atomic(ctx, func(r LibraryRepo) (err error) {
+			l, ok, err = markOverdue(ctx, r, l, now)
+			return err
+		})
+		if err != nil {
+			return marked, err
+		}
+		if !ok {
+			continue
+		}
+		marked = append(marked, l)
+
+		err = events.Publish(loan.OverdueEvent{
+			Loan:       l,
+			DaysLate:   l.DaysLate(now),
+			OccurredAt: now,
+		})
+		if err != nil {
+			return marked, err
+		}
+	}
+	return marked, nil
+}
+
+// markOverdue marks a loan overdue unless it was returned or marked since
+// it was listed, ok tells if it was marked
+func markOverdue(ctx context.Context, r LibraryRepo, l loan.Loan, now time.Time) (loan.Loan, bool, error) {
+	if _, err := r.GetBookByID(ctx, l.BookID); err != nil {
+		return l, false, err
+	}
+	loans, err := r.BookLoans(ctx, l.BookID)
+	if err != nil {
+		return l, false, err
+	}
+	for _, current := range loans {
+		if current.ID != l.ID {
+			continue
+		}
+		if current.IsReturned() || !current.OverdueAt.IsZero() {
+			return current, false, nil
+		}
+		current.OverdueAt = now
+		return current, true, r.UpdateLoan(ctx, current)
+	}
+	return l, false, nil
+}
@@ -0,0 +1,204 @@
+package usecase_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/entity/hold"
+	"github.com/tempcke/books/entity/loan"
+	"github.com/tempcke/books/entity/patron"
+	"github.com/tempcke/books/repository/memory"
+	"github.com/tempcke/books/usecase"
+)
+
+func TestCheckOut(t *testing.T) {
+	repo := memory.NewRepo()
+	b := makeBook("check out")
+	p := patron.NewPatron("Jane Doe", "jane@example.com")
+	due := time.Now().AddDate(0, 0, 14)
+
+	t.Run("expect error when book does not exist", func(t *testing.T) {
+		_, err := usecase.CheckOut(ctx, repo, b.ID, p.ID, time.Now(), due, actor)
+		assert.Error(t, err)
+	})
+
+	repo.AddBook(ctx, b)
+
+	t.Run("expect error when patron does not exist", func(t *testing.T) {
+		_, err := usecase.CheckOut(ctx, repo, b.ID, p.ID, time.Now(), due, actor)
+		assert.Error(t, err)
+	})
+
+	repo.AddPatron(ctx, p)
+
+	t.Run("expect error when due date is in the past", func(t *testing.T) {
+		_, err := usecase.CheckOut(ctx, repo, b.ID, p.ID, time.Now(), time.Now().AddDate(0, 0, -1), actor)
+		assert.ErrorIs(t, err, loan.ErrDueDateInvalid)
+		assertStatus(t, repo, b.ID, book.StatusCheckedIn)
+	})
+
+	t.Run("should record a loan", func(t *testing.T) {
+		l, err := usecase.CheckOut(ctx, repo, b.ID, p.ID, time.Now(), due, actor)
+		assert.NoError(t, err)
+		assert.Equal(t, b.ID, l.BookID)
+		assert.Equal(t, p.ID, l.PatronID)
+		assert.Equal(t, due, l.DueDate)
+		assert.False(t, l.IsReturned())
+		assertStatus(t, repo, b.ID, book.StatusCheckedOut)
+
+		loans, _ := repo.BookLoans(ctx, b.ID)
+		assert.Equal(t, []loan.Loan{l}, loans)
+	})
+
+	t.Run("expect error when already checked out", func(t *testing.T) {
+		_, err := usecase.CheckOut(ctx, repo, b.ID, p.ID, time.Now(), due, actor)
+		assert.Equal(t, usecase.ErrBookIsCheckedOut, err)
+		loans, _ := repo.BookLoans(ctx, b.ID)
+		assert.Len(t, loans, 1)
+	})
+}
+
+func TestCheckIn(t *testing.T) {
+	repo := memory.NewRepo()
+	b := makeBook("check in")
+	p := patron.NewPatron("Jane Doe", "jane@example.com")
+	repo.AddPatron(ctx, p)
+
+	t.Run("expect error when book does not exist", func(t *testing.T) {
+		_, err := usecase.CheckIn(ctx, repo, b.ID, "", time.Now(), hold.DefaultPickupWindow, actor)
+		assert.Error(t, err)
+	})
+
+	repo.AddBook(ctx, b)
+
+	t.Run("expect error when not checked out", func(t *testing.T) {
+		_, err := usecase.CheckIn(ctx, repo, b.ID, "", time.Now(), hold.DefaultPickupWindow, actor)
+		assert.Equal(t, usecase.ErrBookIsNotCheckedOut, err)
+	})
+
+	t.Run("should close the open loan", func(t *testing.T) {
+		checkedOutAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+		returnedAt := checkedOutAt.AddDate(0, 0, 5)
+		out, err := usecase.CheckOut(ctx, repo, b.ID, p.ID, checkedOutAt, checkedOutAt.AddDate(0, 0, 7), actor)
+		assert.NoError(t, err)
+		assert.Equal(t, checkedOutAt, out.CheckedOutAt)
+
+		in, err := usecase.CheckIn(ctx, repo, b.ID, "", returnedAt, hold.DefaultPickupWindow, actor)
+		assert.NoError(t, err)
+		assert.Equal(t, out.ID, in.ID)
+		assert.True(t, in.IsReturned())
+		assert.Equal(t, returnedAt, in.ReturnedAt)
+		assertStatus(t, repo, b.ID, book.StatusCheckedIn)
+
+		loans, _ := repo.BookLoans(ctx, b.ID)
+		if assert.Len(t, loans, 1) {
+			assert.True(t, loans[0].IsReturned())
+		}
+	})
+
+	t.Run("book can be checked out again", func(t *testing.T) {
+		_, err := usecase.CheckOut(ctx, repo, b.ID, p.ID, time.Now(), time.Now().AddDate(0, 0, 7), actor)
+		assert.NoError(t, err)
+		loans, _ := repo.BookLoans(ctx, b.ID)
+		assert.Len(t, loans, 2)
+	})
+}
+
+func assertStatus(t *testing.T, repo usecase.BookReader, bookID string, status book.Status) {
+	t.Helper()
+	b, err := repo.GetBookByID(ctx, bookID)
+	assert.NoError(t, err)
+	assert.Equal(t, status, b.Status)
+}
+
+func TestOverdueLoans(t *testing.T) {
+	repo := memory.NewRepo()
+	p := patron.NewPatron("Jane Doe", "jane@example.com")
+	repo.AddPatron(ctx, p)
+
+	b1, b2, b3 := makeBook("due first"), makeBook("due later"), makeBook("returned")
+	repo.AddBook(ctx, b1)
+	repo.AddBook(ctx, b2)
+	repo.AddBook(ctx, b3)
+
+	now := time.Now()
+	l1, _ := usecase.CheckOut(ctx, repo, b1.ID, p.ID, now, now.AddDate(0, 0, 7), actor)
+	l2, _ := usecase.CheckOut(ctx, repo, b2.ID, p.ID, now, now.AddDate(0, 0, 14), actor)
+	usecase.CheckOut(ctx, repo, b3.ID, p.ID, now, now.AddDate(0, 0, 7), actor)
+	usecase.CheckIn(ctx, repo, b3.ID, "", now, hold.DefaultPickupWindow, actor)
+
+	t.Run("nothing is overdue on the due date", func(t *testing.T) {
+		overdue, err := usecase.OverdueLoans(ctx, repo, now.AddDate(0, 0, 7))
+		assert.NoError(t, err)
+		assert.Len(t, overdue, 0)
+	})
+
+	t.Run("open loans past due, most late first", func(t *testing.T) {
+		overdue, err := usecase.OverdueLoans(ctx, repo, now.AddDate(0, 0, 20))
+		assert.NoError(t, err)
+		if assert.Len(t, overdue, 2) {
+			assert.Equal(t, l1.ID, overdue[0].Loan.ID)
+			assert.Equal(t, p, overdue[0].Patron)
+			assert.Equal(t, 13, overdue[0].DaysLate)
+			assert.Equal(t, l2.ID, overdue[1].Loan.ID)
+			assert.Equal(t, 6, overdue[1].DaysLate)
+		}
+	})
+}
+
+func TestMarkOverdueLoans(t *testing.T) {
+	repo := memory.NewRepo()
+	events := new(eventRecorder)
+	p := patron.NewPatron("Jane Doe", "jane@example.com")
+	b := makeBook("overdue")
+	repo.AddPatron(ctx, p)
+	repo.AddBook(ctx, b)
+
+	now := time.Now()
+	l, _ := usecase.CheckOut(ctx, repo, b.ID, p.ID, now, now.AddDate(0, 0, 14), actor)
+
+	t.Run("loans not yet due are not marked", func(t *testing.T) {
+		marked, err := usecase.MarkOverdueLoans(ctx, repo, events, now)
+		assert.NoError(t, err)
+		assert.Len(t, marked, 0)
+		assert.Len(t, events.events, 0)
+	})
+
+	later := now.AddDate(0, 0, 16)
+	t.Run("overdue loans are marked and announced", func(t *testing.T) {
+		marked, err := usecase.MarkOverdueLoans(ctx, repo, events, later)
+		assert.NoError(t, err)
+		if assert.Len(t, marked, 1) {
+			assert.Equal(t, l.ID, marked[0].ID)
+			assert.Equal(t, later, marked[0].OverdueAt)
+		}
+		loans, _ := repo.BookLoans(ctx, b.ID)
+		assert.Equal(t, later, loans[0].OverdueAt)
+
+		if assert.Len(t, events.events, 1) {
+			e := events.events[0].(loan.OverdueEvent)
+			assert.Equal(t, l.ID, e.Loan.ID)
+			assert.Equal(t, 2, e.DaysLate)
+			assert.Equal(t, later, e.OccurredAt)
+		}
+	})
+
+	t.Run("loans are only marked once", func(t *testing.T) {
+		marked, err := usecase.MarkOverdueLoans(ctx, repo, events, later.AddDate(0, 0, 1))
+		assert.NoError(t, err)
+		assert.Len(t, marked, 0)
+		assert.Len(t, events.events, 1)
+	})
+}
+
+// eventRecorder is an EventPublisher which keeps every event published
+type eventRecorder struct {
+	events []interface{}
+}
+
+func (r *eventRecorder) Publish(event interface{}) error {
+	r.events = append(r.events, event)
+	return nil
+}
@@ -0,0 +1,36 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/tempcke/books/entity/patron"
+)
+
+// PatronReader is used to fetch information about patrons
+type PatronReader interface {
+	GetPatronByID(ctx context.Context, id string) (patron.Patron, error)
+}
+
+// PatronWriter is used to add patrons
+type PatronWriter interface {
+	AddPatron(ctx context.Context, p patron.Patron) error
+}
+
+// PatronReaderWriter is used to manage patron accounts
+type PatronReaderWriter interface {
+	PatronReader
+	PatronWriter
+}
+
+// AddPatron is used to store a patron
+func AddPatron(ctx context.Context, r PatronWriter, p patron.Patron) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	return r.AddPatron(ctx, p)
+}
+
+// GetPatron gets a patron by id
+func GetPatron(ctx context.Context, r PatronReader, id string) (patron.Patron, error) {
+	return r.GetPatronByID(ctx, id)
+}
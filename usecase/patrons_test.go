@@ -0,0 +1,24 @@
+package usecase_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/entity/patron"
+	"github.com/tempcke/books/repository/memory"
+	"github.com/tempcke/books/usecase"
+)
+
+func TestAddPatron(t *testing.T) {
+	repo := memory.NewRepo()
+	goodPatron := patron.NewPatron("Jane Doe", "jane@example.com")
+	badPatron := patron.NewPatron("Jane Doe", "") // empty email will not validate
+	assert.NoError(t, usecase.AddPatron(ctx, repo, goodPatron))
+	assert.Error(t, usecase.AddPatron(ctx, repo, badPatron))
+
+	_, err := usecase.GetPatron(ctx, repo, badPatron.ID)
+	assert.Error(t, err)
+	p, err := usecase.GetPatron(ctx, repo, goodPatron.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, goodPatron, p)
+}
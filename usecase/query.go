@@ -0,0 +1,212 @@
+package usecase
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/tempcke/books/entity/book"
+)
+
+const dateFormat = "2006-01-02"
+
+// Query Errors
+var (
+	ErrSortFieldInvalid = errors.New("Sort field is not supported")
+	ErrCursorInvalid    = errors.New("Cursor is not valid")
+	ErrLimitInvalid     = errors.New("Limit must not be negative")
+)
+
+// BookFilter narrows down a book list, zero values are not filtered on
+type BookFilter struct {
+	Author        string
+	Status        book.Status
+	Rating        book.Rating
+	PubDateFrom   time.Time
+	PubDateTo     time.Time
+	TitleContains string
+}
+
+// Match tells if a book passes every filter, useful for in memory storage
+func (f BookFilter) Match(b book.Book) bool {
+	if f.Author != "" && !strings.EqualFold(f.Author, b.Author) {
+		return false
+	}
+	if f.Status != "" && f.Status != b.Status {
+		return false
+	}
+	if f.Rating != 0 && f.Rating != b.Rating {
+		return false
+	}
+	// pubdate is a date, so the time of day should not matter
+	if !f.PubDateFrom.IsZero() && b.PubDate.Format(dateFormat) < f.PubDateFrom.Format(dateFormat) {
+		return false
+	}
+	if !f.PubDateTo.IsZero() && b.PubDate.Format(dateFormat) > f.PubDateTo.Format(dateFormat) {
+		return false
+	}
+	if f.TitleContains != "" &&
+		!strings.Contains(strings.ToLower(b.Title), strings.ToLower(f.TitleContains)) {
+		return false
+	}
+	return true
+}
+
+// SortField is a book attribute a list can be ordered by
+type SortField string
+
+// SortField values
+const (
+	SortByTitle     = SortField("title")
+	SortByAuthor    = SortField("author")
+	SortByPublisher = SortField("publisher")
+	SortByPubDate   = SortField("pubdate")
+	SortByRating    = SortField("rating")
+	SortByStatus    = SortField("status")
+)
+
+// Sort orders a book list by a single field
+type Sort struct {
+	Field SortField
+	Desc  bool
+}
+
+// BookQuery describes which books, in which order, a book list should contain
+// Limit of zero means no limit, After is the Next token of a previous page
+type BookQuery struct {
+	Filter BookFilter
+	Sort   []Sort
+	Limit  int
+	After  string
+}
+
+// Validate the BookQuery object
+func (q BookQuery) Validate() error {
+	if q.Limit < 0 {
+		return ErrLimitInvalid
+	}
+	for _, s := range q.Sort {
+		if err := s.Field.validate(); err != nil {
+			return err
+		}
+	}
+	if q.After != "" {
+		if _, err := ParseCursor(q.After); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OrderBy returns the sort order to apply, defaults to title
+// the book id must always be used as the final tie breaker so that the
+// order is total and a cursor can resume exactly where a page ended
+func (q BookQuery) OrderBy() []Sort {
+	order := q.Sort
+	if len(order) == 0 {
+		order = []Sort{{Field: SortByTitle}}
+	}
+	return order
+}
+
+// Less reports whether book a comes before book b in the query order
+func (q BookQuery) Less(a, b book.Book) bool {
+	for _, s := range q.OrderBy() {
+		c := s.Field.compare(a, b)
+		if c == 0 {
+			continue
+		}
+		if s.Desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	return a.ID < b.ID
+}
+
+func (f SortField) validate() error {
+	switch f {
+	case SortByTitle, SortByAuthor, SortByPublisher,
+		SortByPubDate, SortByRating, SortByStatus:
+		return nil
+	}
+	return ErrSortFieldInvalid
+}
+
+func (f SortField) compare(a, b book.Book) int {
+	switch f {
+	case SortByTitle:
+		return strings.Compare(a.Title, b.Title)
+	case SortByAuthor:
+		return strings.Compare(a.Author, b.Author)
+	case SortByPublisher:
+		return strings.Compare(a.Publisher, b.Publisher)
+	case SortByPubDate:
+		switch {
+		case a.PubDate.Before(b.PubDate):
+			return -1
+		case a.PubDate.After(b.PubDate):
+			return 1
+		}
+	case SortByRating:
+		return a.Rating.Int() - b.Rating.Int()
+	case SortByStatus:
+		return strings.Compare(a.Status.String(), b.Status.String())
+	}
+	return 0
+}
+
+// BookPage is one page of a book list, Next is empty on the last page
+type BookPage struct {
+	Books []book.Book
+	Next  string
+}
+
+// cursor holds the sortable values of the last book on a page
+type cursor struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"t,omitempty"`
+	Author    string    `json:"a,omitempty"`
+	Publisher string    `json:"p,omitempty"`
+	PubDate   time.Time `json:"d"`
+	Rating    int       `json:"r,omitempty"`
+	Status    string    `json:"s,omitempty"`
+}
+
+// NewCursor returns an opaque token pointing just after book b
+func NewCursor(b book.Book) string {
+	raw, _ := json.Marshal(cursor{
+		ID:        b.ID,
+		Title:     b.Title,
+		Author:    b.Author,
+		Publisher: b.Publisher,
+		PubDate:   b.PubDate,
+		Rating:    b.Rating.Int(),
+		Status:    b.Status.String(),
+	})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// ParseCursor decodes a token made by NewCursor, the returned book only
+// has the fields a list can be sorted by
+func ParseCursor(token string) (book.Book, error) {
+	var c cursor
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return book.Book{}, ErrCursorInvalid
+	}
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID == "" {
+		return book.Book{}, ErrCursorInvalid
+	}
+	return book.Book{
+		ID:        c.ID,
+		Title:     c.Title,
+		Author:    c.Author,
+		Publisher: c.Publisher,
+		PubDate:   c.PubDate,
+		Rating:    book.Rating(c.Rating),
+		Status:    book.Status(c.Status),
+	}, nil
+}
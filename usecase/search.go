@@ -0,0 +1,61 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strings"
+
+	"github.com/tempcke/books/entity/book"
+)
+
+// Search Errors
+var (
+	ErrSearchQueryRequired = errors.New("Search query is required")
+)
+
+// SearchResult is a book matching a search along with its relevance
+// Highlights maps a field name to an html escaped snippet with the matches
+// wrapped in <b></b>
+type SearchResult struct {
+	Book       book.Book
+	Score      float64
+	Highlights map[string]string
+}
+
+// Highlight markers wrapped around matching terms in SearchResult.Highlights
+const (
+	HighlightStart = "<b>"
+	HighlightStop  = "</b>"
+)
+
+// Match markers the repositories wrap around matching terms, characters of
+// the unicode private use area so they can not be confused with book text
+const (
+	MatchStart = "\uE000"
+	MatchStop  = "\uE001"
+)
+
+// Highlight is a snippet with its matches wrapped in MatchStart and MatchStop
+// as html, the text is escaped and the matches wrapped in HighlightStart and
+// HighlightStop, ok is false when the snippet has no match
+func Highlight(snippet string) (highlight string, ok bool) {
+	if !strings.Contains(snippet, MatchStart) {
+		return "", false
+	}
+	return strings.NewReplacer(
+		MatchStart, HighlightStart,
+		MatchStop, HighlightStop,
+	).Replace(html.EscapeString(snippet)), true
+}
+
+// SearchBooks finds the books most relevant to a free text query
+func SearchBooks(ctx context.Context, r BookReader, query string, limit int) ([]SearchResult, error) {
+	if query == "" {
+		return nil, ErrSearchQueryRequired
+	}
+	if limit < 0 {
+		return nil, ErrLimitInvalid
+	}
+	return r.SearchBooks(ctx, query, limit)
+}
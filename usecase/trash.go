@@ -0,0 +1,57 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/tempcke/books/entity/book"
+)
+
+// DefaultTrashRetention is how long removed books are kept in the trash
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// TrashReader is used to fetch the removed books
+type TrashReader interface {
+	// TrashedBooks lists the books in the trash, most recently removed first
+	TrashedBooks(ctx context.Context) ([]book.Book, error)
+}
+
+// TrashWriter is used to restore or permanently delete removed books
+// RestoreBook fails with ErrISBNExists when the ISBN of the book was given to
+// another book while it was in the trash
+// PurgeBooks deletes the books removed before the given time along with
+// their history, copies, loans and holds, it returns how many it deleted
+type TrashWriter interface {
+	RestoreBook(ctx context.Context, id string) error
+	PurgeBooks(ctx context.Context, removedBefore time.Time) (int, error)
+}
+
+// TrashReaderWriter is used for the books in the trash
+type TrashReaderWriter interface {
+	TrashReader
+	TrashWriter
+}
+
+// TrashedBooks lists the books in the trash, most recently removed first
+func TrashedBooks(ctx context.Context, r TrashReader) ([]book.Book, error) {
+	return r.TrashedBooks(ctx)
+}
+
+// RestoreBook takes a book out of the trash, error if it is not in the trash
+func RestoreBook(ctx context.Context, r LibraryRepo, id string) (book.Book, error) {
+	var b book.Book
+	err := r.Atomic(ctx, func(r LibraryRepo) (err error) {
+		if err := r.RestoreBook(ctx, id); err != nil {
+			return err
+		}
+		b, err = r.GetBookByID(ctx, id)
+		return err
+	})
+	return b, err
+}
+
+// PurgeTrash permanently deletes the books which were in the trash for longer
+// than the retention period as of now, it returns how many it deleted
+func PurgeTrash(ctx context.Context, r TrashWriter, now time.Time, retention time.Duration) (int, error) {
+	return r.PurgeBooks(ctx, now.Add(-retention))
+}
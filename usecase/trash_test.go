@@ -0,0 +1,61 @@
+package usecase_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/repository/memory"
+	"github.com/tempcke/books/usecase"
+)
+
+func TestRestoreBook(t *testing.T) {
+	repo := memory.NewRepo()
+	b := makeBook("restore book")
+	repo.AddBook(ctx, b)
+
+	t.Run("expect error if book is not in the trash", func(t *testing.T) {
+		_, err := usecase.RestoreBook(ctx, repo, b.ID)
+		assert.Error(t, err)
+	})
+
+	t.Run("restore a removed book", func(t *testing.T) {
+		assert.NoError(t, usecase.RemoveBook(ctx, repo, b.ID, 0))
+		trash, err := usecase.TrashedBooks(ctx, repo)
+		assert.NoError(t, err)
+		assert.Len(t, trash, 1)
+
+		restored, err := usecase.RestoreBook(ctx, repo, b.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, b.ID, restored.ID)
+		assert.False(t, restored.IsDeleted())
+
+		trash, err = usecase.TrashedBooks(ctx, repo)
+		assert.NoError(t, err)
+		assert.Len(t, trash, 0)
+	})
+}
+
+func TestPurgeTrash(t *testing.T) {
+	repo := memory.NewRepo()
+	b := makeBook("purge book")
+	repo.AddBook(ctx, b)
+	usecase.RemoveBook(ctx, repo, b.ID, 0)
+	now := time.Now()
+
+	t.Run("books within the retention period are kept", func(t *testing.T) {
+		n, err := usecase.PurgeTrash(ctx, repo, now, usecase.DefaultTrashRetention)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, n)
+	})
+
+	t.Run("books past the retention period are purged", func(t *testing.T) {
+		later := now.Add(usecase.DefaultTrashRetention + time.Minute)
+		n, err := usecase.PurgeTrash(ctx, repo, later, usecase.DefaultTrashRetention)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		_, err = usecase.RestoreBook(ctx, repo, b.ID)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,12 @@
+package usecase
+
+import "context"
+
+// UnitOfWork runs a set of reads and writes atomically, fn is given a repo
+// bound to the unit of work and everything it changed is rolled back when fn
+// returns an error.  Reading a book within a unit of work locks the book until
+// the unit of work ends, so usecases start by reading the book they change.
+// A unit of work started within another one joins it.
+type UnitOfWork interface {
+	Atomic(ctx context.Context, fn func(r LibraryRepo) error) error
+}
@@ -0,0 +1,99 @@
+package usecase_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempcke/books/entity/book"
+	"github.com/tempcke/books/entity/patron"
+	"github.com/tempcke/books/repository/memory"
+	"github.com/tempcke/books/usecase"
+)
+
+func TestUnitOfWork(t *testing.T) {
+	repo := memory.NewRepo()
+	errFailed := errors.New("failed")
+
+	t.Run("changes are rolled back when it fails", func(t *testing.T) {
+		a, b := makeBook("kept"), makeBook("rolled back")
+		repo.AddBook(ctx, a)
+
+		err := repo.Atomic(ctx, func(r usecase.LibraryRepo) error {
+			if err := r.AddBook(ctx, b); err != nil {
+				return err
+			}
+			if _, err := usecase.ChangeBookRating(ctx, r, a.ID, 0, book.RateThree, actor); err != nil {
+				return err
+			}
+			return errFailed
+		})
+		assert.Equal(t, errFailed, err)
+
+		_, err = repo.GetBookByID(ctx, b.ID)
+		assert.Error(t, err)
+		stored, _ := repo.GetBookByID(ctx, a.ID)
+		assert.Equal(t, a.Rating, stored.Rating)
+		history, _ := repo.BookHistory(ctx, a.ID)
+		assert.Len(t, history, 2)
+	})
+
+	t.Run("nested units of work join the first one", func(t *testing.T) {
+		b := makeBook("nested")
+		err := repo.Atomic(ctx, func(r usecase.LibraryRepo) error {
+			err := r.Atomic(ctx, func(r usecase.LibraryRepo) error {
+				return r.AddBook(ctx, b)
+			})
+			assert.NoError(t, err)
+			return errFailed
+		})
+		assert.Equal(t, errFailed, err)
+		_, err = repo.GetBookByID(ctx, b.ID)
+		assert.Error(t, err)
+	})
+}
+
+func TestConcurrentCheckOut(t *testing.T) {
+	repo := memory.NewRepo()
+	b := makeBook("one copy")
+	repo.AddBook(ctx, b)
+	due := time.Now().AddDate(0, 0, 14)
+
+	patrons := make([]patron.Patron, 10)
+	for i := range patrons {
+		patrons[i] = patron.NewPatron("Patron", "patron@example.com")
+		repo.AddPatron(ctx, patrons[i])
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		lent     int
+		failures []error
+	)
+	for _, p := range patrons {
+		p := p
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := usecase.CheckOut(ctx, repo, b.ID, p.ID, time.Now(), due, actor)
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				lent++
+				return
+			}
+			failures = append(failures, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, lent)
+	for _, err := range failures {
+		assert.Equal(t, usecase.ErrBookIsCheckedOut, err)
+	}
+	loans, _ := repo.BookLoans(ctx, b.ID)
+	assert.Len(t, loans, 1)
+}